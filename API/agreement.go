@@ -0,0 +1,468 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+// Agreement types. Agreements are symmetric between the two airlines; an
+// ALLIANCE agreement records that both are members of the same alliance and
+// implies all of the other agreements.
+const (
+	AgreementInterline           = "INTERLINE"
+	AgreementThroughCheckIn      = "THROUGH_CHECK_IN"
+	AgreementBaggageThroughCheck = "BAGGAGE_THROUGH_CHECK"
+	AgreementAlliance            = "ALLIANCE"
+)
+
+var agreementTypes = map[string]bool{
+	AgreementInterline:           true,
+	AgreementThroughCheckIn:      true,
+	AgreementBaggageThroughCheck: true,
+	AgreementAlliance:            true,
+}
+
+var errAgreementOverlaps = errors.New("The airlines already have an agreement of this type in the same period")
+
+type AirlineAgreement struct {
+	ID               string `json:"id"`
+	AirlineID        string `json:"airlineID"`
+	PartnerAirlineID string `json:"partnerAirlineID"`
+	Type             string `json:"type"`
+	// Alliance names the alliance of an ALLIANCE agreement, e.g. "Star Alliance".
+	Alliance string `json:"alliance,omitempty"`
+	// ValidFrom and ValidTo are inclusive YYYY-MM-DD operating dates; an
+	// empty ValidTo leaves the agreement open-ended.
+	ValidFrom string `json:"validFrom"`
+	ValidTo   string `json:"validTo,omitempty"`
+}
+
+// airlinePair is the key shared by all agreements between two airlines,
+// whichever of them is named first.
+func airlinePair(a, b string) string {
+	ids := []string{a, b}
+	sort.Strings(ids)
+	return ids[0] + "#" + ids[1]
+}
+
+func (agreement *AirlineAgreement) validOn(date string) bool {
+	return date >= agreement.ValidFrom && (agreement.ValidTo == "" || date <= agreement.ValidTo)
+}
+
+// overlaps reports whether two agreements of the same type cover a common date.
+func (agreement *AirlineAgreement) overlaps(other *AirlineAgreement) bool {
+	if agreement.Type != other.Type {
+		return false
+	}
+	endsBefore := func(a, b *AirlineAgreement) bool { return a.ValidTo != "" && a.ValidTo < b.ValidFrom }
+	return !endsBefore(agreement, other) && !endsBefore(other, agreement)
+}
+
+func validateAgreement(agreement *AirlineAgreement, svc *dynamodb.DynamoDB) error {
+	agreement.Type = strings.ToUpper(strings.TrimSpace(agreement.Type))
+	agreement.Alliance = strings.TrimSpace(agreement.Alliance)
+
+	if !agreementTypes[agreement.Type] {
+		return fmt.Errorf("Type must be one of %s, %s, %s or %s", AgreementInterline, AgreementThroughCheckIn, AgreementBaggageThroughCheck, AgreementAlliance)
+	}
+	if agreement.Type == AgreementAlliance && agreement.Alliance == "" {
+		return errors.New("Alliance is required for an ALLIANCE agreement")
+	}
+	if agreement.Type != AgreementAlliance && agreement.Alliance != "" {
+		return errors.New("Alliance is only allowed on an ALLIANCE agreement")
+	}
+	if agreement.AirlineID == "" || agreement.PartnerAirlineID == "" {
+		return errors.New("AirlineID and PartnerAirlineID are required")
+	}
+	if agreement.AirlineID == agreement.PartnerAirlineID {
+		return errors.New("An airline cannot have an agreement with itself")
+	}
+	if _, err := GetAirlineByID(agreement.AirlineID, svc); err != nil {
+		return fmt.Errorf("Airline %s does not exist", agreement.AirlineID)
+	}
+	if _, err := GetAirlineByID(agreement.PartnerAirlineID, svc); err != nil {
+		return fmt.Errorf("Airline %s does not exist", agreement.PartnerAirlineID)
+	}
+
+	if _, err := time.Parse("2006-01-02", agreement.ValidFrom); err != nil {
+		return errors.New("ValidFrom must be formatted as YYYY-MM-DD")
+	}
+	if agreement.ValidTo != "" {
+		if _, err := time.Parse("2006-01-02", agreement.ValidTo); err != nil {
+			return errors.New("ValidTo must be formatted as YYYY-MM-DD")
+		}
+		if agreement.ValidTo < agreement.ValidFrom {
+			return errors.New("ValidTo is before ValidFrom")
+		}
+	}
+	return nil
+}
+
+// checkAgreementOverlap fails if the airlines have another agreement than
+// exceptID of the same type whose validity overlaps.
+func checkAgreementOverlap(agreement *AirlineAgreement, exceptID string, svc *dynamodb.DynamoDB) error {
+	existing, err := getPairAgreements(agreement.AirlineID, agreement.PartnerAirlineID, svc)
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.ID != exceptID && agreement.overlaps(other) {
+			return errAgreementOverlaps
+		}
+	}
+	return nil
+}
+
+func CreateAgreement(agreement AirlineAgreement, svc *dynamodb.DynamoDB) (*AirlineAgreement, error) {
+	if err := validateAgreement(&agreement, svc); err != nil {
+		return nil, err
+	}
+	if !doesTableExist("AirlineAgreements", svc) {
+		if err := createAirlineAgreementsTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkAgreementOverlap(&agreement, "", svc); err != nil {
+		return nil, err
+	}
+
+	agreement.ID = uuid.New().String()
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("AirlineAgreements"),
+		Item:                agreementItem(&agreement),
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created AirlineAgreement: ID=%s, Type=%s, Airlines=%s\n", agreement.ID, agreement.Type, airlinePair(agreement.AirlineID, agreement.PartnerAirlineID))
+	return &agreement, nil
+}
+
+// UpdateAgreement changes the validity dates and alliance name of an
+// agreement. Its airlines and type cannot be changed; create a new agreement
+// instead.
+func UpdateAgreement(agreementID string, agreement AirlineAgreement, svc *dynamodb.DynamoDB) (*AirlineAgreement, error) {
+	existing, err := GetAgreementByID(agreementID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if agreement.AirlineID == "" && agreement.PartnerAirlineID == "" {
+		agreement.AirlineID, agreement.PartnerAirlineID = existing.AirlineID, existing.PartnerAirlineID
+	}
+	if agreement.Type == "" {
+		agreement.Type = existing.Type
+	}
+	if err := validateAgreement(&agreement, svc); err != nil {
+		return nil, err
+	}
+	if airlinePair(agreement.AirlineID, agreement.PartnerAirlineID) != airlinePair(existing.AirlineID, existing.PartnerAirlineID) {
+		return nil, errors.New("The airlines of an agreement cannot be changed")
+	}
+	if agreement.Type != existing.Type {
+		return nil, errors.New("The type of an agreement cannot be changed")
+	}
+	if err := checkAgreementOverlap(&agreement, existing.ID, svc); err != nil {
+		return nil, err
+	}
+
+	agreement.ID = existing.ID
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("AirlineAgreements"),
+		Item:                agreementItem(&agreement),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Updated AirlineAgreement: ID=%s, ValidFrom=%s, ValidTo=%s\n", agreement.ID, agreement.ValidFrom, agreement.ValidTo)
+	return &agreement, nil
+}
+
+func DeleteAgreement(agreementID string, svc *dynamodb.DynamoDB) error {
+	if !doesTableExist("AirlineAgreements", svc) {
+		return errors.New("Agreement not found")
+	}
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("AirlineAgreements"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(agreementID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+		return errors.New("Agreement not found")
+	}
+	return err
+}
+
+func agreementItem(agreement *AirlineAgreement) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(agreement.ID),
+		},
+		"AirlinePair": {
+			S: aws.String(airlinePair(agreement.AirlineID, agreement.PartnerAirlineID)),
+		},
+		"AirlineID": {
+			S: aws.String(agreement.AirlineID),
+		},
+		"PartnerAirlineID": {
+			S: aws.String(agreement.PartnerAirlineID),
+		},
+		"Type": {
+			S: aws.String(agreement.Type),
+		},
+		"ValidFrom": {
+			S: aws.String(agreement.ValidFrom),
+		},
+	}
+	if agreement.Alliance != "" {
+		item["Alliance"] = &dynamodb.AttributeValue{S: aws.String(agreement.Alliance)}
+	}
+	if agreement.ValidTo != "" {
+		item["ValidTo"] = &dynamodb.AttributeValue{S: aws.String(agreement.ValidTo)}
+	}
+	return item
+}
+
+func GetAgreementByID(agreementID string, svc *dynamodb.DynamoDB) (*AirlineAgreement, error) {
+	if !doesTableExist("AirlineAgreements", svc) {
+		return nil, errors.New("Agreement not found")
+	}
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("AirlineAgreements"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(agreementID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errors.New("Agreement not found")
+	}
+
+	agreement := &AirlineAgreement{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, agreement); err != nil {
+		return nil, err
+	}
+	return agreement, nil
+}
+
+// GetAgreements returns every agreement, or only those of airlineID when it
+// is set.
+func GetAgreements(airlineID string, svc *dynamodb.DynamoDB) ([]*AirlineAgreement, error) {
+	agreements := []*AirlineAgreement{}
+	if !doesTableExist("AirlineAgreements", svc) {
+		return agreements, nil
+	}
+	input := &dynamodb.ScanInput{
+		TableName: aws.String("AirlineAgreements"),
+	}
+	if airlineID != "" {
+		input.FilterExpression = aws.String("AirlineID = :airline OR PartnerAirlineID = :airline")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":airline": {
+				S: aws.String(airlineID),
+			},
+		}
+	}
+
+	var unmarshalErr error
+	err := svc.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			agreement := &AirlineAgreement{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, agreement); unmarshalErr != nil {
+				return false
+			}
+			agreements = append(agreements, agreement)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agreements, unmarshalErr
+}
+
+// getPairAgreements returns all agreements between two airlines.
+func getPairAgreements(a, b string, svc *dynamodb.DynamoDB) ([]*AirlineAgreement, error) {
+	if !doesTableExist("AirlineAgreements", svc) {
+		return nil, nil
+	}
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("AirlineAgreements"),
+		IndexName:              aws.String("AirlinePairIndex"),
+		KeyConditionExpression: aws.String("AirlinePair = :pair"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pair": {
+				S: aws.String(airlinePair(a, b)),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agreements := []*AirlineAgreement{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &agreements); err != nil {
+		return nil, err
+	}
+	return agreements, nil
+}
+
+// AgreementTerms are what two airlines allow each other on a connection.
+type AgreementTerms struct {
+	Interline           bool `json:"interline"`
+	ThroughCheckIn      bool `json:"throughCheckIn"`
+	BaggageThroughCheck bool `json:"baggageThroughCheck"`
+}
+
+// carrierAgreements looks up the terms between the airlines of two flights,
+// caching the agreements of each pair for the lifetime of one search or
+// booking.
+type carrierAgreements struct {
+	svc   *dynamodb.DynamoDB
+	pairs map[string][]*AirlineAgreement
+}
+
+func newCarrierAgreements(svc *dynamodb.DynamoDB) *carrierAgreements {
+	return &carrierAgreements{svc: svc, pairs: map[string][]*AirlineAgreement{}}
+}
+
+// between returns the terms that apply when first and second are sold on one
+// ticket: only agreements valid on both operating dates count. Flights of the
+// same airline, and flights stored without an airline, are unrestricted.
+func (c *carrierAgreements) between(first, second *Flight) (AgreementTerms, error) {
+	if first.AirlineID == "" || second.AirlineID == "" || first.AirlineID == second.AirlineID {
+		return AgreementTerms{Interline: true, ThroughCheckIn: true, BaggageThroughCheck: true}, nil
+	}
+
+	pair := airlinePair(first.AirlineID, second.AirlineID)
+	agreements, ok := c.pairs[pair]
+	if !ok {
+		var err error
+		if agreements, err = getPairAgreements(first.AirlineID, second.AirlineID, c.svc); err != nil {
+			return AgreementTerms{}, err
+		}
+		c.pairs[pair] = agreements
+	}
+
+	terms := AgreementTerms{}
+	for _, agreement := range agreements {
+		if !agreement.validOn(first.OperatingDate) || !agreement.validOn(second.OperatingDate) {
+			continue
+		}
+		switch agreement.Type {
+		case AgreementAlliance:
+			terms = AgreementTerms{Interline: true, ThroughCheckIn: true, BaggageThroughCheck: true}
+		case AgreementInterline:
+			terms.Interline = true
+		case AgreementThroughCheckIn:
+			terms.ThroughCheckIn = true
+		case AgreementBaggageThroughCheck:
+			terms.BaggageThroughCheck = true
+		}
+	}
+	return terms, nil
+}
+
+// canTicketWith reports whether flight can be sold on one ticket together with
+// every flight already in legs.
+func (c *carrierAgreements) canTicketWith(legs []*Flight, flight *Flight) (bool, error) {
+	for _, leg := range legs {
+		terms, err := c.between(leg, flight)
+		if err != nil {
+			return false, err
+		}
+		if !terms.Interline {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// validateBookingCarriers checks that every pair of airlines in a booking may
+// ticket together on the dates they operate.
+func validateBookingCarriers(flights []*Flight, svc *dynamodb.DynamoDB) error {
+	carriers := newCarrierAgreements(svc)
+	for i := 1; i < len(flights); i++ {
+		for _, earlier := range flights[:i] {
+			terms, err := carriers.between(earlier, flights[i])
+			if err != nil {
+				return err
+			}
+			if !terms.Interline {
+				return fmt.Errorf("Flights %s and %s cannot be booked together: their airlines have no interline agreement", earlier.FlightNumber, flights[i].FlightNumber)
+			}
+		}
+	}
+	return nil
+}
+
+func createAirlineAgreementsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("AirlineAgreements"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("AirlinePair"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("AirlinePairIndex"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("AirlinePair"),
+						KeyType:       aws.String("HASH"),
+					},
+				},
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String("ALL"),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			},
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("AirlineAgreements table created successfully")
+	return nil
+}
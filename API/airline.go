@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,67 +14,433 @@ import (
 )
 
 type Airline struct {
-	ID   string `json:"id"`
+	ID string `json:"id"`
+	// Code is the 2-character IATA designator, which starts the airline's
+	// flight numbers, e.g. "FB" in "FB123".
 	Code string `json:"code"`
+	// ICAO is the 3-letter ICAO designator, e.g. "BUC".
+	ICAO     string `json:"icao"`
+	Name     string `json:"name"`
+	Callsign string `json:"callsign,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 code of the airline's home country.
+	Country string `json:"country"`
+	// Active is true unless set to false; airlines stored before it existed are active.
+	Active  *bool  `json:"active,omitempty"`
+	LogoURL string `json:"logoURL,omitempty"`
+}
+
+var (
+	errAirlineCodeTaken = errors.New("Airline code is not unique")
+	errAirlineICAOTaken = errors.New("Airline ICAO code is not unique")
+)
+
+const maxAirlineNameLength = 100
+
+var (
+	// An IATA designator is two letters or digits, but not two digits.
+	airlineCodePattern     = regexp.MustCompile("^([A-Z][A-Z0-9]|[0-9][A-Z])$")
+	airlineICAOPattern     = regexp.MustCompile("^[A-Z]{3}$")
+	airlineCallsignPattern = regexp.MustCompile("^[A-Z0-9][A-Z0-9 -]{0,29}$")
+)
+
+func (airline *Airline) isActive() bool {
+	return airline.Active == nil || *airline.Active
 }
 
 func ValidateAirlineCode(code string) error {
-	code = strings.TrimSpace(code)
-	if len(code) >= 6 {
-		return errors.New("Airline code must have a length less than 6 characters")
+	if !airlineCodePattern.MatchString(code) {
+		return errors.New("Airline code must be a 2-character IATA designator of letters and digits, not two digits")
 	}
 	return nil
 }
 
-func CreateAirline(airline Airline, svc *dynamodb.DynamoDB) error {
-	// Validate the airline code.
+func ValidateAirlineICAO(icao string) error {
+	if !airlineICAOPattern.MatchString(icao) {
+		return errors.New("Airline ICAO code must be exactly 3 letters")
+	}
+	return nil
+}
+
+// ValidateAirline checks every field of an airline and normalizes its codes
+// to upper case.
+func ValidateAirline(airline *Airline) error {
+	airline.Code = strings.ToUpper(strings.TrimSpace(airline.Code))
 	if err := ValidateAirlineCode(airline.Code); err != nil {
 		return err
 	}
+	return validateAirlineDetails(airline)
+}
+
+// validateAirlineDetails checks and normalizes every field of an airline but
+// its IATA designator, as airlines stored before designators were checked
+// may keep a longer code.
+func validateAirlineDetails(airline *Airline) error {
+	airline.Code = strings.ToUpper(strings.TrimSpace(airline.Code))
+	airline.ICAO = strings.ToUpper(strings.TrimSpace(airline.ICAO))
+	airline.Callsign = strings.ToUpper(strings.TrimSpace(airline.Callsign))
+	airline.Country = strings.ToUpper(strings.TrimSpace(airline.Country))
+	airline.Name = strings.TrimSpace(airline.Name)
+	airline.LogoURL = strings.TrimSpace(airline.LogoURL)
+
+	if err := ValidateAirlineICAO(airline.ICAO); err != nil {
+		return err
+	}
+	if airline.Name == "" {
+		return errors.New("Airline name is required")
+	}
+	if len(airline.Name) > maxAirlineNameLength {
+		return fmt.Errorf("Airline name must be at most %d characters", maxAirlineNameLength)
+	}
+	if airline.Callsign != "" && !airlineCallsignPattern.MatchString(airline.Callsign) {
+		return errors.New("Callsign must be at most 30 letters, digits, spaces or hyphens")
+	}
+	if !isCountryCode(airline.Country) {
+		return fmt.Errorf("Country %q is not an ISO 3166-1 alpha-2 code", airline.Country)
+	}
+	if airline.LogoURL != "" {
+		logo, err := url.Parse(airline.LogoURL)
+		if err != nil || (logo.Scheme != "http" && logo.Scheme != "https") || logo.Host == "" {
+			return errors.New("LogoURL must be an absolute http or https URL")
+		}
+	}
+	if airline.Active == nil {
+		active := true
+		airline.Active = &active
+	}
+	return nil
+}
+
+// flightNumberPattern is the part of a flight number after the airline
+// designator: a 1-4 digit number with an optional operational suffix letter.
+var flightNumberPattern = regexp.MustCompile("^[0-9]{1,4}[A-Z]?$")
+
+// ValidateFlightNumber checks that a flight number is the airline's
+// designator followed by a 1-4 digit number and an optional suffix, e.g. "FB123A".
+func ValidateFlightNumber(flightNumber, airlineCode string) error {
+	if airlineCode == "" || !strings.HasPrefix(flightNumber, airlineCode) {
+		return fmt.Errorf("FlightNumber %s must start with the airline designator %s", flightNumber, airlineCode)
+	}
+	if !flightNumberPattern.MatchString(strings.TrimPrefix(flightNumber, airlineCode)) {
+		return fmt.Errorf("FlightNumber %s must be %s followed by a 1-4 digit number and an optional suffix letter", flightNumber, airlineCode)
+	}
+	return nil
+}
+
+func CreateAirline(airline Airline, svc *dynamodb.DynamoDB) error {
+	if err := ValidateAirline(&airline); err != nil {
+		return err
+	}
 	if !doesTableExist("Airlines", svc) {
 		if err := createAirlinesTable(svc); err != nil {
 			fmt.Printf("Error creating Airlines table: %v\n", err)
 		}
+	} else if err := ensureIndex("Airlines", airlineICAOIndex(), svc); err != nil {
+		return err
 	}
-	// Check if the airline code is already in use.
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("Airlines"),
-		IndexName: aws.String("CodeIndex"),
+	if !doesTableExist("AirlineDesignators", svc) {
+		if err := createAirlineDesignatorsTable(svc); err != nil {
+			fmt.Printf("Error creating AirlineDesignators table: %v\n", err)
+		}
+	}
+	// Airlines stored before AirlineDesignators existed only show up in the
+	// indexes, so they are still checked there.
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airlines"),
+		IndexName:              aws.String("CodeIndex"),
+		KeyConditionExpression: aws.String("Code = :code"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":code": {
 				S: aws.String(airline.Code),
 			},
 		},
-		KeyConditionExpression: aws.String("Code = :code"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Items) > 0 {
+		return errAirlineCodeTaken
+	}
+	if err := checkAirlineICAOUnique(airline.ICAO, "", svc); err != nil {
+		return err
 	}
-	result, err := svc.Query(queryInput)
+
+	airline.ID = uuid.New().String()
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{
+				TableName:           aws.String("Airlines"),
+				Item:                airlineItem(&airline),
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			}},
+			{Put: airlineDesignatorPut(airlineDesignatorIATA, airline.Code, airline.ID)},
+			{Put: airlineDesignatorPut(airlineDesignatorICAO, airline.ICAO, airline.ID)},
+		},
+	})
+	if err != nil {
+		return airlineDesignatorError(err, 1)
+	}
+
+	fmt.Printf("Created Airline: ID=%s, Code=%s, ICAO=%s\n", airline.ID, airline.Code, airline.ICAO)
+	return nil
+}
+
+// UpdateAirline replaces the data of an airline. The IATA designator is part
+// of the key and of the airline's flight numbers, so it cannot be changed.
+func UpdateAirline(airlineID string, airline Airline, svc *dynamodb.DynamoDB) (*Airline, error) {
+	existing, err := GetAirlineByID(airlineID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(airline.Code) == "" {
+		airline.Code = existing.Code
+	}
+	if err := validateAirlineDetails(&airline); err != nil {
+		return nil, err
+	}
+	if airline.Code != existing.Code {
+		return nil, errors.New("Airline code cannot be changed")
+	}
+	if err := ensureIndex("Airlines", airlineICAOIndex(), svc); err != nil {
+		return nil, err
+	}
+	if !doesTableExist("AirlineDesignators", svc) {
+		if err := createAirlineDesignatorsTable(svc); err != nil {
+			fmt.Printf("Error creating AirlineDesignators table: %v\n", err)
+		}
+	}
+	if err := checkAirlineICAOUnique(airline.ICAO, existing.ID, svc); err != nil {
+		return nil, err
+	}
+
+	// The update fails if the ICAO code changed since it was read, so its
+	// designator item is released by whoever changed it.
+	airline.ID = existing.ID
+	put := &dynamodb.Put{
+		TableName:           aws.String("Airlines"),
+		Item:                airlineItem(&airline),
+		ConditionExpression: aws.String("attribute_exists(ID) AND attribute_not_exists(ICAO)"),
+	}
+	if existing.ICAO != "" {
+		put.ConditionExpression = aws.String("attribute_exists(ID) AND ICAO = :icao")
+		put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":icao": {
+				S: aws.String(existing.ICAO),
+			},
+		}
+	}
+	writes := []*dynamodb.TransactWriteItem{
+		{Put: put},
+		{Put: airlineDesignatorPut(airlineDesignatorIATA, airline.Code, airline.ID)},
+		{Put: airlineDesignatorPut(airlineDesignatorICAO, airline.ICAO, airline.ID)},
+	}
+	if existing.ICAO != "" && existing.ICAO != airline.ICAO {
+		writes = append(writes, airlineDesignatorDelete(airlineDesignatorICAO, existing.ICAO, airline.ID))
+	}
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	if err != nil {
+		return nil, airlineDesignatorError(err, 1)
+	}
+
+	fmt.Printf("Updated Airline: ID=%s, Code=%s, ICAO=%s\n", airline.ID, airline.Code, airline.ICAO)
+	return &airline, nil
+}
+
+func airlineItem(airline *Airline) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(airline.ID),
+		},
+		"Code": {
+			S: aws.String(airline.Code),
+		},
+		"ICAO": {
+			S: aws.String(airline.ICAO),
+		},
+		"Name": {
+			S: aws.String(airline.Name),
+		},
+		"Country": {
+			S: aws.String(airline.Country),
+		},
+		"Active": {
+			BOOL: aws.Bool(airline.isActive()),
+		},
+	}
+	if airline.Callsign != "" {
+		item["Callsign"] = &dynamodb.AttributeValue{S: aws.String(airline.Callsign)}
+	}
+	if airline.LogoURL != "" {
+		item["LogoURL"] = &dynamodb.AttributeValue{S: aws.String(airline.LogoURL)}
+	}
+	return item
+}
+
+// checkAirlineICAOUnique fails if another airline than exceptID uses the ICAO code.
+func checkAirlineICAOUnique(icao, exceptID string, svc *dynamodb.DynamoDB) error {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airlines"),
+		IndexName:              aws.String("ICAOIndex"),
+		KeyConditionExpression: aws.String("ICAO = :icao"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":icao": {
+				S: aws.String(icao),
+			},
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	if len(result.Items) > 0 {
-		return errors.New("Airline code is not unique")
+	for _, item := range result.Items {
+		if item["ID"] == nil || aws.StringValue(item["ID"].S) != exceptID {
+			return errAirlineICAOTaken
+		}
 	}
+	return nil
+}
 
-	airlineID := uuid.New().String()
-	// Create a new airline in DynamoDB with ID and Code.
-	putInput := &dynamodb.PutItemInput{
-		TableName: aws.String("Airlines"),
+// The AirlineDesignators table holds one item per IATA and ICAO designator
+// in use, written in the same transaction as the airline, so two airlines
+// cannot take the same code.
+const (
+	airlineDesignatorIATA = "IATA"
+	airlineDesignatorICAO = "ICAO"
+)
+
+func airlineDesignatorKey(kind, code string) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{S: aws.String(kind + "#" + code)}
+}
+
+// airlineDesignatorPut claims a designator unless another airline holds it.
+func airlineDesignatorPut(kind, code, airlineID string) *dynamodb.Put {
+	return &dynamodb.Put{
+		TableName: aws.String("AirlineDesignators"),
 		Item: map[string]*dynamodb.AttributeValue{
-			"ID": {
+			"Designator": airlineDesignatorKey(kind, code),
+			"AirlineID": {
 				S: aws.String(airlineID),
 			},
-			"Code": {
-				S: aws.String(airline.Code),
+		},
+		ConditionExpression: aws.String("attribute_not_exists(Designator) OR AirlineID = :airlineID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":airlineID": {
+				S: aws.String(airlineID),
+			},
+		},
+	}
+}
+
+// airlineDesignatorDelete releases a designator the airline no longer uses.
+func airlineDesignatorDelete(kind, code, airlineID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String("AirlineDesignators"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"Designator": airlineDesignatorKey(kind, code),
+			},
+			ConditionExpression: aws.String("attribute_not_exists(Designator) OR AirlineID = :airlineID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":airlineID": {
+					S: aws.String(airlineID),
+				},
 			},
 		},
 	}
-	_, err = svc.PutItem(putInput)
+}
+
+// airlineDesignatorError turns a failed airline transaction into the taken
+// designator, where the IATA and ICAO claims start at index first.
+func airlineDesignatorError(err error, first int) error {
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return err
+	}
+	reasons := canceled.CancellationReasons
+	for i, taken := range []error{errAirlineCodeTaken, errAirlineICAOTaken} {
+		if at := first + i; len(reasons) > at && reasons[at].Code != nil && *reasons[at].Code == "ConditionalCheckFailed" {
+			return taken
+		}
+	}
+	return errors.New("Airline was changed concurrently, please retry")
+}
+
+// AirlineDesignatorBackfillReport lists the designators BackfillAirlineDesignators
+// found held by more than one airline, which need manual repair.
+type AirlineDesignatorBackfillReport struct {
+	Airlines   int      `json:"airlines"`
+	Claimed    int      `json:"claimed"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// BackfillAirlineDesignators claims the designators of airlines stored
+// before AirlineDesignators existed.
+func BackfillAirlineDesignators(svc *dynamodb.DynamoDB) (*AirlineDesignatorBackfillReport, error) {
+	if !doesTableExist("AirlineDesignators", svc) {
+		if err := createAirlineDesignatorsTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	airlines, err := GetAllAirlines(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AirlineDesignatorBackfillReport{Duplicates: []string{}}
+	for _, airline := range airlines {
+		report.Airlines++
+		designators := map[string]string{airlineDesignatorIATA: airline.Code}
+		if airline.ICAO != "" {
+			designators[airlineDesignatorICAO] = airline.ICAO
+		}
+		for kind, code := range designators {
+			put := airlineDesignatorPut(kind, code, airline.ID)
+			_, err := svc.PutItem(&dynamodb.PutItemInput{
+				TableName:                 put.TableName,
+				Item:                      put.Item,
+				ConditionExpression:       put.ConditionExpression,
+				ExpressionAttributeValues: put.ExpressionAttributeValues,
+			})
+			if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+				report.Duplicates = append(report.Duplicates, fmt.Sprintf("%s %s of airline %s", kind, code, airline.ID))
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Claimed++
+		}
+	}
+	return report, nil
+}
+
+func createAirlineDesignatorsTable(svc *dynamodb.DynamoDB) error {
+	_, err := svc.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String("AirlineDesignators"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Designator"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Designator"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Created Airline: ID=%s, Code=%s\n", airlineID, airline.Code)
+	fmt.Println("Created AirlineDesignators table")
 	return nil
 }
 
@@ -107,33 +475,120 @@ func GetAirlineByID(airlineID string, svc *dynamodb.DynamoDB) (*Airline, error)
 	return airline, nil
 }
 
-func GetAllAirlines(svc *dynamodb.DynamoDB) ([]*Airline, error) {
-	// Create a DynamoDB Scan input to retrieve all items from the Airlines table.
-	input := &dynamodb.ScanInput{
-		TableName: aws.String("Airlines"),
+func GetAirlineByCode(code string, svc *dynamodb.DynamoDB) (*Airline, error) {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airlines"),
+		IndexName:              aws.String("CodeIndex"),
+		KeyConditionExpression: aws.String("Code = :code"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":code": {
+				S: aws.String(code),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) == 0 {
+		return nil, errors.New("Airline not found")
+	}
+
+	airline := &Airline{}
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], airline); err != nil {
+		return nil, err
 	}
 
-	// Perform the scan operation.
-	result, err := svc.Scan(input)
+	return airline, nil
+}
+
+func GetAirlineByICAO(icao string, svc *dynamodb.DynamoDB) (*Airline, error) {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airlines"),
+		IndexName:              aws.String("ICAOIndex"),
+		KeyConditionExpression: aws.String("ICAO = :icao"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":icao": {
+				S: aws.String(icao),
+			},
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if len(result.Items) == 0 {
+		return nil, errors.New("Airline not found")
+	}
+
+	airline := &Airline{}
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], airline); err != nil {
+		return nil, err
+	}
+
+	return airline, nil
+}
+
+// GetAirlineByDesignator finds an airline by its 2-character IATA or 3-letter
+// ICAO designator.
+func GetAirlineByDesignator(designator string, svc *dynamodb.DynamoDB) (*Airline, error) {
+	designator = strings.ToUpper(strings.TrimSpace(designator))
+	switch {
+	case ValidateAirlineCode(designator) == nil:
+		return GetAirlineByCode(designator, svc)
+	case ValidateAirlineICAO(designator) == nil:
+		return GetAirlineByICAO(designator, svc)
+	}
+	return nil, errors.New("Airline designator must be a 2-character IATA or 3-letter ICAO code")
+}
+
+func GetAllAirlines(svc *dynamodb.DynamoDB) ([]*Airline, error) {
 	// Initialize a slice to hold the retrieved airlines.
 	airlines := []*Airline{}
 
-	// Iterate through the scan results and parse each item into an Airline struct.
-	for _, item := range result.Items {
-		airline := &Airline{}
-		if err := dynamodbattribute.UnmarshalMap(item, airline); err != nil {
-			return nil, err
+	// Scan every page of the Airlines table and parse each item into an Airline struct.
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String("Airlines"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			airline := &Airline{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, airline); unmarshalErr != nil {
+				return false
+			}
+			airlines = append(airlines, airline)
 		}
-		airlines = append(airlines, airline)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
 	}
 
 	return airlines, nil
 }
 
+func airlineICAOIndex() *dynamodb.GlobalSecondaryIndex {
+	return &dynamodb.GlobalSecondaryIndex{
+		IndexName: aws.String("ICAOIndex"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ICAO"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		Projection: &dynamodb.Projection{
+			ProjectionType: aws.String("ALL"),
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
 func createAirlinesTable(svc *dynamodb.DynamoDB) error {
 	// Define the parameters for creating the "Airlines" table.
 	params := &dynamodb.CreateTableInput{
@@ -157,6 +612,10 @@ func createAirlinesTable(svc *dynamodb.DynamoDB) error {
 				AttributeName: aws.String("Code"),
 				AttributeType: aws.String("S"),
 			},
+			{
+				AttributeName: aws.String("ICAO"),
+				AttributeType: aws.String("S"),
+			},
 		},
 		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
 			ReadCapacityUnits:  aws.Int64(5),
@@ -179,6 +638,7 @@ func createAirlinesTable(svc *dynamodb.DynamoDB) error {
 					WriteCapacityUnits: aws.Int64(5),
 				},
 			},
+			airlineICAOIndex(),
 		},
 	}
 
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestValidateFlightNumber(t *testing.T) {
+	tests := []struct {
+		name         string
+		flightNumber string
+		airlineCode  string
+		wantErr      bool
+	}{
+		{name: "one digit", flightNumber: "FB1", airlineCode: "FB"},
+		{name: "four digits", flightNumber: "FB1234", airlineCode: "FB"},
+		{name: "suffix letter", flightNumber: "FB123A", airlineCode: "FB"},
+		{name: "designator with a digit", flightNumber: "9W456", airlineCode: "9W"},
+		{name: "legacy designator", flightNumber: "FBAIR12", airlineCode: "FBAIR"},
+		{name: "other airline", flightNumber: "XY123", airlineCode: "FB", wantErr: true},
+		{name: "no airline", flightNumber: "FB123", airlineCode: "", wantErr: true},
+		{name: "no number", flightNumber: "FB", airlineCode: "FB", wantErr: true},
+		{name: "five digits", flightNumber: "FB12345", airlineCode: "FB", wantErr: true},
+		{name: "two suffix letters", flightNumber: "FB12AB", airlineCode: "FB", wantErr: true},
+		{name: "letter before the number", flightNumber: "FBA12", airlineCode: "FB", wantErr: true},
+		{name: "lower case suffix", flightNumber: "FB12a", airlineCode: "FB", wantErr: true},
+		{name: "space", flightNumber: "FB 12", airlineCode: "FB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFlightNumber(tt.flightNumber, tt.airlineCode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFlightNumber(%q, %q) error = %v, wantErr %v", tt.flightNumber, tt.airlineCode, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -13,10 +15,38 @@ import (
 )
 
 type Airport struct {
-	ID   string `json:"id"`
+	ID string `json:"id"`
+	// Code is the 3-letter IATA code of the airport.
 	Code string `json:"code"`
+	// ICAO is the 4-letter ICAO code of the airport, e.g. "LBSF".
+	ICAO string `json:"icao"`
+	Name string `json:"name"`
+	City string `json:"city"`
+	// Country is the ISO 3166-1 alpha-2 code of the country, e.g. "BG".
+	Country   string   `json:"country"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	// Elevation is the height of the airport above sea level in feet.
+	Elevation *int `json:"elevation,omitempty"`
+	// Timezone is the IANA time zone of the airport, e.g. "Europe/Sofia".
+	Timezone string `json:"timezone"`
+	// Terminals and their gates are where flights are assigned, see gate.go.
+	Terminals []Terminal `json:"terminals,omitempty"`
 }
 
+var (
+	errAirportCodeTaken = errors.New("Airport code is not unique")
+	errAirportICAOTaken = errors.New("Airport ICAO code is not unique")
+)
+
+const (
+	maxAirportNameLength = 100
+	// The lowest and highest airports in the world are about -1,300 and
+	// 14,500 feet above sea level.
+	minAirportElevation = -1500
+	maxAirportElevation = 20000
+)
+
 func ValidateAirportCode(code string) error {
 	code = strings.TrimSpace(code)
 	if len(code) != 3 || !isAlphabetic(code) {
@@ -25,16 +55,95 @@ func ValidateAirportCode(code string) error {
 	return nil
 }
 
-func CreateAirport(airport Airport, svc *dynamodb.DynamoDB) error {
-	// Validate the airport code.
+func ValidateAirportICAO(icao string) error {
+	if len(icao) != 4 || !isAlphabetic(icao) {
+		return errors.New("ICAO code must be exactly 4 alphabetic characters")
+	}
+	return nil
+}
+
+// ValidateAirport checks every field of an airport and normalizes its codes
+// to upper case.
+func ValidateAirport(airport *Airport) error {
+	airport.Code = strings.ToUpper(strings.TrimSpace(airport.Code))
+	airport.ICAO = strings.ToUpper(strings.TrimSpace(airport.ICAO))
+	airport.Country = strings.ToUpper(strings.TrimSpace(airport.Country))
+	airport.Name = strings.TrimSpace(airport.Name)
+	airport.City = strings.TrimSpace(airport.City)
+	airport.Timezone = strings.TrimSpace(airport.Timezone)
+
 	if err := ValidateAirportCode(airport.Code); err != nil {
 		return err
 	}
+	if err := ValidateAirportICAO(airport.ICAO); err != nil {
+		return err
+	}
+	if airport.Name == "" {
+		return errors.New("Airport name is required")
+	}
+	if len(airport.Name) > maxAirportNameLength {
+		return fmt.Errorf("Airport name must be at most %d characters", maxAirportNameLength)
+	}
+	if airport.City == "" {
+		return errors.New("City is required")
+	}
+	if len(airport.City) > maxAirportNameLength {
+		return fmt.Errorf("City must be at most %d characters", maxAirportNameLength)
+	}
+	if !isCountryCode(airport.Country) {
+		return fmt.Errorf("Country %q is not an ISO 3166-1 alpha-2 code", airport.Country)
+	}
+	if airport.Latitude == nil || *airport.Latitude < -90 || *airport.Latitude > 90 {
+		return errors.New("Latitude must be between -90 and 90")
+	}
+	if airport.Longitude == nil || *airport.Longitude < -180 || *airport.Longitude > 180 {
+		return errors.New("Longitude must be between -180 and 180")
+	}
+	if airport.Elevation != nil && (*airport.Elevation < minAirportElevation || *airport.Elevation > maxAirportElevation) {
+		return fmt.Errorf("Elevation must be between %d and %d feet", minAirportElevation, maxAirportElevation)
+	}
+	if err := ValidateTerminals(airport.Terminals); err != nil {
+		return err
+	}
+	return ValidateAirportTimezone(airport.Timezone)
+}
+
+func ValidateAirportTimezone(timezone string) error {
+	if strings.TrimSpace(timezone) == "" {
+		return errors.New("Timezone is required")
+	}
+	// "Local" would depend on the machine the API runs on.
+	if timezone == "Local" {
+		return errors.New("Timezone must be an IANA time zone name")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("Timezone %q is not a known IANA time zone", timezone)
+	}
+	return nil
+}
+
+func CreateAirport(airport Airport, svc *dynamodb.DynamoDB) error {
+	if err := ValidateAirport(&airport); err != nil {
+		return err
+	}
 	if !doesTableExist("Airports", svc) {
 		if err := createAirportsTable(svc); err != nil {
 			fmt.Printf("Error creating Airports table: %v\n", err)
 		}
+	} else if err := ensureAirportIndexes(svc); err != nil {
+		return err
+	}
+	if !doesTableExist("AirportSearch", svc) {
+		if err := createAirportSearchTable(svc); err != nil {
+			fmt.Printf("Error creating AirportSearch table: %v\n", err)
+		}
 	}
+	return insertAirport(&airport, svc)
+}
+
+// insertAirport stores a validated airport under a new ID if its IATA and ICAO
+// codes are not in use.
+func insertAirport(airport *Airport, svc *dynamodb.DynamoDB) error {
 	// Check if the airport code is already in use.
 	queryInput := &dynamodb.QueryInput{
 		TableName: aws.String("Airports"),
@@ -52,27 +161,145 @@ func CreateAirport(airport Airport, svc *dynamodb.DynamoDB) error {
 	}
 
 	if len(result.Items) > 0 {
-		return errors.New("Airport code is not unique")
+		return errAirportCodeTaken
 	}
-	airportID := uuid.New().String()
-	// Create a new airport in DynamoDB with ID and Code.
-	putInput := &dynamodb.PutItemInput{
-		TableName: aws.String("Airports"),
-		Item: map[string]*dynamodb.AttributeValue{
-			"ID": {
-				S: aws.String(airportID),
-			},
-			"Code": {
-				S: aws.String(airport.Code),
-			},
+	if err := checkAirportICAOUnique(airport.ICAO, "", svc); err != nil {
+		return err
+	}
+
+	airport.ID = uuid.New().String()
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("Airports"),
+		Item:                airportItem(airport),
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created Airport: ID=%s, Code=%s, ICAO=%s\n", airport.ID, airport.Code, airport.ICAO)
+	// The airport is stored; a failed search entry is repaired by index-airports.
+	if err := indexAirport(nil, airport, svc); err != nil {
+		fmt.Printf("Error indexing Airport %s for search: %v\n", airport.Code, err)
+	}
+	return nil
+}
+
+// UpdateAirport replaces the reference data of an airport. The IATA code is
+// part of the key and cannot be changed.
+func UpdateAirport(airportID string, airport Airport, svc *dynamodb.DynamoDB) (*Airport, error) {
+	existing, err := GetAirportByID(airportID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(airport.Code) == "" {
+		airport.Code = existing.Code
+	}
+	if err := ValidateAirport(&airport); err != nil {
+		return nil, err
+	}
+	if airport.Code != existing.Code {
+		return nil, errors.New("Airport code cannot be changed")
+	}
+	if err := ensureAirportIndexes(svc); err != nil {
+		return nil, err
+	}
+
+	airport.ID = existing.ID
+	if err := replaceAirport(existing, &airport, svc); err != nil {
+		return nil, err
+	}
+	return &airport, nil
+}
+
+// replaceAirport overwrites the stored airport existing with validated data if
+// its ICAO code is not used by another airport.
+func replaceAirport(existing, airport *Airport, svc *dynamodb.DynamoDB) error {
+	if err := checkAirportICAOUnique(airport.ICAO, airport.ID, svc); err != nil {
+		return err
+	}
+
+	// Terminals are kept unless the new data lists them.
+	if airport.Terminals == nil {
+		airport.Terminals = existing.Terminals
+	}
+
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("Airports"),
+		Item:                airportItem(airport),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated Airport: ID=%s, Code=%s, ICAO=%s\n", airport.ID, airport.Code, airport.ICAO)
+	if err := indexAirport(existing, airport, svc); err != nil {
+		fmt.Printf("Error indexing Airport %s for search: %v\n", airport.Code, err)
+	}
+	return nil
+}
+
+func airportItem(airport *Airport) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(airport.ID),
+		},
+		"Code": {
+			S: aws.String(airport.Code),
 		},
+		"ICAO": {
+			S: aws.String(airport.ICAO),
+		},
+		"Name": {
+			S: aws.String(airport.Name),
+		},
+		"City": {
+			S: aws.String(airport.City),
+		},
+		"Country": {
+			S: aws.String(airport.Country),
+		},
+		"Latitude": {
+			N: aws.String(strconv.FormatFloat(*airport.Latitude, 'f', -1, 64)),
+		},
+		"Longitude": {
+			N: aws.String(strconv.FormatFloat(*airport.Longitude, 'f', -1, 64)),
+		},
+		"Timezone": {
+			S: aws.String(airport.Timezone),
+		},
+	}
+	if airport.Elevation != nil {
+		item["Elevation"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(*airport.Elevation))}
+	}
+	if len(airport.Terminals) > 0 {
+		item["Terminals"] = terminalsValue(airport.Terminals)
 	}
-	_, err = svc.PutItem(putInput)
+	return item
+}
+
+// checkAirportICAOUnique fails if another airport than exceptID uses the ICAO code.
+func checkAirportICAOUnique(icao, exceptID string, svc *dynamodb.DynamoDB) error {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airports"),
+		IndexName:              aws.String("ICAOIndex"),
+		KeyConditionExpression: aws.String("ICAO = :icao"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":icao": {
+				S: aws.String(icao),
+			},
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Created Airport: ID=%s, Code=%s\n", airportID, airport.Code)
+	for _, item := range result.Items {
+		if item["ID"] == nil || aws.StringValue(item["ID"].S) != exceptID {
+			return errAirportICAOTaken
+		}
+	}
 	return nil
 }
 
@@ -111,33 +338,179 @@ func GetAirportByID(airportID string, svc *dynamodb.DynamoDB) (*Airport, error)
 	return airport, nil
 }
 
-func GetAllAirports(svc *dynamodb.DynamoDB) ([]*Airport, error) {
-	// Create a DynamoDB Scan input to retrieve all items from the Airports table.
-	input := &dynamodb.ScanInput{
+func GetAirportByCode(code string, svc *dynamodb.DynamoDB) (*Airport, error) {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airports"),
+		IndexName:              aws.String("CodeIndex"),
+		KeyConditionExpression: aws.String("Code = :code"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":code": {
+				S: aws.String(code),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) == 0 {
+		return nil, errors.New("Airport not found")
+	}
+
+	airport := &Airport{}
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], airport); err != nil {
+		return nil, err
+	}
+
+	return airport, nil
+}
+
+func GetAirportByICAO(icao string, svc *dynamodb.DynamoDB) (*Airport, error) {
+	result, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("Airports"),
+		IndexName:              aws.String("ICAOIndex"),
+		KeyConditionExpression: aws.String("ICAO = :icao"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":icao": {
+				S: aws.String(icao),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) == 0 {
+		return nil, errors.New("Airport not found")
+	}
+
+	airport := &Airport{}
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], airport); err != nil {
+		return nil, err
+	}
+
+	return airport, nil
+}
+
+// LookupAirport finds an airport by its 3-letter IATA or 4-letter ICAO code.
+func LookupAirport(code string, svc *dynamodb.DynamoDB) (*Airport, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	switch {
+	case ValidateAirportCode(code) == nil:
+		return GetAirportByCode(code, svc)
+	case ValidateAirportICAO(code) == nil:
+		return GetAirportByICAO(code, svc)
+	}
+	return nil, errors.New("Airport code must be a 3-letter IATA or 4-letter ICAO code")
+}
+
+// UpdateAirportTimezone sets the time zone of an airport. Flights already
+// stored keep their local times until recompute-flight-arrivals is run.
+func UpdateAirportTimezone(airportID, timezone string, svc *dynamodb.DynamoDB) (*Airport, error) {
+	if err := ValidateAirportTimezone(timezone); err != nil {
+		return nil, err
+	}
+	airport, err := GetAirportByID(airportID, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = svc.UpdateItem(&dynamodb.UpdateItemInput{
 		TableName: aws.String("Airports"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(airport.ID),
+			},
+			"Code": {
+				S: aws.String(airport.Code),
+			},
+		},
+		UpdateExpression: aws.String("SET #timezone = :timezone"),
+		ExpressionAttributeNames: map[string]*string{
+			"#timezone": aws.String("Timezone"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":timezone": {
+				S: aws.String(timezone),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Perform the scan operation.
-	result, err := svc.Scan(input)
+	fmt.Printf("Airport %s timezone set to %s\n", airport.Code, timezone)
+	airport.Timezone = timezone
+	return airport, nil
+}
+
+// airportLocation returns the time zone of an airport. Airports stored before
+// time zones existed fall back to UTC.
+func airportLocation(code string, svc *dynamodb.DynamoDB) (*time.Location, error) {
+	airport, err := GetAirportByCode(code, svc)
 	if err != nil {
 		return nil, err
 	}
+	if airport.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(airport.Timezone)
+}
 
+func GetAllAirports(svc *dynamodb.DynamoDB) ([]*Airport, error) {
 	// Initialize a slice to hold the retrieved airports.
 	airports := []*Airport{}
 
-	// Iterate through the scan results and parse each item into an Airport struct.
-	for _, item := range result.Items {
-		airport := &Airport{}
-		if err := dynamodbattribute.UnmarshalMap(item, airport); err != nil {
-			return nil, err
+	// Scan every page of the Airports table and parse each item into an Airport struct.
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String("Airports"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			airport := &Airport{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, airport); unmarshalErr != nil {
+				return false
+			}
+			airports = append(airports, airport)
 		}
-		airports = append(airports, airport)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
 	}
 
 	return airports, nil
 }
 
+func airportICAOIndex() *dynamodb.GlobalSecondaryIndex {
+	return &dynamodb.GlobalSecondaryIndex{
+		IndexName: aws.String("ICAOIndex"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ICAO"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		Projection: &dynamodb.Projection{
+			ProjectionType: aws.String("ALL"),
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// ensureAirportIndexes adds ICAOIndex to an Airports table created before it
+// existed. Airports can only be written once the index is active, since their
+// ICAO codes could not be checked for uniqueness until then.
+func ensureAirportIndexes(svc *dynamodb.DynamoDB) error {
+	return ensureIndex("Airports", airportICAOIndex(), svc)
+}
+
 func createAirportsTable(svc *dynamodb.DynamoDB) error {
 	// Define the parameters for creating the "Airports" table.
 	params := &dynamodb.CreateTableInput{
@@ -161,6 +534,10 @@ func createAirportsTable(svc *dynamodb.DynamoDB) error {
 				AttributeName: aws.String("Code"),
 				AttributeType: aws.String("S"),
 			},
+			{
+				AttributeName: aws.String("ICAO"),
+				AttributeType: aws.String("S"),
+			},
 		},
 		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
 			{
@@ -179,6 +556,7 @@ func createAirportsTable(svc *dynamodb.DynamoDB) error {
 					WriteCapacityUnits: aws.Int64(5),
 				},
 			},
+			airportICAOIndex(),
 		},
 		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
 			ReadCapacityUnits:  aws.Int64(5),
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Airports are imported from files in the OurAirports airports.csv layout.
+// Columns are found by name, so extra or reordered columns are fine. OurAirports
+// has no time zones: an optional "timezone" column supplies them, otherwise the
+// time zone of the stored airport is kept and new airports are skipped.
+var airportCSVRequiredColumns = []string{"name", "latitude_deg", "longitude_deg", "iso_country", "municipality", "iata_code"}
+
+// airportCSVICAOColumns are tried in order for the ICAO code; older files have
+// no icao_code column and carry it in gps_code or ident.
+var airportCSVICAOColumns = []string{"icao_code", "gps_code", "ident"}
+
+type AirportImportSkip struct {
+	Line   int    `json:"line"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type AirportImportReport struct {
+	DryRun   bool `json:"dryRun"`
+	RowsRead int  `json:"rowsRead"`
+	// WithoutIATA counts the rows ignored because they have no IATA code.
+	WithoutIATA int                 `json:"withoutIATA"`
+	Added       int                 `json:"added"`
+	Updated     int                 `json:"updated"`
+	Unchanged   int                 `json:"unchanged"`
+	Skipped     []AirportImportSkip `json:"skipped"`
+}
+
+// csvColumns maps the lower-case names in a CSV header to their positions.
+type csvColumns map[string]int
+
+// readCSVColumns reads the header of a CSV file and checks that it has the
+// required columns.
+func readCSVColumns(reader *csv.Reader, required []string) (csvColumns, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Reading header: %v", err)
+	}
+	columns := csvColumns{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range required {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("Column %s is missing", column)
+		}
+	}
+	return columns, nil
+}
+
+func (columns csvColumns) value(record []string, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// ImportAirportsCSV adds the airports of a CSV file that have an IATA code and
+// updates the stored airports whose data changed. Rows failing validation or
+// uniqueness are skipped and reported; the import can be re-run at any time.
+// With dryRun nothing is written.
+func ImportAirportsCSV(r io.Reader, dryRun bool, svc *dynamodb.DynamoDB) (*AirportImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	columns, err := readCSVColumns(reader, airportCSVRequiredColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	byCode := map[string]*Airport{}
+	byICAO := map[string]*Airport{}
+	if doesTableExist("Airports", svc) {
+		if !dryRun {
+			if err := ensureAirportIndexes(svc); err != nil {
+				return nil, err
+			}
+		}
+		airports, err := GetAllAirports(svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, airport := range airports {
+			byCode[airport.Code] = airport
+			if airport.ICAO != "" {
+				byICAO[airport.ICAO] = airport
+			}
+		}
+	} else if !dryRun {
+		if err := createAirportsTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	if !dryRun && !doesTableExist("AirportSearch", svc) {
+		if err := createAirportSearchTable(svc); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &AirportImportReport{DryRun: dryRun, Skipped: []AirportImportSkip{}}
+	seen := map[string]bool{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return report, fmt.Errorf("Line %d: %v", line, err)
+		}
+		report.RowsRead++
+
+		code := strings.ToUpper(columns.value(record, "iata_code"))
+		if code == "" {
+			report.WithoutIATA++
+			continue
+		}
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, AirportImportSkip{Line: line, Code: code, Reason: reason})
+		}
+		if seen[code] {
+			skip("IATA code appears more than once in the file")
+			continue
+		}
+		seen[code] = true
+		if columns.value(record, "type") == "closed" {
+			skip("Airport is closed")
+			continue
+		}
+
+		existing := byCode[code]
+		airport, err := parseAirportCSVRecord(record, columns, existing)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+		if err := ValidateAirport(airport); err != nil {
+			skip(err.Error())
+			continue
+		}
+		if other, ok := byICAO[airport.ICAO]; ok && other.Code != airport.Code {
+			skip(fmt.Sprintf("ICAO code %s is used by airport %s", airport.ICAO, other.Code))
+			continue
+		}
+		if existing != nil && airportsEqual(existing, airport) {
+			report.Unchanged++
+			continue
+		}
+
+		if !dryRun {
+			if existing != nil {
+				airport.ID = existing.ID
+				err = replaceAirport(existing, airport, svc)
+			} else {
+				err = insertAirport(airport, svc)
+			}
+			if errors.Is(err, errAirportCodeTaken) || errors.Is(err, errAirportICAOTaken) {
+				skip(err.Error())
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("Line %d: %v", line, err)
+			}
+		}
+
+		if existing != nil {
+			delete(byICAO, existing.ICAO)
+			report.Updated++
+		} else {
+			report.Added++
+		}
+		byCode[airport.Code] = airport
+		byICAO[airport.ICAO] = airport
+	}
+
+	return report, nil
+}
+
+// parseAirportCSVRecord builds an airport from a row. existing is the stored
+// airport with the same IATA code, if any, and supplies a missing time zone.
+func parseAirportCSVRecord(record []string, columns csvColumns, existing *Airport) (*Airport, error) {
+	airport := &Airport{
+		Code:     columns.value(record, "iata_code"),
+		Name:     columns.value(record, "name"),
+		City:     columns.value(record, "municipality"),
+		Country:  columns.value(record, "iso_country"),
+		Timezone: columns.value(record, "timezone"),
+	}
+	for _, column := range airportCSVICAOColumns {
+		if icao := columns.value(record, column); ValidateAirportICAO(strings.ToUpper(icao)) == nil {
+			airport.ICAO = icao
+			break
+		}
+	}
+	if airport.ICAO == "" {
+		return nil, errors.New("No ICAO code")
+	}
+	if airport.Timezone == "" && existing != nil {
+		airport.Timezone = existing.Timezone
+	}
+	if airport.Timezone == "" {
+		return nil, errors.New("No timezone, add a timezone column to import new airports")
+	}
+
+	latitude, err := strconv.ParseFloat(columns.value(record, "latitude_deg"), 64)
+	if err != nil {
+		return nil, errors.New("Latitude is not a number")
+	}
+	longitude, err := strconv.ParseFloat(columns.value(record, "longitude_deg"), 64)
+	if err != nil {
+		return nil, errors.New("Longitude is not a number")
+	}
+	airport.Latitude = &latitude
+	airport.Longitude = &longitude
+
+	if value := columns.value(record, "elevation_ft"); value != "" {
+		elevation, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("Elevation is not a whole number")
+		}
+		airport.Elevation = &elevation
+	}
+	return airport, nil
+}
+
+func airportsEqual(a, b *Airport) bool {
+	floatEqual := func(x, y *float64) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	intEqual := func(x, y *int) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	return a.Code == b.Code && a.ICAO == b.ICAO && a.Name == b.Name && a.City == b.City &&
+		a.Country == b.Country && a.Timezone == b.Timezone &&
+		floatEqual(a.Latitude, b.Latitude) && floatEqual(a.Longitude, b.Longitude) &&
+		intEqual(a.Elevation, b.Elevation)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Airports are searched through the AirportSearch table, which holds one item
+// per airport for every prefix of the words of its codes, name and city, e.g.
+// "so", "sof", "sofi" and "sofia" for Sofia. A search is a single Query on the
+// prefix of one word of the text typed so far; the items carry the fields
+// needed to rank and show the matches without reading the Airports table.
+
+const (
+	minAirportSearchPrefix = 2
+	maxAirportSearchPrefix = 12
+	// airportSearchCandidates bounds the items read per search.
+	airportSearchCandidates   = 500
+	defaultAirportSearchLimit = 10
+	maxAirportSearchLimit     = 25
+)
+
+type AirportSearchResult struct {
+	ID      string `json:"id"`
+	Code    string `json:"code"`
+	ICAO    string `json:"icao"`
+	Name    string `json:"name"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+	// Score ranks the results, higher first.
+	Score int `json:"score"`
+}
+
+// foldLetters covers letters that do not decompose into a base letter and an accent.
+var foldLetters = strings.NewReplacer("ø", "o", "ł", "l", "đ", "d", "ß", "ss", "æ", "ae", "œ", "oe", "ı", "i", "þ", "th")
+
+// normalizeSearchText lower-cases text and removes accents, so "Zürich" and
+// "zurich" compare equal.
+func normalizeSearchText(text string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(stripAccents, strings.ToLower(text))
+	if err != nil {
+		folded = strings.ToLower(text)
+	}
+	return foldLetters.Replace(folded)
+}
+
+// searchTokens splits text into normalized words, treating punctuation as a
+// separator, so "Charles-de-Gaulle" gives "charles", "de" and "gaulle".
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(normalizeSearchText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func airportSearchTokens(airport *Airport) []string {
+	tokens := []string{strings.ToLower(airport.Code), strings.ToLower(airport.ICAO)}
+	tokens = append(tokens, searchTokens(airport.Name)...)
+	return append(tokens, searchTokens(airport.City)...)
+}
+
+// airportSearchPrefixes returns the prefixes an airport is indexed under.
+func airportSearchPrefixes(airport *Airport) map[string]bool {
+	prefixes := map[string]bool{}
+	for _, token := range airportSearchTokens(airport) {
+		letters := []rune(token)
+		for length := minAirportSearchPrefix; length <= len(letters) && length <= maxAirportSearchPrefix; length++ {
+			prefixes[string(letters[:length])] = true
+		}
+	}
+	return prefixes
+}
+
+// indexAirport brings the search entries of an airport up to date. previous is
+// the airport as it was indexed before, or nil for a new airport.
+func indexAirport(previous, airport *Airport, svc *dynamodb.DynamoDB) error {
+	prefixes := airportSearchPrefixes(airport)
+	requests := []*dynamodb.WriteRequest{}
+	if previous != nil {
+		for prefix := range airportSearchPrefixes(previous) {
+			if prefixes[prefix] {
+				continue
+			}
+			requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"Prefix": {
+						S: aws.String(prefix),
+					},
+					"AirportID": {
+						S: aws.String(airport.ID),
+					},
+				},
+			}})
+		}
+	}
+	for prefix := range prefixes {
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{
+			Item: map[string]*dynamodb.AttributeValue{
+				"Prefix": {
+					S: aws.String(prefix),
+				},
+				"AirportID": {
+					S: aws.String(airport.ID),
+				},
+				"Code": {
+					S: aws.String(airport.Code),
+				},
+				"ICAO": {
+					S: aws.String(airport.ICAO),
+				},
+				"Name": {
+					S: aws.String(airport.Name),
+				},
+				"City": {
+					S: aws.String(airport.City),
+				},
+				"Country": {
+					S: aws.String(airport.Country),
+				},
+			},
+		}})
+	}
+
+	for start := 0; start < len(requests); start += 25 {
+		end := start + 25
+		if end > len(requests) {
+			end = len(requests)
+		}
+		pending := map[string][]*dynamodb.WriteRequest{"AirportSearch": requests[start:end]}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 5 {
+				return errors.New("AirportSearch writes were throttled, run index-airports")
+			}
+			output, err := svc.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = output.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// ReindexAirports rebuilds the search entries of every airport, e.g. for
+// airports stored before search existed. It returns how many were indexed.
+func ReindexAirports(svc *dynamodb.DynamoDB) (int, error) {
+	if !doesTableExist("AirportSearch", svc) {
+		if err := createAirportSearchTable(svc); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("AirportSearch table created, run again once it is active")
+	}
+	airports, err := GetAllAirports(svc)
+	if err != nil {
+		return 0, err
+	}
+	for i, airport := range airports {
+		if err := indexAirport(nil, airport, svc); err != nil {
+			return i, fmt.Errorf("Airport %s: %v", airport.Code, err)
+		}
+	}
+	return len(airports), nil
+}
+
+// SearchAirports finds airports whose code, ICAO code, name or city start with
+// the words typed, ignoring case and accents. When nothing matches exactly,
+// words with one typo (two for long words) match too.
+func SearchAirports(query string, limit int, svc *dynamodb.DynamoDB) ([]AirportSearchResult, error) {
+	if limit <= 0 {
+		limit = defaultAirportSearchLimit
+	}
+	if limit > maxAirportSearchLimit {
+		limit = maxAirportSearchLimit
+	}
+	words := searchTokens(query)
+	if len(words) == 0 {
+		return []AirportSearchResult{}, nil
+	}
+	// Look up the longest word, it has the fewest candidates.
+	lookup := words[0]
+	for _, word := range words[1:] {
+		if len([]rune(word)) > len([]rune(lookup)) {
+			lookup = word
+		}
+	}
+	letters := []rune(lookup)
+	if len(letters) < minAirportSearchPrefix {
+		return []AirportSearchResult{}, nil
+	}
+	if len(letters) > maxAirportSearchPrefix {
+		letters = letters[:maxAirportSearchPrefix]
+	}
+
+	candidates, err := airportSearchCandidatesFor(string(letters), svc)
+	if err != nil {
+		return nil, err
+	}
+	results := rankAirports(candidates, normalizeSearchText(strings.TrimSpace(query)), words, false)
+	// Typos are only looked for after the first three letters, which keeps
+	// the candidates to one small partition.
+	if len(results) == 0 && len(letters) > 3 {
+		if candidates, err = airportSearchCandidatesFor(string(letters[:3]), svc); err != nil {
+			return nil, err
+		}
+		results = rankAirports(candidates, normalizeSearchText(strings.TrimSpace(query)), words, true)
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func airportSearchCandidatesFor(prefix string, svc *dynamodb.DynamoDB) ([]AirportSearchResult, error) {
+	candidates := []AirportSearchResult{}
+	var unmarshalErr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("AirportSearch"),
+		KeyConditionExpression: aws.String("#prefix = :prefix"),
+		ExpressionAttributeNames: map[string]*string{
+			"#prefix": aws.String("Prefix"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":prefix": {
+				S: aws.String(prefix),
+			},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var candidate AirportSearchResult
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &candidate); unmarshalErr != nil {
+				return false
+			}
+			candidate.ID = aws.StringValue(item["AirportID"].S)
+			candidates = append(candidates, candidate)
+		}
+		return len(candidates) < airportSearchCandidates
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candidates, unmarshalErr
+}
+
+// rankAirports keeps the candidates matching every word and sorts them by score.
+func rankAirports(candidates []AirportSearchResult, query string, words []string, fuzzy bool) []AirportSearchResult {
+	results := []AirportSearchResult{}
+	for _, candidate := range candidates {
+		airport := &Airport{Code: candidate.Code, ICAO: candidate.ICAO, Name: candidate.Name, City: candidate.City}
+		tokens := airportSearchTokens(airport)
+
+		typos := 0
+		matched := true
+		for _, word := range words {
+			best := -1
+			for _, token := range tokens {
+				if strings.HasPrefix(token, word) {
+					best = 0
+					break
+				}
+				if fuzzy {
+					if distance := prefixDistance(word, token); distance <= allowedTypos(word) && (best < 0 || distance < best) {
+						best = distance
+					}
+				}
+			}
+			if best < 0 {
+				matched = false
+				break
+			}
+			typos += best
+		}
+		if !matched {
+			continue
+		}
+
+		code, icao := strings.ToLower(candidate.Code), strings.ToLower(candidate.ICAO)
+		name, city := normalizeSearchText(candidate.Name), normalizeSearchText(candidate.City)
+		switch {
+		case query == code:
+			candidate.Score = 1000
+		case query == icao:
+			candidate.Score = 900
+		case strings.HasPrefix(code, query):
+			candidate.Score = 800
+		case city == query || name == query:
+			candidate.Score = 700
+		case strings.HasPrefix(city, query):
+			candidate.Score = 600
+		case strings.HasPrefix(name, query):
+			candidate.Score = 500
+		case strings.HasPrefix(icao, query):
+			candidate.Score = 400
+		default:
+			candidate.Score = 300
+		}
+		candidate.Score -= 100 * typos
+		results = append(results, candidate)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		// Prefer the closest match, e.g. the city "Zürich" over "Zurich Lake".
+		if len(results[i].City) != len(results[j].City) {
+			return len(results[i].City) < len(results[j].City)
+		}
+		if len(results[i].Name) != len(results[j].Name) {
+			return len(results[i].Name) < len(results[j].Name)
+		}
+		return results[i].Code < results[j].Code
+	})
+	return results
+}
+
+func allowedTypos(word string) int {
+	if len([]rune(word)) >= 8 {
+		return 2
+	}
+	return 1
+}
+
+// prefixDistance is the smallest edit distance between word and a prefix of token.
+func prefixDistance(word, token string) int {
+	a, b := []rune(word), []rune(token)
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	best := previous[0]
+	for _, distance := range previous {
+		best = minInt(best, distance)
+	}
+	return best
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func createAirportSearchTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("AirportSearch"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Prefix"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("AirportID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Prefix"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("AirportID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("AirportSearch table created successfully")
+	return nil
+}
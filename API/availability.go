@@ -0,0 +1,464 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// SeatAvailability holds the maintained seat counters for one FlightSection of a flight.
+type SeatAvailability struct {
+	FlightNumber    string `json:"flightNumber"`
+	FlightSectionID string `json:"flightSectionID"`
+	SeatClass       string `json:"seatClass"`
+	Total           int    `json:"total"`
+	Booked          int    `json:"booked"`
+	Held            int    `json:"held"`
+	Blocked         int    `json:"blocked"`
+	Free            int    `json:"free"`
+	// BlockExpiries lists when blocks of the section expire, as
+	// "<RFC3339>#<seatID>", so reads leave expired blocks out of Blocked and
+	// ReleaseDueBlocks finds the seats to release.
+	BlockExpiries []string `dynamodbav:"BlockExpiries,stringset,omitempty" json:"-"`
+}
+
+// availabilityDelta describes how a seat state change moves the counters.
+type availabilityDelta struct {
+	Total   int
+	Booked  int
+	Held    int
+	Blocked int
+	// BlockExpiries are added to the section's pending block expiries.
+	BlockExpiries []string
+}
+
+func (d availabilityDelta) isZero() bool {
+	return d.Total == 0 && d.Booked == 0 && d.Held == 0 && d.Blocked == 0 && len(d.BlockExpiries) == 0
+}
+
+func (a *SeatAvailability) computeFree() {
+	a.Free = a.Total - a.Booked - a.Held - a.Blocked
+	if a.Free < 0 {
+		a.Free = 0
+	}
+}
+
+// availabilityUpdate builds the transactional counter update for a seat state change.
+func availabilityUpdate(flightNumber string, flightSection *FlightSection, delta availabilityDelta) *dynamodb.TransactWriteItem {
+	item := &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: aws.String("SeatAvailability"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"FlightNumber": {
+					S: aws.String(flightNumber),
+				},
+				"FlightSectionID": {
+					S: aws.String(flightSection.ID),
+				},
+			},
+			UpdateExpression: aws.String("SET SeatClass = :seatClass ADD Total :total, Booked :booked, Held :held, Blocked :blocked"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":seatClass": {
+					S: aws.String(flightSection.SeatClass),
+				},
+				":total": {
+					N: aws.String(fmt.Sprintf("%d", delta.Total)),
+				},
+				":booked": {
+					N: aws.String(fmt.Sprintf("%d", delta.Booked)),
+				},
+				":held": {
+					N: aws.String(fmt.Sprintf("%d", delta.Held)),
+				},
+				":blocked": {
+					N: aws.String(fmt.Sprintf("%d", delta.Blocked)),
+				},
+			},
+		},
+	}
+	if len(delta.BlockExpiries) > 0 {
+		*item.Update.UpdateExpression += ", BlockExpiries :blockExpiries"
+		item.Update.ExpressionAttributeValues[":blockExpiries"] = &dynamodb.AttributeValue{SS: aws.StringSlice(delta.BlockExpiries)}
+	}
+	return item
+}
+
+type availabilityKey struct {
+	FlightNumber    string
+	FlightSectionID string
+}
+
+// availabilityDeltas sums counter changes of several seats so each section
+// gets a single update in a transaction.
+type availabilityDeltas struct {
+	order  []availabilityKey
+	deltas map[availabilityKey]availabilityDelta
+}
+
+func newAvailabilityDeltas() *availabilityDeltas {
+	return &availabilityDeltas{deltas: map[availabilityKey]availabilityDelta{}}
+}
+
+func (d *availabilityDeltas) add(flightNumber, flightSectionID string, delta availabilityDelta) {
+	key := availabilityKey{FlightNumber: flightNumber, FlightSectionID: flightSectionID}
+	sum, ok := d.deltas[key]
+	if !ok {
+		d.order = append(d.order, key)
+	}
+	sum.Total += delta.Total
+	sum.Booked += delta.Booked
+	sum.Held += delta.Held
+	sum.Blocked += delta.Blocked
+	sum.BlockExpiries = append(sum.BlockExpiries, delta.BlockExpiries...)
+	d.deltas[key] = sum
+}
+
+func (d *availabilityDeltas) writes(svc *dynamodb.DynamoDB) ([]*dynamodb.TransactWriteItem, error) {
+	writes := []*dynamodb.TransactWriteItem{}
+	for _, key := range d.order {
+		delta := d.deltas[key]
+		if delta.isZero() {
+			continue
+		}
+		if err := ensureAvailability(key.FlightNumber, key.FlightSectionID, svc); err != nil {
+			return nil, err
+		}
+		flightSection, err := GetFlightSectionByID(key.FlightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, availabilityUpdate(key.FlightNumber, flightSection, delta))
+	}
+	return writes, nil
+}
+
+// writeSeatWithAvailability applies the seat writes and the matching counter update in one transaction.
+// conflictMessages[i] is returned when the condition on writes[i] fails.
+func writeSeatWithAvailability(writes []*dynamodb.TransactWriteItem, conflictMessages []string, flightNumber, flightSectionID string, delta availabilityDelta, svc *dynamodb.DynamoDB) error {
+	items := append([]*dynamodb.TransactWriteItem{}, writes...)
+
+	if !delta.isZero() {
+		if err := ensureAvailability(flightNumber, flightSectionID, svc); err != nil {
+			return err
+		}
+		flightSection, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return err
+		}
+		items = append(items, availabilityUpdate(flightNumber, flightSection, delta))
+	}
+
+	_, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			for i, reason := range canceled.CancellationReasons {
+				if i < len(conflictMessages) && conflictMessages[i] != "" &&
+					reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
+					return errors.New(conflictMessages[i])
+				}
+			}
+			return errors.New("Seat was modified concurrently, please retry")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// FlightAvailability holds the seat counters of one dated flight.
+type FlightAvailability struct {
+	FlightID      string              `json:"flightID"`
+	FlightNumber  string              `json:"flightNumber"`
+	OperatingDate string              `json:"operatingDate"`
+	OriginAirport string              `json:"originAirport"`
+	Sections      []*SeatAvailability `json:"sections"`
+}
+
+// ensureAvailability makes sure the counters of a section exist before a
+// delta moves them. Missing counters are counted from the seats first, so
+// sections whose seats predate the counters do not start counting from zero.
+func ensureAvailability(flightNumber, flightSectionID string, svc *dynamodb.DynamoDB) error {
+	if !doesTableExist("SeatAvailability", svc) {
+		if err := createSeatAvailabilityTable(svc); err != nil {
+			return err
+		}
+	}
+
+	sectionAvailability, err := getSectionAvailability(flightNumber, flightSectionID, true, svc)
+	if err != nil || sectionAvailability != nil {
+		return err
+	}
+
+	_, err = rebuildSectionAvailability(flightNumber, flightSectionID, true, svc)
+	return err
+}
+
+// getSectionAvailability returns the stored counters of a section, or nil
+// when it has none.
+func getSectionAvailability(flightNumber, flightSectionID string, consistentRead bool, svc *dynamodb.DynamoDB) (*SeatAvailability, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("SeatAvailability"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FlightNumber": {
+				S: aws.String(flightNumber),
+			},
+			"FlightSectionID": {
+				S: aws.String(flightSectionID),
+			},
+		},
+		ConsistentRead: aws.Bool(consistentRead),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	sectionAvailability := &SeatAvailability{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, sectionAvailability); err != nil {
+		return nil, err
+	}
+	sectionAvailability.computeFree()
+	return sectionAvailability, nil
+}
+
+// GetAvailabilityForFlight returns the counters of the sections of one dated
+// flight, leaving out other dates that share its FlightNumber. It only reads:
+// sections without counters are counted from their seats, and blocks that
+// expired are left out of Blocked until ReleaseDueBlocks releases them.
+func GetAvailabilityForFlight(flight Flight, svc *dynamodb.DynamoDB) ([]*SeatAvailability, error) {
+	stored := doesTableExist("SeatAvailability", svc)
+
+	availability := []*SeatAvailability{}
+	now := time.Now()
+	for _, flightSectionID := range flight.FlightSectionID {
+		var sectionAvailability *SeatAvailability
+		var err error
+		if stored {
+			if sectionAvailability, err = getSectionAvailability(flight.FlightNumber, flightSectionID, false, svc); err != nil {
+				return nil, err
+			}
+		}
+		if sectionAvailability == nil {
+			if sectionAvailability, err = countSectionAvailability(flight.FlightNumber, flightSectionID, svc); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := discountExpiredBlocks(sectionAvailability, now, svc); err != nil {
+			return nil, err
+		}
+		availability = append(availability, sectionAvailability)
+	}
+
+	return availability, nil
+}
+
+// GetFlightAvailability returns the counters of one dated flight.
+func GetFlightAvailability(flight *Flight, svc *dynamodb.DynamoDB) (*FlightAvailability, error) {
+	sections, err := GetAvailabilityForFlight(*flight, svc)
+	if err != nil {
+		return nil, err
+	}
+	return newFlightAvailability(flight, sections), nil
+}
+
+func newFlightAvailability(flight *Flight, sections []*SeatAvailability) *FlightAvailability {
+	return &FlightAvailability{
+		FlightID:      flight.ID,
+		FlightNumber:  flight.FlightNumber,
+		OperatingDate: flight.operatingDate(),
+		OriginAirport: flight.OriginAirport,
+		Sections:      sections,
+	}
+}
+
+// GetAvailabilityForFlights returns the availability of several dated flights keyed by flight ID.
+func GetAvailabilityForFlights(flightIDs []string, svc *dynamodb.DynamoDB) (map[string]*FlightAvailability, error) {
+	availability := map[string]*FlightAvailability{}
+
+	for _, flightID := range flightIDs {
+		if _, seen := availability[flightID]; seen {
+			continue
+		}
+		flight, err := GetFlightByID(flightID, svc)
+		if err != nil {
+			return nil, fmt.Errorf("Flight %s: %v", flightID, err)
+		}
+		flightAvailability, err := GetFlightAvailability(flight, svc)
+		if err != nil {
+			return nil, err
+		}
+		availability[flightID] = flightAvailability
+	}
+
+	return availability, nil
+}
+
+// RebuildAvailability recounts the seats of one dated flight and overwrites
+// its counters. It is meant for flights whose seats were created before the
+// counters existed.
+func RebuildAvailability(flight *Flight, svc *dynamodb.DynamoDB) (*FlightAvailability, error) {
+	if !doesTableExist("SeatAvailability", svc) {
+		if err := createSeatAvailabilityTable(svc); err != nil {
+			return nil, err
+		}
+	}
+
+	sections := []*SeatAvailability{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		sectionAvailability, err := rebuildSectionAvailability(flight.FlightNumber, flightSectionID, false, svc)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, sectionAvailability)
+	}
+	return newFlightAvailability(flight, sections), nil
+}
+
+// rebuildSectionAvailability recounts the seats a flight number has in a
+// section. With onlyMissing the counters are only written when they do not
+// exist yet, so counters another request created meanwhile are kept.
+func rebuildSectionAvailability(flightNumber, flightSectionID string, onlyMissing bool, svc *dynamodb.DynamoDB) (*SeatAvailability, error) {
+	sectionAvailability, err := countSectionAvailability(flightNumber, flightSectionID, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sections without seats get zero counters so they are not recounted on every write.
+	if err := putAvailability(sectionAvailability, onlyMissing, svc); err != nil {
+		return nil, err
+	}
+	sectionAvailability.computeFree()
+	return sectionAvailability, nil
+}
+
+// countSectionAvailability counts the seats a flight number has in a section
+// without storing the counters.
+func countSectionAvailability(flightNumber, flightSectionID string, svc *dynamodb.DynamoDB) (*SeatAvailability, error) {
+	flightSection, err := GetFlightSectionByID(flightSectionID, svc)
+	if err != nil {
+		return nil, err
+	}
+	sectionAvailability := &SeatAvailability{
+		FlightNumber:    flightNumber,
+		FlightSectionID: flightSectionID,
+		SeatClass:       flightSection.SeatClass,
+	}
+
+	if doesTableExist("Seats", svc) {
+		seats, err := GetSeatsByFlightSectionID(flightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, seat := range seats {
+			if seat.FlightNumber != flightNumber {
+				continue
+			}
+			sectionAvailability.Total++
+			if seat.IsBooked {
+				sectionAvailability.Booked++
+			} else if seat.IsHeld {
+				sectionAvailability.Held++
+			}
+			if seat.IsBlocked {
+				sectionAvailability.Blocked++
+			}
+			if expiry := blockExpiry(seat); expiry != "" {
+				sectionAvailability.BlockExpiries = append(sectionAvailability.BlockExpiries, expiry)
+			}
+		}
+	}
+
+	sectionAvailability.computeFree()
+	return sectionAvailability, nil
+}
+
+// putAvailability stores the counters of a section. With onlyMissing stored
+// counters are left as they are.
+func putAvailability(sectionAvailability *SeatAvailability, onlyMissing bool, svc *dynamodb.DynamoDB) error {
+	putInput := &dynamodb.PutItemInput{
+		TableName: aws.String("SeatAvailability"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"FlightNumber": {
+				S: aws.String(sectionAvailability.FlightNumber),
+			},
+			"FlightSectionID": {
+				S: aws.String(sectionAvailability.FlightSectionID),
+			},
+			"SeatClass": {
+				S: aws.String(sectionAvailability.SeatClass),
+			},
+			"Total": {
+				N: aws.String(fmt.Sprintf("%d", sectionAvailability.Total)),
+			},
+			"Booked": {
+				N: aws.String(fmt.Sprintf("%d", sectionAvailability.Booked)),
+			},
+			"Held": {
+				N: aws.String(fmt.Sprintf("%d", sectionAvailability.Held)),
+			},
+			"Blocked": {
+				N: aws.String(fmt.Sprintf("%d", sectionAvailability.Blocked)),
+			},
+		},
+	}
+	if len(sectionAvailability.BlockExpiries) > 0 {
+		putInput.Item["BlockExpiries"] = &dynamodb.AttributeValue{SS: aws.StringSlice(sectionAvailability.BlockExpiries)}
+	}
+	if onlyMissing {
+		putInput.ConditionExpression = aws.String("attribute_not_exists(FlightSectionID)")
+	}
+	if _, err := svc.PutItem(putInput); err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok && onlyMissing {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func createSeatAvailabilityTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("SeatAvailability"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("FlightNumber"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("FlightSectionID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("FlightNumber"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("FlightSectionID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("SeatAvailability table created successfully")
+	return nil
+}
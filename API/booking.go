@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+const (
+	BookingStatusConfirmed = "CONFIRMED"
+)
+
+// maxTransactItems is the DynamoDB limit on items in one transaction.
+const maxTransactItems = 100
+
+// BookingSegment is one leg of a booking with one seat per passenger. The
+// dated flight is given by FlightID, or by FlightNumber with OperatingDate
+// and OriginAirport when the number alone is ambiguous.
+type BookingSegment struct {
+	FlightNumber  string    `json:"flightNumber"`
+	FlightID      string    `json:"flightID,omitempty"`
+	OperatingDate string    `json:"operatingDate,omitempty"`
+	OriginAirport string    `json:"originAirport,omitempty"`
+	Seats         []SeatRef `json:"seats"`
+	// SoldAs is the flight number the segment was sold under, the operating
+	// FlightNumber or a marketing number of the flight.
+	SoldAs string `json:"soldAs,omitempty"`
+	// FlightStatus is the current status of the flight, filled in when the
+	// booking is read and never stored.
+	FlightStatus string `json:"flightStatus,omitempty" dynamodbav:"-"`
+	// DepartureGate and ArrivalGate are the flight's current gates, also
+	// filled in when the booking is read.
+	DepartureGate *GateAssignment `json:"departureGate,omitempty" dynamodbav:"-"`
+	ArrivalGate   *GateAssignment `json:"arrivalGate,omitempty" dynamodbav:"-"`
+}
+
+type Booking struct {
+	ID             string           `json:"id"`
+	PassengerNames []string         `json:"passengerNames"`
+	Segments       []BookingSegment `json:"segments"`
+	Status         string           `json:"status"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	// ScheduleChangeIDs lists the schedule changes that affected the booking.
+	// PendingScheduleChange is set while one of them waits in the queue.
+	ScheduleChangeIDs     []string `json:"scheduleChangeIDs,omitempty"`
+	PendingScheduleChange bool     `json:"pendingScheduleChange"`
+}
+
+func validateBooking(booking Booking) error {
+	if len(booking.PassengerNames) == 0 {
+		return errors.New("At least one passenger is required")
+	}
+	for _, name := range booking.PassengerNames {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("Passenger names must not be empty")
+		}
+	}
+	if len(booking.Segments) == 0 {
+		return errors.New("At least one segment is required")
+	}
+	for _, segment := range booking.Segments {
+		if segment.FlightID == "" && strings.TrimSpace(segment.FlightNumber) == "" {
+			return errors.New("Every segment needs a FlightID or a FlightNumber")
+		}
+		if len(segment.Seats) != len(booking.PassengerNames) {
+			return fmt.Errorf("Segment %s needs exactly one seat per passenger", segment.FlightNumber)
+		}
+	}
+	seats := map[SeatRef]bool{}
+	for _, segment := range booking.Segments {
+		for _, ref := range segment.Seats {
+			key := SeatRef{ID: ref.ID, FlightSectionID: ref.FlightSectionID}
+			if seats[key] {
+				return fmt.Errorf("Seat %s is listed more than once", ref.ID)
+			}
+			seats[key] = true
+		}
+	}
+	return nil
+}
+
+// validateBookingConnections checks that consecutive segments connect at the
+// same airport, leave at least the minimum connection time of the airport
+// and do not wait longer than defaultMaxConnection, like itinerary search.
+func validateBookingConnections(flights []*Flight, svc *dynamodb.DynamoDB) error {
+	mct := newConnectionTimes(svc)
+	for i := 1; i < len(flights); i++ {
+		previous, next := flights[i-1], flights[i]
+		if !strings.EqualFold(previous.DestinationAirport, next.OriginAirport) {
+			return fmt.Errorf("Flight %s does not depart from the arrival airport of %s", next.FlightNumber, previous.FlightNumber)
+		}
+		if err := mct.check(previous, next); err != nil {
+			return err
+		}
+		if next.DepartureDate.Sub(flightArrival(*previous)) > defaultMaxConnection {
+			return fmt.Errorf("Connection from %s to %s is longer than %s", previous.FlightNumber, next.FlightNumber, defaultMaxConnection)
+		}
+	}
+	return nil
+}
+
+// CreateBooking books the seats of every segment together with the booking
+// record in a single transaction, so a multi-leg booking either holds all of
+// its seats or none of them.
+func CreateBooking(booking Booking, svc *dynamodb.DynamoDB) (*Booking, error) {
+	if err := validateBooking(booking); err != nil {
+		return nil, err
+	}
+	if !doesTableExist("Bookings", svc) {
+		if err := createBookingsTable(svc); err != nil {
+			fmt.Printf("Error creating Bookings table: %v\n", err)
+		}
+	}
+
+	booking.ID = uuid.New().String()
+	booking.Status = BookingStatusConfirmed
+	booking.CreatedAt = time.Now().UTC()
+
+	flights := []*Flight{}
+	for i, segment := range booking.Segments {
+		flight, err := resolveSegmentFlight(segment, svc)
+		if err != nil {
+			return nil, err
+		}
+		if !flight.isOpenForSale() {
+			return nil, fmt.Errorf("Flight %s is %s and closed for sale", flight.FlightNumber, flight.currentStatus())
+		}
+		booking.Segments[i].SoldAs = flight.FlightNumber
+		if flight.hasNumber(segment.FlightNumber) {
+			booking.Segments[i].SoldAs = segment.FlightNumber
+		}
+		booking.Segments[i].FlightID = flight.ID
+		booking.Segments[i].FlightNumber = flight.FlightNumber
+		booking.Segments[i].OperatingDate = flight.operatingDate()
+		booking.Segments[i].OriginAirport = flight.OriginAirport
+		flights = append(flights, flight)
+	}
+	if err := validateBookingConnections(flights, svc); err != nil {
+		return nil, err
+	}
+	if err := validateBookingCarriers(flights, svc); err != nil {
+		return nil, err
+	}
+
+	writes := []*dynamodb.TransactWriteItem{}
+	counters := newAvailabilityDeltas()
+	for i, segment := range booking.Segments {
+		sections := []string{}
+		seen := map[string]bool{}
+		for _, ref := range segment.Seats {
+			seat, err := getSeat(ref.ID, ref.FlightSectionID, svc)
+			if err != nil {
+				return nil, err
+			}
+			if !seatOnFlight(seat, flights[i]) {
+				return nil, fmt.Errorf("Seat %s is not on flight %s on %s", seat.ID, segment.FlightNumber, segment.OperatingDate)
+			}
+			if seat.IsBooked {
+				return nil, fmt.Errorf("Seat %s is already booked", seat.ID)
+			}
+			if seat.IsHeld && !seat.heldFor(ref.HoldToken) {
+				return nil, fmt.Errorf("Seat %s is held by another customer", seat.ID)
+			}
+
+			next := *seat
+			next.IsBooked = true
+			next.IsHeld = false
+			next.BookingID = booking.ID
+			if err := releaseExpiredBlock(&next); err != nil {
+				return nil, fmt.Errorf("Seat %s: %v", seat.ID, err)
+			}
+
+			writes = append(writes, seatUpdate(seat, &next))
+			counters.add(seat.FlightNumber, seat.FlightSectionID, availabilityDelta{
+				Booked:  1,
+				Held:    -boolToInt(seat.IsHeld),
+				Blocked: -boolToInt(seat.IsBlocked),
+			})
+			if !seen[seat.FlightSectionID] {
+				seen[seat.FlightSectionID] = true
+				sections = append(sections, seat.FlightSectionID)
+			}
+		}
+		// The flight must still be open for sale and still have the seats' sections.
+		writes = append(writes, flightOpenForSaleCheck(flights[i], sections))
+	}
+
+	bookingPut, err := bookingPut(booking)
+	if err != nil {
+		return nil, err
+	}
+	writes = append(writes, &dynamodb.TransactWriteItem{Put: bookingPut})
+
+	counterWrites, err := counters.writes(svc)
+	if err != nil {
+		return nil, err
+	}
+	writes = append(writes, counterWrites...)
+	if len(writes) > maxTransactItems {
+		return nil, errors.New("Booking has too many seats to book in one transaction")
+	}
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			return nil, errors.New("One or more seats were taken or a flight closed for sale while booking, please retry")
+		}
+		return nil, err
+	}
+
+	fmt.Printf("Created Booking: ID=%s, Segments=%d, Passengers=%d\n", booking.ID, len(booking.Segments), len(booking.PassengerNames))
+	return &booking, nil
+}
+
+// resolveSegmentFlight finds the dated flight a booking segment refers to.
+func resolveSegmentFlight(segment BookingSegment, svc *dynamodb.DynamoDB) (*Flight, error) {
+	if segment.FlightID == "" {
+		return ResolveFlight(segment.FlightNumber, segment.OperatingDate, segment.OriginAirport, svc)
+	}
+	flight, err := GetFlightByID(segment.FlightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if segment.FlightNumber != "" && !flight.hasNumber(segment.FlightNumber) {
+		return nil, fmt.Errorf("Flight %s is not flight number %s", flight.ID, segment.FlightNumber)
+	}
+	return flight, nil
+}
+
+func bookingPut(booking Booking) (*dynamodb.Put, error) {
+	segments, err := dynamodbattribute.Marshal(booking.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.Put{
+		TableName: aws.String("Bookings"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(booking.ID),
+			},
+			"PassengerNames": {
+				L: stringListValue(booking.PassengerNames),
+			},
+			"Segments": segments,
+			"Status": {
+				S: aws.String(booking.Status),
+			},
+			"CreatedAt": {
+				S: aws.String(booking.CreatedAt.Format(time.RFC3339)),
+			},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}, nil
+}
+
+func stringListValue(values []string) []*dynamodb.AttributeValue {
+	list := make([]*dynamodb.AttributeValue, len(values))
+	for i, value := range values {
+		list[i] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+	return list
+}
+
+func GetBookingByID(bookingID string, svc *dynamodb.DynamoDB) (*Booking, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("Bookings"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(bookingID),
+			},
+		},
+	}
+
+	result, err := svc.GetItem(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, errors.New("Booking not found")
+	}
+
+	booking := &Booking{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, booking); err != nil {
+		return nil, err
+	}
+
+	for i, segment := range booking.Segments {
+		if segment.FlightID == "" {
+			continue
+		}
+		flight, err := GetFlightByID(segment.FlightID, svc)
+		if err != nil {
+			return nil, err
+		}
+		booking.Segments[i].FlightStatus = flight.currentStatus()
+		booking.Segments[i].DepartureGate = flight.DepartureGate
+		booking.Segments[i].ArrivalGate = flight.ArrivalGate
+	}
+
+	return booking, nil
+}
+
+func createBookingsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("Bookings"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Bookings table created successfully")
+	return nil
+}
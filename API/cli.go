@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// runCommand runs an administrative command from the command line instead of
+// starting the Lambda handler, e.g. `main repair-seats -dry-run`.
+func runCommand(args []string, svc *dynamodb.DynamoDB) error {
+	switch args[0] {
+	case "repair-seats":
+		flags := flag.NewFlagSet("repair-seats", flag.ExitOnError)
+		flightNumber := flags.String("flight", "", "only repair seats of this FlightNumber")
+		dryRun := flags.Bool("dry-run", false, "report duplicates without changing anything")
+		flags.Parse(args[1:])
+
+		report, err := RepairDuplicateSeats(*flightNumber, *dryRun, svc)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	case "import-seats":
+		flags := flag.NewFlagSet("import-seats", flag.ExitOnError)
+		flightNumber := flags.String("flight", "", "FlightNumber to import the seats into")
+		date := flags.String("date", "", "operating date (YYYY-MM-DD) of the flight")
+		origin := flags.String("origin", "", "origin airport of the flight leg")
+		file := flags.String("file", "", "path of the seat CSV file")
+		dryRun := flags.Bool("dry-run", false, "validate the file without creating seats")
+		actor := flags.String("actor", "", "who is importing, recorded on blocked seats")
+		flags.Parse(args[1:])
+
+		if *flightNumber == "" || *file == "" {
+			return errors.New("-flight and -file are required")
+		}
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		flight, err := ResolveFlight(*flightNumber, *date, *origin, svc)
+		if err != nil {
+			return err
+		}
+		report, err := ImportSeatsCSV(flight, f, *dryRun, *actor, svc)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		if len(report.Errors) > 0 {
+			return fmt.Errorf("%d lines failed validation, nothing was imported", len(report.Errors))
+		}
+		return nil
+	case "import-airports":
+		flags := flag.NewFlagSet("import-airports", flag.ExitOnError)
+		file := flags.String("file", "", "path of the airports CSV file in the OurAirports layout")
+		dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+		flags.Parse(args[1:])
+
+		if *file == "" {
+			return errors.New("-file is required")
+		}
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		report, err := ImportAirportsCSV(f, *dryRun, svc)
+		if report != nil {
+			if err := printJSON(report); err != nil {
+				return err
+			}
+		}
+		return err
+	case "migrate-flight-times":
+		migrated, err := MigrateFlightTimes(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migrated FlightTime of %d flights to FlightTimeNs\n", migrated)
+		return nil
+	case "release-expired-blocks":
+		released, err := ReleaseDueBlocks(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Released %d expired seat blocks\n", released)
+		return nil
+	case "resume-schedule-changes":
+		resumed, err := ResumeScheduleChanges(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Resumed %d schedule changes\n", resumed)
+		return nil
+	case "import-mct":
+		flags := flag.NewFlagSet("import-mct", flag.ExitOnError)
+		file := flags.String("file", "", "path of the minimum connection time CSV file")
+		dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+		flags.Parse(args[1:])
+
+		if *file == "" {
+			return errors.New("-file is required")
+		}
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		report, err := ImportMCTCSV(f, *dryRun, svc)
+		if report != nil {
+			if err := printJSON(report); err != nil {
+				return err
+			}
+		}
+		return err
+	case "index-airports":
+		indexed, err := ReindexAirports(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Indexed %d airports for search\n", indexed)
+		return nil
+	case "export-seats":
+		flags := flag.NewFlagSet("export-seats", flag.ExitOnError)
+		flightNumber := flags.String("flight", "", "FlightNumber to export the seats of")
+		date := flags.String("date", "", "operating date (YYYY-MM-DD) of the flight")
+		origin := flags.String("origin", "", "origin airport of the flight leg")
+		flags.Parse(args[1:])
+
+		if *flightNumber == "" {
+			return errors.New("-flight is required")
+		}
+		flight, err := ResolveFlight(*flightNumber, *date, *origin, svc)
+		if err != nil {
+			return err
+		}
+		return ExportSeatsCSV(flight, os.Stdout, svc)
+	case "backfill-flight-routes":
+		updated, err := BackfillFlightRoutes(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backfilled route keys on %d flights\n", updated)
+		return nil
+	case "generate-schedules":
+		flags := flag.NewFlagSet("generate-schedules", flag.ExitOnError)
+		days := flags.Int("days", defaultScheduleHorizon, "number of days ahead to generate flights for")
+		scheduleID := flags.String("schedule", "", "only generate flights of this schedule")
+		flags.Parse(args[1:])
+
+		if *scheduleID != "" {
+			report, err := GenerateScheduleFlights(*scheduleID, *days, svc)
+			if err != nil {
+				return err
+			}
+			return printJSON(report)
+		}
+		reports, err := GenerateAllScheduleFlights(*days, svc)
+		if err != nil {
+			return err
+		}
+		return printJSON(reports)
+	case "import-ssim":
+		flags := flag.NewFlagSet("import-ssim", flag.ExitOnError)
+		file := flags.String("file", "", "path of the SSIM Chapter 7 file")
+		dryRun := flags.Bool("dry-run", false, "validate and diff the file without storing schedules")
+		days := flags.Int("days", defaultScheduleHorizon, "days ahead to generate flights for, 0 to only store schedules")
+		flags.Parse(args[1:])
+
+		if *file == "" {
+			return errors.New("-file is required")
+		}
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		report, err := ImportSSIM(f, *dryRun, *days, svc)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		if len(report.Errors) > 0 {
+			return fmt.Errorf("%d records failed validation, nothing was imported", len(report.Errors))
+		}
+		return nil
+	case "recompute-flight-arrivals":
+		updated, err := RecomputeFlightArrivals(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Recomputed arrival times of %d flights\n", updated)
+		return nil
+	case "backfill-flight-airlines":
+		updated, unmatched, err := BackfillFlightAirlines(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Linked %d flights to their airline, %d flights matched no airline\n", updated, unmatched)
+		return nil
+	case "backfill-flight-distances":
+		updated, unknown, err := BackfillFlightDistances(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Set the distance of %d flights, %d flights have an airport without coordinates\n", updated, unknown)
+		return nil
+	case "backfill-routes":
+		created, err := BackfillRoutes(svc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %d active routes from existing flights\n", created)
+		return nil
+	case "reaccommodate-flight":
+		flags := flag.NewFlagSet("reaccommodate-flight", flag.ExitOnError)
+		flightID := flags.String("flight", "", "ID of the cancelled flight")
+		window := flags.Int("window", 0, "hours around the departure to search, 0 for the default")
+		actor := flags.String("actor", "cli", "who is re-accommodating")
+		flags.Parse(args[1:])
+
+		if *flightID == "" {
+			return errors.New("-flight is required")
+		}
+		report, err := ReaccommodateFlight(*flightID, *window, *actor, svc)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	case "backfill-flight-keys":
+		report, err := BackfillFlightKeys(svc)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	case "backfill-airline-designators":
+		report, err := BackfillAirlineDesignators(svc)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	default:
+		return fmt.Errorf("Unknown command %q", args[0])
+	}
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// A codeshare flight is operated by the airline of its FlightNumber and sold
+// by other airlines under their own marketing flight numbers. Every marketing
+// number holds a FlightKey like the operating one, so no two flights share a
+// number on the same date and origin, and the MarketingFlights table finds the
+// flights a marketing number is sold on. All numbers share the seats of the
+// operating flight.
+
+// MarketingFlight is a flight number under which an airline sells a flight
+// operated by another airline.
+type MarketingFlight struct {
+	AirlineID    string `json:"airlineID"`
+	FlightNumber string `json:"flightNumber"`
+}
+
+// hasNumber reports whether a flight operates or is sold under flightNumber.
+func (flight *Flight) hasNumber(flightNumber string) bool {
+	if flight.FlightNumber == flightNumber {
+		return true
+	}
+	for _, marketing := range flight.MarketingFlights {
+		if marketing.FlightNumber == flightNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// numberFor returns the flight number an airline uses for a flight, or "".
+func (flight *Flight) numberFor(airlineID string) string {
+	if flight.AirlineID == airlineID {
+		return flight.FlightNumber
+	}
+	for _, marketing := range flight.MarketingFlights {
+		if marketing.AirlineID == airlineID {
+			return marketing.FlightNumber
+		}
+	}
+	return ""
+}
+
+// airlineOf returns the airline using flightNumber for a flight, or "".
+func (flight *Flight) airlineOf(flightNumber string) string {
+	if flight.FlightNumber == flightNumber {
+		return flight.AirlineID
+	}
+	for _, marketing := range flight.MarketingFlights {
+		if marketing.FlightNumber == flightNumber {
+			return marketing.AirlineID
+		}
+	}
+	return ""
+}
+
+// validateMarketingFlight checks that a marketing number belongs to an active
+// airline other than the operating one and is not already used on the flight.
+func validateMarketingFlight(flight *Flight, marketing *MarketingFlight, svc *dynamodb.DynamoDB) error {
+	marketing.FlightNumber = strings.ToUpper(strings.TrimSpace(marketing.FlightNumber))
+	if marketing.AirlineID == "" || marketing.FlightNumber == "" {
+		return errors.New("A marketing flight needs an AirlineID and a FlightNumber")
+	}
+	if marketing.AirlineID == flight.AirlineID {
+		return errors.New("The operating airline cannot market its own flight")
+	}
+	airline, err := GetAirlineByID(marketing.AirlineID, svc)
+	if err != nil {
+		return err
+	}
+	if err := ValidateFlightNumber(marketing.FlightNumber, airline.Code); err != nil {
+		return err
+	}
+	if !airline.isActive() {
+		return fmt.Errorf("Airline %s is not active", airline.Code)
+	}
+	if flight.hasNumber(marketing.FlightNumber) {
+		return fmt.Errorf("Flight already has number %s", marketing.FlightNumber)
+	}
+	if flight.numberFor(marketing.AirlineID) != "" {
+		return fmt.Errorf("Airline %s already markets the flight", airline.Code)
+	}
+	return nil
+}
+
+// validateMarketingFlights checks the marketing numbers of a new flight.
+func validateMarketingFlights(flight *Flight, svc *dynamodb.DynamoDB) error {
+	marketingFlights := flight.MarketingFlights
+	flight.MarketingFlights = nil
+	for i := range marketingFlights {
+		if err := validateMarketingFlight(flight, &marketingFlights[i], svc); err != nil {
+			flight.MarketingFlights = marketingFlights
+			return err
+		}
+		flight.MarketingFlights = append(flight.MarketingFlights, marketingFlights[i])
+	}
+	return nil
+}
+
+// marketingFlightWrites reserves the FlightKey of a marketing number and
+// records it in the MarketingFlights table.
+func marketingFlightWrites(flight *Flight, marketing MarketingFlight) []*dynamodb.TransactWriteItem {
+	key := flightKeyPut(flight)
+	key.Item["FlightKey"] = &dynamodb.AttributeValue{S: aws.String(flightKey(marketing.FlightNumber, flight.operatingDate(), flight.OriginAirport))}
+	return []*dynamodb.TransactWriteItem{
+		{Put: key},
+		{Put: &dynamodb.Put{
+			TableName: aws.String("MarketingFlights"),
+			Item: map[string]*dynamodb.AttributeValue{
+				"FlightNumber": {
+					S: aws.String(marketing.FlightNumber),
+				},
+				"FlightID": {
+					S: aws.String(flight.ID),
+				},
+				"AirlineID": {
+					S: aws.String(marketing.AirlineID),
+				},
+			},
+		}},
+	}
+}
+
+func marketingFlightDeletes(flight *Flight, marketing MarketingFlight) []*dynamodb.TransactWriteItem {
+	return []*dynamodb.TransactWriteItem{
+		{Delete: &dynamodb.Delete{
+			TableName: aws.String("FlightKeys"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"FlightKey": {
+					S: aws.String(flightKey(marketing.FlightNumber, flight.operatingDate(), flight.OriginAirport)),
+				},
+			},
+		}},
+		{Delete: &dynamodb.Delete{
+			TableName: aws.String("MarketingFlights"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"FlightNumber": {
+					S: aws.String(marketing.FlightNumber),
+				},
+				"FlightID": {
+					S: aws.String(flight.ID),
+				},
+			},
+		}},
+	}
+}
+
+// ensureMarketingFlightsTable creates the MarketingFlights table on first use.
+func ensureMarketingFlightsTable(svc *dynamodb.DynamoDB) {
+	if !doesTableExist("MarketingFlights", svc) {
+		if err := createMarketingFlightsTable(svc); err != nil {
+			fmt.Printf("Error creating MarketingFlights table: %v\n", err)
+		}
+	}
+}
+
+// AddMarketingFlight sells a flight under another airline's flight number.
+func AddMarketingFlight(flightID string, marketing MarketingFlight, svc *dynamodb.DynamoDB) (*Flight, error) {
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMarketingFlight(flight, &marketing, svc); err != nil {
+		return nil, err
+	}
+	ensureMarketingFlightsTable(svc)
+
+	value, err := dynamodbattribute.Marshal([]MarketingFlight{marketing})
+	if err != nil {
+		return nil, err
+	}
+	writes := []*dynamodb.TransactWriteItem{{Update: &dynamodb.Update{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String("SET MarketingFlights = list_append(if_not_exists(MarketingFlights, :empty), :marketing)"),
+		ConditionExpression: aws.String("attribute_exists(ID) AND (OperatingDate = :operatingDate OR attribute_not_exists(OperatingDate))"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":empty":         {L: []*dynamodb.AttributeValue{}},
+			":marketing":     value,
+			":operatingDate": {S: aws.String(flight.operatingDate())},
+		},
+	}}}
+	writes = append(writes, marketingFlightWrites(flight, marketing)...)
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	if err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			reasons := canceled.CancellationReasons
+			if len(reasons) > 1 && reasons[1].Code != nil && *reasons[1].Code == "ConditionalCheckFailed" {
+				return nil, fmt.Errorf("%w: %s operates on %s from %s", errFlightExists, marketing.FlightNumber, flight.operatingDate(), flight.OriginAirport)
+			}
+			return nil, errors.New("Flight was changed concurrently, please retry")
+		}
+		return nil, err
+	}
+
+	fmt.Printf("Flight %s is sold as %s\n", flight.FlightNumber, marketing.FlightNumber)
+	flight.MarketingFlights = append(flight.MarketingFlights, marketing)
+	return flight, nil
+}
+
+// RemoveMarketingFlight stops selling a flight under a marketing number.
+// Bookings already sold under it keep it as their SoldAs number.
+func RemoveMarketingFlight(flightID, flightNumber string, svc *dynamodb.DynamoDB) (*Flight, error) {
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, marketing := range flight.MarketingFlights {
+		if marketing.FlightNumber == flightNumber {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("Flight is not sold as %s", flightNumber)
+	}
+	marketing := flight.MarketingFlights[index]
+
+	writes := []*dynamodb.TransactWriteItem{{Update: &dynamodb.Update{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String(fmt.Sprintf("REMOVE MarketingFlights[%d]", index)),
+		ConditionExpression: aws.String(fmt.Sprintf("MarketingFlights[%d].flightNumber = :flightNumber AND (OperatingDate = :operatingDate OR attribute_not_exists(OperatingDate))", index)),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":flightNumber":  {S: aws.String(flightNumber)},
+			":operatingDate": {S: aws.String(flight.operatingDate())},
+		},
+	}}}
+	writes = append(writes, marketingFlightDeletes(flight, marketing)...)
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	if err != nil {
+		if _, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			return nil, errors.New("Flight was changed concurrently, please retry")
+		}
+		return nil, err
+	}
+
+	fmt.Printf("Flight %s is no longer sold as %s\n", flight.FlightNumber, flightNumber)
+	flight.MarketingFlights = append(flight.MarketingFlights[:index], flight.MarketingFlights[index+1:]...)
+	return flight, nil
+}
+
+// getMarketedFlights returns the flights sold under a marketing number.
+func getMarketedFlights(flightNumber string, svc *dynamodb.DynamoDB) ([]*Flight, error) {
+	if !doesTableExist("MarketingFlights", svc) {
+		return nil, nil
+	}
+	flights := []*Flight{}
+	var flightErr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("MarketingFlights"),
+		KeyConditionExpression: aws.String("FlightNumber = :flightNumber"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":flightNumber": {
+				S: aws.String(flightNumber),
+			},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight *Flight
+			if flight, flightErr = GetFlightByID(aws.StringValue(item["FlightID"].S), svc); flightErr != nil {
+				return false
+			}
+			flights = append(flights, flight)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flights, flightErr
+}
+
+// PassengerListEntry is one booked seat of a flight.
+type PassengerListEntry struct {
+	BookingID     string `json:"bookingID"`
+	PassengerName string `json:"passengerName"`
+	SeatID        string `json:"seatID"`
+	Row           int    `json:"row"`
+	Col           int    `json:"col"`
+	// SoldAs is the flight number the booking was sold under.
+	SoldAs string `json:"soldAs"`
+}
+
+// PassengerList lists the passengers of a flight under its operating carrier,
+// whichever numbers they were sold under.
+type PassengerList struct {
+	FlightID               string               `json:"flightID"`
+	FlightNumber           string               `json:"flightNumber"`
+	OperatingCarrier       *Airline             `json:"operatingCarrier"`
+	MarketingFlightNumbers []string             `json:"marketingFlightNumbers"`
+	OperatingDate          string               `json:"operatingDate"`
+	OriginAirport          string               `json:"originAirport"`
+	DestinationAirport     string               `json:"destinationAirport"`
+	DepartureGate          *GateAssignment      `json:"departureGate,omitempty"`
+	ArrivalGate            *GateAssignment      `json:"arrivalGate,omitempty"`
+	Passengers             []PassengerListEntry `json:"passengers"`
+}
+
+func GetPassengerList(flightID string, svc *dynamodb.DynamoDB) (*PassengerList, error) {
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	carrier, err := GetAirlineByID(flight.AirlineID, svc)
+	if err != nil {
+		return nil, fmt.Errorf("Operating airline of flight %s: %v", flight.FlightNumber, err)
+	}
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &PassengerList{
+		FlightID:               flight.ID,
+		FlightNumber:           flight.FlightNumber,
+		OperatingCarrier:       carrier,
+		MarketingFlightNumbers: []string{},
+		OperatingDate:          flight.operatingDate(),
+		OriginAirport:          flight.OriginAirport,
+		DestinationAirport:     flight.DestinationAirport,
+		DepartureGate:          flight.DepartureGate,
+		ArrivalGate:            flight.ArrivalGate,
+		Passengers:             []PassengerListEntry{},
+	}
+	for _, marketing := range flight.MarketingFlights {
+		list.MarketingFlightNumbers = append(list.MarketingFlightNumbers, marketing.FlightNumber)
+	}
+
+	bookings := map[string]*Booking{}
+	for _, seat := range seats {
+		if !seat.IsBooked || seat.BookingID == "" {
+			continue
+		}
+		booking, ok := bookings[seat.BookingID]
+		if !ok {
+			if booking, err = GetBookingByID(seat.BookingID, svc); err != nil {
+				return nil, err
+			}
+			bookings[seat.BookingID] = booking
+		}
+		for _, segment := range booking.Segments {
+			if segment.FlightID != flight.ID {
+				continue
+			}
+			for i, ref := range segment.Seats {
+				if ref.ID != seat.ID || i >= len(booking.PassengerNames) {
+					continue
+				}
+				soldAs := segment.SoldAs
+				if soldAs == "" {
+					soldAs = flight.FlightNumber
+				}
+				list.Passengers = append(list.Passengers, PassengerListEntry{
+					BookingID:     booking.ID,
+					PassengerName: booking.PassengerNames[i],
+					SeatID:        seat.ID,
+					Row:           seat.Row,
+					Col:           seat.Col,
+					SoldAs:        soldAs,
+				})
+			}
+		}
+	}
+
+	sort.Slice(list.Passengers, func(i, j int) bool {
+		if list.Passengers[i].Row != list.Passengers[j].Row {
+			return list.Passengers[i].Row < list.Passengers[j].Row
+		}
+		return list.Passengers[i].Col < list.Passengers[j].Col
+	})
+	return list, nil
+}
+
+func createMarketingFlightsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("MarketingFlights"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("FlightNumber"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("FlightID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("FlightNumber"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("FlightID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("MarketingFlights table created successfully")
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	// earthRadiusKm is the mean radius of the Earth.
+	earthRadiusKm     = 6371.0088
+	kmPerNauticalMile = 1.852
+
+	defaultCruiseSpeedKmh = 780
+	defaultTaxiMinutes    = 30
+	// Estimated block times are rounded up to a multiple of blockTimeStep.
+	blockTimeStep = 5 * time.Minute
+)
+
+// BlockTimeSettings estimate the block time of a flight from its distance: the
+// time in the air at CruiseSpeedKmh plus a fixed Taxi allowance for both ends.
+// They come from BLOCK_TIME_CRUISE_SPEED_KMH and BLOCK_TIME_TAXI_MINUTES.
+type BlockTimeSettings struct {
+	CruiseSpeedKmh int
+	Taxi           time.Duration
+}
+
+func blockTimeSettings() BlockTimeSettings {
+	settings := BlockTimeSettings{
+		CruiseSpeedKmh: intFromEnv("BLOCK_TIME_CRUISE_SPEED_KMH", defaultCruiseSpeedKmh),
+		Taxi:           durationFromEnv("BLOCK_TIME_TAXI_MINUTES", time.Minute, defaultTaxiMinutes),
+	}
+	if settings.CruiseSpeedKmh == 0 {
+		settings.CruiseSpeedKmh = defaultCruiseSpeedKmh
+	}
+	return settings
+}
+
+func (settings BlockTimeSettings) estimate(distanceKm float64) time.Duration {
+	airborne := time.Duration(distanceKm / float64(settings.CruiseSpeedKmh) * float64(time.Hour))
+	blockTime := settings.Taxi + airborne
+	if rest := blockTime % blockTimeStep; rest != 0 {
+		blockTime += blockTimeStep - rest
+	}
+	return blockTime
+}
+
+// haversineKm returns the great-circle distance between two points given in degrees.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// airportDistanceKm returns the distance between two airports rounded to
+// 0.1 km. It is false when either airport has no coordinates.
+func airportDistanceKm(origin, destination *Airport) (float64, bool) {
+	if origin.Latitude == nil || origin.Longitude == nil || destination.Latitude == nil || destination.Longitude == nil {
+		return 0, false
+	}
+	distance := haversineKm(*origin.Latitude, *origin.Longitude, *destination.Latitude, *destination.Longitude)
+	return roundDistance(distance), true
+}
+
+func roundDistance(distance float64) float64 {
+	return math.Round(distance*10) / 10
+}
+
+// flightDistanceKm returns the distance between two stored airports, or 0
+// when either has no coordinates.
+func flightDistanceKm(originCode, destinationCode string, svc *dynamodb.DynamoDB) (float64, error) {
+	origin, err := GetAirportByCode(originCode, svc)
+	if err != nil {
+		return 0, err
+	}
+	destination, err := GetAirportByCode(destinationCode, svc)
+	if err != nil {
+		return 0, err
+	}
+	distance, _ := airportDistanceKm(origin, destination)
+	return distance, nil
+}
+
+// RouteInfo describes the great-circle route between two airports.
+type RouteInfo struct {
+	OriginAirport      string  `json:"originAirport"`
+	DestinationAirport string  `json:"destinationAirport"`
+	DistanceKm         float64 `json:"distanceKm"`
+	DistanceNM         float64 `json:"distanceNM"`
+	// EstimatedBlockMinutes is the block time CreateFlight uses when
+	// FlightTime is omitted.
+	EstimatedBlockMinutes int `json:"estimatedBlockMinutes"`
+	CruiseSpeedKmh        int `json:"cruiseSpeedKmh"`
+	TaxiMinutes           int `json:"taxiMinutes"`
+}
+
+func GetRouteInfo(originCode, destinationCode string, svc *dynamodb.DynamoDB) (*RouteInfo, error) {
+	origin, err := GetAirportByCode(originCode, svc)
+	if err != nil {
+		return nil, errors.New("OriginAirport does not exist")
+	}
+	destination, err := GetAirportByCode(destinationCode, svc)
+	if err != nil {
+		return nil, errors.New("DestinationAirport does not exist")
+	}
+	distance, ok := airportDistanceKm(origin, destination)
+	if !ok {
+		return nil, errors.New("OriginAirport or DestinationAirport has no coordinates")
+	}
+
+	settings := blockTimeSettings()
+	return &RouteInfo{
+		OriginAirport:         origin.Code,
+		DestinationAirport:    destination.Code,
+		DistanceKm:            distance,
+		DistanceNM:            roundDistance(distance / kmPerNauticalMile),
+		EstimatedBlockMinutes: int(settings.estimate(distance).Minutes()),
+		CruiseSpeedKmh:        settings.CruiseSpeedKmh,
+		TaxiMinutes:           int(settings.Taxi.Minutes()),
+	}, nil
+}
+
+// BackfillFlightDistances sets DistanceKm on flights stored before distances
+// existed. It returns how many flights were updated and how many have an
+// airport without coordinates; run it again once those airports are complete.
+func BackfillFlightDistances(svc *dynamodb.DynamoDB) (int, int, error) {
+	airports := map[string]*Airport{}
+	airport := func(code string) (*Airport, error) {
+		if cached, ok := airports[code]; ok {
+			return cached, nil
+		}
+		loaded, err := GetAirportByCode(code, svc)
+		if err != nil {
+			return nil, fmt.Errorf("Airport %s: %v", code, err)
+		}
+		airports[code] = loaded
+		return loaded, nil
+	}
+
+	updated, unknown := 0, 0
+	var updateErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("Flights"),
+		FilterExpression: aws.String("attribute_not_exists(DistanceKm)"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if updateErr = dynamodbattribute.UnmarshalMap(item, &flight); updateErr != nil {
+				return false
+			}
+			var origin, destination *Airport
+			if origin, updateErr = airport(flight.OriginAirport); updateErr != nil {
+				return false
+			}
+			if destination, updateErr = airport(flight.DestinationAirport); updateErr != nil {
+				return false
+			}
+			distance, ok := airportDistanceKm(origin, destination)
+			if !ok {
+				unknown++
+				continue
+			}
+
+			_, updateErr = svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String("Flights"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID":            item["ID"],
+					"OriginAirport": item["OriginAirport"],
+				},
+				UpdateExpression: aws.String("SET DistanceKm = :distance"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":distance": {
+						N: aws.String(strconv.FormatFloat(distance, 'f', -1, 64)),
+					},
+				},
+			})
+			if updateErr != nil {
+				return false
+			}
+			updated++
+		}
+		return true
+	})
+	if err != nil {
+		return updated, unknown, err
+	}
+	return updated, unknown, updateErr
+}
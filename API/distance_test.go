@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{name: "same point", lat1: 52.3086, lon1: 4.7639, lat2: 52.3086, lon2: 4.7639, want: 0},
+		{name: "one degree of the equator", lat1: 0, lon1: 0, lat2: 0, lon2: 1, want: 111.2},
+		{name: "AMS to LHR", lat1: 52.3086, lon1: 4.7639, lat2: 51.4706, lon2: -0.4619, want: 370.4},
+		{name: "JFK to LHR", lat1: 40.6398, lon1: -73.7789, lat2: 51.4706, lon2: -0.4619, want: 5539.7},
+		{name: "across the antimeridian", lat1: -33.9461, lon1: 151.1772, lat2: 51.4706, lon2: -0.4619, want: 17020.7},
+		{name: "antipodes", lat1: 0, lon1: 0, lat2: 0, lon2: 180, want: 20015.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roundDistance(haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)); got != tt.want {
+				t.Errorf("haversineKm() = %v, want %v", got, tt.want)
+			}
+			if got := roundDistance(haversineKm(tt.lat2, tt.lon2, tt.lat1, tt.lon1)); got != tt.want {
+				t.Errorf("haversineKm() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAirportDistanceKm(t *testing.T) {
+	coordinate := func(value float64) *float64 { return &value }
+	ams := &Airport{Code: "AMS", Latitude: coordinate(52.3086), Longitude: coordinate(4.7639)}
+	lhr := &Airport{Code: "LHR", Latitude: coordinate(51.4706), Longitude: coordinate(-0.4619)}
+	unknown := &Airport{Code: "XXX", Latitude: coordinate(51.4706)}
+
+	tests := []struct {
+		name                string
+		origin, destination *Airport
+		want                float64
+		wantOK              bool
+	}{
+		{name: "both known", origin: ams, destination: lhr, want: 370.4, wantOK: true},
+		{name: "origin without coordinates", origin: unknown, destination: lhr},
+		{name: "destination without coordinates", origin: ams, destination: unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := airportDistanceKm(tt.origin, tt.destination)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("airportDistanceKm() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBlockTimeEstimate(t *testing.T) {
+	defaults := BlockTimeSettings{CruiseSpeedKmh: defaultCruiseSpeedKmh, Taxi: defaultTaxiMinutes * time.Minute}
+
+	tests := []struct {
+		name       string
+		settings   BlockTimeSettings
+		distanceKm float64
+		want       time.Duration
+	}{
+		{name: "no distance is taxi only", settings: defaults, distanceKm: 0, want: 30 * time.Minute},
+		{name: "exact step", settings: defaults, distanceKm: 780, want: 90 * time.Minute},
+		{name: "rounded up to the next step", settings: defaults, distanceKm: 370.4, want: 60 * time.Minute},
+		{name: "just over a step", settings: defaults, distanceKm: 793, want: 95 * time.Minute},
+		{name: "long haul", settings: defaults, distanceKm: 5539.7, want: 7*time.Hour + 40*time.Minute},
+		{name: "custom speed and taxi", settings: BlockTimeSettings{CruiseSpeedKmh: 900, Taxi: 15 * time.Minute}, distanceKm: 450, want: 45 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.estimate(tt.distanceKm); got != tt.want {
+				t.Errorf("estimate(%v) = %v, want %v", tt.distanceKm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockTimeSettingsFromEnv(t *testing.T) {
+	t.Setenv("BLOCK_TIME_CRUISE_SPEED_KMH", "0")
+	t.Setenv("BLOCK_TIME_TAXI_MINUTES", "20")
+
+	got := blockTimeSettings()
+	want := BlockTimeSettings{CruiseSpeedKmh: defaultCruiseSpeedKmh, Taxi: 20 * time.Minute}
+	if got != want {
+		t.Errorf("blockTimeSettings() = %+v, want %+v", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,37 +15,121 @@ import (
 type Flight struct {
 	ID                 string        `json:"id"`
 	FlightNumber       string        `json:"flightNumber"`
-	FlightSectionID    []string      `json:flightSectionID`
+	AirlineID          string        `json:"airlineID"`
+	FlightSectionID    []string      `json:"FlightSectionID"`
 	OriginAirport      string        `json:"originAirport"`
 	DestinationAirport string        `json:"destinationAirport"`
 	DepartureDate      time.Time     `json:"departureDate"`
-	FlightTime         time.Duration `json:"flightTime"`
+	FlightTime         time.Duration `json:"flightTime" dynamodbav:"FlightTimeNs"` // Stored in nanoseconds, see MigrateFlightTimes
 	ETA                string        `json:"eta"`
+	// MarketingFlights are the numbers other airlines sell the flight under,
+	// see codeshare.go.
+	MarketingFlights []MarketingFlight `json:"marketingFlights,omitempty"`
+	// DistanceKm is the great-circle distance between the airports, 0 when
+	// either has no coordinates. CreateFlight estimates an omitted FlightTime
+	// from it, see BlockTimeSettings.
+	DistanceKm float64 `json:"distanceKm,omitempty"`
+	// ArrivalUTC is the arrival instant. DepartureLocal and ArrivalLocal are
+	// RFC3339 times in the origin's and destination's time zone, so they
+	// carry each airport's UTC offset on that date.
+	ArrivalUTC     time.Time `json:"arrivalUTC"`
+	DepartureLocal string    `json:"departureLocal"`
+	ArrivalLocal   string    `json:"arrivalLocal"`
+	// ScheduleID is set on flights generated from a Schedule.
+	ScheduleID string `json:"scheduleID,omitempty"`
+	// OperatingDate is the departure date in the origin's time zone. Together
+	// with FlightNumber and OriginAirport it identifies the flight.
+	OperatingDate string `json:"operatingDate"`
+	// Status follows the lifecycle in flightstatus.go.
+	Status             string               `json:"status"`
+	EstimatedDeparture *time.Time           `json:"estimatedDeparture,omitempty"`
+	EstimatedArrival   *time.Time           `json:"estimatedArrival,omitempty"`
+	ActualDeparture    *time.Time           `json:"actualDeparture,omitempty"`
+	ActualArrival      *time.Time           `json:"actualArrival,omitempty"`
+	DivertedTo         string               `json:"divertedTo,omitempty"`
+	StatusHistory      []FlightStatusChange `json:"statusHistory,omitempty"`
+	// DepartureGate and ArrivalGate are the gates assigned at the origin and
+	// destination, see gate.go.
+	DepartureGate *GateAssignment `json:"departureGate,omitempty"`
+	ArrivalGate   *GateAssignment `json:"arrivalGate,omitempty"`
+	GateHistory   []GateChange    `json:"gateHistory,omitempty"`
 }
 
 func CreateFlight(flight Flight, svc *dynamodb.DynamoDB) error {
+	_, err := createFlight(flight, svc)
+	return err
+}
+
+// createFlight validates and stores a flight, returning it with its generated ID.
+func createFlight(flight Flight, svc *dynamodb.DynamoDB) (*Flight, error) {
 	// Validate the flight data as needed.
 	if err := validateFlightData(flight); err != nil {
-		return err
+		return nil, err
 	}
 	if !doesTableExist("Flights", svc) {
 		if err := createFlightsTable(svc); err != nil {
 			fmt.Printf("Error creating Flights table: %v\n", err)
 		}
 	}
+	// Check that the flight number belongs to the operating airline.
+	airline, err := GetAirlineByID(flight.AirlineID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFlightNumber(flight.FlightNumber, airline.Code); err != nil {
+		return nil, err
+	}
+	if !airline.isActive() {
+		return nil, fmt.Errorf("Airline %s is not active", airline.Code)
+	}
+	if err := validateMarketingFlights(&flight, svc); err != nil {
+		return nil, err
+	}
 	// Check if OriginAirport and DestinationAirport exist.
-	if !doesAirportExist(flight.OriginAirport, svc) {
-		return errors.New("OriginAirport does not exist")
+	originAirport, err := GetAirportByCode(flight.OriginAirport, svc)
+	if err != nil {
+		return nil, errors.New("OriginAirport does not exist")
+	}
+	destinationAirport, err := GetAirportByCode(flight.DestinationAirport, svc)
+	if err != nil {
+		return nil, errors.New("DestinationAirport does not exist")
+	}
+	distance, ok := airportDistanceKm(originAirport, destinationAirport)
+	if ok {
+		flight.DistanceKm = distance
 	}
-	if !doesAirportExist(flight.DestinationAirport, svc) {
-		return errors.New("DestinationAirport does not exist")
+	if flight.FlightTime == 0 {
+		if !ok {
+			return nil, errors.New("FlightTime is required because OriginAirport or DestinationAirport has no coordinates")
+		}
+		flight.FlightTime = blockTimeSettings().estimate(distance)
+	}
+	origin, err := airportLocation(flight.OriginAirport, svc)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := airportLocation(flight.DestinationAirport, svc)
+	if err != nil {
+		return nil, err
+	}
+	setFlightLocalTimes(&flight, flight.FlightTime, origin, destination)
+	flight.OperatingDate = flight.DepartureDate.In(origin).Format("2006-01-02")
+	// The airline must be approved to operate the route on the day.
+	if _, err := activeRoute(flight.AirlineID, flight.OriginAirport, flight.DestinationAirport, flight.OperatingDate, svc); err != nil {
+		return nil, err
 	}
 	// Check if FlightSectionIDs exist.
 	if !doFlightSectionsExist(flight.FlightSectionID, svc) {
-		return errors.New("One or more flightsection values do not exist")
+		return nil, errors.New("One or more flightsection values do not exist")
+	}
+
+	if !doesTableExist("FlightKeys", svc) {
+		if err := createFlightKeysTable(svc); err != nil {
+			fmt.Printf("Error creating FlightKeys table: %v\n", err)
+		}
 	}
 
-	flightID := uuid.New().String()
+	flight.ID = uuid.New().String()
 	// Convert the list of FlightSectionID strings to a list of DynamoDB attribute values.
 	flightSectionIDs := make([]*string, len(flight.FlightSectionID))
 	for i, id := range flight.FlightSectionID {
@@ -52,15 +137,18 @@ func CreateFlight(flight Flight, svc *dynamodb.DynamoDB) error {
 	}
 
 	// Create a new flight item in DynamoDB.
-	putInput := &dynamodb.PutItemInput{
+	put := &dynamodb.Put{
 		TableName: aws.String("Flights"),
 		Item: map[string]*dynamodb.AttributeValue{
 			"ID": {
-				S: aws.String(flightID),
+				S: aws.String(flight.ID),
 			},
 			"FlightNumber": {
 				S: aws.String(flight.FlightNumber),
 			},
+			"AirlineID": {
+				S: aws.String(flight.AirlineID),
+			},
 			"FlightSectionID": {
 				SS: flightSectionIDs,
 			},
@@ -73,21 +161,57 @@ func CreateFlight(flight Flight, svc *dynamodb.DynamoDB) error {
 			"DepartureDate": {
 				S: aws.String(flight.DepartureDate.Format(time.RFC3339)), // Store as a string
 			},
-			"FlightTime": {
-				N: aws.String(fmt.Sprintf("%d", flight.FlightTime.Milliseconds())), // Store as milliseconds
+			"FlightTimeNs": {
+				N: aws.String(fmt.Sprintf("%d", flight.FlightTime.Nanoseconds())),
 			},
 			"ETA": {
-				S: aws.String(CalculateETA(flight)),
+				S: aws.String(flight.ETA),
+			},
+			"ArrivalUTC": {
+				S: aws.String(flight.ArrivalUTC.Format(time.RFC3339)),
+			},
+			"DepartureLocal": {
+				S: aws.String(flight.DepartureLocal),
+			},
+			"ArrivalLocal": {
+				S: aws.String(flight.ArrivalLocal),
+			},
+			"Route": {
+				S: aws.String(flightRoute(flight.OriginAirport, flight.DestinationAirport)),
+			},
+			"DepartureUTC": {
+				S: aws.String(flight.DepartureDate.UTC().Format(time.RFC3339)),
+			},
+			"OperatingDate": {
+				S: aws.String(flight.OperatingDate),
 			},
 		},
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
 	}
-	_, err := svc.PutItem(putInput)
-	if err != nil {
-		return err
+	flight.Status = FlightStatusScheduled
+	flight.StatusHistory = []FlightStatusChange{{Status: FlightStatusScheduled, ChangedAt: time.Now().UTC(), Reason: "Flight created"}}
+	put.Item["Status"] = &dynamodb.AttributeValue{S: aws.String(flight.Status)}
+	put.Item["StatusHistory"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{flightStatusChangeValue(flight.StatusHistory[0])}}
+	if len(flight.MarketingFlights) > 0 {
+		marketingFlights, err := dynamodbattribute.Marshal(flight.MarketingFlights)
+		if err != nil {
+			return nil, err
+		}
+		put.Item["MarketingFlights"] = marketingFlights
+		ensureMarketingFlightsTable(svc)
+	}
+	if flight.DistanceKm > 0 {
+		put.Item["DistanceKm"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(flight.DistanceKm, 'f', -1, 64))}
+	}
+	if flight.ScheduleID != "" {
+		put.Item["ScheduleID"] = &dynamodb.AttributeValue{S: aws.String(flight.ScheduleID)}
+	}
+	if err := writeFlight(&flight, put, svc); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Created Flight: ID=%s, FlightNumber=%s\n", flightID, flight.FlightNumber)
-	return nil
+	fmt.Printf("Created Flight: ID=%s, FlightNumber=%s, OperatingDate=%s\n", flight.ID, flight.FlightNumber, flight.OperatingDate)
+	return &flight, nil
 }
 
 func GetAllFlights(svc *dynamodb.DynamoDB) ([]Flight, error) {
@@ -116,6 +240,119 @@ func GetAllFlights(svc *dynamodb.DynamoDB) ([]Flight, error) {
 
 	return flights, nil
 }
+
+// GetFlightByFlightNumber returns the flight registered under the given
+// FlightNumber. It fails when the number operates on more than one date; use
+// ResolveFlight to pick a dated flight.
+func GetFlightByFlightNumber(flightNumber string, svc *dynamodb.DynamoDB) (*Flight, error) {
+	return ResolveFlight(flightNumber, "", "", svc)
+}
+
+func GetFlightByID(flightID string, svc *dynamodb.DynamoDB) (*Flight, error) {
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String("Flights"),
+		KeyConditionExpression: aws.String("#id = :id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("ID"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {
+				S: aws.String(flightID),
+			},
+		},
+	}
+
+	result, err := svc.Query(queryInput)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) == 0 {
+		return nil, errors.New("Flight not found")
+	}
+
+	flight := &Flight{}
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], flight); err != nil {
+		return nil, err
+	}
+
+	return flight, nil
+}
+
+// flightAirlineIndex lists the flights of an operating airline by departure time.
+func flightAirlineIndex() *dynamodb.GlobalSecondaryIndex {
+	return flightDepartureIndex("AirlineIndex", "AirlineID")
+}
+
+// GetFlightsByAirline returns the flights operated by an airline, ordered by departure.
+func GetFlightsByAirline(airlineID string, svc *dynamodb.DynamoDB) ([]Flight, error) {
+	return queryFlightDepartures(flightAirlineIndex(), airlineID, time.Unix(0, 0), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), svc)
+}
+
+// BackfillFlightAirlines sets AirlineID on flights created before flights
+// referenced an airline, matching the flight number against the airline
+// designators. It returns how many flights were linked and how many matched no airline.
+func BackfillFlightAirlines(svc *dynamodb.DynamoDB) (int, int, error) {
+	if err := ensureFlightSearchIndexes(svc); err != nil {
+		return 0, 0, err
+	}
+	airlines, err := GetAllAirlines(svc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	updated, unmatched := 0, 0
+	var updateErr error
+	err = svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("Flights"),
+		FilterExpression: aws.String("attribute_not_exists(AirlineID)"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if updateErr = dynamodbattribute.UnmarshalMap(item, &flight); updateErr != nil {
+				return false
+			}
+
+			// Prefer the longest designator, so "ABC1" goes to ABC rather than AB.
+			var match *Airline
+			for _, airline := range airlines {
+				if ValidateFlightNumber(flight.FlightNumber, airline.Code) == nil && (match == nil || len(airline.Code) > len(match.Code)) {
+					match = airline
+				}
+			}
+			if match == nil {
+				fmt.Printf("No airline matches flight %s (%s)\n", flight.ID, flight.FlightNumber)
+				unmatched++
+				continue
+			}
+
+			_, updateErr = svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String("Flights"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID":            item["ID"],
+					"OriginAirport": item["OriginAirport"],
+				},
+				UpdateExpression: aws.String("SET AirlineID = :airlineID"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":airlineID": {
+						S: aws.String(match.ID),
+					},
+				},
+			})
+			if updateErr != nil {
+				return false
+			}
+			updated++
+		}
+		return true
+	})
+	if err != nil {
+		return updated, unmatched, err
+	}
+
+	return updated, unmatched, updateErr
+}
+
 func GetFlightsByOriginAirport(originAirport string, svc *dynamodb.DynamoDB) ([]Flight, error) {
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String("Flights"),
@@ -193,11 +430,11 @@ func validateFlightData(flight Flight) error {
 		message string
 	}{
 		{flight.FlightNumber, "FlightNumber is required"},
+		{flight.AirlineID, "AirlineID is required"},
 		{flight.FlightSectionID, "FlightSectionID is required"},
 		{flight.OriginAirport, "OriginAirport is required"},
 		{flight.DestinationAirport, "DestinationAirport is required"},
 		{flight.DepartureDate, "DepartureDate is required and must be a valid date"},
-		{flight.FlightTime, "FlightTime must be greater than 0"},
 	}
 
 	for _, rule := range validationRules {
@@ -205,19 +442,157 @@ func validateFlightData(flight Flight) error {
 			return errors.New(rule.message)
 		}
 	}
+	// A FlightTime of 0 is estimated from the distance.
+	if flight.FlightTime < 0 {
+		return errors.New("FlightTime must not be negative")
+	}
 
 	return nil
 }
 
-// CalculateETA calculates the Estimated Time of Arrival (ETA) and returns it as a formatted string.
-func CalculateETA(flight Flight) string {
-	departureTime := flight.DepartureDate
-	arrivalTime := departureTime.Add(flight.FlightTime)
+// flightArrival returns the arrival instant of a flight.
+func flightArrival(flight Flight) time.Time {
+	return flight.DepartureDate.Add(flight.FlightTime)
+}
+
+// setFlightLocalTimes fills in the arrival instant and the local times of a
+// flight. The ETA is the local arrival time as RFC3339, so it keeps the date
+// and UTC offset of overnight and cross-zone flights. Arrival is computed on
+// the instant, so DST changes at either airport only affect how the times are
+// presented.
+func setFlightLocalTimes(flight *Flight, flightTime time.Duration, origin, destination *time.Location) {
+	arrival := flight.DepartureDate.Add(flightTime)
+	flight.ArrivalUTC = arrival.UTC()
+	flight.DepartureLocal = flight.DepartureDate.In(origin).Format(time.RFC3339)
+	flight.ArrivalLocal = arrival.In(destination).Format(time.RFC3339)
+	flight.ETA = flight.ArrivalLocal
+}
+
+// RecomputeFlightArrivals rewrites the ETA, arrival instant and local times
+// of every flight from its departure, flight time and the current airport
+// time zones. It is safe to run again, e.g. after an airport's zone changes.
+func RecomputeFlightArrivals(svc *dynamodb.DynamoDB) (int, error) {
+	locations := map[string]*time.Location{}
+	location := func(code string) (*time.Location, error) {
+		if loc, ok := locations[code]; ok {
+			return loc, nil
+		}
+		loc, err := airportLocation(code, svc)
+		if err != nil {
+			return nil, fmt.Errorf("Airport %s: %v", code, err)
+		}
+		locations[code] = loc
+		return loc, nil
+	}
+
+	updated := 0
+	var updateErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String("Flights"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if updateErr = dynamodbattribute.UnmarshalMap(item, &flight); updateErr != nil {
+				return false
+			}
+			origin, err := location(flight.OriginAirport)
+			if err != nil {
+				updateErr = err
+				return false
+			}
+			destination, err := location(flight.DestinationAirport)
+			if err != nil {
+				updateErr = err
+				return false
+			}
+			setFlightLocalTimes(&flight, flight.FlightTime, origin, destination)
+
+			_, updateErr = svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String("Flights"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID":            item["ID"],
+					"OriginAirport": item["OriginAirport"],
+				},
+				UpdateExpression: aws.String("SET ETA = :eta, ArrivalUTC = :arrivalUTC, DepartureLocal = :departureLocal, ArrivalLocal = :arrivalLocal"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":eta": {
+						S: aws.String(flight.ETA),
+					},
+					":arrivalUTC": {
+						S: aws.String(flight.ArrivalUTC.Format(time.RFC3339)),
+					},
+					":departureLocal": {
+						S: aws.String(flight.DepartureLocal),
+					},
+					":arrivalLocal": {
+						S: aws.String(flight.ArrivalLocal),
+					},
+				},
+			})
+			if updateErr != nil {
+				return false
+			}
+			updated++
+		}
+		return true
+	})
+	if err != nil {
+		return updated, err
+	}
 
-	// Format the ETA as "15:28" (HH:mm).
-	etaString := arrivalTime.Format("15:04")
+	return updated, updateErr
+}
 
-	return etaString
+// MigrateFlightTimes moves the FlightTime of flights stored in milliseconds
+// under FlightTime to nanoseconds under FlightTimeNs, which is the only
+// attribute flights are read from. It returns the number of flights migrated.
+func MigrateFlightTimes(svc *dynamodb.DynamoDB) (int, error) {
+	migrated := 0
+	var updateErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String("Flights"),
+		ProjectionExpression: aws.String("ID, OriginAirport, FlightTime"),
+		FilterExpression:     aws.String("attribute_exists(FlightTime)"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			stored := item["FlightTime"]
+			if stored.N == nil {
+				continue
+			}
+			milliseconds, err := strconv.ParseInt(*stored.N, 10, 64)
+			if err != nil {
+				updateErr = fmt.Errorf("Flight %s has an invalid FlightTime %s", aws.StringValue(item["ID"].S), *stored.N)
+				return false
+			}
+
+			// A flight changed since it was stored already has FlightTimeNs.
+			_, updateErr = svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String("Flights"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID":            item["ID"],
+					"OriginAirport": item["OriginAirport"],
+				},
+				UpdateExpression:    aws.String("SET FlightTimeNs = if_not_exists(FlightTimeNs, :flightTime) REMOVE FlightTime"),
+				ConditionExpression: aws.String("FlightTime = :stored"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":flightTime": {
+						N: aws.String(strconv.FormatInt((time.Duration(milliseconds) * time.Millisecond).Nanoseconds(), 10)),
+					},
+					":stored": stored,
+				},
+			})
+			if updateErr != nil {
+				return false
+			}
+			migrated++
+		}
+		return true
+	})
+	if err != nil {
+		return migrated, err
+	}
+
+	return migrated, updateErr
 }
 
 func createFlightsTable(svc *dynamodb.DynamoDB) error {
@@ -251,8 +626,23 @@ func createFlightsTable(svc *dynamodb.DynamoDB) error {
 				AttributeName: aws.String("FlightNumber"),
 				AttributeType: aws.String("S"),
 			},
+			{
+				AttributeName: aws.String("Route"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("AirlineID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("DepartureUTC"),
+				AttributeType: aws.String("S"),
+			},
 		},
 		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			flightRouteDateIndex(),
+			flightOriginDateIndex(),
+			flightAirlineIndex(),
 			{
 				IndexName: aws.String("originAiport"),
 				KeySchema: []*dynamodb.KeySchemaElement{
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// A flight is identified by its FlightNumber, its OperatingDate (the local
+// departure date at the origin) and its OriginAirport; a multi-leg flight has
+// one flight per leg. The FlightKeys table holds one item per identity, so a
+// dated flight can only be stored once, and each FlightSection is claimed by
+// the flight it belongs to, which binds its seats to that dated flight.
+
+var errFlightExists = errors.New("Flight already exists")
+
+// flightKey is the FlightKeys partition key of a dated flight.
+func flightKey(flightNumber, operatingDate, originAirport string) string {
+	return flightNumber + "#" + operatingDate + "#" + originAirport
+}
+
+// operatingDate returns the OperatingDate of a flight. Flights stored before
+// it existed fall back to the UTC departure date.
+func (flight *Flight) operatingDate() string {
+	if flight.OperatingDate != "" {
+		return flight.OperatingDate
+	}
+	return flight.DepartureDate.UTC().Format("2006-01-02")
+}
+
+func flightKeyPut(flight *Flight) *dynamodb.Put {
+	return &dynamodb.Put{
+		TableName: aws.String("FlightKeys"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"FlightKey": {
+				S: aws.String(flightKey(flight.FlightNumber, flight.operatingDate(), flight.OriginAirport)),
+			},
+			"FlightID": {
+				S: aws.String(flight.ID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(FlightKey)"),
+	}
+}
+
+// flightSectionClaim attaches a section to a flight unless another flight owns it.
+func flightSectionClaim(flightSectionID, flightID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: aws.String("FlightSections"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(flightSectionID),
+				},
+			},
+			UpdateExpression:    aws.String("SET FlightID = :flightID"),
+			ConditionExpression: aws.String("attribute_exists(ID) AND (attribute_not_exists(FlightID) OR FlightID = :flightID)"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":flightID": {
+					S: aws.String(flightID),
+				},
+			},
+		},
+	}
+}
+
+// writeFlight stores a new flight together with its FlightKey, the claims on
+// its sections and its marketing numbers in one transaction.
+func writeFlight(flight *Flight, put *dynamodb.Put, svc *dynamodb.DynamoDB) error {
+	writes := []*dynamodb.TransactWriteItem{{Put: put}, {Put: flightKeyPut(flight)}}
+	for _, flightSectionID := range flight.FlightSectionID {
+		writes = append(writes, flightSectionClaim(flightSectionID, flight.ID))
+	}
+	for _, marketing := range flight.MarketingFlights {
+		writes = append(writes, marketingFlightWrites(flight, marketing)...)
+	}
+	sectionsEnd := 2 + len(flight.FlightSectionID)
+
+	_, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	if err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			for i, reason := range canceled.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				if i == 1 {
+					return fmt.Errorf("%w: %s operates on %s from %s", errFlightExists, flight.FlightNumber, flight.operatingDate(), flight.OriginAirport)
+				}
+				if i >= 2 && i < sectionsEnd {
+					return fmt.Errorf("FlightSection %s already belongs to another flight", flight.FlightSectionID[i-2])
+				}
+				if i >= sectionsEnd {
+					marketing := flight.MarketingFlights[(i-sectionsEnd)/2]
+					return fmt.Errorf("%w: %s operates on %s from %s", errFlightExists, marketing.FlightNumber, flight.operatingDate(), flight.OriginAirport)
+				}
+			}
+			return errors.New("Flight was created concurrently, please retry")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// deleteFlightKey frees the identity of a deleted flight and of its marketing numbers.
+func deleteFlightKey(flight *Flight, svc *dynamodb.DynamoDB) error {
+	for _, marketing := range flight.MarketingFlights {
+		for _, write := range marketingFlightDeletes(flight, marketing) {
+			_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+				TableName: write.Delete.TableName,
+				Key:       write.Delete.Key,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("FlightKeys"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FlightKey": {
+				S: aws.String(flightKey(flight.FlightNumber, flight.operatingDate(), flight.OriginAirport)),
+			},
+		},
+		ConditionExpression: aws.String("FlightID = :flightID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":flightID": {
+				S: aws.String(flight.ID),
+			},
+		},
+	})
+	if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+		return nil
+	}
+	return err
+}
+
+// FindFlightsByNumber returns the flights operated or marketed under a flight
+// number, optionally restricted to an operating date and origin airport.
+func FindFlightsByNumber(flightNumber, operatingDate, originAirport string, svc *dynamodb.DynamoDB) ([]*Flight, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("Flights"),
+		IndexName:              aws.String("FlightNumberIndex"),
+		KeyConditionExpression: aws.String("#fn = :fn"),
+		ExpressionAttributeNames: map[string]*string{
+			"#fn": aws.String("FlightNumber"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":fn": {
+				S: aws.String(flightNumber),
+			},
+		},
+	}
+
+	candidates := []*Flight{}
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			flight := &Flight{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, flight); unmarshalErr != nil {
+				return false
+			}
+			candidates = append(candidates, flight)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	marketed, err := getMarketedFlights(flightNumber, svc)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, marketed...)
+
+	matches := []*Flight{}
+	for _, flight := range candidates {
+		if operatingDate != "" && flight.operatingDate() != operatingDate {
+			continue
+		}
+		if originAirport != "" && flight.OriginAirport != originAirport {
+			continue
+		}
+		matches = append(matches, flight)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].DepartureDate.Before(matches[j].DepartureDate)
+	})
+	return matches, nil
+}
+
+// ResolveFlight finds the dated flight meant by a FlightNumber, which may be
+// an operating or a marketing number. operatingDate and originAirport may be
+// empty, but the flight number must then identify a single flight.
+func ResolveFlight(flightNumber, operatingDate, originAirport string, svc *dynamodb.DynamoDB) (*Flight, error) {
+	matches, err := FindFlightsByNumber(flightNumber, operatingDate, originAirport, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(matches) == 0:
+		return nil, errors.New("Flight not found")
+	case len(matches) > 1 && operatingDate == "":
+		return nil, fmt.Errorf("Flight %s operates on several dates, an operating date is required", flightNumber)
+	case len(matches) > 1:
+		return nil, fmt.Errorf("Flight %s has several legs on %s, an origin airport is required", flightNumber, operatingDate)
+	}
+	return matches[0], nil
+}
+
+// FlightKeyBackfillReport lists what BackfillFlightKeys could not fix on its own.
+type FlightKeyBackfillReport struct {
+	Flights int `json:"flights"`
+	Keyed   int `json:"keyed"`
+	// DuplicateFlights are flights whose identity another flight already holds.
+	DuplicateFlights []string `json:"duplicateFlights"`
+	// SharedSections are sections referenced by more than one flight.
+	SharedSections []string `json:"sharedSections"`
+	SeatsLinked    int      `json:"seatsLinked"`
+}
+
+// BackfillFlightKeys gives flights created before flight identities existed
+// their OperatingDate and FlightKey, attaches their sections and links their
+// seats. Duplicates and shared sections are reported for manual repair.
+func BackfillFlightKeys(svc *dynamodb.DynamoDB) (*FlightKeyBackfillReport, error) {
+	if !doesTableExist("FlightKeys", svc) {
+		if err := createFlightKeysTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	flights, err := GetAllFlights(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FlightKeyBackfillReport{DuplicateFlights: []string{}, SharedSections: []string{}}
+	locations := map[string]*time.Location{}
+	for i := range flights {
+		flight := &flights[i]
+		report.Flights++
+
+		if flight.OperatingDate == "" {
+			location, ok := locations[flight.OriginAirport]
+			if !ok {
+				if location, err = airportLocation(flight.OriginAirport, svc); err != nil {
+					return report, fmt.Errorf("Airport %s: %v", flight.OriginAirport, err)
+				}
+				locations[flight.OriginAirport] = location
+			}
+			flight.OperatingDate = flight.DepartureDate.In(location).Format("2006-01-02")
+		}
+
+		writes := []*dynamodb.TransactWriteItem{{Update: &dynamodb.Update{
+			TableName: aws.String("Flights"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(flight.ID),
+				},
+				"OriginAirport": {
+					S: aws.String(flight.OriginAirport),
+				},
+			},
+			UpdateExpression: aws.String("SET OperatingDate = :operatingDate"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":operatingDate": {
+					S: aws.String(flight.OperatingDate),
+				},
+			},
+		}}}
+		key := flightKeyPut(flight)
+		key.ConditionExpression = aws.String("attribute_not_exists(FlightKey) OR FlightID = :flightID")
+		key.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":flightID": {S: aws.String(flight.ID)}}
+		writes = append(writes, &dynamodb.TransactWriteItem{Put: key})
+
+		_, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		if err != nil {
+			if _, ok := err.(*dynamodb.TransactionCanceledException); ok {
+				report.DuplicateFlights = append(report.DuplicateFlights, flight.ID)
+				continue
+			}
+			return report, err
+		}
+		report.Keyed++
+
+		for _, flightSectionID := range flight.FlightSectionID {
+			claim := flightSectionClaim(flightSectionID, flight.ID).Update
+			_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName:                 claim.TableName,
+				Key:                       claim.Key,
+				UpdateExpression:          claim.UpdateExpression,
+				ConditionExpression:       claim.ConditionExpression,
+				ExpressionAttributeValues: claim.ExpressionAttributeValues,
+			})
+			if err != nil {
+				if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+					report.SharedSections = append(report.SharedSections, flightSectionID)
+					continue
+				}
+				return report, err
+			}
+
+			linked, err := linkSectionSeats(flightSectionID, flight.ID, svc)
+			report.SeatsLinked += linked
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// linkSectionSeats sets FlightID on the seats of a section that have none.
+func linkSectionSeats(flightSectionID, flightID string, svc *dynamodb.DynamoDB) (int, error) {
+	seats, err := GetSeatsByFlightSectionID(flightSectionID, svc)
+	if err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for _, seat := range seats {
+		if seat.FlightID != "" {
+			continue
+		}
+		_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("Seats"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(seat.ID),
+				},
+				"FlightSectionID": {
+					S: aws.String(seat.FlightSectionID),
+				},
+			},
+			UpdateExpression: aws.String("SET FlightID = :flightID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":flightID": {
+					S: aws.String(flightID),
+				},
+			},
+		})
+		if err != nil {
+			return linked, err
+		}
+		linked++
+	}
+	return linked, nil
+}
+
+func createFlightKeysTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("FlightKeys"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("FlightKey"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("FlightKey"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("FlightKeys table created successfully")
+	return nil
+}
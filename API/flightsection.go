@@ -15,12 +15,36 @@ type FlightSection struct {
 	SeatClass string `json:"seatClass"`
 	NumRows   int    `json:"numRows"`
 	NumCols   int    `json:"numCols"`
+	// AislesAfter lists the column numbers that are followed by an aisle.
+	AislesAfter []int `json:"aislesAfter"`
+	// FlightID is the dated flight the section belongs to, set when the
+	// flight is created.
+	FlightID string `json:"flightID,omitempty"`
+}
+
+func validateAislesAfter(flightSection FlightSection) error {
+	for _, col := range flightSection.AislesAfter {
+		if col < 1 || col >= flightSection.NumCols {
+			return errors.New("AislesAfter columns must be between 1 and NumCols-1")
+		}
+	}
+	return nil
 }
 
 func CreateFlightSection(flightSection FlightSection, svc *dynamodb.DynamoDB) error {
+	_, err := createFlightSection(flightSection, svc)
+	return err
+}
+
+// createFlightSection stores a flight section, returning it with its generated ID.
+func createFlightSection(flightSection FlightSection, svc *dynamodb.DynamoDB) (*FlightSection, error) {
 	// Generate a unique ID for the flight section.
 	flightSectionID := uuid.New().String()
 
+	if err := validateAislesAfter(flightSection); err != nil {
+		return nil, err
+	}
+
 	if !doesTableExist("FlightSections", svc) {
 		if err := createFlightSectionsTable(svc); err != nil {
 			fmt.Printf("Error creating FlightSections table: %v\n", err)
@@ -44,14 +68,22 @@ func CreateFlightSection(flightSection FlightSection, svc *dynamodb.DynamoDB) er
 			},
 		},
 	}
+	if len(flightSection.AislesAfter) > 0 {
+		aisles := make([]*string, len(flightSection.AislesAfter))
+		for i, col := range flightSection.AislesAfter {
+			aisles[i] = aws.String(fmt.Sprintf("%d", col))
+		}
+		input.Item["AislesAfter"] = &dynamodb.AttributeValue{NS: aisles}
+	}
 
 	_, err := svc.PutItem(input)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Printf("Created Flight Section: ID=%s, SeatClass=%s, NumRows=%d, NumCols=%d\n", flightSectionID, flightSection.SeatClass, flightSection.NumRows, flightSection.NumCols)
-	return nil
+	flightSection.ID = flightSectionID
+	return &flightSection, nil
 }
 
 func GetAllFlightSections(svc *dynamodb.DynamoDB) ([]FlightSection, error) {
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	FlightStatusScheduled = "SCHEDULED"
+	FlightStatusDelayed   = "DELAYED"
+	FlightStatusBoarding  = "BOARDING"
+	FlightStatusDeparted  = "DEPARTED"
+	FlightStatusArrived   = "ARRIVED"
+	FlightStatusDiverted  = "DIVERTED"
+	FlightStatusCancelled = "CANCELLED"
+)
+
+// flightStatusTransitions lists the statuses each status may move to.
+// ARRIVED and CANCELLED are final.
+var flightStatusTransitions = map[string][]string{
+	FlightStatusScheduled: {FlightStatusDelayed, FlightStatusBoarding, FlightStatusCancelled},
+	FlightStatusDelayed:   {FlightStatusDelayed, FlightStatusBoarding, FlightStatusCancelled},
+	FlightStatusBoarding:  {FlightStatusDelayed, FlightStatusDeparted, FlightStatusCancelled},
+	FlightStatusDeparted:  {FlightStatusArrived, FlightStatusDiverted},
+	FlightStatusDiverted:  {FlightStatusArrived},
+	FlightStatusArrived:   {},
+	FlightStatusCancelled: {},
+}
+
+// FlightStatusChange is one entry of a flight's status history.
+type FlightStatusChange struct {
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changedAt"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type FlightStatusUpdate struct {
+	Status             string     `json:"status"`
+	EstimatedDeparture *time.Time `json:"estimatedDeparture"`
+	EstimatedArrival   *time.Time `json:"estimatedArrival"`
+	ActualDeparture    *time.Time `json:"actualDeparture"`
+	ActualArrival      *time.Time `json:"actualArrival"`
+	DivertedTo         string     `json:"divertedTo"`
+	Actor              string     `json:"actor"`
+	Reason             string     `json:"reason"`
+}
+
+// currentStatus returns the flight's status. Flights stored before statuses
+// existed have none and count as scheduled.
+func (flight *Flight) currentStatus() string {
+	if flight.Status == "" {
+		return FlightStatusScheduled
+	}
+	return flight.Status
+}
+
+// isOpenForSale reports whether seats on the flight can still be sold.
+func (flight *Flight) isOpenForSale() bool {
+	status := flight.currentStatus()
+	return status == FlightStatusScheduled || status == FlightStatusDelayed
+}
+
+func canTransitionFlightStatus(from, to string) bool {
+	for _, allowed := range flightStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func flightStatusChangeValue(change FlightStatusChange) *dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"Status": {
+			S: aws.String(change.Status),
+		},
+		"ChangedAt": {
+			S: aws.String(change.ChangedAt.Format(time.RFC3339Nano)),
+		},
+	}
+	if change.Actor != "" {
+		item["Actor"] = &dynamodb.AttributeValue{S: aws.String(change.Actor)}
+	}
+	if change.Reason != "" {
+		item["Reason"] = &dynamodb.AttributeValue{S: aws.String(change.Reason)}
+	}
+	return &dynamodb.AttributeValue{M: item}
+}
+
+// applyFlightStatusUpdate checks the rules of the target status and fills in
+// the times it implies, returning the attributes to set.
+func applyFlightStatusUpdate(flight *Flight, update FlightStatusUpdate, svc *dynamodb.DynamoDB) (map[string]time.Time, error) {
+	times := map[string]time.Time{}
+	now := time.Now().UTC()
+
+	switch update.Status {
+	case FlightStatusDelayed:
+		if update.EstimatedDeparture == nil || !update.EstimatedDeparture.After(flight.DepartureDate) {
+			return nil, errors.New("A delay needs an EstimatedDeparture after the scheduled departure")
+		}
+		times["EstimatedDeparture"] = *update.EstimatedDeparture
+		times["EstimatedArrival"] = update.EstimatedDeparture.Add(flight.FlightTime)
+	case FlightStatusDeparted:
+		departure := now
+		if update.ActualDeparture != nil {
+			departure = *update.ActualDeparture
+		}
+		times["ActualDeparture"] = departure
+		times["EstimatedArrival"] = departure.Add(flight.FlightTime)
+	case FlightStatusDiverted:
+		if err := ValidateAirportCode(update.DivertedTo); err != nil {
+			return nil, errors.New("DivertedTo: " + err.Error())
+		}
+		if strings.EqualFold(update.DivertedTo, flight.DestinationAirport) {
+			return nil, errors.New("DivertedTo must differ from the destination")
+		}
+		if !doesAirportExist(update.DivertedTo, svc) {
+			return nil, errors.New("DivertedTo airport does not exist")
+		}
+	case FlightStatusArrived:
+		arrival := now
+		if update.ActualArrival != nil {
+			arrival = *update.ActualArrival
+		}
+		if flight.ActualDeparture != nil && !arrival.After(*flight.ActualDeparture) {
+			return nil, errors.New("ActualArrival must be after ActualDeparture")
+		}
+		times["ActualArrival"] = arrival
+	case FlightStatusCancelled:
+		if strings.TrimSpace(update.Reason) == "" {
+			return nil, errors.New("A cancellation needs a Reason")
+		}
+	}
+
+	if update.EstimatedArrival != nil && update.Status != FlightStatusArrived {
+		times["EstimatedArrival"] = *update.EstimatedArrival
+	}
+	return times, nil
+}
+
+// UpdateFlightStatus moves a flight to a new status if the transition is
+// allowed, recording the change in the flight's status history. The update is
+// conditional on the status it was checked against, so concurrent changes
+// cannot skip a transition rule.
+func UpdateFlightStatus(flightID string, update FlightStatusUpdate, svc *dynamodb.DynamoDB) (*Flight, error) {
+	update.Status = strings.ToUpper(strings.TrimSpace(update.Status))
+	if _, ok := flightStatusTransitions[update.Status]; !ok {
+		return nil, fmt.Errorf("Unknown flight status %q", update.Status)
+	}
+	if strings.TrimSpace(update.Actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	from := flight.currentStatus()
+	if !canTransitionFlightStatus(from, update.Status) {
+		return nil, fmt.Errorf("A %s flight cannot become %s", from, update.Status)
+	}
+
+	times, err := applyFlightStatusUpdate(flight, update, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	change := FlightStatusChange{Status: update.Status, ChangedAt: time.Now().UTC(), Actor: update.Actor, Reason: update.Reason}
+	expression := "SET #status = :to, StatusHistory = list_append(if_not_exists(StatusHistory, :empty), :change)"
+	values := map[string]*dynamodb.AttributeValue{
+		":to": {
+			S: aws.String(update.Status),
+		},
+		":from": {
+			S: aws.String(from),
+		},
+		":empty": {
+			L: []*dynamodb.AttributeValue{},
+		},
+		":change": {
+			L: []*dynamodb.AttributeValue{flightStatusChangeValue(change)},
+		},
+	}
+	for name, value := range times {
+		expression += fmt.Sprintf(", %s = :%s", name, name)
+		values[":"+name] = &dynamodb.AttributeValue{S: aws.String(value.UTC().Format(time.RFC3339))}
+	}
+	if update.Status == FlightStatusDiverted {
+		expression += ", DivertedTo = :divertedTo"
+		values[":divertedTo"] = &dynamodb.AttributeValue{S: aws.String(strings.ToUpper(update.DivertedTo))}
+	}
+
+	condition := "#status = :from"
+	if from == FlightStatusScheduled {
+		condition = "attribute_not_exists(#status) OR #status = :from"
+	}
+
+	result, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String(expression),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return nil, errors.New("Flight status was changed concurrently, please retry")
+		}
+		return nil, err
+	}
+
+	updated := &Flight{}
+	if err := dynamodbattribute.UnmarshalMap(result.Attributes, updated); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Flight %s status changed from %s to %s by %s\n", flight.ID, from, update.Status, update.Actor)
+	if updated.DepartureGate != nil || updated.ArrivalGate != nil {
+		updated = refreshFlightGates(updated, update.Actor, svc)
+	}
+	return updated, nil
+}
+
+// flightOpenForSaleCheck guards a sale transaction against the flight being
+// closed for sale, or the sections of the sold seats leaving it, after it
+// was read.
+func flightOpenForSaleCheck(flight *Flight, flightSectionIDs []string) *dynamodb.TransactWriteItem {
+	check := flightCabinCheck(flight, flightSectionIDs)
+	check.ConditionCheck.ConditionExpression = aws.String("(attribute_not_exists(#status) OR #status IN (:scheduled, :delayed)) AND " + *check.ConditionCheck.ConditionExpression)
+	check.ConditionCheck.ExpressionAttributeNames = map[string]*string{
+		"#status": aws.String("Status"),
+	}
+	check.ConditionCheck.ExpressionAttributeValues[":scheduled"] = &dynamodb.AttributeValue{S: aws.String(FlightStatusScheduled)}
+	check.ConditionCheck.ExpressionAttributeValues[":delayed"] = &dynamodb.AttributeValue{S: aws.String(FlightStatusDelayed)}
+	return check
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestCanTransitionFlightStatus(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{FlightStatusScheduled, FlightStatusDelayed, true},
+		{FlightStatusScheduled, FlightStatusBoarding, true},
+		{FlightStatusScheduled, FlightStatusCancelled, true},
+		{FlightStatusScheduled, FlightStatusDeparted, false},
+		{FlightStatusScheduled, FlightStatusScheduled, false},
+		{FlightStatusDelayed, FlightStatusDelayed, true},
+		{FlightStatusDelayed, FlightStatusBoarding, true},
+		{FlightStatusDelayed, FlightStatusScheduled, false},
+		{FlightStatusBoarding, FlightStatusDeparted, true},
+		{FlightStatusBoarding, FlightStatusDelayed, true},
+		{FlightStatusBoarding, FlightStatusArrived, false},
+		{FlightStatusDeparted, FlightStatusArrived, true},
+		{FlightStatusDeparted, FlightStatusDiverted, true},
+		{FlightStatusDeparted, FlightStatusCancelled, false},
+		{FlightStatusDiverted, FlightStatusArrived, true},
+		{FlightStatusDiverted, FlightStatusDeparted, false},
+		{FlightStatusArrived, FlightStatusDeparted, false},
+		{FlightStatusCancelled, FlightStatusScheduled, false},
+		{"UNKNOWN", FlightStatusScheduled, false},
+	}
+
+	for _, tt := range tests {
+		if got := canTransitionFlightStatus(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransitionFlightStatus(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// A flight holds a gate on each side: at the origin before departure and at
+// the destination after arrival.
+const (
+	GateSideDeparture = "DEPARTURE"
+	GateSideArrival   = "ARRIVAL"
+
+	defaultGateDepartureMinutes = 60
+	defaultGateArrivalMinutes   = 30
+	// gateLockSlot is the Slot of a gate's gateLock item. It sorts after
+	// every window, so queries by time never return it.
+	gateLockSlot = "LOCK"
+)
+
+var (
+	terminalCodePattern = regexp.MustCompile("^[A-Z0-9]{1,5}$")
+	gateCodePattern     = regexp.MustCompile("^[A-Z0-9]{1,6}$")
+
+	errGateTaken = errors.New("Gate is already assigned")
+)
+
+// Terminal is a passenger terminal of an airport with the gates it contains.
+type Terminal struct {
+	// Code is how the terminal is signposted, e.g. "T2" or "1".
+	Code  string   `json:"code"`
+	Name  string   `json:"name,omitempty"`
+	Gates []string `json:"gates"`
+}
+
+// GateAssignment is the gate a flight uses at Airport and the window it holds it.
+type GateAssignment struct {
+	Airport       string    `json:"airport"`
+	Terminal      string    `json:"terminal"`
+	Gate          string    `json:"gate"`
+	OccupiedFrom  time.Time `json:"occupiedFrom"`
+	OccupiedUntil time.Time `json:"occupiedUntil"`
+}
+
+// GateChange is one entry of a flight's gate history. Terminal and Gate are
+// empty when the gate was released.
+type GateChange struct {
+	Side             string    `json:"side"`
+	Terminal         string    `json:"terminal,omitempty"`
+	Gate             string    `json:"gate,omitempty"`
+	PreviousTerminal string    `json:"previousTerminal,omitempty"`
+	PreviousGate     string    `json:"previousGate,omitempty"`
+	ChangedAt        time.Time `json:"changedAt"`
+	Actor            string    `json:"actor,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+}
+
+type GateAssignmentRequest struct {
+	Terminal string `json:"terminal"`
+	Gate     string `json:"gate"`
+	Actor    string `json:"actor"`
+	Reason   string `json:"reason"`
+}
+
+// gateOccupancy is the GateAssignments item that reserves a gate for one side
+// of a flight. Slot sorts the items of a gate by the start of their window.
+type gateOccupancy struct {
+	Gate          string
+	Slot          string
+	FlightID      string
+	FlightNumber  string
+	Side          string
+	OccupiedFrom  time.Time
+	OccupiedUntil time.Time
+}
+
+// gateLock is the GateAssignments item every reservation of a gate bumps in
+// its transaction, so two overlapping reservations read at the same time
+// cannot both commit. LongestWindowSeconds is the longest window reserved on
+// the gate, bounding how long before a window an overlapping one can start.
+type gateLock struct {
+	Version              int
+	LongestWindowSeconds int64
+}
+
+// ValidateTerminals checks the terminals of an airport and normalizes their
+// codes to upper case.
+func ValidateTerminals(terminals []Terminal) error {
+	seen := map[string]bool{}
+	for i := range terminals {
+		terminal := &terminals[i]
+		terminal.Code = strings.ToUpper(strings.TrimSpace(terminal.Code))
+		terminal.Name = strings.TrimSpace(terminal.Name)
+		if !terminalCodePattern.MatchString(terminal.Code) {
+			return fmt.Errorf("Terminal code %q must be 1-5 letters or digits", terminal.Code)
+		}
+		if seen[terminal.Code] {
+			return fmt.Errorf("Terminal %s is listed more than once", terminal.Code)
+		}
+		seen[terminal.Code] = true
+		if len(terminal.Name) > maxAirportNameLength {
+			return fmt.Errorf("Terminal name must be at most %d characters", maxAirportNameLength)
+		}
+		if len(terminal.Gates) == 0 {
+			return fmt.Errorf("Terminal %s has no gates", terminal.Code)
+		}
+
+		gates := map[string]bool{}
+		for j, gate := range terminal.Gates {
+			gate = strings.ToUpper(strings.TrimSpace(gate))
+			if !gateCodePattern.MatchString(gate) {
+				return fmt.Errorf("Gate %q of terminal %s must be 1-6 letters or digits", gate, terminal.Code)
+			}
+			if gates[gate] {
+				return fmt.Errorf("Gate %s is listed more than once in terminal %s", gate, terminal.Code)
+			}
+			gates[gate] = true
+			terminal.Gates[j] = gate
+		}
+	}
+	return nil
+}
+
+func terminalsValue(terminals []Terminal) *dynamodb.AttributeValue {
+	list := make([]*dynamodb.AttributeValue, len(terminals))
+	for i, terminal := range terminals {
+		item := map[string]*dynamodb.AttributeValue{
+			"Code": {
+				S: aws.String(terminal.Code),
+			},
+			"Gates": {
+				L: stringListValue(terminal.Gates),
+			},
+		}
+		if terminal.Name != "" {
+			item["Name"] = &dynamodb.AttributeValue{S: aws.String(terminal.Name)}
+		}
+		list[i] = &dynamodb.AttributeValue{M: item}
+	}
+	return &dynamodb.AttributeValue{L: list}
+}
+
+// hasGate reports whether the airport has the gate in the terminal.
+func (airport *Airport) hasGate(terminalCode, gate string) bool {
+	for _, terminal := range airport.Terminals {
+		if terminal.Code != terminalCode {
+			continue
+		}
+		for _, existing := range terminal.Gates {
+			if existing == gate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasTerminal reports whether the airport has the terminal.
+func (airport *Airport) hasTerminal(terminalCode string) bool {
+	for _, terminal := range airport.Terminals {
+		if terminal.Code == terminalCode {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateAirportTerminals replaces the terminals and gates of an airport.
+// Gates already assigned to flights keep their assignments.
+func UpdateAirportTerminals(airportID string, terminals []Terminal, svc *dynamodb.DynamoDB) (*Airport, error) {
+	if err := ValidateTerminals(terminals); err != nil {
+		return nil, err
+	}
+	airport, err := GetAirportByID(airportID, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Airports"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(airport.ID),
+			},
+			"Code": {
+				S: aws.String(airport.Code),
+			},
+		},
+		UpdateExpression: aws.String("REMOVE Terminals"),
+	}
+	if len(terminals) > 0 {
+		input.UpdateExpression = aws.String("SET Terminals = :terminals")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":terminals": terminalsValue(terminals),
+		}
+	}
+	if _, err := svc.UpdateItem(input); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Airport %s now has %d terminals\n", airport.Code, len(terminals))
+	airport.Terminals = terminals
+	return airport, nil
+}
+
+func validateGateSide(side string) (string, error) {
+	side = strings.ToUpper(strings.TrimSpace(side))
+	if side != GateSideDeparture && side != GateSideArrival {
+		return "", fmt.Errorf("Side must be %s or %s", GateSideDeparture, GateSideArrival)
+	}
+	return side, nil
+}
+
+// gate returns the flight's assignment on a side, nil when it has none.
+func (flight *Flight) gate(side string) *GateAssignment {
+	if side == GateSideDeparture {
+		return flight.DepartureGate
+	}
+	return flight.ArrivalGate
+}
+
+// gateAirport is the airport where the flight uses its gate on a side.
+func (flight *Flight) gateAirport(side string) string {
+	if side == GateSideDeparture {
+		return strings.ToUpper(flight.OriginAirport)
+	}
+	return strings.ToUpper(flight.DestinationAirport)
+}
+
+// gateAssignable reports whether the gate of a side can still change: the
+// departure gate until the flight leaves, the arrival gate until it lands.
+func (flight *Flight) gateAssignable(side string) bool {
+	switch flight.currentStatus() {
+	case FlightStatusScheduled, FlightStatusDelayed, FlightStatusBoarding:
+		return true
+	case FlightStatusDeparted:
+		return side == GateSideArrival
+	}
+	return false
+}
+
+// gateWindow returns when the flight holds its gate on a side: the departure
+// gate for GATE_DEPARTURE_MINUTES before departure, the arrival gate for
+// GATE_ARRIVAL_MINUTES after arrival. Estimated times replace scheduled ones.
+func (flight *Flight) gateWindow(side string) (time.Time, time.Time) {
+	if side == GateSideDeparture {
+		departure := flight.DepartureDate
+		if flight.EstimatedDeparture != nil {
+			departure = *flight.EstimatedDeparture
+		}
+		before := durationFromEnv("GATE_DEPARTURE_MINUTES", time.Minute, defaultGateDepartureMinutes)
+		return departure.Add(-before).UTC(), departure.UTC()
+	}
+	arrival := flightArrival(*flight)
+	if flight.EstimatedArrival != nil {
+		arrival = *flight.EstimatedArrival
+	}
+	after := durationFromEnv("GATE_ARRIVAL_MINUTES", time.Minute, defaultGateArrivalMinutes)
+	return arrival.UTC(), arrival.Add(after).UTC()
+}
+
+func (assignment *GateAssignment) sameAs(other *GateAssignment) bool {
+	return assignment.Airport == other.Airport && assignment.Terminal == other.Terminal && assignment.Gate == other.Gate &&
+		assignment.OccupiedFrom.Equal(other.OccupiedFrom) && assignment.OccupiedUntil.Equal(other.OccupiedUntil)
+}
+
+func gateKey(airport, terminal, gate string) string {
+	return airport + "#" + terminal + "#" + gate
+}
+
+func gateSlot(assignment *GateAssignment, flightID, side string) string {
+	return assignment.OccupiedFrom.UTC().Format(time.RFC3339) + "#" + flightID + "#" + side
+}
+
+// maxGateWindow is the longest window the current settings give a flight.
+func maxGateWindow() time.Duration {
+	before := durationFromEnv("GATE_DEPARTURE_MINUTES", time.Minute, defaultGateDepartureMinutes)
+	after := durationFromEnv("GATE_ARRIVAL_MINUTES", time.Minute, defaultGateArrivalMinutes)
+	if before > after {
+		return before
+	}
+	return after
+}
+
+// findGateConflict returns another flight's occupancy of the assigned gate
+// that overlaps its window, or nil, with the gate's lock as it was read
+// before the occupancies, for writeFlightGate to condition on.
+func findGateConflict(assignment *GateAssignment, flightID, side string, svc *dynamodb.DynamoDB) (*gateOccupancy, *gateLock, error) {
+	lock := &gateLock{}
+	if !doesTableExist("GateAssignments", svc) {
+		return nil, lock, nil
+	}
+	key := gateKey(assignment.Airport, assignment.Terminal, assignment.Gate)
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("GateAssignments"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Gate": {
+				S: aws.String(key),
+			},
+			"Slot": {
+				S: aws.String(gateLockSlot),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, lock); err != nil {
+		return nil, nil, err
+	}
+
+	// Windows reserved before the gate had a lock are bounded by the settings.
+	lookback := time.Duration(lock.LongestWindowSeconds) * time.Second
+	if settings := maxGateWindow(); settings > lookback {
+		lookback = settings
+	}
+
+	var conflict *gateOccupancy
+	var unmarshalErr error
+	err = svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("GateAssignments"),
+		KeyConditionExpression: aws.String("Gate = :gate AND Slot BETWEEN :from AND :to"),
+		ConsistentRead:         aws.Bool(true),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":gate": {
+				S: aws.String(key),
+			},
+			":from": {
+				S: aws.String(assignment.OccupiedFrom.Add(-lookback).UTC().Format(time.RFC3339)),
+			},
+			// Slots starting exactly when the window ends sort after this and do not overlap.
+			":to": {
+				S: aws.String(assignment.OccupiedUntil.UTC().Format(time.RFC3339)),
+			},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			occupancy := &gateOccupancy{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, occupancy); unmarshalErr != nil {
+				return false
+			}
+			if occupancy.FlightID == flightID && occupancy.Side == side {
+				continue
+			}
+			if occupancy.OccupiedUntil.After(assignment.OccupiedFrom) && occupancy.OccupiedFrom.Before(assignment.OccupiedUntil) {
+				conflict = occupancy
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return conflict, lock, unmarshalErr
+}
+
+// gateLockUpdate bumps the lock of the gate of next, failing when another
+// reservation of the gate committed since lock was read.
+func gateLockUpdate(next *GateAssignment, lock *gateLock) *dynamodb.TransactWriteItem {
+	longest := lock.LongestWindowSeconds
+	if window := int64(next.OccupiedUntil.Sub(next.OccupiedFrom) / time.Second); window > longest {
+		longest = window
+	}
+	condition := "attribute_not_exists(Version)"
+	values := map[string]*dynamodb.AttributeValue{
+		":version": {
+			N: aws.String(fmt.Sprintf("%d", lock.Version+1)),
+		},
+		":longest": {
+			N: aws.String(fmt.Sprintf("%d", longest)),
+		},
+	}
+	if lock.Version > 0 {
+		condition = "Version = :read"
+		values[":read"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprintf("%d", lock.Version))}
+	}
+
+	return &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		TableName: aws.String("GateAssignments"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Gate": {
+				S: aws.String(gateKey(next.Airport, next.Terminal, next.Gate)),
+			},
+			"Slot": {
+				S: aws.String(gateLockSlot),
+			},
+		},
+		UpdateExpression:          aws.String("SET Version = :version, LongestWindowSeconds = :longest"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}}
+}
+
+// writeFlightGate replaces the assignment of one side of a flight, recording
+// the change in its gate history and moving the gate reservation, in a single
+// transaction. It fails if the flight's status or gate changed since it was
+// read, or if the next gate was reserved since lock was read.
+func writeFlightGate(flight *Flight, side string, next *GateAssignment, lock *gateLock, change GateChange, svc *dynamodb.DynamoDB) (*Flight, error) {
+	attribute := "DepartureGate"
+	if side == GateSideArrival {
+		attribute = "ArrivalGate"
+	}
+	previous := flight.gate(side)
+
+	historyValue, err := dynamodbattribute.Marshal([]GateChange{change})
+	if err != nil {
+		return nil, err
+	}
+	expression := "SET GateHistory = list_append(if_not_exists(GateHistory, :empty), :change)"
+	values := map[string]*dynamodb.AttributeValue{
+		":empty": {
+			L: []*dynamodb.AttributeValue{},
+		},
+		":change": historyValue,
+		":status": {
+			S: aws.String(flight.currentStatus()),
+		},
+	}
+	if next != nil {
+		nextValue, err := dynamodbattribute.Marshal(next)
+		if err != nil {
+			return nil, err
+		}
+		expression += ", #gate = :next"
+		values[":next"] = nextValue
+	} else {
+		expression += " REMOVE #gate"
+	}
+
+	condition := "#status = :status"
+	if flight.currentStatus() == FlightStatusScheduled {
+		condition = "(attribute_not_exists(#status) OR #status = :status)"
+	}
+	if previous == nil {
+		condition += " AND attribute_not_exists(#gate)"
+	} else {
+		condition += " AND #gate.#gateCode = :previousGate AND #gate.#terminal = :previousTerminal"
+		values[":previousGate"] = &dynamodb.AttributeValue{S: aws.String(previous.Gate)}
+		values[":previousTerminal"] = &dynamodb.AttributeValue{S: aws.String(previous.Terminal)}
+	}
+
+	names := map[string]*string{
+		"#status": aws.String("Status"),
+		"#gate":   aws.String(attribute),
+	}
+	if previous != nil {
+		names["#gateCode"] = aws.String("gate")
+		names["#terminal"] = aws.String("terminal")
+	}
+
+	writes := []*dynamodb.TransactWriteItem{{Update: &dynamodb.Update{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(flight.OriginAirport),
+			},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}}
+	if previous != nil {
+		writes = append(writes, &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+			TableName: aws.String("GateAssignments"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"Gate": {
+					S: aws.String(gateKey(previous.Airport, previous.Terminal, previous.Gate)),
+				},
+				"Slot": {
+					S: aws.String(gateSlot(previous, flight.ID, side)),
+				},
+			},
+		}})
+	}
+	if next != nil {
+		occupancy, err := dynamodbattribute.MarshalMap(gateOccupancy{
+			Gate:          gateKey(next.Airport, next.Terminal, next.Gate),
+			Slot:          gateSlot(next, flight.ID, side),
+			FlightID:      flight.ID,
+			FlightNumber:  flight.FlightNumber,
+			Side:          side,
+			OccupiedFrom:  next.OccupiedFrom,
+			OccupiedUntil: next.OccupiedUntil,
+		})
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName: aws.String("GateAssignments"),
+			Item:      occupancy,
+		}}, gateLockUpdate(next, lock))
+	}
+
+	if _, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: writes}); err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			reasons := canceled.CancellationReasons
+			if last := len(reasons) - 1; next != nil && last == len(writes)-1 && reasons[last].Code != nil && *reasons[last].Code == "ConditionalCheckFailed" {
+				return nil, fmt.Errorf("%w: gate %s was assigned concurrently, please retry", errGateTaken, next.Gate)
+			}
+			return nil, errors.New("Flight status or gate was changed concurrently, please retry")
+		}
+		return nil, err
+	}
+	return GetFlightByID(flight.ID, svc)
+}
+
+// AssignGate assigns a gate of the flight's origin (DEPARTURE) or destination
+// (ARRIVAL). The gate must exist and must not be held by another flight for
+// an overlapping window.
+func AssignGate(flightID, side string, request GateAssignmentRequest, svc *dynamodb.DynamoDB) (*Flight, error) {
+	side, err := validateGateSide(side)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+	request.Terminal = strings.ToUpper(strings.TrimSpace(request.Terminal))
+	request.Gate = strings.ToUpper(strings.TrimSpace(request.Gate))
+
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if !flight.gateAssignable(side) {
+		return nil, fmt.Errorf("The %s gate of a %s flight cannot be changed", strings.ToLower(side), flight.currentStatus())
+	}
+	airport, err := GetAirportByCode(flight.gateAirport(side), svc)
+	if err != nil {
+		return nil, err
+	}
+	if !airport.hasGate(request.Terminal, request.Gate) {
+		return nil, fmt.Errorf("Airport %s has no gate %s in terminal %s", airport.Code, request.Gate, request.Terminal)
+	}
+
+	next := &GateAssignment{Airport: airport.Code, Terminal: request.Terminal, Gate: request.Gate}
+	next.OccupiedFrom, next.OccupiedUntil = flight.gateWindow(side)
+	previous := flight.gate(side)
+	if previous != nil && previous.sameAs(next) {
+		return flight, nil
+	}
+
+	if !doesTableExist("GateAssignments", svc) {
+		if err := createGateAssignmentsTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	conflict, lock, err := findGateConflict(next, flight.ID, side, svc)
+	if err != nil {
+		return nil, err
+	}
+	if conflict != nil {
+		return nil, fmt.Errorf("%w: %s holds gate %s from %s to %s", errGateTaken, conflict.FlightNumber, next.Gate,
+			conflict.OccupiedFrom.Format(time.RFC3339), conflict.OccupiedUntil.Format(time.RFC3339))
+	}
+
+	change := GateChange{Side: side, Terminal: next.Terminal, Gate: next.Gate, ChangedAt: time.Now().UTC(), Actor: request.Actor, Reason: request.Reason}
+	if previous != nil {
+		change.PreviousTerminal, change.PreviousGate = previous.Terminal, previous.Gate
+	}
+	updated, err := writeFlightGate(flight, side, next, lock, change, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Flight %s %s gate set to %s %s by %s\n", flight.FlightNumber, strings.ToLower(side), next.Terminal, next.Gate, request.Actor)
+	return updated, nil
+}
+
+// ReleaseGate removes the gate assignment of one side of a flight.
+func ReleaseGate(flightID, side, actor, reason string, svc *dynamodb.DynamoDB) (*Flight, error) {
+	side, err := validateGateSide(side)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	previous := flight.gate(side)
+	if previous == nil {
+		return flight, nil
+	}
+
+	change := GateChange{Side: side, PreviousTerminal: previous.Terminal, PreviousGate: previous.Gate, ChangedAt: time.Now().UTC(), Actor: actor, Reason: reason}
+	return writeFlightGate(flight, side, nil, nil, change, svc)
+}
+
+// refreshFlightGates brings the gates of a flight in line with its times and
+// status after they changed. Gates of a cancelled flight, and the arrival
+// gate of a diverted or rerouted one, are released. A gate whose new window
+// overlaps another flight is released as well, to be reassigned by hand.
+// Failures are logged, the change that triggered the refresh stands. It
+// returns the flight as last written.
+func refreshFlightGates(flight *Flight, actor string, svc *dynamodb.DynamoDB) *Flight {
+	for _, side := range []string{GateSideDeparture, GateSideArrival} {
+		previous := flight.gate(side)
+		if previous == nil {
+			continue
+		}
+		change := GateChange{Side: side, PreviousTerminal: previous.Terminal, PreviousGate: previous.Gate, ChangedAt: time.Now().UTC(), Actor: actor}
+
+		var next *GateAssignment
+		var lock *gateLock
+		switch status := flight.currentStatus(); {
+		case status == FlightStatusCancelled:
+			change.Reason = "Flight cancelled"
+		case side == GateSideArrival && (status == FlightStatusDiverted || previous.Airport != flight.gateAirport(side)):
+			change.Reason = "Flight no longer arrives at " + previous.Airport
+		default:
+			moved := *previous
+			moved.OccupiedFrom, moved.OccupiedUntil = flight.gateWindow(side)
+			if moved.sameAs(previous) {
+				continue
+			}
+			conflict, movedLock, err := findGateConflict(&moved, flight.ID, side, svc)
+			if err != nil {
+				fmt.Printf("Error checking gate %s of flight %s: %v\n", previous.Gate, flight.ID, err)
+				continue
+			}
+			if conflict != nil {
+				change.Reason = fmt.Sprintf("Gate taken by %s after a time change", conflict.FlightNumber)
+			} else {
+				next, lock = &moved, movedLock
+				change.Terminal, change.Gate = moved.Terminal, moved.Gate
+				change.Reason = "Time change"
+			}
+		}
+
+		updated, err := writeFlightGate(flight, side, next, lock, change, svc)
+		if err != nil {
+			fmt.Printf("Error updating %s gate of flight %s: %v\n", strings.ToLower(side), flight.ID, err)
+			continue
+		}
+		flight = updated
+	}
+	return flight
+}
+
+func createGateAssignmentsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("GateAssignments"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Gate"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("Slot"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Gate"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("Slot"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("GateAssignments table created successfully")
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Default connection limits used when a search does not set its own.
+// defaultMinConnection is also the minimum connection time at airports
+// without MCT rules.
+const (
+	defaultMinConnection = 45 * time.Minute
+	defaultMaxConnection = 6 * time.Hour
+	maxItineraryStops    = 2
+)
+
+type ItineraryQuery struct {
+	FlightSearchQuery
+	MaxStops      int
+	MinConnection time.Duration
+	MaxConnection time.Duration
+}
+
+type ItineraryLeg struct {
+	Flight      Flight    `json:"flight"`
+	ArrivalDate time.Time `json:"arrivalDate"`
+	FreeSeats   int       `json:"freeSeats"`
+}
+
+// ItineraryConnection describes the change between two legs at Airport,
+// including whether the passenger and their bags are checked through.
+type ItineraryConnection struct {
+	Airport string `json:"airport"`
+	Minutes int    `json:"minutes"`
+	// MinimumMinutes is the minimum connection time at the airport.
+	MinimumMinutes int `json:"minimumMinutes"`
+	AgreementTerms
+}
+
+type Itinerary struct {
+	Legs               []ItineraryLeg        `json:"legs"`
+	Connections        []ItineraryConnection `json:"connections"`
+	Stops              int                   `json:"stops"`
+	DepartureDate      time.Time             `json:"departureDate"`
+	ArrivalDate        time.Time             `json:"arrivalDate"`
+	TotalTravelMinutes int                   `json:"totalTravelMinutes"`
+}
+
+func validateItineraryQuery(query ItineraryQuery) error {
+	if err := validateFlightSearchQuery(query.FlightSearchQuery); err != nil {
+		return err
+	}
+	if query.MaxStops < 0 || query.MaxStops > maxItineraryStops {
+		return errors.New("maxStops must be between 0 and 2")
+	}
+	if query.MinConnection < 0 || query.MaxConnection < query.MinConnection {
+		return errors.New("The connection time range is invalid")
+	}
+	return nil
+}
+
+// itinerarySearch holds the state of one SearchItineraries call.
+type itinerarySearch struct {
+	query     ItineraryQuery
+	svc       *dynamodb.DynamoDB
+	freeSeats map[string]int
+	carriers  *carrierAgreements
+	mct       *connectionTimes
+	found     []Itinerary
+}
+
+// legFreeSeats returns the free seats of a flight for the searched cabin, cached per search.
+func (s *itinerarySearch) legFreeSeats(flight Flight) (int, error) {
+	if freeSeats, ok := s.freeSeats[flight.ID]; ok {
+		return freeSeats, nil
+	}
+	availability, err := GetAvailabilityForFlight(flight, s.svc)
+	if err != nil {
+		return 0, err
+	}
+	freeSeats, _ := freeSeatsForClass(availability, s.query.SeatClass)
+	s.freeSeats[flight.ID] = freeSeats
+	return freeSeats, nil
+}
+
+// extend tries every flight that can follow the legs so far, recording the
+// itineraries that reach the destination.
+func (s *itinerarySearch) extend(legs []ItineraryLeg, candidates []Flight, visited map[string]bool) error {
+	for _, flight := range candidates {
+		destination := strings.ToUpper(flight.DestinationAirport)
+		if visited[destination] || !flight.isOpenForSale() {
+			continue
+		}
+
+		previous := make([]*Flight, len(legs))
+		for i := range legs {
+			previous[i] = &legs[i].Flight
+		}
+		ticketable, err := s.carriers.canTicketWith(previous, &flight)
+		if err != nil {
+			return err
+		}
+		if !ticketable {
+			continue
+		}
+		if len(legs) > 0 {
+			minimum, err := s.mct.minimum(previous[len(previous)-1], &flight)
+			if err != nil {
+				return err
+			}
+			if flight.DepartureDate.Sub(legs[len(legs)-1].ArrivalDate) < minimum {
+				continue
+			}
+		}
+
+		freeSeats, err := s.legFreeSeats(flight)
+		if err != nil {
+			return err
+		}
+		if freeSeats < s.query.Passengers {
+			continue
+		}
+
+		leg := ItineraryLeg{Flight: flight, ArrivalDate: flightArrival(flight), FreeSeats: freeSeats}
+		path := append(append([]ItineraryLeg{}, legs...), leg)
+
+		if destination == strings.ToUpper(s.query.Destination) {
+			itinerary := newItinerary(path)
+			if itinerary.Connections, err = s.connections(path); err != nil {
+				return err
+			}
+			s.found = append(s.found, itinerary)
+			continue
+		}
+
+		stops := len(path)
+		if stops > s.query.MaxStops {
+			continue
+		}
+
+		from := leg.ArrivalDate.Add(s.query.MinConnection)
+		to := leg.ArrivalDate.Add(s.query.MaxConnection)
+		var next []Flight
+		if stops == s.query.MaxStops {
+			// Only the final leg is left, so look up the route directly.
+			next, err = queryFlightsByRoute(destination, s.query.Destination, from, to, s.svc)
+		} else {
+			next, err = queryFlightsFromAirport(destination, from, to, s.svc)
+		}
+		if err != nil {
+			return err
+		}
+
+		visited[destination] = true
+		if err := s.extend(path, next, visited); err != nil {
+			return err
+		}
+		delete(visited, destination)
+	}
+
+	return nil
+}
+
+// connections describes every change of flight in legs.
+func (s *itinerarySearch) connections(legs []ItineraryLeg) ([]ItineraryConnection, error) {
+	connections := []ItineraryConnection{}
+	for i := 1; i < len(legs); i++ {
+		terms, err := s.carriers.between(&legs[i-1].Flight, &legs[i].Flight)
+		if err != nil {
+			return nil, err
+		}
+		minimum, err := s.mct.minimum(&legs[i-1].Flight, &legs[i].Flight)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, ItineraryConnection{
+			Airport:        strings.ToUpper(legs[i].Flight.OriginAirport),
+			Minutes:        int(legs[i].Flight.DepartureDate.Sub(legs[i-1].ArrivalDate).Minutes()),
+			MinimumMinutes: int(minimum.Minutes()),
+			AgreementTerms: terms,
+		})
+	}
+	return connections, nil
+}
+
+func newItinerary(legs []ItineraryLeg) Itinerary {
+	departure := legs[0].Flight.DepartureDate
+	arrival := legs[len(legs)-1].ArrivalDate
+	return Itinerary{
+		Legs:               legs,
+		Stops:              len(legs) - 1,
+		DepartureDate:      departure,
+		ArrivalDate:        arrival,
+		TotalTravelMinutes: int(arrival.Sub(departure).Minutes()),
+	}
+}
+
+// SearchItineraries builds direct and connecting itineraries of up to
+// MaxStops connections. Every leg must be open for sale with enough free
+// seats, every connection must fall within the connection time limits and
+// last at least the minimum connection time of its airport, and flights of
+// different airlines must be covered by an interline or alliance agreement.
+// Results are ranked by total travel time, then by number of stops.
+func SearchItineraries(query ItineraryQuery, svc *dynamodb.DynamoDB) ([]Itinerary, error) {
+	if err := validateItineraryQuery(query); err != nil {
+		return nil, err
+	}
+
+	search := &itinerarySearch{query: query, svc: svc, freeSeats: map[string]int{}, carriers: newCarrierAgreements(svc), mct: newConnectionTimes(svc), found: []Itinerary{}}
+
+	var firstLegs []Flight
+	var err error
+	if query.MaxStops == 0 {
+		firstLegs, err = queryFlightsByRoute(query.Origin, query.Destination, query.DepartureFrom, query.DepartureTo, svc)
+	} else {
+		firstLegs, err = queryFlightsFromAirport(query.Origin, query.DepartureFrom, query.DepartureTo, svc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	visited := map[string]bool{strings.ToUpper(query.Origin): true}
+	if err := search.extend(nil, firstLegs, visited); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(search.found, func(i, j int) bool {
+		a, b := search.found[i], search.found[j]
+		if a.TotalTravelMinutes != b.TotalTravelMinutes {
+			return a.TotalTravelMinutes < b.TotalTravelMinutes
+		}
+		if a.Stops != b.Stops {
+			return a.Stops < b.Stops
+		}
+		return a.DepartureDate.Before(b.DepartureDate)
+	})
+
+	return search.found, nil
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -17,7 +23,7 @@ var svc *dynamodb.DynamoDB
 var ginLambda *ginadapter.GinLambdaV2
 
 type Response struct {
-	message string `json:"message"`
+	Message string `json:"message"`
 }
 
 func main() {
@@ -27,6 +33,12 @@ func main() {
 		log.Printf(err.Error())
 		panic(err)
 	}
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], svc); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	lambda.Start(Handler)
 }
 func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
@@ -53,7 +65,7 @@ func init() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, Response{message: "Airline created successfully"})
+		c.JSON(http.StatusCreated, Response{Message: "Airline created successfully"})
 	})
 
 	r.GET("/airlines", func(c *gin.Context) {
@@ -65,6 +77,36 @@ func init() {
 
 		c.JSON(http.StatusOK, airlines)
 	})
+	r.GET("/airlines/designator/:designator", func(c *gin.Context) {
+		airline, err := GetAirlineByDesignator(c.Param("designator"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, airline)
+	})
+	r.PUT("/airlines/:id", func(c *gin.Context) {
+		var airline Airline
+		if err := c.ShouldBindJSON(&airline); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateAirline(c.Param("id"), airline, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+	r.GET("/airlines/:id/flights", func(c *gin.Context) {
+		flights, err := GetFlightsByAirline(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, flights)
+	})
 	r.GET("/airlines/:id", func(c *gin.Context) {
 		airlineID := c.Param("id")
 
@@ -76,6 +118,111 @@ func init() {
 
 		c.JSON(http.StatusOK, airline)
 	})
+	r.GET("/airlines/:id/routes", func(c *gin.Context) {
+		network, err := GetAirlineNetwork(c.Param("id"), c.Query("status"), c.Query("date"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, network)
+	})
+	r.GET("/airlines/:id/agreements", func(c *gin.Context) {
+		agreements, err := GetAgreements(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, agreements)
+	})
+
+	r.POST("/routes", func(c *gin.Context) {
+		var route Route
+		if err := c.ShouldBindJSON(&route); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := CreateRoute(route, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	})
+	r.GET("/routes/:id", func(c *gin.Context) {
+		route, err := GetRouteByID(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, route)
+	})
+	r.PUT("/routes/:id", func(c *gin.Context) {
+		var route Route
+		if err := c.ShouldBindJSON(&route); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateRoute(c.Param("id"), route, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+
+	r.POST("/agreements", func(c *gin.Context) {
+		var agreement AirlineAgreement
+		if err := c.ShouldBindJSON(&agreement); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := CreateAgreement(agreement, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	})
+	r.GET("/agreements", func(c *gin.Context) {
+		agreements, err := GetAgreements(c.Query("airlineID"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, agreements)
+	})
+	r.GET("/agreements/:id", func(c *gin.Context) {
+		agreement, err := GetAgreementByID(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, agreement)
+	})
+	r.PUT("/agreements/:id", func(c *gin.Context) {
+		var agreement AirlineAgreement
+		if err := c.ShouldBindJSON(&agreement); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateAgreement(c.Param("id"), agreement, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+	r.DELETE("/agreements/:id", func(c *gin.Context) {
+		if err := DeleteAgreement(c.Param("id"), svc); err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, Response{Message: "Agreement deleted successfully"})
+	})
 
 	r.POST("/airports", func(c *gin.Context) {
 		var airport Airport
@@ -90,7 +237,7 @@ func init() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, Response{message: "Airport created successfully"})
+		c.JSON(http.StatusCreated, Response{Message: "Airport created successfully"})
 	})
 
 	r.GET("/airports", func(c *gin.Context) {
@@ -103,6 +250,154 @@ func init() {
 		c.JSON(http.StatusOK, airports)
 	})
 
+	r.PUT("/airports/:id", func(c *gin.Context) {
+		var airport Airport
+
+		if err := c.ShouldBindJSON(&airport); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateAirport(c.Param("id"), airport, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	})
+
+	r.PUT("/airports/:id/timezone", func(c *gin.Context) {
+		var request struct {
+			Timezone string `json:"timezone"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		airport, err := UpdateAirportTimezone(c.Param("id"), request.Timezone, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, airport)
+	})
+
+	r.PUT("/airports/:id/terminals", func(c *gin.Context) {
+		var request struct {
+			Terminals []Terminal `json:"terminals"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		airport, err := UpdateAirportTerminals(c.Param("id"), request.Terminals, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, airport)
+	})
+
+	r.GET("/airports/code/:code", func(c *gin.Context) {
+		airport, err := LookupAirport(c.Param("code"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, airport)
+	})
+	r.GET("/airports/code/:code/routes", func(c *gin.Context) {
+		network, err := GetAirportNetwork(c.Param("code"), c.Query("status"), c.Query("date"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, network)
+	})
+	r.GET("/airports/code/:code/mct-rules", func(c *gin.Context) {
+		airport, err := LookupAirport(c.Param("code"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		rules, err := GetMCTRules(airport.Code, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	})
+	r.POST("/airports/code/:code/mct-rules", func(c *gin.Context) {
+		var rule MCTRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		rule.Airport = c.Param("code")
+
+		created, err := CreateMCTRule(rule, svc)
+		if errors.Is(err, errMCTRuleExists) {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	})
+	r.PUT("/airports/code/:code/mct-rules/:ruleID", func(c *gin.Context) {
+		var rule MCTRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateMCTRule(c.Param("code"), c.Param("ruleID"), rule, svc)
+		if errors.Is(err, errMCTRuleExists) {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+	r.DELETE("/airports/code/:code/mct-rules/:ruleID", func(c *gin.Context) {
+		if err := DeleteMCTRule(c.Param("code"), c.Param("ruleID"), svc); err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	r.POST("/mct-rules/import", func(c *gin.Context) {
+		report, err := ImportMCTCSV(c.Request.Body, c.Query("dryRun") == "true", svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	r.GET("/airports/search", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		results, err := SearchAirports(c.Query("q"), limit, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	})
+
 	r.GET("/airports/:id", func(c *gin.Context) {
 		// Get the ID parameter from the URL
 		airportID := c.Param("id")
@@ -118,6 +413,16 @@ func init() {
 		c.JSON(http.StatusOK, airport)
 	})
 
+	r.GET("/route-info", func(c *gin.Context) {
+		info, err := GetRouteInfo(strings.ToUpper(c.Query("origin")), strings.ToUpper(c.Query("destination")), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	})
+
 	r.POST("/seats", func(c *gin.Context) {
 		var seat Seat
 
@@ -133,7 +438,19 @@ func init() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, Response{message: "Seat created successfully"})
+		c.JSON(http.StatusCreated, Response{Message: "Seat created successfully"})
+	})
+	r.POST("/seats/repair", func(c *gin.Context) {
+		flightNumber := c.Query("flightNumber")
+		dryRun := c.Query("dryRun") == "true"
+
+		report, err := RepairDuplicateSeats(flightNumber, dryRun, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
 	})
 	r.GET("/seats", func(c *gin.Context) {
 		seats, err := GetAllSeats(svc)
@@ -144,10 +461,16 @@ func init() {
 
 		c.JSON(http.StatusOK, seats)
 	})
+	// Routes under /seats/flight/:flightNumber take ?date=YYYY-MM-DD and
+	// ?origin=IATA to pick the dated flight when the number operates more than once.
 	r.GET("/seats/flight/:flightNumber", func(c *gin.Context) {
-		flightNumber := c.Param("flightNumber")
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
 
-		seats, err := GetSeatsByFlightNumber(flightNumber, svc)
+		seats, err := GetSeatsByFlight(flight, svc)
 		if err != nil {
 			c.AbortWithError(http.StatusNotFound, err)
 			return
@@ -155,6 +478,66 @@ func init() {
 
 		c.JSON(http.StatusOK, seats)
 	})
+	r.GET("/seats/flight/:flightNumber/map", func(c *gin.Context) {
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		seatMap, err := GetSeatMap(flight, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		switch c.DefaultQuery("format", "json") {
+		case "svg":
+			c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(RenderSeatMapSVG(seatMap)))
+		case "text":
+			c.String(http.StatusOK, RenderSeatMapText(seatMap))
+		case "json":
+			c.JSON(http.StatusOK, seatMap)
+		default:
+			c.AbortWithError(http.StatusBadRequest, errors.New("format must be json, svg or text"))
+		}
+	})
+	r.POST("/seats/flight/:flightNumber/import", func(c *gin.Context) {
+		dryRun := c.Query("dryRun") == "true"
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		report, err := ImportSeatsCSV(flight, c.Request.Body, dryRun, c.Query("actor"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if len(report.Errors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, report)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	})
+	r.GET("/seats/flight/:flightNumber/export", func(c *gin.Context) {
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		var csvData strings.Builder
+		if err := ExportSeatsCSV(flight, &csvData, svc); err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "seats-"+flight.FlightNumber+"-"+flight.operatingDate()+".csv"))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(csvData.String()))
+	})
 	r.GET("/seats/flightsection/:flightSectionID", func(c *gin.Context) {
 		flightSectionID := c.Param("flightSectionID")
 
@@ -183,7 +566,8 @@ func init() {
 
 		var updateData struct {
 			IsBooked        bool   `json:"IsBooked"`
-			FlightSectionID string `json:FlightSectionId`
+			FlightSectionID string `json:"FlightSectionID"`
+			HoldToken       string `json:"holdToken"`
 		}
 
 		// Bind the request body to the updateData struct
@@ -192,30 +576,158 @@ func init() {
 			return
 		}
 
-		err := UpdateSeatIsBooked(seatID, updateData.FlightSectionID, updateData.IsBooked, svc)
+		err := UpdateSeatIsBooked(seatID, updateData.FlightSectionID, updateData.IsBooked, updateData.HoldToken, svc)
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, Response{message: "Seat updated successfully"})
+		c.JSON(http.StatusOK, Response{Message: "Seat updated successfully"})
 	})
 
-	r.POST("/flightsections", func(c *gin.Context) {
-		var flightSection FlightSection
+	r.PUT("/seats/:id/hold", func(c *gin.Context) {
+		seatID := c.Param("id")
 
-		if err := c.ShouldBindJSON(&flightSection); err != nil {
+		var updateData struct {
+			IsHeld          bool   `json:"IsHeld"`
+			FlightSectionID string `json:"FlightSectionID"`
+			HoldToken       string `json:"holdToken"`
+		}
+
+		if err := c.ShouldBindJSON(&updateData); err != nil {
 			c.AbortWithError(http.StatusBadRequest, err)
 			return
 		}
 
-		if err := CreateFlightSection(flightSection, svc); err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+		holdToken, err := UpdateSeatIsHeld(seatID, updateData.FlightSectionID, updateData.IsHeld, updateData.HoldToken, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, struct {
+			Response
+			HoldToken string `json:"holdToken,omitempty"`
+		}{Response{Message: "Seat hold updated successfully"}, holdToken})
+	})
+
+	r.POST("/seats/block", func(c *gin.Context) {
+		var request SeatBlockRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		results, err := BlockSeats(request, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	})
+	r.POST("/seats/unblock", func(c *gin.Context) {
+		var request SeatUnblockRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		results, err := UnblockSeats(request, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	})
+	r.POST("/seats/flight/:flightNumber/release-expired-blocks", func(c *gin.Context) {
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		results, err := ReleaseExpiredSeatBlocks(flight, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	})
+
+	r.GET("/availability", func(c *gin.Context) {
+		// Accept both ?flightID=A&flightID=B and ?flightID=A,B
+		var flightIDs []string
+		for _, value := range c.QueryArray("flightID") {
+			for _, flightID := range strings.Split(value, ",") {
+				if flightID = strings.TrimSpace(flightID); flightID != "" {
+					flightIDs = append(flightIDs, flightID)
+				}
+			}
+		}
+		if len(flightIDs) == 0 {
+			c.AbortWithError(http.StatusBadRequest, errors.New("At least one flightID is required"))
+			return
+		}
+
+		availability, err := GetAvailabilityForFlights(flightIDs, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, availability)
+	})
+	r.GET("/availability/flight/:flightNumber", func(c *gin.Context) {
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		availability, err := GetFlightAvailability(flight, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, availability)
+	})
+	r.POST("/availability/flight/:flightNumber/rebuild", func(c *gin.Context) {
+		flight, err := ResolveFlight(c.Param("flightNumber"), c.Query("date"), c.Query("origin"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		availability, err := RebuildAvailability(flight, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, availability)
+	})
+
+	r.POST("/flightsections", func(c *gin.Context) {
+		var flightSection FlightSection
+
+		if err := c.ShouldBindJSON(&flightSection); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		if err := CreateFlightSection(flightSection, svc); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
 
 			return
 		}
 
-		c.JSON(http.StatusCreated, Response{message: "Flight section created successfully"})
+		c.JSON(http.StatusCreated, Response{Message: "Flight section created successfully"})
 	})
 
 	r.GET("/flightsections", func(c *gin.Context) {
@@ -257,7 +769,7 @@ func init() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, Response{message: "Flight created successfully"})
+		c.JSON(http.StatusCreated, Response{Message: "Flight created successfully"})
 	})
 	r.GET("/flights", func(c *gin.Context) {
 		flights, err := GetAllFlights(svc)
@@ -267,6 +779,295 @@ func init() {
 		}
 		c.JSON(http.StatusOK, flights)
 	})
+	r.GET("/flights/search", func(c *gin.Context) {
+		departureFrom, departureTo, err := OriginDepartureRange(c.Query("origin"), c.Query("date"), c.Query("from"), c.Query("to"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		passengers, err := strconv.Atoi(c.DefaultQuery("passengers", "1"))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("passengers must be a number"))
+			return
+		}
+
+		query := FlightSearchQuery{
+			Origin:        c.Query("origin"),
+			Destination:   c.Query("destination"),
+			DepartureFrom: departureFrom,
+			DepartureTo:   departureTo,
+			Passengers:    passengers,
+			SeatClass:     c.Query("seatClass"),
+			FlightNumber:  strings.ToUpper(c.Query("flightNumber")),
+		}
+
+		results, err := SearchFlights(query, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	})
+	r.GET("/flights/itineraries", func(c *gin.Context) {
+		departureFrom, departureTo, err := OriginDepartureRange(c.Query("origin"), c.Query("date"), c.Query("from"), c.Query("to"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		passengers, err := strconv.Atoi(c.DefaultQuery("passengers", "1"))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("passengers must be a number"))
+			return
+		}
+		maxStops, err := strconv.Atoi(c.DefaultQuery("maxStops", "2"))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("maxStops must be a number"))
+			return
+		}
+		minConnection, err := time.ParseDuration(c.DefaultQuery("minConnection", "0s"))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("minConnection must be a duration such as 45m"))
+			return
+		}
+		maxConnection, err := time.ParseDuration(c.DefaultQuery("maxConnection", defaultMaxConnection.String()))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("maxConnection must be a duration such as 6h"))
+			return
+		}
+
+		query := ItineraryQuery{
+			FlightSearchQuery: FlightSearchQuery{
+				Origin:        c.Query("origin"),
+				Destination:   c.Query("destination"),
+				DepartureFrom: departureFrom,
+				DepartureTo:   departureTo,
+				Passengers:    passengers,
+				SeatClass:     c.Query("seatClass"),
+			},
+			MaxStops:      maxStops,
+			MinConnection: minConnection,
+			MaxConnection: maxConnection,
+		}
+
+		itineraries, err := SearchItineraries(query, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, itineraries)
+	})
+	r.GET("/flights/:id", func(c *gin.Context) {
+		flight, err := GetFlightByID(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, flight)
+	})
+	r.GET("/flights/number/:flightNumber", func(c *gin.Context) {
+		flights, err := FindFlightsByNumber(strings.ToUpper(c.Param("flightNumber")), c.Query("date"), strings.ToUpper(c.Query("origin")), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, flights)
+	})
+	r.POST("/flights/:id/marketing", func(c *gin.Context) {
+		var marketing MarketingFlight
+		if err := c.ShouldBindJSON(&marketing); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		flight, err := AddMarketingFlight(c.Param("id"), marketing, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, flight)
+	})
+	r.DELETE("/flights/:id/marketing/:flightNumber", func(c *gin.Context) {
+		flight, err := RemoveMarketingFlight(c.Param("id"), strings.ToUpper(c.Param("flightNumber")), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, flight)
+	})
+	r.PUT("/flights/:id/gates/:side", func(c *gin.Context) {
+		var request GateAssignmentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		flight, err := AssignGate(c.Param("id"), c.Param("side"), request, svc)
+		if errors.Is(err, errGateTaken) {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, flight)
+	})
+	r.DELETE("/flights/:id/gates/:side", func(c *gin.Context) {
+		flight, err := ReleaseGate(c.Param("id"), c.Param("side"), c.Query("actor"), c.Query("reason"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, flight)
+	})
+	r.GET("/flights/:id/passengers", func(c *gin.Context) {
+		list, err := GetPassengerList(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+	r.PUT("/flights/:id/status", func(c *gin.Context) {
+		var update FlightStatusUpdate
+
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		// Cancelling also re-accommodates the passengers.
+		if strings.EqualFold(strings.TrimSpace(update.Status), FlightStatusCancelled) {
+			flight, _, err := CancelFlight(c.Param("id"), FlightCancellation{Actor: update.Actor, Reason: update.Reason}, svc)
+			if err != nil && flight == nil {
+				c.AbortWithError(http.StatusConflict, err)
+				return
+			}
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, flight)
+			return
+		}
+
+		flight, err := UpdateFlightStatus(c.Param("id"), update, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, flight)
+	})
+	r.POST("/flights/:id/cancel", func(c *gin.Context) {
+		var cancellation FlightCancellation
+
+		if err := c.ShouldBindJSON(&cancellation); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		flight, report, err := CancelFlight(c.Param("id"), cancellation, svc)
+		if err != nil && flight == nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	})
+	r.POST("/flights/:id/reaccommodate", func(c *gin.Context) {
+		var cancellation FlightCancellation
+
+		if err := c.ShouldBindJSON(&cancellation); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		report, err := ReaccommodateFlight(c.Param("id"), cancellation.WindowHours, cancellation.Actor, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	})
+	r.GET("/flights/:id/reaccommodations", func(c *gin.Context) {
+		reports, err := GetReaccommodationReports(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, reports)
+	})
+	r.POST("/flights/:id/changes", func(c *gin.Context) {
+		var request FlightChangeRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		change, err := ApplyFlightChange(c.Param("id"), request, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, change)
+	})
+	r.GET("/flights/:id/changes", func(c *gin.Context) {
+		changes, err := GetScheduleChangesByFlight(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, changes)
+	})
+	r.GET("/schedule-changes/queue", func(c *gin.Context) {
+		items, err := GetScheduleChangeQueue(strings.ToUpper(c.Query("status")), strings.ToUpper(c.Query("action")), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, items)
+	})
+	r.POST("/schedule-changes/queue/:bookingID/:changeID/resolve", func(c *gin.Context) {
+		var resolution ScheduleChangeResolution
+
+		if err := c.ShouldBindJSON(&resolution); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		item, err := ResolveScheduleChangeQueueItem(c.Param("bookingID"), c.Param("changeID"), resolution, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, item)
+	})
+	r.GET("/schedule-changes/:id", func(c *gin.Context) {
+		change, err := GetScheduleChangeByID(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, change)
+	})
 	r.GET("/flights/origin/:airport", func(c *gin.Context) {
 		originAirport := c.Param("airport")
 		flights, err := GetFlightsByOriginAirport(originAirport, svc)
@@ -287,6 +1088,112 @@ func init() {
 		c.JSON(http.StatusOK, flights)
 	})
 
+	r.POST("/bookings", func(c *gin.Context) {
+		var booking Booking
+
+		if err := c.ShouldBindJSON(&booking); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := CreateBooking(booking, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	})
+	r.GET("/bookings/:id", func(c *gin.Context) {
+		bookingID := c.Param("id")
+
+		booking, err := GetBookingByID(bookingID, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, booking)
+	})
+	r.POST("/schedules", func(c *gin.Context) {
+		var schedule Schedule
+
+		if err := c.ShouldBindJSON(&schedule); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := CreateSchedule(schedule, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	})
+	r.GET("/schedules", func(c *gin.Context) {
+		schedules, err := GetAllSchedules(svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, schedules)
+	})
+	r.GET("/schedules/:id", func(c *gin.Context) {
+		schedule, err := GetScheduleByID(c.Param("id"), svc)
+		if err != nil {
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, schedule)
+	})
+	r.PUT("/schedules/:id", func(c *gin.Context) {
+		var schedule Schedule
+
+		if err := c.ShouldBindJSON(&schedule); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := UpdateSchedule(c.Param("id"), schedule, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	})
+	r.POST("/schedules/:id/generate", func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultScheduleHorizon)))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("days must be a number"))
+			return
+		}
+
+		report, err := GenerateScheduleFlights(c.Param("id"), days, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	})
+	r.POST("/schedules/generate", func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultScheduleHorizon)))
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("days must be a number"))
+			return
+		}
+
+		reports, err := GenerateAllScheduleFlights(days, svc)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, reports)
+	})
+
 	ginLambda = ginadapter.NewV2(r)
 
 }
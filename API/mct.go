@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+// Connection types name whether the arriving and the departing flight are
+// domestic (D) or international (I), arriving flight first.
+const (
+	ConnectionDomesticDomestic           = "DD"
+	ConnectionDomesticInternational      = "DI"
+	ConnectionInternationalDomestic      = "ID"
+	ConnectionInternationalInternational = "II"
+
+	maxMCTMinutes = 24 * 60
+)
+
+var connectionTypes = map[string]bool{
+	ConnectionDomesticDomestic:           true,
+	ConnectionDomesticInternational:      true,
+	ConnectionInternationalDomestic:      true,
+	ConnectionInternationalInternational: true,
+}
+
+var errMCTRuleExists = errors.New("The airport already has a rule for these conditions")
+
+// MCTRule is a minimum connection time at an airport. The rule without any
+// conditions is the airport's default; rules with conditions override it for
+// the connections they match. Airports without rules use defaultMinConnection.
+type MCTRule struct {
+	ID string `json:"id"`
+	// Airport is the IATA code of the connecting airport.
+	Airport string `json:"airport"`
+	// ConnectionType is DD, DI, ID or II, or empty for any connection.
+	ConnectionType string `json:"connectionType,omitempty"`
+	// ArrivalTerminal and DepartureTerminal are matched against the gates
+	// assigned to the flights; a rule naming a terminal does not apply while
+	// the flight has no gate there.
+	ArrivalTerminal    string `json:"arrivalTerminal,omitempty"`
+	DepartureTerminal  string `json:"departureTerminal,omitempty"`
+	ArrivalAirlineID   string `json:"arrivalAirlineID,omitempty"`
+	DepartureAirlineID string `json:"departureAirlineID,omitempty"`
+	Minutes            int    `json:"minutes"`
+}
+
+type MCTImportSkip struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type MCTImportReport struct {
+	DryRun    bool            `json:"dryRun"`
+	RowsRead  int             `json:"rowsRead"`
+	Added     int             `json:"added"`
+	Updated   int             `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Skipped   []MCTImportSkip `json:"skipped"`
+}
+
+// MCT rules are imported from CSV files with these columns. Carriers are
+// airline designators; empty cells leave a condition unset.
+var mctCSVRequiredColumns = []string{"airport", "connection_type", "arrival_terminal", "departure_terminal", "arrival_carrier", "departure_carrier", "minutes"}
+
+// conditions identifies the connections a rule applies to; an airport has at
+// most one rule per conditions.
+func (rule *MCTRule) conditions() string {
+	return strings.Join([]string{rule.ConnectionType, rule.ArrivalTerminal, rule.DepartureTerminal, rule.ArrivalAirlineID, rule.DepartureAirlineID}, "#")
+}
+
+// specificity ranks matching rules: a carrier condition outweighs a terminal
+// condition, which outweighs the connection type.
+func (rule *MCTRule) specificity() int {
+	score := 0
+	for _, set := range []struct {
+		value  string
+		weight int
+	}{
+		{rule.ArrivalAirlineID, 8},
+		{rule.DepartureAirlineID, 8},
+		{rule.ArrivalTerminal, 2},
+		{rule.DepartureTerminal, 2},
+		{rule.ConnectionType, 1},
+	} {
+		if set.value != "" {
+			score += set.weight
+		}
+	}
+	return score
+}
+
+// connectionFacts describe a connection as MCT rules see it. The
+// connection type is empty when an airport's country is unknown, so rules
+// naming a connection type do not apply.
+type connectionFacts struct {
+	connectionType     string
+	arrivalTerminal    string
+	departureTerminal  string
+	arrivalAirlineID   string
+	departureAirlineID string
+}
+
+func (rule *MCTRule) matches(facts connectionFacts) bool {
+	matches := func(condition, value string) bool { return condition == "" || condition == value }
+	return matches(rule.ConnectionType, facts.connectionType) &&
+		matches(rule.ArrivalTerminal, facts.arrivalTerminal) &&
+		matches(rule.DepartureTerminal, facts.departureTerminal) &&
+		matches(rule.ArrivalAirlineID, facts.arrivalAirlineID) &&
+		matches(rule.DepartureAirlineID, facts.departureAirlineID)
+}
+
+// validateMCTRule checks a rule and normalizes its codes. The terminals must
+// exist at the airport and the airlines must exist.
+func validateMCTRule(rule *MCTRule, svc *dynamodb.DynamoDB) error {
+	rule.ConnectionType = strings.ToUpper(strings.TrimSpace(rule.ConnectionType))
+	rule.ArrivalTerminal = strings.ToUpper(strings.TrimSpace(rule.ArrivalTerminal))
+	rule.DepartureTerminal = strings.ToUpper(strings.TrimSpace(rule.DepartureTerminal))
+
+	if rule.ConnectionType != "" && !connectionTypes[rule.ConnectionType] {
+		return fmt.Errorf("ConnectionType must be %s, %s, %s or %s", ConnectionDomesticDomestic, ConnectionDomesticInternational, ConnectionInternationalDomestic, ConnectionInternationalInternational)
+	}
+	if rule.Minutes <= 0 || rule.Minutes > maxMCTMinutes {
+		return fmt.Errorf("Minutes must be between 1 and %d", maxMCTMinutes)
+	}
+
+	airport, err := LookupAirport(rule.Airport, svc)
+	if err != nil {
+		return fmt.Errorf("Airport %s does not exist", rule.Airport)
+	}
+	rule.Airport = airport.Code
+	for _, terminal := range []string{rule.ArrivalTerminal, rule.DepartureTerminal} {
+		if terminal != "" && !airport.hasTerminal(terminal) {
+			return fmt.Errorf("Airport %s has no terminal %s", airport.Code, terminal)
+		}
+	}
+	for _, airlineID := range []string{rule.ArrivalAirlineID, rule.DepartureAirlineID} {
+		if airlineID == "" {
+			continue
+		}
+		if _, err := GetAirlineByID(airlineID, svc); err != nil {
+			return fmt.Errorf("Airline %s does not exist", airlineID)
+		}
+	}
+	return nil
+}
+
+// checkMCTRuleUnique fails if another rule than exceptID at the airport has
+// the same conditions.
+func checkMCTRuleUnique(rule *MCTRule, exceptID string, svc *dynamodb.DynamoDB) error {
+	rules, err := GetMCTRules(rule.Airport, svc)
+	if err != nil {
+		return err
+	}
+	for _, other := range rules {
+		if other.ID != exceptID && other.conditions() == rule.conditions() {
+			return errMCTRuleExists
+		}
+	}
+	return nil
+}
+
+func CreateMCTRule(rule MCTRule, svc *dynamodb.DynamoDB) (*MCTRule, error) {
+	if err := validateMCTRule(&rule, svc); err != nil {
+		return nil, err
+	}
+	if !doesTableExist("MCTRules", svc) {
+		if err := createMCTRulesTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkMCTRuleUnique(&rule, "", svc); err != nil {
+		return nil, err
+	}
+
+	rule.ID = uuid.New().String()
+	if err := putMCTRule(&rule, "attribute_not_exists(ID)", svc); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created MCTRule: ID=%s, Airport=%s, Minutes=%d\n", rule.ID, rule.Airport, rule.Minutes)
+	return &rule, nil
+}
+
+// UpdateMCTRule replaces the conditions and minutes of a rule. Its airport
+// cannot be changed.
+func UpdateMCTRule(airportCode, ruleID string, rule MCTRule, svc *dynamodb.DynamoDB) (*MCTRule, error) {
+	existing, err := GetMCTRule(airportCode, ruleID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Airport == "" {
+		rule.Airport = existing.Airport
+	}
+	if err := validateMCTRule(&rule, svc); err != nil {
+		return nil, err
+	}
+	if rule.Airport != existing.Airport {
+		return nil, errors.New("The airport of a rule cannot be changed")
+	}
+	if err := checkMCTRuleUnique(&rule, existing.ID, svc); err != nil {
+		return nil, err
+	}
+
+	rule.ID = existing.ID
+	if err := putMCTRule(&rule, "attribute_exists(ID)", svc); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Updated MCTRule: ID=%s, Airport=%s, Minutes=%d\n", rule.ID, rule.Airport, rule.Minutes)
+	return &rule, nil
+}
+
+func DeleteMCTRule(airportCode, ruleID string, svc *dynamodb.DynamoDB) error {
+	rule, err := GetMCTRule(airportCode, ruleID, svc)
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("MCTRules"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Airport": {
+				S: aws.String(rule.Airport),
+			},
+			"ID": {
+				S: aws.String(rule.ID),
+			},
+		},
+	})
+	return err
+}
+
+func putMCTRule(rule *MCTRule, condition string, svc *dynamodb.DynamoDB) error {
+	item := map[string]*dynamodb.AttributeValue{
+		"Airport": {
+			S: aws.String(rule.Airport),
+		},
+		"ID": {
+			S: aws.String(rule.ID),
+		},
+		"Minutes": {
+			N: aws.String(strconv.Itoa(rule.Minutes)),
+		},
+	}
+	optional := map[string]string{
+		"ConnectionType":     rule.ConnectionType,
+		"ArrivalTerminal":    rule.ArrivalTerminal,
+		"DepartureTerminal":  rule.DepartureTerminal,
+		"ArrivalAirlineID":   rule.ArrivalAirlineID,
+		"DepartureAirlineID": rule.DepartureAirlineID,
+	}
+	for name, value := range optional {
+		if value != "" {
+			item[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		}
+	}
+
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("MCTRules"),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
+
+func GetMCTRule(airportCode, ruleID string, svc *dynamodb.DynamoDB) (*MCTRule, error) {
+	if !doesTableExist("MCTRules", svc) {
+		return nil, errors.New("MCT rule not found")
+	}
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("MCTRules"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Airport": {
+				S: aws.String(strings.ToUpper(airportCode)),
+			},
+			"ID": {
+				S: aws.String(ruleID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errors.New("MCT rule not found")
+	}
+
+	rule := &MCTRule{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// GetMCTRules returns the rules of an airport given by IATA code.
+func GetMCTRules(airportCode string, svc *dynamodb.DynamoDB) ([]*MCTRule, error) {
+	rules := []*MCTRule{}
+	if !doesTableExist("MCTRules", svc) {
+		return rules, nil
+	}
+
+	var unmarshalErr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("MCTRules"),
+		KeyConditionExpression: aws.String("Airport = :airport"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":airport": {
+				S: aws.String(strings.ToUpper(airportCode)),
+			},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			rule := &MCTRule{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, rule); unmarshalErr != nil {
+				return false
+			}
+			rules = append(rules, rule)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, unmarshalErr
+}
+
+// ImportMCTCSV adds the rules of a CSV file and updates the minutes of stored
+// rules with the same airport and conditions. Invalid rows are skipped and
+// reported. With dryRun nothing is written.
+func ImportMCTCSV(r io.Reader, dryRun bool, svc *dynamodb.DynamoDB) (*MCTImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	columns, err := readCSVColumns(reader, mctCSVRequiredColumns)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun && !doesTableExist("MCTRules", svc) {
+		if err := createMCTRulesTable(svc); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &MCTImportReport{DryRun: dryRun, Skipped: []MCTImportSkip{}}
+	airportRules := map[string]map[string]*MCTRule{}
+	airlines := map[string]string{}
+	airlineID := func(designator string) (string, error) {
+		if designator == "" {
+			return "", nil
+		}
+		if id, ok := airlines[designator]; ok {
+			return id, nil
+		}
+		airline, err := GetAirlineByDesignator(designator, svc)
+		if err != nil {
+			return "", fmt.Errorf("Carrier %s does not exist", designator)
+		}
+		airlines[designator] = airline.ID
+		return airline.ID, nil
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return report, fmt.Errorf("Line %d: %v", line, err)
+		}
+		report.RowsRead++
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, MCTImportSkip{Line: line, Reason: reason})
+		}
+
+		rule := MCTRule{
+			Airport:           columns.value(record, "airport"),
+			ConnectionType:    columns.value(record, "connection_type"),
+			ArrivalTerminal:   columns.value(record, "arrival_terminal"),
+			DepartureTerminal: columns.value(record, "departure_terminal"),
+		}
+		if rule.Minutes, err = strconv.Atoi(columns.value(record, "minutes")); err != nil {
+			skip("Minutes is not a whole number")
+			continue
+		}
+		if rule.ArrivalAirlineID, err = airlineID(strings.ToUpper(columns.value(record, "arrival_carrier"))); err != nil {
+			skip(err.Error())
+			continue
+		}
+		if rule.DepartureAirlineID, err = airlineID(strings.ToUpper(columns.value(record, "departure_carrier"))); err != nil {
+			skip(err.Error())
+			continue
+		}
+		if err := validateMCTRule(&rule, svc); err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		existing, ok := airportRules[rule.Airport]
+		if !ok {
+			rules, err := GetMCTRules(rule.Airport, svc)
+			if err != nil {
+				return report, err
+			}
+			existing = map[string]*MCTRule{}
+			for _, stored := range rules {
+				existing[stored.conditions()] = stored
+			}
+			airportRules[rule.Airport] = existing
+		}
+
+		stored := existing[rule.conditions()]
+		switch {
+		case stored != nil && stored.Minutes == rule.Minutes:
+			report.Unchanged++
+			continue
+		case stored != nil:
+			rule.ID = stored.ID
+			if !dryRun {
+				err = putMCTRule(&rule, "attribute_exists(ID)", svc)
+			}
+			report.Updated++
+		default:
+			rule.ID = uuid.New().String()
+			if !dryRun {
+				err = putMCTRule(&rule, "attribute_not_exists(ID)", svc)
+			}
+			report.Added++
+		}
+		if err != nil {
+			return report, fmt.Errorf("Line %d: %v", line, err)
+		}
+		existing[rule.conditions()] = &rule
+	}
+
+	return report, nil
+}
+
+// connectionTimes finds the minimum connection time of connections, caching
+// airports and their rules for the lifetime of one search or booking.
+type connectionTimes struct {
+	svc      *dynamodb.DynamoDB
+	airports map[string]*Airport
+	rules    map[string][]*MCTRule
+}
+
+func newConnectionTimes(svc *dynamodb.DynamoDB) *connectionTimes {
+	return &connectionTimes{svc: svc, airports: map[string]*Airport{}, rules: map[string][]*MCTRule{}}
+}
+
+func (c *connectionTimes) airport(code string) (*Airport, error) {
+	code = strings.ToUpper(code)
+	if airport, ok := c.airports[code]; ok {
+		return airport, nil
+	}
+	airport, err := GetAirportByCode(code, c.svc)
+	if err != nil {
+		return nil, fmt.Errorf("Airport %s: %v", code, err)
+	}
+	c.airports[code] = airport
+	return airport, nil
+}
+
+// scope returns "D" for a flight within one country and "I" for one
+// between countries, or "" when the country of either airport is unknown.
+func (c *connectionTimes) scope(flight *Flight) (string, error) {
+	origin, err := c.airport(flight.OriginAirport)
+	if err != nil {
+		return "", err
+	}
+	destination, err := c.airport(flight.DestinationAirport)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case origin.Country == "" || destination.Country == "":
+		return "", nil
+	case strings.EqualFold(origin.Country, destination.Country):
+		return "D", nil
+	}
+	return "I", nil
+}
+
+// selectMCTRule returns the most specific rule matching a connection, the
+// longest one when several are equally specific, or nil.
+func selectMCTRule(rules []*MCTRule, facts connectionFacts) *MCTRule {
+	var best *MCTRule
+	for _, rule := range rules {
+		if !rule.matches(facts) {
+			continue
+		}
+		if best == nil || rule.specificity() > best.specificity() ||
+			(rule.specificity() == best.specificity() && rule.Minutes > best.Minutes) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// minimum returns the minimum connection time from arriving to departing at
+// the arrival airport: that of the most specific matching rule, the longest
+// one when several are equally specific.
+func (c *connectionTimes) minimum(arriving, departing *Flight) (time.Duration, error) {
+	code := strings.ToUpper(arriving.DestinationAirport)
+	rules, ok := c.rules[code]
+	if !ok {
+		var err error
+		if rules, err = GetMCTRules(code, c.svc); err != nil {
+			return 0, err
+		}
+		c.rules[code] = rules
+	}
+	if len(rules) == 0 {
+		return defaultMinConnection, nil
+	}
+
+	arrivalScope, err := c.scope(arriving)
+	if err != nil {
+		return 0, err
+	}
+	departureScope, err := c.scope(departing)
+	if err != nil {
+		return 0, err
+	}
+	facts := connectionFacts{
+		arrivalAirlineID:   arriving.AirlineID,
+		departureAirlineID: departing.AirlineID,
+	}
+	if arrivalScope != "" && departureScope != "" {
+		facts.connectionType = arrivalScope + departureScope
+	}
+	if gate := arriving.ArrivalGate; gate != nil && gate.Airport == code {
+		facts.arrivalTerminal = gate.Terminal
+	}
+	if gate := departing.DepartureGate; gate != nil && gate.Airport == code {
+		facts.departureTerminal = gate.Terminal
+	}
+
+	best := selectMCTRule(rules, facts)
+	if best == nil {
+		return defaultMinConnection, nil
+	}
+	return time.Duration(best.Minutes) * time.Minute, nil
+}
+
+// check fails when departing leaves less than the minimum connection time
+// after arriving lands.
+func (c *connectionTimes) check(arriving, departing *Flight) error {
+	minimum, err := c.minimum(arriving, departing)
+	if err != nil {
+		return err
+	}
+	connection := departing.DepartureDate.Sub(flightArrival(*arriving))
+	if connection < minimum {
+		return fmt.Errorf("Connection from %s to %s at %s is %d minutes, the minimum connection time is %d minutes",
+			arriving.FlightNumber, departing.FlightNumber, strings.ToUpper(arriving.DestinationAirport), int(connection.Minutes()), int(minimum.Minutes()))
+	}
+	return nil
+}
+
+func createMCTRulesTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("MCTRules"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Airport"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Airport"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("MCTRules table created successfully")
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+func TestMCTRuleMatches(t *testing.T) {
+	facts := connectionFacts{
+		connectionType:     ConnectionDomesticInternational,
+		arrivalTerminal:    "T1",
+		departureTerminal:  "T2",
+		arrivalAirlineID:   "a1",
+		departureAirlineID: "a2",
+	}
+
+	tests := []struct {
+		name  string
+		rule  MCTRule
+		facts connectionFacts
+		want  bool
+	}{
+		{name: "default rule", rule: MCTRule{}, facts: facts, want: true},
+		{name: "connection type", rule: MCTRule{ConnectionType: ConnectionDomesticInternational}, facts: facts, want: true},
+		{name: "other connection type", rule: MCTRule{ConnectionType: ConnectionInternationalInternational}, facts: facts, want: false},
+		{name: "terminals", rule: MCTRule{ArrivalTerminal: "T1", DepartureTerminal: "T2"}, facts: facts, want: true},
+		{name: "other departure terminal", rule: MCTRule{ArrivalTerminal: "T1", DepartureTerminal: "T1"}, facts: facts, want: false},
+		{name: "carriers", rule: MCTRule{ArrivalAirlineID: "a1", DepartureAirlineID: "a2"}, facts: facts, want: true},
+		{name: "carriers reversed", rule: MCTRule{ArrivalAirlineID: "a2", DepartureAirlineID: "a1"}, facts: facts, want: false},
+		{name: "terminal without a gate", rule: MCTRule{ArrivalTerminal: "T1"}, facts: connectionFacts{connectionType: ConnectionDomesticDomestic}, want: false},
+		{name: "connection type with unknown country", rule: MCTRule{ConnectionType: ConnectionDomesticDomestic}, facts: connectionFacts{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.facts); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCTRuleSpecificity(t *testing.T) {
+	tests := []struct {
+		name string
+		rule MCTRule
+		want int
+	}{
+		{name: "default rule", rule: MCTRule{}, want: 0},
+		{name: "connection type", rule: MCTRule{ConnectionType: ConnectionDomesticDomestic}, want: 1},
+		{name: "one terminal", rule: MCTRule{ArrivalTerminal: "T1"}, want: 2},
+		{name: "terminals and connection type", rule: MCTRule{ConnectionType: ConnectionDomesticDomestic, ArrivalTerminal: "T1", DepartureTerminal: "T2"}, want: 5},
+		{name: "one carrier", rule: MCTRule{DepartureAirlineID: "a1"}, want: 8},
+		{name: "everything", rule: MCTRule{ConnectionType: ConnectionDomesticDomestic, ArrivalTerminal: "T1", DepartureTerminal: "T2", ArrivalAirlineID: "a1", DepartureAirlineID: "a2"}, want: 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.specificity(); got != tt.want {
+				t.Errorf("specificity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectMCTRule(t *testing.T) {
+	defaultRule := &MCTRule{ID: "default", Minutes: 45}
+	domestic := &MCTRule{ID: "domestic", ConnectionType: ConnectionDomesticDomestic, Minutes: 30}
+	international := &MCTRule{ID: "international", ConnectionType: ConnectionInternationalInternational, Minutes: 60}
+	terminals := &MCTRule{ID: "terminals", ArrivalTerminal: "T1", DepartureTerminal: "T2", Minutes: 75}
+	terminalsDomestic := &MCTRule{ID: "terminalsDomestic", ConnectionType: ConnectionDomesticDomestic, ArrivalTerminal: "T1", DepartureTerminal: "T2", Minutes: 50}
+	carrier := &MCTRule{ID: "carrier", ArrivalAirlineID: "a1", Minutes: 25}
+	arrivalTerminal := &MCTRule{ID: "arrivalTerminal", ArrivalTerminal: "T1", Minutes: 40}
+	departureTerminal := &MCTRule{ID: "departureTerminal", DepartureTerminal: "T2", Minutes: 55}
+	rules := []*MCTRule{defaultRule, domestic, international, terminals, terminalsDomestic, carrier}
+
+	tests := []struct {
+		name  string
+		rules []*MCTRule
+		facts connectionFacts
+		want  *MCTRule
+	}{
+		{name: "no rules", rules: nil, facts: connectionFacts{connectionType: ConnectionDomesticDomestic}, want: nil},
+		{name: "no matching rule", rules: []*MCTRule{international}, facts: connectionFacts{connectionType: ConnectionDomesticDomestic}, want: nil},
+		{name: "default only", rules: rules, facts: connectionFacts{connectionType: ConnectionDomesticInternational}, want: defaultRule},
+		{name: "connection type over default", rules: rules, facts: connectionFacts{connectionType: ConnectionDomesticDomestic}, want: domestic},
+		{name: "unknown country falls back to default", rules: rules, facts: connectionFacts{}, want: defaultRule},
+		{name: "terminals over connection type", rules: rules, facts: connectionFacts{connectionType: ConnectionInternationalInternational, arrivalTerminal: "T1", departureTerminal: "T2"}, want: terminals},
+		{name: "terminals and connection type", rules: rules, facts: connectionFacts{connectionType: ConnectionDomesticDomestic, arrivalTerminal: "T1", departureTerminal: "T2"}, want: terminalsDomestic},
+		{name: "carrier over terminals", rules: rules, facts: connectionFacts{connectionType: ConnectionDomesticDomestic, arrivalTerminal: "T1", departureTerminal: "T2", arrivalAirlineID: "a1"}, want: carrier},
+		{name: "longest of equally specific rules", rules: []*MCTRule{arrivalTerminal, departureTerminal}, facts: connectionFacts{arrivalTerminal: "T1", departureTerminal: "T2"}, want: departureTerminal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectMCTRule(tt.rules, tt.facts); got != tt.want {
+				t.Errorf("selectMCTRule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,791 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// defaultReaccommodationWindowHours is how far before and after the cancelled
+// departure alternatives are searched, unless REACCOMMODATION_WINDOW_HOURS or
+// the request sets another window.
+const (
+	defaultReaccommodationWindowHours = 24
+	maxReaccommodationWindowHours     = 7 * 24
+	reaccommodationMaxStops           = 1
+)
+
+type FlightCancellation struct {
+	Actor       string `json:"actor"`
+	Reason      string `json:"reason"`
+	WindowHours int    `json:"windowHours"`
+}
+
+// ReaccommodatedLeg is one flight a moved party now travels on.
+type ReaccommodatedLeg struct {
+	FlightID           string    `json:"flightID"`
+	FlightNumber       string    `json:"flightNumber"`
+	OperatingDate      string    `json:"operatingDate"`
+	OriginAirport      string    `json:"originAirport"`
+	DestinationAirport string    `json:"destinationAirport"`
+	DepartureDate      time.Time `json:"departureDate"`
+	SeatClass          string    `json:"seatClass"`
+	SeatIDs            []string  `json:"seatIDs"`
+}
+
+type ReaccommodatedParty struct {
+	BookingID           string              `json:"bookingID"`
+	Passengers          int                 `json:"passengers"`
+	FromSeatClass       string              `json:"fromSeatClass"`
+	Legs                []ReaccommodatedLeg `json:"legs"`
+	ClassChanged        bool                `json:"classChanged"`
+	ArrivalDelayMinutes int                 `json:"arrivalDelayMinutes"`
+}
+
+// UnaccommodatedParty is a party that is still on the cancelled flight.
+type UnaccommodatedParty struct {
+	BookingID  string   `json:"bookingID,omitempty"`
+	Passengers int      `json:"passengers"`
+	SeatClass  string   `json:"seatClass"`
+	SeatIDs    []string `json:"seatIDs"`
+	Reason     string   `json:"reason"`
+}
+
+type ReleasedSeat struct {
+	SeatID          string `json:"seatID"`
+	FlightSectionID string `json:"flightSectionID"`
+	BookingID       string `json:"bookingID,omitempty"`
+	State           string `json:"state"`
+}
+
+// ReaccommodationReport is the outcome of one re-accommodation run.
+type ReaccommodationReport struct {
+	FlightID      string                `json:"flightID"`
+	FlightNumber  string                `json:"flightNumber"`
+	OperatingDate string                `json:"operatingDate"`
+	WindowHours   int                   `json:"windowHours"`
+	Moved         []ReaccommodatedParty `json:"moved"`
+	NotMoved      []UnaccommodatedParty `json:"notMoved"`
+	ReleasedSeats []ReleasedSeat        `json:"releasedSeats"`
+	Actor         string                `json:"actor"`
+	CreatedAt     time.Time             `json:"createdAt"`
+}
+
+// reaccommodationParty is the passengers of one booking on the cancelled flight.
+type reaccommodationParty struct {
+	booking   *Booking
+	segment   int
+	seats     []*Seat
+	seatClass string
+}
+
+// CancelFlight cancels a flight and moves its passengers to other flights.
+func CancelFlight(flightID string, cancellation FlightCancellation, svc *dynamodb.DynamoDB) (*Flight, *ReaccommodationReport, error) {
+	flight, err := UpdateFlightStatus(flightID, FlightStatusUpdate{
+		Status: FlightStatusCancelled,
+		Actor:  cancellation.Actor,
+		Reason: cancellation.Reason,
+	}, svc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := ReaccommodateFlight(flight.ID, cancellation.WindowHours, cancellation.Actor, svc)
+	if err != nil {
+		return flight, nil, fmt.Errorf("Flight was cancelled but re-accommodation failed, run it again: %v", err)
+	}
+	return flight, report, nil
+}
+
+// ReaccommodateFlight moves the parties still booked on a cancelled flight to
+// alternative flights or connections on the same route, departing within the
+// window around the cancelled departure. A party travels together, in its
+// own cabin when possible, and is moved in a single transaction that also
+// releases its old seats. It can be run again for the parties left behind.
+func ReaccommodateFlight(flightID string, windowHours int, actor string, svc *dynamodb.DynamoDB) (*ReaccommodationReport, error) {
+	if strings.TrimSpace(actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+	window := durationFromEnv("REACCOMMODATION_WINDOW_HOURS", time.Hour, defaultReaccommodationWindowHours)
+	if windowHours != 0 {
+		window = time.Duration(windowHours) * time.Hour
+	}
+	if window <= 0 || window > maxReaccommodationWindowHours*time.Hour {
+		return nil, fmt.Errorf("The window must be between 1 and %d hours", maxReaccommodationWindowHours)
+	}
+
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if flight.currentStatus() != FlightStatusCancelled {
+		return nil, errors.New("Only cancelled flights are re-accommodated")
+	}
+
+	report := &ReaccommodationReport{
+		FlightID:      flight.ID,
+		FlightNumber:  flight.FlightNumber,
+		OperatingDate: flight.operatingDate(),
+		WindowHours:   int(window / time.Hour),
+		Moved:         []ReaccommodatedParty{},
+		NotMoved:      []UnaccommodatedParty{},
+		ReleasedSeats: []ReleasedSeat{},
+		Actor:         actor,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	sections := map[string]*FlightSection{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		section, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		sections[flightSectionID] = section
+	}
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	parties, err := reaccommodationParties(flight, seats, sections, report, svc)
+	if err != nil {
+		return nil, err
+	}
+	for _, party := range parties {
+		moved, reason, err := reaccommodateParty(flight, party, window, svc)
+		if err != nil {
+			return report, err
+		}
+		if moved == nil {
+			report.NotMoved = append(report.NotMoved, UnaccommodatedParty{
+				BookingID:  party.booking.ID,
+				Passengers: len(party.seats),
+				SeatClass:  party.seatClass,
+				SeatIDs:    seatIDs(party.seats),
+				Reason:     reason,
+			})
+			continue
+		}
+		report.Moved = append(report.Moved, *moved)
+		for _, seat := range party.seats {
+			report.ReleasedSeats = append(report.ReleasedSeats, ReleasedSeat{SeatID: seat.ID, FlightSectionID: seat.FlightSectionID, BookingID: seat.BookingID, State: SeatStateBooked})
+		}
+	}
+
+	// Holds on a cancelled flight cannot turn into bookings any more.
+	for _, seat := range seats {
+		if !seat.IsHeld || seat.IsBooked {
+			continue
+		}
+		next := *seat
+		next.IsHeld = false
+		if err := updateSeatState(seat, &next, svc); err != nil {
+			fmt.Printf("Error releasing held Seat %s: %v\n", seat.ID, err)
+			continue
+		}
+		report.ReleasedSeats = append(report.ReleasedSeats, ReleasedSeat{SeatID: seat.ID, FlightSectionID: seat.FlightSectionID, State: SeatStateHeld})
+	}
+
+	if err := putReaccommodationReport(report, svc); err != nil {
+		return report, err
+	}
+
+	fmt.Printf("Re-accommodated Flight %s: moved=%d notMoved=%d released=%d\n", flight.ID, len(report.Moved), len(report.NotMoved), len(report.ReleasedSeats))
+	return report, nil
+}
+
+// reaccommodationParties groups the booked seats of the flight by booking,
+// in booking order. Seats booked without a booking are reported as not moved.
+func reaccommodationParties(flight *Flight, seats []*Seat, sections map[string]*FlightSection, report *ReaccommodationReport, svc *dynamodb.DynamoDB) ([]*reaccommodationParty, error) {
+	byID := map[string]*Seat{}
+	bookingIDs := []string{}
+	seen := map[string]bool{}
+	for _, seat := range seats {
+		if !seat.IsBooked {
+			continue
+		}
+		if seat.BookingID == "" {
+			report.NotMoved = append(report.NotMoved, UnaccommodatedParty{
+				Passengers: 1,
+				SeatClass:  sections[seat.FlightSectionID].SeatClass,
+				SeatIDs:    []string{seat.ID},
+				Reason:     "Seat is booked without a booking",
+			})
+			continue
+		}
+		byID[seat.ID] = seat
+		if !seen[seat.BookingID] {
+			seen[seat.BookingID] = true
+			bookingIDs = append(bookingIDs, seat.BookingID)
+		}
+	}
+
+	parties := []*reaccommodationParty{}
+	for _, bookingID := range bookingIDs {
+		booking, err := GetBookingByID(bookingID, svc)
+		if err != nil {
+			return nil, err
+		}
+		party := &reaccommodationParty{booking: booking, segment: -1}
+		for i, segment := range booking.Segments {
+			if segment.FlightID == flight.ID || (segment.FlightID == "" && segment.FlightNumber == flight.FlightNumber) {
+				party.segment = i
+				break
+			}
+		}
+		if party.segment >= 0 {
+			// Keep the passenger order of the segment.
+			for _, ref := range booking.Segments[party.segment].Seats {
+				if seat, ok := byID[ref.ID]; ok {
+					party.seats = append(party.seats, seat)
+				}
+			}
+		}
+		if len(party.seats) == 0 {
+			report.NotMoved = append(report.NotMoved, UnaccommodatedParty{
+				BookingID: bookingID,
+				Reason:    "Booking does not reference its seats on this flight",
+			})
+			continue
+		}
+		party.seatClass = partySeatClass(party.seats, sections)
+		parties = append(parties, party)
+	}
+
+	sort.SliceStable(parties, func(i, j int) bool {
+		return parties[i].booking.CreatedAt.Before(parties[j].booking.CreatedAt)
+	})
+	return parties, nil
+}
+
+// partySeatClass is the cabin most of the party sits in, the better one on a tie.
+func partySeatClass(seats []*Seat, sections map[string]*FlightSection) string {
+	counts := map[string]int{}
+	for _, seat := range seats {
+		counts[sections[seat.FlightSectionID].SeatClass]++
+	}
+	best := ""
+	for seatClass, count := range counts {
+		if best == "" || count > counts[best] || (count == counts[best] && seatClassRank(seatClass) < seatClassRank(best)) {
+			best = seatClass
+		}
+	}
+	return best
+}
+
+// reaccommodateParty tries the alternatives in the party's cabin first and
+// then in any cabin. It returns nil with a reason when none works out.
+func reaccommodateParty(flight *Flight, party *reaccommodationParty, window time.Duration, svc *dynamodb.DynamoDB) (*ReaccommodatedParty, string, error) {
+	booking := party.booking
+	from := flight.DepartureDate.Add(-window)
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	to := flight.DepartureDate.Add(window)
+
+	// The new flights must still connect with the rest of the booking, with
+	// at least the minimum connection time of the connecting airports.
+	var previous, next *Flight
+	var err error
+	if party.segment > 0 {
+		if previous, err = resolveSegmentFlight(booking.Segments[party.segment-1], svc); err != nil {
+			return nil, "", err
+		}
+		if earliest := flightArrival(*previous); from.Before(earliest) {
+			from = earliest
+		}
+	}
+	if party.segment < len(booking.Segments)-1 {
+		if next, err = resolveSegmentFlight(booking.Segments[party.segment+1], svc); err != nil {
+			return nil, "", err
+		}
+	}
+	mct := newConnectionTimes(svc)
+	reason := ""
+	if !from.Before(to) {
+		return nil, "No time left within the window", nil
+	}
+
+	for _, seatClass := range []string{party.seatClass, ""} {
+		itineraries, err := SearchItineraries(ItineraryQuery{
+			FlightSearchQuery: FlightSearchQuery{
+				Origin:        flight.OriginAirport,
+				Destination:   flight.DestinationAirport,
+				DepartureFrom: from,
+				DepartureTo:   to,
+				Passengers:    len(party.seats),
+				SeatClass:     seatClass,
+			},
+			MaxStops:      reaccommodationMaxStops,
+			MaxConnection: defaultMaxConnection,
+		}, svc)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Prefer the alternative arriving closest to the original arrival.
+		arrival := flightArrival(*flight)
+		sort.SliceStable(itineraries, func(i, j int) bool {
+			di, dj := absDuration(itineraries[i].ArrivalDate.Sub(arrival)), absDuration(itineraries[j].ArrivalDate.Sub(arrival))
+			if di != dj {
+				return di < dj
+			}
+			return itineraries[i].Stops < itineraries[j].Stops
+		})
+
+		for _, itinerary := range itineraries {
+			connects, err := connectsWithBooking(itinerary, previous, next, mct)
+			if err != nil {
+				return nil, "", err
+			}
+			if !connects {
+				continue
+			}
+			moved, err := moveParty(flight, party, itinerary, svc)
+			if err == errReaccommodationBookingChanged {
+				return nil, err.Error(), nil
+			}
+			if err == errReaccommodationTooLarge {
+				// A shorter itinerary may still fit in one transaction.
+				reason = err.Error()
+				continue
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if moved != nil {
+				moved.ArrivalDelayMinutes = int(itinerary.ArrivalDate.Sub(arrival) / time.Minute)
+				return moved, "", nil
+			}
+		}
+	}
+
+	if reason != "" {
+		return nil, reason, nil
+	}
+	return nil, fmt.Sprintf("No alternative with %d seats together within %d hours", len(party.seats), int(window/time.Hour)), nil
+}
+
+// connectsWithBooking reports whether the itinerary leaves at least the
+// minimum connection time after previous and before next, either may be nil.
+func connectsWithBooking(itinerary Itinerary, previous, next *Flight, mct *connectionTimes) (bool, error) {
+	pairs := [][2]*Flight{}
+	if previous != nil {
+		pairs = append(pairs, [2]*Flight{previous, &itinerary.Legs[0].Flight})
+	}
+	if next != nil {
+		pairs = append(pairs, [2]*Flight{&itinerary.Legs[len(itinerary.Legs)-1].Flight, next})
+	}
+	for _, pair := range pairs {
+		minimum, err := mct.minimum(pair[0], pair[1])
+		if err != nil {
+			return false, err
+		}
+		if pair[1].DepartureDate.Sub(flightArrival(*pair[0])) < minimum {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// moveParty seats the party on every leg of the itinerary and moves the
+// booking in one transaction. It returns nil when the seats are not available
+// together or were taken meanwhile, and an error when the move does not fit
+// in one transaction or the booking changed since it was read.
+func moveParty(flight *Flight, party *reaccommodationParty, itinerary Itinerary, svc *dynamodb.DynamoDB) (*ReaccommodatedParty, error) {
+	booking := party.booking
+	moved := &ReaccommodatedParty{BookingID: booking.ID, Passengers: len(party.seats), FromSeatClass: party.seatClass, Legs: []ReaccommodatedLeg{}}
+
+	writes := []*dynamodb.TransactWriteItem{}
+	counters := newAvailabilityDeltas()
+	segments := []BookingSegment{}
+	for _, leg := range itinerary.Legs {
+		legFlight := leg.Flight
+		seats, seatClass, err := pickPartySeats(&legFlight, len(party.seats), party.seatClass, svc)
+		if err != nil {
+			return nil, err
+		}
+		if seats == nil {
+			return nil, nil
+		}
+		if !strings.EqualFold(seatClass, party.seatClass) {
+			moved.ClassChanged = true
+		}
+
+		segment := BookingSegment{
+			FlightNumber:  legFlight.FlightNumber,
+			FlightID:      legFlight.ID,
+			OperatingDate: legFlight.operatingDate(),
+			OriginAirport: legFlight.OriginAirport,
+			Seats:         []SeatRef{},
+			SoldAs:        legFlight.FlightNumber,
+		}
+		// Keep selling under the same airline's number where it markets the new flight.
+		soldAs := booking.Segments[party.segment].SoldAs
+		if number := legFlight.numberFor(flight.airlineOf(soldAs)); soldAs != "" && number != "" {
+			segment.SoldAs = number
+		}
+		sections := []string{}
+		seen := map[string]bool{}
+		for _, seat := range seats {
+			next := *seat
+			next.IsBooked = true
+			next.IsHeld = false
+			next.BookingID = booking.ID
+			if err := releaseExpiredBlock(&next); err != nil {
+				return nil, nil
+			}
+			writes = append(writes, seatUpdate(seat, &next))
+			counters.add(seat.FlightNumber, seat.FlightSectionID, availabilityDelta{
+				Booked:  1,
+				Held:    -boolToInt(seat.IsHeld),
+				Blocked: -boolToInt(seat.IsBlocked),
+			})
+			segment.Seats = append(segment.Seats, SeatRef{ID: seat.ID, FlightSectionID: seat.FlightSectionID})
+			if !seen[seat.FlightSectionID] {
+				seen[seat.FlightSectionID] = true
+				sections = append(sections, seat.FlightSectionID)
+			}
+		}
+		segments = append(segments, segment)
+		writes = append(writes, flightOpenForSaleCheck(&legFlight, sections))
+		moved.Legs = append(moved.Legs, ReaccommodatedLeg{
+			FlightID:           legFlight.ID,
+			FlightNumber:       legFlight.FlightNumber,
+			OperatingDate:      legFlight.operatingDate(),
+			OriginAirport:      legFlight.OriginAirport,
+			DestinationAirport: legFlight.DestinationAirport,
+			DepartureDate:      legFlight.DepartureDate,
+			SeatClass:          seatClass,
+			SeatIDs:            seatIDs(seats),
+		})
+	}
+
+	for _, seat := range party.seats {
+		next := *seat
+		next.IsBooked = false
+		next.BookingID = ""
+		writes = append(writes, seatUpdate(seat, &next))
+		counters.add(seat.FlightNumber, seat.FlightSectionID, availabilityDelta{Booked: -1})
+	}
+
+	// The segments are replaced as a whole, so the update only goes through
+	// if they are still stored as they were when the party was planned.
+	read, err := readBookingSegments(booking, svc)
+	if err != nil {
+		return nil, err
+	}
+	updated := append([]BookingSegment{}, booking.Segments[:party.segment]...)
+	updated = append(updated, segments...)
+	updated = append(updated, booking.Segments[party.segment+1:]...)
+	segmentsValue, err := dynamodbattribute.Marshal(updated)
+	if err != nil {
+		return nil, err
+	}
+	bookingIndex := len(writes)
+	writes = append(writes, &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		TableName: aws.String("Bookings"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(booking.ID),
+			},
+		},
+		UpdateExpression:    aws.String("SET Segments = :segments"),
+		ConditionExpression: aws.String("Segments = :read"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":segments": segmentsValue,
+			":read":     read,
+		},
+	}})
+
+	counterWrites, err := counters.writes(svc)
+	if err != nil {
+		return nil, err
+	}
+	writes = append(writes, counterWrites...)
+	if len(writes) > maxTransactItems {
+		return nil, errReaccommodationTooLarge
+	}
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	if err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			reasons := canceled.CancellationReasons
+			if len(reasons) > bookingIndex && reasons[bookingIndex].Code != nil && *reasons[bookingIndex].Code == "ConditionalCheckFailed" {
+				return nil, errReaccommodationBookingChanged
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	booking.Segments = updated
+	return moved, nil
+}
+
+var (
+	errReaccommodationTooLarge       = fmt.Errorf("Moving the party takes more than the %d writes of one transaction", maxTransactItems)
+	errReaccommodationBookingChanged = errors.New("Booking was changed while it was reaccommodated")
+)
+
+// readBookingSegments returns the segments of the booking as they are
+// stored, or errReaccommodationBookingChanged when they no longer match the
+// booking as it was read.
+func readBookingSegments(booking *Booking, svc *dynamodb.DynamoDB) (*dynamodb.AttributeValue, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("Bookings"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(booking.ID),
+			},
+		},
+		ProjectionExpression: aws.String("Segments"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil || result.Item["Segments"] == nil {
+		return nil, errReaccommodationBookingChanged
+	}
+
+	stored := []BookingSegment{}
+	if err := dynamodbattribute.Unmarshal(result.Item["Segments"], &stored); err != nil {
+		return nil, err
+	}
+	// Round trip the booking's segments so both sides drop the flight status
+	// and gates filled in on read.
+	value, err := dynamodbattribute.Marshal(booking.Segments)
+	if err != nil {
+		return nil, err
+	}
+	expected := []BookingSegment{}
+	if err := dynamodbattribute.Unmarshal(value, &expected); err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(stored, expected) {
+		return nil, errReaccommodationBookingChanged
+	}
+	return result.Item["Segments"], nil
+}
+
+// pickPartySeats finds free seats on a flight that keep a party together,
+// preferring its own cabin, then a better one, then a worse one. Within a
+// cabin the seats closest together in a single section win. It returns nil
+// when no cabin has enough free seats.
+func pickPartySeats(flight *Flight, passengers int, seatClass string, svc *dynamodb.DynamoDB) ([]*Seat, string, error) {
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	free := map[string][]*Seat{}
+	for _, seat := range seats {
+		if !seat.IsBooked && !seat.IsHeld && !seat.isBlockActive(now) {
+			free[seat.FlightSectionID] = append(free[seat.FlightSectionID], seat)
+		}
+	}
+
+	sectionsByClass := map[string][]string{}
+	classes := []string{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		section, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return nil, "", err
+		}
+		key := strings.ToLower(section.SeatClass)
+		if _, ok := sectionsByClass[key]; !ok {
+			classes = append(classes, section.SeatClass)
+		}
+		sectionsByClass[key] = append(sectionsByClass[key], flightSectionID)
+	}
+	rank := seatClassRank(seatClass)
+	sort.SliceStable(classes, func(i, j int) bool {
+		return classPreference(rank, seatClassRank(classes[i])) < classPreference(rank, seatClassRank(classes[j]))
+	})
+
+	for _, candidate := range classes {
+		var best []*Seat
+		bestSpread := 0
+		for _, flightSectionID := range sectionsByClass[strings.ToLower(candidate)] {
+			sectionSeats := free[flightSectionID]
+			sort.Slice(sectionSeats, func(i, j int) bool {
+				if sectionSeats[i].Row != sectionSeats[j].Row {
+					return sectionSeats[i].Row < sectionSeats[j].Row
+				}
+				return sectionSeats[i].Col < sectionSeats[j].Col
+			})
+			for start := 0; start+passengers <= len(sectionSeats); start++ {
+				group := sectionSeats[start : start+passengers]
+				spread := seatGroupSpread(group)
+				if best == nil || spread < bestSpread {
+					best, bestSpread = group, spread
+				}
+			}
+		}
+		if best != nil {
+			return append([]*Seat{}, best...), candidate, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// classPreference orders cabins by distance from the wanted one, a better
+// cabin before a worse one at the same distance.
+func classPreference(wanted, rank int) int {
+	diff := rank - wanted
+	if diff < 0 {
+		return -2*diff - 1
+	}
+	return 2 * diff
+}
+
+// seatGroupSpread is how far apart a group of seats sorted by row and column
+// sits: rows spanned weigh more than gaps within a row.
+func seatGroupSpread(group []*Seat) int {
+	spread := (group[len(group)-1].Row - group[0].Row) * 100
+	for i := 1; i < len(group); i++ {
+		if group[i].Row == group[i-1].Row {
+			spread += group[i].Col - group[i-1].Col - 1
+		}
+	}
+	return spread
+}
+
+func seatIDs(seats []*Seat) []string {
+	ids := make([]string, len(seats))
+	for i, seat := range seats {
+		ids[i] = seat.ID
+	}
+	return ids
+}
+
+func putReaccommodationReport(report *ReaccommodationReport, svc *dynamodb.DynamoDB) error {
+	if !doesTableExist("Reaccommodations", svc) {
+		if err := createReaccommodationsTable(svc); err != nil {
+			fmt.Printf("Error creating Reaccommodations table: %v\n", err)
+		}
+	}
+
+	moved, err := dynamodbattribute.Marshal(report.Moved)
+	if err != nil {
+		return err
+	}
+	notMoved, err := dynamodbattribute.Marshal(report.NotMoved)
+	if err != nil {
+		return err
+	}
+	released, err := dynamodbattribute.Marshal(report.ReleasedSeats)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("Reaccommodations"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"FlightID": {
+				S: aws.String(report.FlightID),
+			},
+			"CreatedAt": {
+				S: aws.String(report.CreatedAt.Format(time.RFC3339Nano)),
+			},
+			"FlightNumber": {
+				S: aws.String(report.FlightNumber),
+			},
+			"OperatingDate": {
+				S: aws.String(report.OperatingDate),
+			},
+			"WindowHours": {
+				N: aws.String(fmt.Sprintf("%d", report.WindowHours)),
+			},
+			"Moved":         moved,
+			"NotMoved":      notMoved,
+			"ReleasedSeats": released,
+			"Actor": {
+				S: aws.String(report.Actor),
+			},
+		},
+	})
+	return err
+}
+
+// GetReaccommodationReports returns the re-accommodation runs of a flight, oldest first.
+func GetReaccommodationReports(flightID string, svc *dynamodb.DynamoDB) ([]ReaccommodationReport, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("Reaccommodations"),
+		KeyConditionExpression: aws.String("FlightID = :flightID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":flightID": {
+				S: aws.String(flightID),
+			},
+		},
+	}
+
+	reports := []ReaccommodationReport{}
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var report ReaccommodationReport
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &report); unmarshalErr != nil {
+				return false
+			}
+			reports = append(reports, report)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	return reports, nil
+}
+
+func createReaccommodationsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("Reaccommodations"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("FlightID"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("CreatedAt"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("FlightID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("CreatedAt"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Reaccommodations table created successfully")
+	return nil
+}
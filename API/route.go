@@ -0,0 +1,579 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+// Route statuses. Flights can only be created on ACTIVE routes; changing the
+// status of a route does not touch the flights already created on it.
+const (
+	RouteStatusPlanned      = "PLANNED"
+	RouteStatusActive       = "ACTIVE"
+	RouteStatusSuspended    = "SUSPENDED"
+	RouteStatusDiscontinued = "DISCONTINUED"
+)
+
+var routeStatuses = map[string]bool{
+	RouteStatusPlanned:      true,
+	RouteStatusActive:       true,
+	RouteStatusSuspended:    true,
+	RouteStatusDiscontinued: true,
+}
+
+var (
+	errRouteNotApproved = errors.New("Route is not approved")
+	errRouteOverlaps    = errors.New("The airline already has this route in the same period")
+)
+
+// Route is a city pair an airline is approved to operate in one direction.
+type Route struct {
+	ID                 string  `json:"id"`
+	AirlineID          string  `json:"airlineID"`
+	OriginAirport      string  `json:"originAirport"`
+	DestinationAirport string  `json:"destinationAirport"`
+	DistanceKm         float64 `json:"distanceKm,omitempty"`
+	// Status is PLANNED when omitted on creation.
+	Status string `json:"status"`
+	// ValidFrom and ValidTo limit a seasonal route to inclusive YYYY-MM-DD
+	// operating dates; either may be empty for an open-ended route.
+	ValidFrom string `json:"validFrom,omitempty"`
+	ValidTo   string `json:"validTo,omitempty"`
+	// AircraftType and AircraftConfiguration are the defaults of schedules
+	// created on the route, e.g. "320" and "C20Y150".
+	AircraftType          string `json:"aircraftType,omitempty"`
+	AircraftConfiguration string `json:"aircraftConfiguration,omitempty"`
+}
+
+// AirlineNetwork is the route map of an airline.
+type AirlineNetwork struct {
+	AirlineID string   `json:"airlineID"`
+	Airports  []string `json:"airports"`
+	Routes    []*Route `json:"routes"`
+}
+
+// AirportNetwork lists the routes of all airlines from and to an airport.
+type AirportNetwork struct {
+	Airport    string   `json:"airport"`
+	Airlines   []string `json:"airlines"`
+	Departures []*Route `json:"departures"`
+	Arrivals   []*Route `json:"arrivals"`
+}
+
+func (route *Route) operatesOn(date string) bool {
+	return (route.ValidFrom == "" || date >= route.ValidFrom) && (route.ValidTo == "" || date <= route.ValidTo)
+}
+
+// overlaps reports whether two routes between the same airports share an
+// operating date.
+func (route *Route) overlaps(other *Route) bool {
+	endsBefore := func(a, b *Route) bool { return a.ValidTo != "" && b.ValidFrom != "" && a.ValidTo < b.ValidFrom }
+	return !endsBefore(route, other) && !endsBefore(other, route)
+}
+
+// ValidateRoute checks a route, normalizes its codes and sets its distance.
+func ValidateRoute(route *Route, svc *dynamodb.DynamoDB) error {
+	route.OriginAirport = strings.ToUpper(strings.TrimSpace(route.OriginAirport))
+	route.DestinationAirport = strings.ToUpper(strings.TrimSpace(route.DestinationAirport))
+	route.Status = strings.ToUpper(strings.TrimSpace(route.Status))
+	route.AircraftType = strings.ToUpper(strings.TrimSpace(route.AircraftType))
+	route.AircraftConfiguration = strings.ToUpper(strings.TrimSpace(route.AircraftConfiguration))
+
+	if route.Status == "" {
+		route.Status = RouteStatusPlanned
+	}
+	if !routeStatuses[route.Status] {
+		return fmt.Errorf("Status must be one of %s, %s, %s or %s", RouteStatusPlanned, RouteStatusActive, RouteStatusSuspended, RouteStatusDiscontinued)
+	}
+	if route.OriginAirport == route.DestinationAirport {
+		return errors.New("OriginAirport and DestinationAirport must differ")
+	}
+	for _, date := range []struct{ name, value string }{{"ValidFrom", route.ValidFrom}, {"ValidTo", route.ValidTo}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date.value); err != nil {
+			return fmt.Errorf("%s must be formatted as YYYY-MM-DD", date.name)
+		}
+	}
+	if route.ValidFrom != "" && route.ValidTo != "" && route.ValidTo < route.ValidFrom {
+		return errors.New("ValidTo is before ValidFrom")
+	}
+
+	if _, err := GetAirlineByID(route.AirlineID, svc); err != nil {
+		return fmt.Errorf("Airline %s does not exist", route.AirlineID)
+	}
+	origin, err := GetAirportByCode(route.OriginAirport, svc)
+	if err != nil {
+		return errors.New("OriginAirport does not exist")
+	}
+	destination, err := GetAirportByCode(route.DestinationAirport, svc)
+	if err != nil {
+		return errors.New("DestinationAirport does not exist")
+	}
+	route.DistanceKm, _ = airportDistanceKm(origin, destination)
+	return nil
+}
+
+// checkRouteOverlap fails if the airline has another route than exceptID
+// between the same airports whose validity overlaps. Discontinued routes
+// are ignored.
+func checkRouteOverlap(route *Route, exceptID string, svc *dynamodb.DynamoDB) error {
+	if route.Status == RouteStatusDiscontinued {
+		return nil
+	}
+	existing, err := getAirlineRoutesBetween(route.AirlineID, route.OriginAirport, route.DestinationAirport, svc)
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.ID != exceptID && other.Status != RouteStatusDiscontinued && route.overlaps(other) {
+			return errRouteOverlaps
+		}
+	}
+	return nil
+}
+
+func CreateRoute(route Route, svc *dynamodb.DynamoDB) (*Route, error) {
+	if err := ValidateRoute(&route, svc); err != nil {
+		return nil, err
+	}
+	if !doesTableExist("Routes", svc) {
+		if err := createRoutesTable(svc); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRouteOverlap(&route, "", svc); err != nil {
+		return nil, err
+	}
+
+	route.ID = uuid.New().String()
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("Routes"),
+		Item:                routeItem(&route),
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created Route: ID=%s, AirlineID=%s, Route=%s-%s, Status=%s\n", route.ID, route.AirlineID, route.OriginAirport, route.DestinationAirport, route.Status)
+	return &route, nil
+}
+
+// UpdateRoute changes the status, validity and default aircraft of a route.
+// Its airline and airports cannot be changed.
+func UpdateRoute(routeID string, route Route, svc *dynamodb.DynamoDB) (*Route, error) {
+	existing, err := GetRouteByID(routeID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if route.AirlineID == "" {
+		route.AirlineID = existing.AirlineID
+	}
+	if route.OriginAirport == "" {
+		route.OriginAirport = existing.OriginAirport
+	}
+	if route.DestinationAirport == "" {
+		route.DestinationAirport = existing.DestinationAirport
+	}
+	if route.Status == "" {
+		route.Status = existing.Status
+	}
+	if err := ValidateRoute(&route, svc); err != nil {
+		return nil, err
+	}
+	if route.AirlineID != existing.AirlineID || route.OriginAirport != existing.OriginAirport || route.DestinationAirport != existing.DestinationAirport {
+		return nil, errors.New("The airline and airports of a route cannot be changed")
+	}
+	if err := checkRouteOverlap(&route, existing.ID, svc); err != nil {
+		return nil, err
+	}
+
+	route.ID = existing.ID
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("Routes"),
+		Item:                routeItem(&route),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Updated Route: ID=%s, Status=%s\n", route.ID, route.Status)
+	return &route, nil
+}
+
+func routeItem(route *Route) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(route.ID),
+		},
+		"AirlineID": {
+			S: aws.String(route.AirlineID),
+		},
+		"OriginAirport": {
+			S: aws.String(route.OriginAirport),
+		},
+		"DestinationAirport": {
+			S: aws.String(route.DestinationAirport),
+		},
+		"Route": {
+			S: aws.String(flightRoute(route.OriginAirport, route.DestinationAirport)),
+		},
+		"Status": {
+			S: aws.String(route.Status),
+		},
+	}
+	if route.DistanceKm > 0 {
+		item["DistanceKm"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(route.DistanceKm, 'f', -1, 64))}
+	}
+	optional := map[string]string{
+		"ValidFrom":             route.ValidFrom,
+		"ValidTo":               route.ValidTo,
+		"AircraftType":          route.AircraftType,
+		"AircraftConfiguration": route.AircraftConfiguration,
+	}
+	for name, value := range optional {
+		if value != "" {
+			item[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		}
+	}
+	return item
+}
+
+func GetRouteByID(routeID string, svc *dynamodb.DynamoDB) (*Route, error) {
+	if !doesTableExist("Routes", svc) {
+		return nil, errors.New("Route not found")
+	}
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("Routes"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(routeID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errors.New("Route not found")
+	}
+
+	route := &Route{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// queryRoutes returns the routes of an index partition, optionally narrowed
+// by a key condition on its range key.
+func queryRoutes(input *dynamodb.QueryInput, svc *dynamodb.DynamoDB) ([]*Route, error) {
+	routes := []*Route{}
+	if !doesTableExist("Routes", svc) {
+		return routes, nil
+	}
+	input.TableName = aws.String("Routes")
+
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			route := &Route{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, route); unmarshalErr != nil {
+				return false
+			}
+			routes = append(routes, route)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return routes, unmarshalErr
+}
+
+func getAirlineRoutes(airlineID string, svc *dynamodb.DynamoDB) ([]*Route, error) {
+	return queryRoutes(&dynamodb.QueryInput{
+		IndexName:              aws.String("AirlineRouteIndex"),
+		KeyConditionExpression: aws.String("AirlineID = :airline"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":airline": {
+				S: aws.String(airlineID),
+			},
+		},
+	}, svc)
+}
+
+func getAirlineRoutesBetween(airlineID, origin, destination string, svc *dynamodb.DynamoDB) ([]*Route, error) {
+	return queryRoutes(&dynamodb.QueryInput{
+		IndexName:              aws.String("AirlineRouteIndex"),
+		KeyConditionExpression: aws.String("AirlineID = :airline AND #Route = :route"),
+		ExpressionAttributeNames: map[string]*string{
+			"#Route": aws.String("Route"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":airline": {
+				S: aws.String(airlineID),
+			},
+			":route": {
+				S: aws.String(flightRoute(origin, destination)),
+			},
+		},
+	}, svc)
+}
+
+func getAirportRoutes(indexName, attribute, code string, svc *dynamodb.DynamoDB) ([]*Route, error) {
+	return queryRoutes(&dynamodb.QueryInput{
+		IndexName:              aws.String(indexName),
+		KeyConditionExpression: aws.String(attribute + " = :code"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":code": {
+				S: aws.String(code),
+			},
+		},
+	}, svc)
+}
+
+// filterRoutes keeps the routes with the given status that operate on date;
+// an empty status or date matches every route.
+func filterRoutes(routes []*Route, status, date string) []*Route {
+	filtered := []*Route{}
+	for _, route := range routes {
+		if status != "" && route.Status != strings.ToUpper(status) {
+			continue
+		}
+		if date != "" && !route.operatesOn(date) {
+			continue
+		}
+		filtered = append(filtered, route)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if a.OriginAirport != b.OriginAirport {
+			return a.OriginAirport < b.OriginAirport
+		}
+		if a.DestinationAirport != b.DestinationAirport {
+			return a.DestinationAirport < b.DestinationAirport
+		}
+		return a.ValidFrom < b.ValidFrom
+	})
+	return filtered
+}
+
+// GetAirlineNetwork returns the routes of an airline and the airports they
+// serve, filtered by status and operating date when those are set.
+func GetAirlineNetwork(airlineID, status, date string, svc *dynamodb.DynamoDB) (*AirlineNetwork, error) {
+	if _, err := GetAirlineByID(airlineID, svc); err != nil {
+		return nil, err
+	}
+	routes, err := getAirlineRoutes(airlineID, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	network := &AirlineNetwork{AirlineID: airlineID, Airports: []string{}, Routes: filterRoutes(routes, status, date)}
+	airports := map[string]bool{}
+	for _, route := range network.Routes {
+		for _, code := range []string{route.OriginAirport, route.DestinationAirport} {
+			if !airports[code] {
+				airports[code] = true
+				network.Airports = append(network.Airports, code)
+			}
+		}
+	}
+	sort.Strings(network.Airports)
+	return network, nil
+}
+
+// GetAirportNetwork returns the routes of every airline from and to an
+// airport, given by IATA or ICAO code, filtered by status and operating date
+// when those are set.
+func GetAirportNetwork(code, status, date string, svc *dynamodb.DynamoDB) (*AirportNetwork, error) {
+	airport, err := LookupAirport(code, svc)
+	if err != nil {
+		return nil, err
+	}
+	code = airport.Code
+	departures, err := getAirportRoutes("OriginIndex", "OriginAirport", code, svc)
+	if err != nil {
+		return nil, err
+	}
+	arrivals, err := getAirportRoutes("DestinationIndex", "DestinationAirport", code, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	network := &AirportNetwork{
+		Airport:    code,
+		Airlines:   []string{},
+		Departures: filterRoutes(departures, status, date),
+		Arrivals:   filterRoutes(arrivals, status, date),
+	}
+	airlines := map[string]bool{}
+	for _, route := range append(append([]*Route{}, network.Departures...), network.Arrivals...) {
+		if !airlines[route.AirlineID] {
+			airlines[route.AirlineID] = true
+			network.Airlines = append(network.Airlines, route.AirlineID)
+		}
+	}
+	sort.Strings(network.Airlines)
+	return network, nil
+}
+
+// activeRoute returns the ACTIVE route of an airline between two airports
+// that operates on date, or an error wrapping errRouteNotApproved.
+func activeRoute(airlineID, origin, destination, date string, svc *dynamodb.DynamoDB) (*Route, error) {
+	routes, err := getAirlineRoutesBetween(airlineID, origin, destination, svc)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		if route.Status == RouteStatusActive && route.operatesOn(date) {
+			return route, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: the airline has no active route %s-%s on %s", errRouteNotApproved, strings.ToUpper(origin), strings.ToUpper(destination), date)
+}
+
+// applyRouteDefaults fills in the aircraft a schedule leaves empty from the
+// route it starts operating on. Schedules on routes that are not active yet
+// keep them empty.
+func applyRouteDefaults(schedule *Schedule, svc *dynamodb.DynamoDB) error {
+	if schedule.AircraftType != "" && schedule.AircraftConfiguration != "" {
+		return nil
+	}
+	route, err := activeRoute(schedule.AirlineID, schedule.OriginAirport, schedule.DestinationAirport, schedule.ValidFrom, svc)
+	if errors.Is(err, errRouteNotApproved) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if schedule.AircraftType == "" {
+		schedule.AircraftType = route.AircraftType
+	}
+	if schedule.AircraftConfiguration == "" {
+		schedule.AircraftConfiguration = route.AircraftConfiguration
+	}
+	return nil
+}
+
+// BackfillRoutes creates an ACTIVE, open-ended route for every airline and
+// city pair that has flights but no route yet, so that flights created before
+// routes existed can keep operating. Flights without an airline are skipped.
+func BackfillRoutes(svc *dynamodb.DynamoDB) (int, error) {
+	if !doesTableExist("Routes", svc) {
+		if err := createRoutesTable(svc); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("Routes table is being created, retry once it is active")
+	}
+
+	seen := map[string]bool{}
+	pending := []Route{}
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String("Flights"),
+		ProjectionExpression: aws.String("AirlineID, OriginAirport, DestinationAirport"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if err := dynamodbattribute.UnmarshalMap(item, &flight); err != nil || flight.AirlineID == "" {
+				continue
+			}
+			key := flight.AirlineID + "#" + flightRoute(flight.OriginAirport, flight.DestinationAirport)
+			if !seen[key] {
+				seen[key] = true
+				pending = append(pending, Route{AirlineID: flight.AirlineID, OriginAirport: flight.OriginAirport, DestinationAirport: flight.DestinationAirport, Status: RouteStatusActive})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, route := range pending {
+		existing, err := getAirlineRoutesBetween(route.AirlineID, route.OriginAirport, route.DestinationAirport, svc)
+		if err != nil {
+			return created, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+		if _, err := CreateRoute(route, svc); err != nil {
+			return created, fmt.Errorf("Route %s-%s of airline %s: %v", route.OriginAirport, route.DestinationAirport, route.AirlineID, err)
+		}
+		created++
+	}
+	return created, nil
+}
+
+func createRoutesTable(svc *dynamodb.DynamoDB) error {
+	index := func(name string, keys ...string) *dynamodb.GlobalSecondaryIndex {
+		keySchema := []*dynamodb.KeySchemaElement{{AttributeName: aws.String(keys[0]), KeyType: aws.String("HASH")}}
+		if len(keys) > 1 {
+			keySchema = append(keySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(keys[1]), KeyType: aws.String("RANGE")})
+		}
+		return &dynamodb.GlobalSecondaryIndex{
+			IndexName: aws.String(name),
+			KeySchema: keySchema,
+			Projection: &dynamodb.Projection{
+				ProjectionType: aws.String("ALL"),
+			},
+			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(5),
+				WriteCapacityUnits: aws.Int64(5),
+			},
+		}
+	}
+
+	attributeDefinitions := []*dynamodb.AttributeDefinition{}
+	for _, name := range []string{"ID", "AirlineID", "Route", "OriginAirport", "DestinationAirport"} {
+		attributeDefinitions = append(attributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String("S"),
+		})
+	}
+
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("Routes"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: attributeDefinitions,
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			// AirlineRouteIndex finds the routes of an airline, optionally
+			// narrowed to one city pair.
+			index("AirlineRouteIndex", "AirlineID", "Route"),
+			index("OriginIndex", "OriginAirport"),
+			index("DestinationIndex", "DestinationAirport"),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Routes table created successfully")
+	return nil
+}
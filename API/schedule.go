@@ -0,0 +1,930 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// Lambda images carry no zoneinfo, so embed it for schedule time zones.
+	_ "time/tzdata"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+// Limits of the rolling generation horizon, in days.
+const (
+	defaultScheduleHorizon = 60
+	maxScheduleHorizon     = 365
+)
+
+// Schedule describes a flight operating on a weekly pattern. The generator
+// turns it into one dated Flight per operating day.
+type Schedule struct {
+	ID                 string `json:"id"`
+	FlightNumber       string `json:"flightNumber"`
+	AirlineID          string `json:"airlineID"`
+	OriginAirport      string `json:"originAirport"`
+	DestinationAirport string `json:"destinationAirport"`
+	// DepartureTime is the local departure time at the origin, e.g. "07:45".
+	DepartureTime string `json:"departureTime"`
+	// Timezone is the IANA zone of DepartureTime, UTC when empty.
+	Timezone     string `json:"timezone"`
+	BlockMinutes int    `json:"blockMinutes"`
+	// DaysOfWeek uses the SSIM pattern with Monday first, e.g. "1234567" or "1.3.5..".
+	DaysOfWeek string `json:"daysOfWeek"`
+	ValidFrom  string `json:"validFrom"`
+	ValidTo    string `json:"validTo"`
+	// FlightSectionIDs are the template sections copied onto every generated flight.
+	FlightSectionIDs []string `json:"flightSectionIDs"`
+	// AircraftType and AircraftConfiguration are informational, e.g. "320" and "C20Y150".
+	AircraftType          string `json:"aircraftType,omitempty"`
+	AircraftConfiguration string `json:"aircraftConfiguration,omitempty"`
+}
+
+// scheduleInstance records the flight generated for one operating date.
+type scheduleInstance struct {
+	ScheduleID       string
+	OperatingDate    string
+	FlightID         string
+	FlightNumber     string
+	OriginAirport    string
+	FlightSectionIDs []string
+	// Signature captures the schedule fields the flight was generated from.
+	Signature string
+}
+
+type ScheduleSkip struct {
+	OperatingDate string `json:"operatingDate"`
+	Reason        string `json:"reason"`
+}
+
+// ScheduleGenerationReport lists the operating dates touched by one generation run.
+type ScheduleGenerationReport struct {
+	ScheduleID string         `json:"scheduleID"`
+	Created    []string       `json:"created"`
+	Updated    []string       `json:"updated"`
+	Removed    []string       `json:"removed"`
+	Unchanged  int            `json:"unchanged"`
+	Skipped    []ScheduleSkip `json:"skipped"`
+	// ScheduleChanges are the IDs of the changes made to flights with bookings.
+	ScheduleChanges []string `json:"scheduleChanges"`
+}
+
+func validateDaysOfWeek(pattern string) error {
+	if len(pattern) != 7 {
+		return errors.New("DaysOfWeek must have 7 positions, Monday first")
+	}
+	operating := false
+	for i, day := range pattern {
+		if day == '.' || day == ' ' {
+			continue
+		}
+		if day != rune('1'+i) {
+			return fmt.Errorf("DaysOfWeek position %d must be %c or '.'", i+1, '1'+i)
+		}
+		operating = true
+	}
+	if !operating {
+		return errors.New("DaysOfWeek must include at least one day")
+	}
+	return nil
+}
+
+func (schedule *Schedule) location() (*time.Location, error) {
+	if schedule.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(schedule.Timezone)
+}
+
+func validateSchedule(schedule Schedule, svc *dynamodb.DynamoDB) error {
+	if err := validateScheduleDetails(schedule, svc); err != nil {
+		return err
+	}
+	if len(schedule.FlightSectionIDs) == 0 {
+		return errors.New("At least one FlightSectionID is required")
+	}
+	if !doFlightSectionsExist(schedule.FlightSectionIDs, svc) {
+		return errors.New("One or more flightsection values do not exist")
+	}
+	return nil
+}
+
+// validateScheduleDetails checks everything of a schedule but its sections,
+// which an SSIM import only creates once the whole file is valid.
+func validateScheduleDetails(schedule Schedule, svc *dynamodb.DynamoDB) error {
+	if strings.TrimSpace(schedule.FlightNumber) == "" {
+		return errors.New("FlightNumber is required")
+	}
+	if strings.TrimSpace(schedule.AirlineID) == "" {
+		return errors.New("AirlineID is required")
+	}
+	if err := ValidateAirportCode(schedule.OriginAirport); err != nil {
+		return errors.New("OriginAirport: " + err.Error())
+	}
+	if err := ValidateAirportCode(schedule.DestinationAirport); err != nil {
+		return errors.New("DestinationAirport: " + err.Error())
+	}
+	if strings.EqualFold(schedule.OriginAirport, schedule.DestinationAirport) {
+		return errors.New("OriginAirport and DestinationAirport must differ")
+	}
+	if _, err := time.Parse("15:04", schedule.DepartureTime); err != nil {
+		return errors.New("DepartureTime must be formatted as HH:MM")
+	}
+	if _, err := schedule.location(); err != nil {
+		return fmt.Errorf("Timezone %q is not a known IANA time zone", schedule.Timezone)
+	}
+	if schedule.BlockMinutes <= 0 {
+		return errors.New("BlockMinutes must be greater than 0")
+	}
+	if err := validateDaysOfWeek(schedule.DaysOfWeek); err != nil {
+		return err
+	}
+	validFrom, err := time.Parse("2006-01-02", schedule.ValidFrom)
+	if err != nil {
+		return errors.New("ValidFrom must be formatted as YYYY-MM-DD")
+	}
+	validTo, err := time.Parse("2006-01-02", schedule.ValidTo)
+	if err != nil {
+		return errors.New("ValidTo must be formatted as YYYY-MM-DD")
+	}
+	if validTo.Before(validFrom) {
+		return errors.New("ValidTo is before ValidFrom")
+	}
+	airline, err := GetAirlineByID(schedule.AirlineID, svc)
+	if err != nil {
+		return err
+	}
+	if err := ValidateFlightNumber(schedule.FlightNumber, airline.Code); err != nil {
+		return err
+	}
+	if !airline.isActive() {
+		return fmt.Errorf("Airline %s is not active", airline.Code)
+	}
+	if !doesAirportExist(schedule.OriginAirport, svc) {
+		return errors.New("OriginAirport does not exist")
+	}
+	if !doesAirportExist(schedule.DestinationAirport, svc) {
+		return errors.New("DestinationAirport does not exist")
+	}
+	return nil
+}
+
+func CreateSchedule(schedule Schedule, svc *dynamodb.DynamoDB) (*Schedule, error) {
+	if err := validateSchedule(schedule, svc); err != nil {
+		return nil, err
+	}
+	if err := applyRouteDefaults(&schedule, svc); err != nil {
+		return nil, err
+	}
+	ensureScheduleTables(svc)
+
+	schedule.ID = uuid.New().String()
+	if err := putSchedule(schedule, "attribute_not_exists(ID)", svc); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created Schedule: ID=%s, FlightNumber=%s\n", schedule.ID, schedule.FlightNumber)
+	return &schedule, nil
+}
+
+// UpdateSchedule replaces a schedule. Generated flights follow the change on
+// the next generation run.
+func UpdateSchedule(scheduleID string, schedule Schedule, svc *dynamodb.DynamoDB) (*Schedule, error) {
+	if err := validateSchedule(schedule, svc); err != nil {
+		return nil, err
+	}
+	if err := applyRouteDefaults(&schedule, svc); err != nil {
+		return nil, err
+	}
+
+	schedule.ID = scheduleID
+	if err := putSchedule(schedule, "attribute_exists(ID)", svc); err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return nil, errors.New("Schedule not found")
+		}
+		return nil, err
+	}
+
+	fmt.Printf("Updated Schedule: ID=%s\n", schedule.ID)
+	return &schedule, nil
+}
+
+func putSchedule(schedule Schedule, condition string, svc *dynamodb.DynamoDB) error {
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("Schedules"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(schedule.ID),
+			},
+			"FlightNumber": {
+				S: aws.String(schedule.FlightNumber),
+			},
+			"AirlineID": {
+				S: aws.String(schedule.AirlineID),
+			},
+			"OriginAirport": {
+				S: aws.String(strings.ToUpper(schedule.OriginAirport)),
+			},
+			"DestinationAirport": {
+				S: aws.String(strings.ToUpper(schedule.DestinationAirport)),
+			},
+			"DepartureTime": {
+				S: aws.String(schedule.DepartureTime),
+			},
+			"Timezone": {
+				S: aws.String(schedule.Timezone),
+			},
+			"BlockMinutes": {
+				N: aws.String(fmt.Sprintf("%d", schedule.BlockMinutes)),
+			},
+			"DaysOfWeek": {
+				S: aws.String(schedule.DaysOfWeek),
+			},
+			"ValidFrom": {
+				S: aws.String(schedule.ValidFrom),
+			},
+			"ValidTo": {
+				S: aws.String(schedule.ValidTo),
+			},
+			"FlightSectionIDs": {
+				L: stringListValue(schedule.FlightSectionIDs),
+			},
+		},
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+	if schedule.AircraftType != "" {
+		input.Item["AircraftType"] = &dynamodb.AttributeValue{S: aws.String(schedule.AircraftType)}
+	}
+	if schedule.AircraftConfiguration != "" {
+		input.Item["AircraftConfiguration"] = &dynamodb.AttributeValue{S: aws.String(schedule.AircraftConfiguration)}
+	}
+
+	_, err := svc.PutItem(input)
+	return err
+}
+
+func GetScheduleByID(scheduleID string, svc *dynamodb.DynamoDB) (*Schedule, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("Schedules"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(scheduleID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, errors.New("Schedule not found")
+	}
+
+	schedule := &Schedule{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func GetAllSchedules(svc *dynamodb.DynamoDB) ([]Schedule, error) {
+	schedules := []Schedule{}
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String("Schedules"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var schedule Schedule
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &schedule); unmarshalErr != nil {
+				return false
+			}
+			schedules = append(schedules, schedule)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return schedules, nil
+}
+
+// operatesOn reports whether the schedule operates on a local calendar date.
+func (schedule *Schedule) operatesOn(date time.Time) bool {
+	if date.Format("2006-01-02") < schedule.ValidFrom || date.Format("2006-01-02") > schedule.ValidTo {
+		return false
+	}
+	// Go counts weekdays from Sunday, the pattern from Monday.
+	day := (int(date.Weekday()) + 6) % 7
+	return schedule.DaysOfWeek[day] != '.' && schedule.DaysOfWeek[day] != ' '
+}
+
+// departureOn returns the departure instant on a local calendar date.
+func (schedule *Schedule) departureOn(date time.Time, location *time.Location) time.Time {
+	clock, _ := time.Parse("15:04", schedule.DepartureTime)
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+}
+
+// signatureOn identifies what the flight of a date is generated from, so a
+// run can tell whether an existing flight is still up to date.
+func (schedule *Schedule) signatureOn(date time.Time, location *time.Location) string {
+	return strings.Join([]string{
+		schedule.FlightNumber,
+		schedule.AirlineID,
+		flightRoute(schedule.OriginAirport, schedule.DestinationAirport),
+		schedule.departureOn(date, location).UTC().Format(time.RFC3339),
+		fmt.Sprintf("%d", schedule.BlockMinutes),
+		strings.Join(schedule.FlightSectionIDs, ","),
+	}, "|")
+}
+
+// GenerateScheduleFlights materialises the flights of a schedule for the next
+// horizonDays days. Running it again only creates the missing dates. Flights
+// whose schedule changed, or whose date no longer operates, are replaced or
+// removed unless they have booked or held seats. A changed flight with booked
+// or held seats is changed in place as a schedule change, see
+// schedulechange.go; one whose date no longer operates is reported as skipped.
+func GenerateScheduleFlights(scheduleID string, horizonDays int, svc *dynamodb.DynamoDB) (*ScheduleGenerationReport, error) {
+	if horizonDays < 1 || horizonDays > maxScheduleHorizon {
+		return nil, fmt.Errorf("The horizon must be between 1 and %d days", maxScheduleHorizon)
+	}
+	schedule, err := GetScheduleByID(scheduleID, svc)
+	if err != nil {
+		return nil, err
+	}
+	location, err := schedule.location()
+	if err != nil {
+		return nil, err
+	}
+	ensureScheduleTables(svc)
+	ensureSeatTables(svc)
+
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	instances, err := getScheduleInstances(schedule.ID, today.Format("2006-01-02"), svc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScheduleGenerationReport{
+		ScheduleID: schedule.ID,
+		Created:    []string{},
+		Updated:    []string{},
+		Removed:    []string{},
+		Skipped:    []ScheduleSkip{},
+
+		ScheduleChanges: []string{},
+	}
+	templates := map[string]*FlightSection{}
+
+	for offset := 0; offset < horizonDays; offset++ {
+		date := today.AddDate(0, 0, offset)
+		operatingDate := date.Format("2006-01-02")
+		if !schedule.operatesOn(date) {
+			continue
+		}
+
+		signature := schedule.signatureOn(date, location)
+		existing, ok := instances[operatingDate]
+		delete(instances, operatingDate)
+		if ok {
+			if existing.Signature == signature {
+				report.Unchanged++
+				continue
+			}
+			removed, _, err := removeScheduleInstance(existing, svc)
+			if err != nil {
+				return report, err
+			}
+			if !removed {
+				changeID, reason, err := changeScheduledFlight(schedule, existing, date, location, signature, svc)
+				if err != nil {
+					return report, fmt.Errorf("%s: %v", operatingDate, err)
+				}
+				if reason != "" {
+					report.Skipped = append(report.Skipped, ScheduleSkip{OperatingDate: operatingDate, Reason: reason})
+					continue
+				}
+				if changeID != "" {
+					report.ScheduleChanges = append(report.ScheduleChanges, changeID)
+				}
+				report.Updated = append(report.Updated, operatingDate)
+				continue
+			}
+		}
+
+		created, err := generateScheduledFlight(schedule, date, location, signature, templates, svc)
+		if errors.Is(err, errFlightExists) || errors.Is(err, errRouteNotApproved) {
+			report.Skipped = append(report.Skipped, ScheduleSkip{OperatingDate: operatingDate, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %v", operatingDate, err)
+		}
+		if !created {
+			report.Skipped = append(report.Skipped, ScheduleSkip{OperatingDate: operatingDate, Reason: "Generated concurrently by another run"})
+		} else if ok {
+			report.Updated = append(report.Updated, operatingDate)
+		} else {
+			report.Created = append(report.Created, operatingDate)
+		}
+	}
+
+	// What is left was generated before but no longer operates, or lies beyond
+	// the horizon. Only flights on dates the schedule dropped are removed.
+	for operatingDate, instance := range instances {
+		date, _ := time.Parse("2006-01-02", operatingDate)
+		if schedule.operatesOn(date) {
+			continue
+		}
+		removed, reason, err := removeScheduleInstance(instance, svc)
+		if err != nil {
+			return report, err
+		}
+		if removed {
+			report.Removed = append(report.Removed, operatingDate)
+		} else {
+			report.Skipped = append(report.Skipped, ScheduleSkip{OperatingDate: operatingDate, Reason: reason})
+		}
+	}
+
+	fmt.Printf("Generated Schedule %s: created=%d updated=%d removed=%d skipped=%d\n",
+		schedule.ID, len(report.Created), len(report.Updated), len(report.Removed), len(report.Skipped))
+	return report, nil
+}
+
+// GenerateAllScheduleFlights runs the generator for every schedule.
+func GenerateAllScheduleFlights(horizonDays int, svc *dynamodb.DynamoDB) ([]*ScheduleGenerationReport, error) {
+	schedules, err := GetAllSchedules(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []*ScheduleGenerationReport{}
+	for _, schedule := range schedules {
+		report, err := GenerateScheduleFlights(schedule.ID, horizonDays, svc)
+		if err != nil {
+			return reports, fmt.Errorf("Schedule %s: %v", schedule.ID, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// generateScheduledFlight copies the template sections, creates the dated
+// flight with all of its seats and records the instance. It returns false when
+// another run recorded the same date first, after removing what it created.
+func generateScheduledFlight(schedule *Schedule, date time.Time, location *time.Location, signature string, templates map[string]*FlightSection, svc *dynamodb.DynamoDB) (bool, error) {
+	instance := scheduleInstance{
+		ScheduleID:    schedule.ID,
+		OperatingDate: date.Format("2006-01-02"),
+		FlightNumber:  schedule.FlightNumber,
+		OriginAirport: strings.ToUpper(schedule.OriginAirport),
+		Signature:     signature,
+	}
+
+	sections := map[string]*FlightSection{}
+	seats := []Seat{}
+	for _, templateID := range schedule.FlightSectionIDs {
+		template, ok := templates[templateID]
+		if !ok {
+			var err error
+			if template, err = GetFlightSectionByID(templateID, svc); err != nil {
+				return false, err
+			}
+			templates[templateID] = template
+		}
+
+		section, err := createFlightSection(FlightSection{
+			SeatClass:   template.SeatClass,
+			NumRows:     template.NumRows,
+			NumCols:     template.NumCols,
+			AislesAfter: template.AislesAfter,
+		}, svc)
+		if err != nil {
+			return false, err
+		}
+		sections[section.ID] = section
+		instance.FlightSectionIDs = append(instance.FlightSectionIDs, section.ID)
+		seats = append(seats, scheduledSeats(schedule.FlightNumber, section)...)
+	}
+
+	flight, err := createFlight(Flight{
+		FlightNumber:       schedule.FlightNumber,
+		AirlineID:          schedule.AirlineID,
+		FlightSectionID:    instance.FlightSectionIDs,
+		OriginAirport:      instance.OriginAirport,
+		DestinationAirport: strings.ToUpper(schedule.DestinationAirport),
+		DepartureDate:      schedule.departureOn(date, location),
+		FlightTime:         time.Duration(schedule.BlockMinutes) * time.Minute,
+		ScheduleID:         schedule.ID,
+	}, svc)
+	if err != nil {
+		deleteScheduledSections(instance.FlightNumber, instance.FlightSectionIDs, svc)
+		return false, err
+	}
+	instance.FlightID = flight.ID
+	for i := range seats {
+		seats[i].FlightID = flight.ID
+	}
+
+	if err := writeImportedSeats(seats, sections, svc); err != nil {
+		deleteScheduledFlight(instance, svc)
+		return false, err
+	}
+
+	if err := putScheduleInstance(instance, "attribute_not_exists(OperatingDate)", svc); err != nil {
+		if err := deleteScheduledSeats(seats, sections, svc); err != nil {
+			return false, err
+		}
+		deleteScheduledFlight(instance, svc)
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// changeScheduledFlight applies a changed schedule to a generated flight that
+// has booked or held seats, returning the ID of the schedule change. When the
+// flight cannot be changed in place a reason is returned instead.
+func changeScheduledFlight(schedule *Schedule, instance scheduleInstance, date time.Time, location *time.Location, signature string, svc *dynamodb.DynamoDB) (string, string, error) {
+	flight, err := GetFlightByID(instance.FlightID, svc)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case !flight.isOpenForSale():
+		return "", fmt.Sprintf("Flight is %s and has booked or held seats", flight.currentStatus()), nil
+	case flight.FlightNumber != schedule.FlightNumber || flight.AirlineID != schedule.AirlineID:
+		return "", "Flight has booked or held seats and its flight number changed", nil
+	case flight.OriginAirport != strings.ToUpper(schedule.OriginAirport):
+		return "", "Flight has booked or held seats and its origin changed", nil
+	}
+
+	departure := schedule.departureOn(date, location)
+	change, err := applyFlightChange(flight.ID, FlightChangeRequest{
+		DepartureDate:      &departure,
+		DestinationAirport: schedule.DestinationAirport,
+		BlockMinutes:       schedule.BlockMinutes,
+		FlightSectionIDs:   schedule.FlightSectionIDs,
+		Actor:              "schedule-generator",
+		Reason:             fmt.Sprintf("Schedule %s changed", schedule.ID),
+	}, svc)
+	if errors.Is(err, errFlightExists) || errors.Is(err, errRouteNotApproved) {
+		return "", err.Error(), nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if flight, err = GetFlightByID(flight.ID, svc); err != nil {
+		return "", "", err
+	}
+	instance.FlightSectionIDs = flight.FlightSectionID
+	instance.Signature = signature
+	if err := putScheduleInstance(instance, "", svc); err != nil {
+		return "", "", err
+	}
+
+	if change == nil {
+		return "", "", nil
+	}
+	return change.ID, "", nil
+}
+
+// scheduledSeats lays out every seat of a section, marking window and aisle seats.
+func scheduledSeats(flightNumber string, section *FlightSection) []Seat {
+	aisles := map[int]bool{}
+	for _, col := range section.AislesAfter {
+		aisles[col] = true
+		aisles[col+1] = true
+	}
+
+	seats := []Seat{}
+	for row := 1; row <= section.NumRows; row++ {
+		for col := 1; col <= section.NumCols; col++ {
+			attributes := []string{}
+			if col == 1 || col == section.NumCols {
+				attributes = append(attributes, "WINDOW")
+			}
+			if aisles[col] {
+				attributes = append(attributes, "AISLE")
+			}
+			seats = append(seats, Seat{
+				ID:              uuid.New().String(),
+				Row:             row,
+				Col:             col,
+				FlightSectionID: section.ID,
+				FlightNumber:    flightNumber,
+				Attributes:      attributes,
+			})
+		}
+	}
+	return seats
+}
+
+// removeScheduleInstance deletes a generated flight with its sections and
+// seats. Flights with booked or held seats are kept, and the reason is returned.
+func removeScheduleInstance(instance scheduleInstance, svc *dynamodb.DynamoDB) (bool, string, error) {
+	seats := []Seat{}
+	sections := map[string]*FlightSection{}
+	for _, flightSectionID := range instance.FlightSectionIDs {
+		section, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return false, "", err
+		}
+		sections[flightSectionID] = section
+
+		sectionSeats, err := GetSeatsByFlightSectionID(flightSectionID, svc)
+		if err != nil {
+			return false, "", err
+		}
+		for _, seat := range sectionSeats {
+			if seat.IsBooked || seat.IsHeld {
+				return false, "Flight has booked or held seats", nil
+			}
+			seats = append(seats, *seat)
+		}
+	}
+
+	if err := deleteScheduledSeats(seats, sections, svc); err != nil {
+		return false, "", err
+	}
+	deleteScheduledFlight(instance, svc)
+
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("ScheduleInstances"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ScheduleID": {
+				S: aws.String(instance.ScheduleID),
+			},
+			"OperatingDate": {
+				S: aws.String(instance.OperatingDate),
+			},
+		},
+	})
+	if err != nil {
+		return false, "", err
+	}
+
+	return true, "", nil
+}
+
+// deleteScheduledSeats removes seats with their positions and counters in
+// transactional chunks.
+func deleteScheduledSeats(seats []Seat, sections map[string]*FlightSection, svc *dynamodb.DynamoDB) error {
+	for start := 0; start < len(seats); start += seatImportChunkSize {
+		end := start + seatImportChunkSize
+		if end > len(seats) {
+			end = len(seats)
+		}
+
+		_, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: seatImportTransaction(seats[start:end], sections, true),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteScheduledFlight removes the flight of an instance with its FlightKey
+// and sections. Failures are logged, as they only leave unreferenced items behind.
+func deleteScheduledFlight(instance scheduleInstance, svc *dynamodb.DynamoDB) {
+	if instance.FlightID != "" {
+		result, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("Flights"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(instance.FlightID),
+				},
+				"OriginAirport": {
+					S: aws.String(instance.OriginAirport),
+				},
+			},
+			ReturnValues: aws.String("ALL_OLD"),
+		})
+		if err != nil {
+			fmt.Printf("Error deleting Flight %s: %v\n", instance.FlightID, err)
+		} else if len(result.Attributes) > 0 {
+			flight := &Flight{}
+			if err := dynamodbattribute.UnmarshalMap(result.Attributes, flight); err == nil {
+				err = deleteFlightKey(flight, svc)
+			}
+			if err != nil {
+				fmt.Printf("Error deleting FlightKey of Flight %s: %v\n", instance.FlightID, err)
+			}
+		}
+	}
+	deleteScheduledSections(instance.FlightNumber, instance.FlightSectionIDs, svc)
+}
+
+func deleteScheduledSections(flightNumber string, flightSectionIDs []string, svc *dynamodb.DynamoDB) {
+	for _, flightSectionID := range flightSectionIDs {
+		_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("FlightSections"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(flightSectionID),
+				},
+			},
+		})
+		if err != nil {
+			fmt.Printf("Error deleting FlightSection %s: %v\n", flightSectionID, err)
+		}
+
+		_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("SeatAvailability"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"FlightNumber": {
+					S: aws.String(flightNumber),
+				},
+				"FlightSectionID": {
+					S: aws.String(flightSectionID),
+				},
+			},
+		})
+		if err != nil {
+			fmt.Printf("Error deleting availability of FlightSection %s: %v\n", flightSectionID, err)
+		}
+	}
+}
+
+// putScheduleInstance records a generated flight. New instances are written
+// with a condition, so a concurrent run for the same date fails instead of
+// generating it twice. An empty condition overwrites the instance.
+func putScheduleInstance(instance scheduleInstance, condition string, svc *dynamodb.DynamoDB) error {
+	flightSectionIDs := make([]*string, len(instance.FlightSectionIDs))
+	for i, id := range instance.FlightSectionIDs {
+		flightSectionIDs[i] = aws.String(id)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("ScheduleInstances"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"ScheduleID": {
+				S: aws.String(instance.ScheduleID),
+			},
+			"OperatingDate": {
+				S: aws.String(instance.OperatingDate),
+			},
+			"FlightID": {
+				S: aws.String(instance.FlightID),
+			},
+			"FlightNumber": {
+				S: aws.String(instance.FlightNumber),
+			},
+			"OriginAirport": {
+				S: aws.String(instance.OriginAirport),
+			},
+			"FlightSectionIDs": {
+				SS: flightSectionIDs,
+			},
+			"Signature": {
+				S: aws.String(instance.Signature),
+			},
+		},
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+	_, err := svc.PutItem(input)
+	return err
+}
+
+// getScheduleInstances returns the generated flights of a schedule from a date on, keyed by date.
+func getScheduleInstances(scheduleID, fromDate string, svc *dynamodb.DynamoDB) (map[string]scheduleInstance, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("ScheduleInstances"),
+		KeyConditionExpression: aws.String("ScheduleID = :scheduleID AND OperatingDate >= :from"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":scheduleID": {
+				S: aws.String(scheduleID),
+			},
+			":from": {
+				S: aws.String(fromDate),
+			},
+		},
+	}
+
+	instances := map[string]scheduleInstance{}
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var instance scheduleInstance
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &instance); unmarshalErr != nil {
+				return false
+			}
+			instances[instance.OperatingDate] = instance
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return instances, nil
+}
+
+func ensureScheduleTables(svc *dynamodb.DynamoDB) {
+	if !doesTableExist("Schedules", svc) {
+		if err := createSchedulesTable(svc); err != nil {
+			fmt.Printf("Error creating Schedules table: %v\n", err)
+		}
+	}
+	if !doesTableExist("ScheduleInstances", svc) {
+		if err := createScheduleInstancesTable(svc); err != nil {
+			fmt.Printf("Error creating ScheduleInstances table: %v\n", err)
+		}
+	}
+}
+
+func createSchedulesTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("Schedules"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Schedules table created successfully")
+	return nil
+}
+
+func createScheduleInstancesTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("ScheduleInstances"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ScheduleID"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("OperatingDate"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ScheduleID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("OperatingDate"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ScheduleInstances table created successfully")
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateDaysOfWeek(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{name: "every day", pattern: "1234567"},
+		{name: "dots for days off", pattern: "1.3.5.7"},
+		{name: "spaces for days off", pattern: "1 3 5 7"},
+		{name: "weekend only", pattern: ".....67"},
+		{name: "no day", pattern: ".......", wantErr: true},
+		{name: "too short", pattern: "12345", wantErr: true},
+		{name: "too long", pattern: "12345678", wantErr: true},
+		{name: "day in the wrong position", pattern: "2......", wantErr: true},
+		{name: "letter", pattern: "1X34567", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDaysOfWeek(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDaysOfWeek(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleOperatesOn(t *testing.T) {
+	schedule := &Schedule{ValidFrom: "2024-06-01", ValidTo: "2024-06-30", DaysOfWeek: "1.3.5.7"}
+
+	tests := []struct {
+		name string
+		date string
+		want bool
+	}{
+		{name: "Monday", date: "2024-06-03", want: true},
+		{name: "Tuesday is off", date: "2024-06-04", want: false},
+		{name: "Wednesday", date: "2024-06-05", want: true},
+		{name: "Saturday is off", date: "2024-06-01", want: false},
+		{name: "Sunday", date: "2024-06-02", want: true},
+		{name: "last valid day", date: "2024-06-30", want: true},
+		{name: "before the period", date: "2024-05-27", want: false},
+		{name: "after the period", date: "2024-07-01", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := time.Parse("2006-01-02", tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.operatesOn(date); got != tt.want {
+				t.Errorf("operatesOn(%s) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
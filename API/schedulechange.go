@@ -0,0 +1,1451 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+const (
+	ScheduleChangeMinor       = "MINOR"
+	ScheduleChangeSignificant = "SIGNIFICANT"
+)
+
+// Actions a schedule change can require on a booking. Minor changes that
+// keep every passenger in their cabin need neither and are only flagged.
+const (
+	ScheduleChangeActionCustomer = "CUSTOMER_ACTION"
+	ScheduleChangeActionAgent    = "AGENT_REVIEW"
+)
+
+// A change is PENDING from the moment the flight switches until every
+// affected booking has been flagged; ResumeScheduleChanges finishes it.
+const (
+	ScheduleChangePending = "PENDING"
+	ScheduleChangeApplied = "APPLIED"
+)
+
+// cabinChangeTimeout bounds how long a cabin change keeps the seats of the
+// old cabin from changing, so a change that stopped halfway does not stop
+// sales for good.
+const cabinChangeTimeout = 5 * time.Minute
+
+const (
+	ScheduleChangeQueueOpen     = "OPEN"
+	ScheduleChangeQueueResolved = "RESOLVED"
+)
+
+// Outcomes of moving an occupied seat to a new cabin configuration.
+const (
+	SeatRemapSameSeat     = "SAME_SEAT"
+	SeatRemapMoved        = "MOVED"
+	SeatRemapClassChanged = "CLASS_CHANGED"
+	SeatRemapUnseated     = "UNSEATED"
+)
+
+const defaultMinorChangeMinutes = 60
+
+// ScheduleChangeThresholds are the largest departure and arrival shifts that
+// still count as a minor change. They are read from the environment variables
+// SCHEDULE_CHANGE_MINOR_DEPARTURE_MINUTES and SCHEDULE_CHANGE_MINOR_ARRIVAL_MINUTES.
+type ScheduleChangeThresholds struct {
+	MinorDeparture time.Duration `json:"minorDeparture"`
+	MinorArrival   time.Duration `json:"minorArrival"`
+}
+
+func scheduleChangeThresholds() ScheduleChangeThresholds {
+	return ScheduleChangeThresholds{
+		MinorDeparture: durationFromEnv("SCHEDULE_CHANGE_MINOR_DEPARTURE_MINUTES", time.Minute, defaultMinorChangeMinutes),
+		MinorArrival:   durationFromEnv("SCHEDULE_CHANGE_MINOR_ARRIVAL_MINUTES", time.Minute, defaultMinorChangeMinutes),
+	}
+}
+
+// durationFromEnv reads a whole number of units from an environment variable.
+func durationFromEnv(name string, unit time.Duration, fallback int) time.Duration {
+	return time.Duration(intFromEnv(name, fallback)) * unit
+}
+
+// intFromEnv reads a whole, non-negative number from an environment variable.
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		fmt.Printf("Ignoring invalid %s=%q, using %d\n", name, value, fallback)
+		return fallback
+	}
+	return count
+}
+
+// FlightChangeRequest changes a dated flight. Fields left empty keep their
+// current value. FlightSectionIDs are the template sections of a new cabin
+// configuration; they are copied like a schedule's templates.
+type FlightChangeRequest struct {
+	DepartureDate      *time.Time `json:"departureDate"`
+	DestinationAirport string     `json:"destinationAirport"`
+	BlockMinutes       int        `json:"blockMinutes"`
+	FlightSectionIDs   []string   `json:"flightSectionIDs"`
+	Actor              string     `json:"actor"`
+	Reason             string     `json:"reason"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// SeatRemap records where an occupied seat went when the cabin changed.
+type SeatRemap struct {
+	BookingID         string `json:"bookingID,omitempty"`
+	FromSeatID        string `json:"fromSeatID"`
+	FromSeatClass     string `json:"fromSeatClass"`
+	FromRow           int    `json:"fromRow"`
+	FromCol           int    `json:"fromCol"`
+	ToSeatID          string `json:"toSeatID,omitempty"`
+	ToFlightSectionID string `json:"toFlightSectionID,omitempty"`
+	ToSeatClass       string `json:"toSeatClass,omitempty"`
+	ToRow             int    `json:"toRow,omitempty"`
+	ToCol             int    `json:"toCol,omitempty"`
+	Outcome           string `json:"outcome"`
+}
+
+// ScheduleChange is the record of one change to a dated flight.
+type ScheduleChange struct {
+	ID                    string        `json:"id"`
+	FlightID              string        `json:"flightID"`
+	FlightNumber          string        `json:"flightNumber"`
+	OperatingDate         string        `json:"operatingDate"`
+	Classification        string        `json:"classification"`
+	Changes               []FieldChange `json:"changes"`
+	DepartureShiftMinutes int           `json:"departureShiftMinutes"`
+	ArrivalShiftMinutes   int           `json:"arrivalShiftMinutes"`
+	SeatRemaps            []SeatRemap   `json:"seatRemaps"`
+	AffectedBookings      []string      `json:"affectedBookings"`
+	Actor                 string        `json:"actor"`
+	Reason                string        `json:"reason,omitempty"`
+	// Status is empty on changes recorded before changes could be resumed.
+	Status    string    `json:"status,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ScheduleChangeQueueItem is a booking waiting for the customer or an agent
+// after a schedule change.
+type ScheduleChangeQueueItem struct {
+	BookingID      string        `json:"bookingID"`
+	ChangeID       string        `json:"changeID"`
+	FlightID       string        `json:"flightID"`
+	FlightNumber   string        `json:"flightNumber"`
+	OperatingDate  string        `json:"operatingDate"`
+	Classification string        `json:"classification"`
+	Action         string        `json:"action"`
+	Reasons        []string      `json:"reasons"`
+	Changes        []FieldChange `json:"changes"`
+	SeatRemaps     []SeatRemap   `json:"seatRemaps"`
+	Status         string        `json:"status"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	ResolvedAt     *time.Time    `json:"resolvedAt,omitempty"`
+	ResolvedBy     string        `json:"resolvedBy,omitempty"`
+	Resolution     string        `json:"resolution,omitempty"`
+}
+
+type ScheduleChangeResolution struct {
+	Actor      string `json:"actor"`
+	Resolution string `json:"resolution"`
+}
+
+// flightChangePlan is a validated change before anything is written.
+type flightChangePlan struct {
+	flight         *Flight
+	changed        Flight
+	changes        []FieldChange
+	oldSections    map[string]*FlightSection
+	newSections    map[string]*FlightSection
+	newSeats       []Seat
+	occupied       []*Seat
+	remaps         []SeatRemap
+	departureShift time.Duration
+	arrivalShift   time.Duration
+}
+
+// ApplyFlightChange changes the time, destination, block time or cabin
+// configuration of a dated flight. The change is classified, occupied seats
+// are moved to the new cabin, and every booking on the flight is flagged;
+// bookings that need the customer or an agent are queued.
+func ApplyFlightChange(flightID string, request FlightChangeRequest, svc *dynamodb.DynamoDB) (*ScheduleChange, error) {
+	change, err := applyFlightChange(flightID, request, svc)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return nil, errors.New("The change does not alter the flight")
+	}
+	return change, nil
+}
+
+// applyFlightChange returns a nil change when the request leaves the flight as it is.
+func applyFlightChange(flightID string, request FlightChangeRequest, svc *dynamodb.DynamoDB) (*ScheduleChange, error) {
+	if strings.TrimSpace(request.Actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+	if request.BlockMinutes < 0 {
+		return nil, errors.New("BlockMinutes must not be negative")
+	}
+	flight, err := GetFlightByID(flightID, svc)
+	if err != nil {
+		return nil, err
+	}
+	if !flight.isOpenForSale() {
+		return nil, fmt.Errorf("A %s flight cannot be changed", flight.currentStatus())
+	}
+
+	plan, err := planFlightChange(flight, request, svc)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.changes) == 0 {
+		return nil, nil
+	}
+	ensureScheduleChangeTables(svc)
+
+	change := &ScheduleChange{
+		ID:                    uuid.New().String(),
+		FlightID:              flight.ID,
+		FlightNumber:          flight.FlightNumber,
+		OperatingDate:         plan.changed.OperatingDate,
+		Classification:        plan.classify(scheduleChangeThresholds()),
+		Changes:               plan.changes,
+		DepartureShiftMinutes: int(plan.departureShift / time.Minute),
+		ArrivalShiftMinutes:   int(plan.arrivalShift / time.Minute),
+		SeatRemaps:            plan.remaps,
+		AffectedBookings:      []string{},
+		Actor:                 request.Actor,
+		Reason:                request.Reason,
+		Status:                ScheduleChangePending,
+		CreatedAt:             time.Now().UTC(),
+	}
+	bookings := map[string]bool{}
+	for _, seat := range plan.occupied {
+		if seat.IsBooked && seat.BookingID != "" && !bookings[seat.BookingID] {
+			bookings[seat.BookingID] = true
+			change.AffectedBookings = append(change.AffectedBookings, seat.BookingID)
+		}
+	}
+	sort.Strings(change.AffectedBookings)
+
+	// The change is recorded with the flight switch, so the bookings can
+	// still be flagged by ResumeScheduleChanges if flagging stops halfway.
+	if err := plan.write(change, svc); err != nil {
+		return nil, err
+	}
+	if err := flagScheduleChange(change, &plan.changed, svc); err != nil {
+		return change, err
+	}
+
+	// Assigned gates follow the new times and destination.
+	if flight.DepartureGate != nil || flight.ArrivalGate != nil {
+		if changed, err := GetFlightByID(flight.ID, svc); err == nil {
+			refreshFlightGates(changed, request.Actor, svc)
+		}
+	}
+
+	fmt.Printf("Changed Flight %s (%s): %s, %d bookings affected\n", flight.ID, flight.FlightNumber, change.Classification, len(change.AffectedBookings))
+	return change, nil
+}
+
+func planFlightChange(flight *Flight, request FlightChangeRequest, svc *dynamodb.DynamoDB) (*flightChangePlan, error) {
+	plan := &flightChangePlan{flight: flight, changed: *flight, changes: []FieldChange{}, remaps: []SeatRemap{}}
+	changed := &plan.changed
+
+	if request.DepartureDate != nil && !request.DepartureDate.Equal(flight.DepartureDate) {
+		changed.DepartureDate = *request.DepartureDate
+	}
+	if request.DestinationAirport != "" {
+		destination := strings.ToUpper(request.DestinationAirport)
+		if err := ValidateAirportCode(destination); err != nil {
+			return nil, errors.New("DestinationAirport: " + err.Error())
+		}
+		if destination == flight.OriginAirport {
+			return nil, errors.New("DestinationAirport must differ from the origin")
+		}
+		if destination != flight.DestinationAirport && !doesAirportExist(destination, svc) {
+			return nil, errors.New("DestinationAirport does not exist")
+		}
+		changed.DestinationAirport = destination
+	}
+	if changed.DestinationAirport != flight.DestinationAirport {
+		distance, err := flightDistanceKm(changed.OriginAirport, changed.DestinationAirport, svc)
+		if err != nil {
+			return nil, err
+		}
+		changed.DistanceKm = distance
+	}
+	flightTime := flight.FlightTime
+	if request.BlockMinutes > 0 {
+		flightTime = time.Duration(request.BlockMinutes) * time.Minute
+	}
+
+	origin, err := airportLocation(changed.OriginAirport, svc)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := airportLocation(changed.DestinationAirport, svc)
+	if err != nil {
+		return nil, err
+	}
+	setFlightLocalTimes(changed, flightTime, origin, destination)
+	changed.FlightTime = flightTime
+	changed.OperatingDate = changed.DepartureDate.In(origin).Format("2006-01-02")
+	// Flights stored before airlines were linked have no route to check.
+	if flight.AirlineID != "" && (changed.DestinationAirport != flight.DestinationAirport || changed.OperatingDate != flight.operatingDate()) {
+		if _, err := activeRoute(flight.AirlineID, changed.OriginAirport, changed.DestinationAirport, changed.OperatingDate, svc); err != nil {
+			return nil, err
+		}
+	}
+
+	plan.departureShift = absDuration(changed.DepartureDate.Sub(flight.DepartureDate))
+	plan.arrivalShift = absDuration(changed.ArrivalUTC.Sub(flightArrival(*flight)))
+	plan.addChange("DepartureDate", flight.DepartureDate.UTC().Format(time.RFC3339), changed.DepartureDate.UTC().Format(time.RFC3339))
+	plan.addChange("OperatingDate", flight.operatingDate(), changed.OperatingDate)
+	plan.addChange("DestinationAirport", flight.DestinationAirport, changed.DestinationAirport)
+	plan.addChange("FlightTime", flight.FlightTime.String(), flightTime.String())
+	plan.addChange("ArrivalUTC", flightArrival(*flight).UTC().Format(time.RFC3339), changed.ArrivalUTC.Format(time.RFC3339))
+
+	plan.oldSections = map[string]*FlightSection{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		section, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		plan.oldSections[flightSectionID] = section
+	}
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, err
+	}
+	for _, seat := range seats {
+		if seat.IsBooked || seat.IsHeld {
+			plan.occupied = append(plan.occupied, seat)
+		}
+	}
+
+	if len(request.FlightSectionIDs) > 0 {
+		templates := []*FlightSection{}
+		for _, templateID := range request.FlightSectionIDs {
+			template, err := GetFlightSectionByID(templateID, svc)
+			if err != nil {
+				return nil, err
+			}
+			templates = append(templates, template)
+		}
+		current := []*FlightSection{}
+		for _, section := range plan.oldSections {
+			current = append(current, section)
+		}
+		if from, to := cabinLayout(current), cabinLayout(templates); from != to {
+			plan.changes = append(plan.changes, FieldChange{Field: "CabinConfiguration", From: from, To: to})
+			plan.newSections = map[string]*FlightSection{}
+			changed.FlightSectionID = []string{}
+			for _, template := range templates {
+				section := &FlightSection{
+					ID:          uuid.New().String(),
+					SeatClass:   template.SeatClass,
+					NumRows:     template.NumRows,
+					NumCols:     template.NumCols,
+					AislesAfter: template.AislesAfter,
+					FlightID:    flight.ID,
+				}
+				plan.newSections[section.ID] = section
+				changed.FlightSectionID = append(changed.FlightSectionID, section.ID)
+				for _, seat := range scheduledSeats(flight.FlightNumber, section) {
+					seat.FlightID = flight.ID
+					plan.newSeats = append(plan.newSeats, seat)
+				}
+			}
+			plan.remaps = remapSeats(plan.occupied, plan.oldSections, plan.newSeats, plan.newSections)
+		}
+	}
+
+	return plan, nil
+}
+
+func (plan *flightChangePlan) addChange(field, from, to string) {
+	if from != to {
+		plan.changes = append(plan.changes, FieldChange{Field: field, From: from, To: to})
+	}
+}
+
+// classify makes a change significant when the route changes, a time moves
+// by more than the thresholds allow, or a passenger loses their cabin or seat.
+func (plan *flightChangePlan) classify(thresholds ScheduleChangeThresholds) string {
+	if plan.changed.DestinationAirport != plan.flight.DestinationAirport {
+		return ScheduleChangeSignificant
+	}
+	if plan.departureShift > thresholds.MinorDeparture || plan.arrivalShift > thresholds.MinorArrival {
+		return ScheduleChangeSignificant
+	}
+	for _, remap := range plan.remaps {
+		if remap.Outcome == SeatRemapClassChanged || remap.Outcome == SeatRemapUnseated {
+			return ScheduleChangeSignificant
+		}
+	}
+	return ScheduleChangeMinor
+}
+
+// write locks the old cabin and stores the new cabin with the moved seats
+// first, then switches the flight over and records the change in one
+// transaction and finally removes the old cabin.
+func (plan *flightChangePlan) write(change *ScheduleChange, svc *dynamodb.DynamoDB) error {
+	if plan.newSections != nil {
+		if err := plan.lockCabin(change, svc); err != nil {
+			return err
+		}
+		for _, flightSectionID := range plan.changed.FlightSectionID {
+			section := plan.newSections[flightSectionID]
+			if _, err := createFlightSection(*section, svc); err != nil {
+				deleteScheduledSections(plan.flight.FlightNumber, plan.changed.FlightSectionID, svc)
+				plan.unlockCabin(change, svc)
+				return err
+			}
+		}
+		if err := writeImportedSeats(plan.newSeats, plan.newSections, svc); err != nil {
+			deleteScheduledSections(plan.flight.FlightNumber, plan.changed.FlightSectionID, svc)
+			plan.unlockCabin(change, svc)
+			return err
+		}
+	}
+
+	if err := plan.switchFlight(change, svc); err != nil {
+		if plan.newSections != nil {
+			if undoErr := deleteScheduledSeats(plan.newSeats, plan.newSections, svc); undoErr != nil {
+				fmt.Printf("Error removing the new cabin of Flight %s: %v\n", plan.flight.ID, undoErr)
+			}
+			deleteScheduledSections(plan.flight.FlightNumber, plan.changed.FlightSectionID, svc)
+			plan.unlockCabin(change, svc)
+		}
+		return err
+	}
+
+	// The flight has switched, so failing to remove the old cabin only
+	// leaves orphaned seats behind.
+	if plan.newSections != nil {
+		old := []Seat{}
+		for _, flightSectionID := range plan.flight.FlightSectionID {
+			seats, err := GetSeatsByFlightSectionID(flightSectionID, svc)
+			if err != nil {
+				fmt.Printf("Error reading the old cabin of Flight %s: %v\n", plan.flight.ID, err)
+				return nil
+			}
+			for _, seat := range seats {
+				old = append(old, *seat)
+			}
+		}
+		if err := deleteScheduledSeats(old, plan.oldSections, svc); err != nil {
+			fmt.Printf("Error removing the old cabin of Flight %s: %v\n", plan.flight.ID, err)
+			return nil
+		}
+		deleteScheduledSections(plan.flight.FlightNumber, plan.flight.FlightSectionID, svc)
+	}
+	return nil
+}
+
+// lockCabin stops the seats of the old cabin from being sold or released
+// until the flight switches, see flightCabinCheck. Seats that changed since
+// the plan read them fail the change, as their passengers would not be moved.
+func (plan *flightChangePlan) lockCabin(change *ScheduleChange, svc *dynamodb.DynamoDB) error {
+	now := time.Now().UTC()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(plan.flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(plan.flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String("SET CabinChangeID = :change, CabinChangeUntil = :until"),
+		ConditionExpression: aws.String("DepartureDate = :oldDeparture AND FlightSectionID = :oldSections AND (attribute_not_exists(CabinChangeID) OR CabinChangeUntil < :now)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":change":       {S: aws.String(change.ID)},
+			":until":        {S: aws.String(now.Add(cabinChangeTimeout).Format(time.RFC3339))},
+			":now":          {S: aws.String(now.Format(time.RFC3339))},
+			":oldDeparture": {S: aws.String(plan.flight.DepartureDate.Format(time.RFC3339))},
+			":oldSections":  {SS: aws.StringSlice(plan.flight.FlightSectionID)},
+		},
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return errors.New("Flight was changed concurrently, please retry")
+		}
+		return err
+	}
+
+	seats, err := GetSeatsByFlight(plan.flight, svc)
+	if err != nil {
+		plan.unlockCabin(change, svc)
+		return err
+	}
+	planned := map[string]*Seat{}
+	for _, seat := range plan.occupied {
+		planned[seat.ID] = seat
+	}
+	for _, seat := range seats {
+		if !seat.IsBooked && !seat.IsHeld {
+			continue
+		}
+		read, ok := planned[seat.ID]
+		if !ok || read.IsBooked != seat.IsBooked || read.BookingID != seat.BookingID || read.HoldToken != seat.HoldToken {
+			plan.unlockCabin(change, svc)
+			return errors.New("Seats of the flight were sold or released while the change was planned, please retry")
+		}
+		delete(planned, seat.ID)
+	}
+	if len(planned) > 0 {
+		plan.unlockCabin(change, svc)
+		return errors.New("Seats of the flight were sold or released while the change was planned, please retry")
+	}
+	return nil
+}
+
+// unlockCabin lets the old cabin be sold again after a cabin change failed.
+func (plan *flightChangePlan) unlockCabin(change *ScheduleChange, svc *dynamodb.DynamoDB) {
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(plan.flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(plan.flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String("REMOVE CabinChangeID, CabinChangeUntil"),
+		ConditionExpression: aws.String("CabinChangeID = :change"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":change": {S: aws.String(change.ID)},
+		},
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); !ok {
+			fmt.Printf("Error unlocking the cabin of Flight %s: %v\n", plan.flight.ID, err)
+		}
+	}
+}
+
+// flightCabinCheck guards a seat transaction against the sections of the
+// seats leaving the flight, or a cabin change locking them, after the flight
+// was read.
+func flightCabinCheck(flight *Flight, flightSectionIDs []string) *dynamodb.TransactWriteItem {
+	expression := "(attribute_not_exists(CabinChangeID) OR CabinChangeUntil < :now)"
+	values := map[string]*dynamodb.AttributeValue{
+		":now": {S: aws.String(time.Now().UTC().Format(time.RFC3339))},
+	}
+	for _, flightSectionID := range flightSectionIDs {
+		placeholder := fmt.Sprintf(":section%d", len(values))
+		expression += " AND contains(FlightSectionID, " + placeholder + ")"
+		values[placeholder] = &dynamodb.AttributeValue{S: aws.String(flightSectionID)}
+	}
+	return &dynamodb.TransactWriteItem{
+		ConditionCheck: &dynamodb.ConditionCheck{
+			TableName: aws.String("Flights"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(flight.ID),
+				},
+				"OriginAirport": {
+					S: aws.String(flight.OriginAirport),
+				},
+			},
+			ConditionExpression:       aws.String(expression),
+			ExpressionAttributeValues: values,
+		},
+	}
+}
+
+// switchFlight updates the flight item, moves its FlightKey when the
+// operating date changes, claims the new sections and records the change.
+// It fails if the flight was changed or closed for sale since it was read.
+func (plan *flightChangePlan) switchFlight(change *ScheduleChange, svc *dynamodb.DynamoDB) error {
+	flight, changed := plan.flight, &plan.changed
+
+	changePut, err := scheduleChangePut(change)
+	if err != nil {
+		return err
+	}
+
+	expression := "SET DepartureDate = :departure, DepartureUTC = :departureUTC, FlightTimeNs = :flightTime, ETA = :eta, " +
+		"ArrivalUTC = :arrivalUTC, DepartureLocal = :departureLocal, ArrivalLocal = :arrivalLocal, OperatingDate = :operatingDate, " +
+		"DestinationAirport = :destination, #route = :route, FlightSectionID = :sections"
+	values := map[string]*dynamodb.AttributeValue{
+		":departure":      {S: aws.String(changed.DepartureDate.Format(time.RFC3339))},
+		":departureUTC":   {S: aws.String(changed.DepartureDate.UTC().Format(time.RFC3339))},
+		":flightTime":     {N: aws.String(fmt.Sprintf("%d", changed.FlightTime.Nanoseconds()))},
+		":eta":            {S: aws.String(changed.ETA)},
+		":arrivalUTC":     {S: aws.String(changed.ArrivalUTC.Format(time.RFC3339))},
+		":departureLocal": {S: aws.String(changed.DepartureLocal)},
+		":arrivalLocal":   {S: aws.String(changed.ArrivalLocal)},
+		":operatingDate":  {S: aws.String(changed.OperatingDate)},
+		":destination":    {S: aws.String(changed.DestinationAirport)},
+		":route":          {S: aws.String(flightRoute(changed.OriginAirport, changed.DestinationAirport))},
+		":sections":       {SS: aws.StringSlice(changed.FlightSectionID)},
+		":oldDeparture":   {S: aws.String(flight.DepartureDate.Format(time.RFC3339))},
+		":oldSections":    {SS: aws.StringSlice(flight.FlightSectionID)},
+		":scheduled":      {S: aws.String(FlightStatusScheduled)},
+		":delayed":        {S: aws.String(FlightStatusDelayed)},
+	}
+	removes := []string{}
+	if changed.DestinationAirport != flight.DestinationAirport {
+		if changed.DistanceKm > 0 {
+			expression += ", DistanceKm = :distance"
+			values[":distance"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(changed.DistanceKm, 'f', -1, 64))}
+		} else {
+			removes = append(removes, "DistanceKm")
+		}
+	}
+	condition := "DepartureDate = :oldDeparture AND FlightSectionID = :oldSections AND (attribute_not_exists(#status) OR #status IN (:scheduled, :delayed))"
+	if plan.newSections != nil {
+		// The cabin must still be locked by this change, see lockCabin.
+		condition += " AND CabinChangeID = :change"
+		values[":change"] = &dynamodb.AttributeValue{S: aws.String(change.ID)}
+		removes = append(removes, "CabinChangeID", "CabinChangeUntil")
+	}
+	if len(removes) > 0 {
+		expression += " REMOVE " + strings.Join(removes, ", ")
+	}
+	writes := []*dynamodb.TransactWriteItem{{Update: &dynamodb.Update{
+		TableName: aws.String("Flights"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(flight.ID),
+			},
+			"OriginAirport": {
+				S: aws.String(flight.OriginAirport),
+			},
+		},
+		UpdateExpression:    aws.String(expression),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+			"#route":  aws.String("Route"),
+		},
+		ExpressionAttributeValues: values,
+	}}}
+
+	keyMoved := changed.OperatingDate != flight.operatingDate()
+	if keyMoved {
+		writes = append(writes,
+			&dynamodb.TransactWriteItem{Put: flightKeyPut(changed)},
+			&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+				TableName: aws.String("FlightKeys"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"FlightKey": {
+						S: aws.String(flightKey(flight.FlightNumber, flight.operatingDate(), flight.OriginAirport)),
+					},
+				},
+			}},
+		)
+		// Marketing numbers follow the flight to its new date.
+		for _, marketing := range flight.MarketingFlights {
+			key := flightKeyPut(changed)
+			key.Item["FlightKey"] = &dynamodb.AttributeValue{S: aws.String(flightKey(marketing.FlightNumber, changed.OperatingDate, changed.OriginAirport))}
+			writes = append(writes, &dynamodb.TransactWriteItem{Put: key}, marketingFlightDeletes(flight, marketing)[0])
+		}
+	}
+	if plan.newSections != nil {
+		for _, flightSectionID := range changed.FlightSectionID {
+			writes = append(writes, flightSectionClaim(flightSectionID, flight.ID))
+		}
+	}
+	writes = append(writes, &dynamodb.TransactWriteItem{Put: changePut})
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	if err != nil {
+		if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			reasons := canceled.CancellationReasons
+			if keyMoved && len(reasons) > 1 && reasons[1].Code != nil && *reasons[1].Code == "ConditionalCheckFailed" {
+				return fmt.Errorf("%w: %s operates on %s from %s", errFlightExists, changed.FlightNumber, changed.OperatingDate, changed.OriginAirport)
+			}
+			for i, marketing := range flight.MarketingFlights {
+				if at := 3 + 2*i; keyMoved && len(reasons) > at && reasons[at].Code != nil && *reasons[at].Code == "ConditionalCheckFailed" {
+					return fmt.Errorf("%w: %s operates on %s from %s", errFlightExists, marketing.FlightNumber, changed.OperatingDate, changed.OriginAirport)
+				}
+			}
+			return errors.New("Flight was changed concurrently, please retry")
+		}
+		return err
+	}
+	return nil
+}
+
+// cabinLayout describes a cabin configuration, e.g. "Business 4x4, Economy 20x6".
+// Sections are sorted, so the same cabin is described the same way.
+func cabinLayout(sections []*FlightSection) string {
+	type layout struct {
+		rank int
+		text string
+	}
+	layouts := []layout{}
+	for _, section := range sections {
+		text := fmt.Sprintf("%s %dx%d", section.SeatClass, section.NumRows, section.NumCols)
+		if len(section.AislesAfter) > 0 {
+			text += fmt.Sprintf(" aisles %v", section.AislesAfter)
+		}
+		layouts = append(layouts, layout{rank: seatClassRank(section.SeatClass), text: text})
+	}
+	sort.Slice(layouts, func(i, j int) bool {
+		if layouts[i].rank != layouts[j].rank {
+			return layouts[i].rank < layouts[j].rank
+		}
+		return layouts[i].text < layouts[j].text
+	})
+
+	texts := make([]string, len(layouts))
+	for i, layout := range layouts {
+		texts[i] = layout.text
+	}
+	return strings.Join(texts, ", ")
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// remapSeats moves booked and then held seats onto the new cabin, which is
+// updated in place. A seat keeps its row and column when its cabin still has
+// it, otherwise it gets a free seat of the same kind (window or aisle) in the
+// same cabin, then any free seat in the cabin, then the nearest other cabin.
+func remapSeats(occupied []*Seat, oldSections map[string]*FlightSection, newSeats []Seat, newSections map[string]*FlightSection) []SeatRemap {
+	ordered := append([]*Seat{}, occupied...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.IsBooked != b.IsBooked {
+			return a.IsBooked
+		}
+		ra, rb := seatClassRank(oldSections[a.FlightSectionID].SeatClass), seatClassRank(oldSections[b.FlightSectionID].SeatClass)
+		if ra != rb {
+			return ra < rb
+		}
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		return a.Col < b.Col
+	})
+
+	taken := make([]bool, len(newSeats))
+	remaps := []SeatRemap{}
+	for _, seat := range ordered {
+		seatClass := oldSections[seat.FlightSectionID].SeatClass
+		remap := SeatRemap{
+			BookingID:     seat.BookingID,
+			FromSeatID:    seat.ID,
+			FromSeatClass: seatClass,
+			FromRow:       seat.Row,
+			FromCol:       seat.Col,
+			Outcome:       SeatRemapUnseated,
+		}
+
+		best, bestScore := -1, 0
+		for i := range newSeats {
+			if taken[i] {
+				continue
+			}
+			score := remapScore(seat, seatClass, &newSeats[i], newSections[newSeats[i].FlightSectionID].SeatClass)
+			if best == -1 || score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		if best >= 0 {
+			taken[best] = true
+			target := &newSeats[best]
+			target.IsBooked = seat.IsBooked
+			target.IsHeld = seat.IsHeld && !seat.IsBooked
+			if target.IsHeld {
+				target.HoldToken = seat.HoldToken
+			}
+			target.BookingID = seat.BookingID
+
+			remap.ToSeatID = target.ID
+			remap.ToFlightSectionID = target.FlightSectionID
+			remap.ToSeatClass = newSections[target.FlightSectionID].SeatClass
+			remap.ToRow, remap.ToCol = target.Row, target.Col
+			switch {
+			case !strings.EqualFold(remap.ToSeatClass, seatClass):
+				remap.Outcome = SeatRemapClassChanged
+			case target.Row == seat.Row && target.Col == seat.Col:
+				remap.Outcome = SeatRemapSameSeat
+			default:
+				remap.Outcome = SeatRemapMoved
+			}
+		}
+		remaps = append(remaps, remap)
+	}
+	return remaps
+}
+
+// remapScore ranks a candidate seat, lower is better.
+func remapScore(seat *Seat, seatClass string, candidate *Seat, candidateClass string) int {
+	score := 0
+	if !strings.EqualFold(seatClass, candidateClass) {
+		score += 1000000 * classPreference(seatClassRank(seatClass), seatClassRank(candidateClass))
+	}
+	if candidate.Row != seat.Row || candidate.Col != seat.Col {
+		score += 100000
+		if seatHasAttribute(seat, "WINDOW") != seatHasAttribute(candidate, "WINDOW") || seatHasAttribute(seat, "AISLE") != seatHasAttribute(candidate, "AISLE") {
+			score += 10000
+		}
+		score += candidate.Row*100 + candidate.Col
+	}
+	return score
+}
+
+func seatHasAttribute(seat *Seat, attribute string) bool {
+	for _, value := range seat.Attributes {
+		if value == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// flagScheduleChange flags every booking affected by a change and then
+// marks the change applied. Bookings flagged before are skipped, so it can
+// run again on a change that stopped halfway.
+func flagScheduleChange(change *ScheduleChange, flight *Flight, svc *dynamodb.DynamoDB) error {
+	for _, bookingID := range change.AffectedBookings {
+		if err := flagBookingForChange(bookingID, change, flight, svc); err != nil {
+			return fmt.Errorf("Booking %s: %v", bookingID, err)
+		}
+	}
+
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("ScheduleChanges"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(change.ID),
+			},
+		},
+		UpdateExpression: aws.String("SET #status = :applied"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":applied": {S: aws.String(ScheduleChangeApplied)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	change.Status = ScheduleChangeApplied
+	return nil
+}
+
+// ResumeScheduleChanges finishes flagging the bookings of changes that
+// stopped after the flight had switched. It returns how many it finished.
+func ResumeScheduleChanges(svc *dynamodb.DynamoDB) (int, error) {
+	if !doesTableExist("ScheduleChanges", svc) {
+		return 0, nil
+	}
+
+	changes := []ScheduleChange{}
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("ScheduleChanges"),
+		FilterExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending": {S: aws.String(ScheduleChangePending)},
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		pageChanges := []ScheduleChange{}
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageChanges); unmarshalErr != nil {
+			return false
+		}
+		changes = append(changes, pageChanges...)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if unmarshalErr != nil {
+		return 0, unmarshalErr
+	}
+
+	resumed := 0
+	for i := range changes {
+		change := &changes[i]
+		flight, err := GetFlightByID(change.FlightID, svc)
+		if err != nil {
+			return resumed, fmt.Errorf("Schedule change %s: %v", change.ID, err)
+		}
+		if err := flagScheduleChange(change, flight, svc); err != nil {
+			return resumed, fmt.Errorf("Schedule change %s: %v", change.ID, err)
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// flagBookingForChange points the booking's seats at the new cabin, records
+// the change on the booking and queues it when someone has to act on it.
+// The queue item is written first and the booking update is conditioned on
+// the change not being recorded yet, so a booking is flagged only once.
+func flagBookingForChange(bookingID string, change *ScheduleChange, flight *Flight, svc *dynamodb.DynamoDB) error {
+	booking, err := GetBookingByID(bookingID, svc)
+	if err != nil {
+		return err
+	}
+	for _, changeID := range booking.ScheduleChangeIDs {
+		if changeID == change.ID {
+			return nil
+		}
+	}
+
+	moved := map[string]SeatRemap{}
+	remaps := []SeatRemap{}
+	for _, remap := range change.SeatRemaps {
+		if remap.BookingID == bookingID {
+			moved[remap.FromSeatID] = remap
+			remaps = append(remaps, remap)
+		}
+	}
+
+	reasons := []string{}
+	flights := []*Flight{}
+	for i, segment := range booking.Segments {
+		onFlight := segment.FlightID == flight.ID || (segment.FlightID == "" && segment.FlightNumber == flight.FlightNumber)
+		if !onFlight {
+			if segment.FlightID != "" {
+				other, err := GetFlightByID(segment.FlightID, svc)
+				if err != nil {
+					return err
+				}
+				flights = append(flights, other)
+			}
+			continue
+		}
+		flights = append(flights, flight)
+		booking.Segments[i].OperatingDate = flight.OperatingDate
+
+		seats := []SeatRef{}
+		for _, ref := range segment.Seats {
+			remap, ok := moved[ref.ID]
+			if !ok {
+				seats = append(seats, ref)
+				continue
+			}
+			switch remap.Outcome {
+			case SeatRemapUnseated:
+				// The old seat stays on the booking until an agent reseats the
+				// passenger, so every passenger keeps one seat per segment.
+				reasons = append(reasons, fmt.Sprintf("Seat %d%s in %s could not be kept", remap.FromRow, seatColumnLetter(remap.FromCol), remap.FromSeatClass))
+				seats = append(seats, ref)
+				continue
+			case SeatRemapClassChanged:
+				reasons = append(reasons, fmt.Sprintf("Seat %d%s moved from %s to %s", remap.FromRow, seatColumnLetter(remap.FromCol), remap.FromSeatClass, remap.ToSeatClass))
+			}
+			seats = append(seats, SeatRef{ID: remap.ToSeatID, FlightSectionID: remap.ToFlightSectionID})
+		}
+		booking.Segments[i].Seats = seats
+	}
+	if len(flights) == len(booking.Segments) {
+		if err := validateBookingConnections(flights, svc); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+
+	action := ""
+	switch {
+	case len(reasons) > 0:
+		action = ScheduleChangeActionAgent
+	case change.Classification == ScheduleChangeSignificant:
+		action = ScheduleChangeActionCustomer
+		reasons = append(reasons, "Significant schedule change")
+	}
+
+	if action != "" {
+		err := putScheduleChangeQueueItem(ScheduleChangeQueueItem{
+			BookingID:      bookingID,
+			ChangeID:       change.ID,
+			FlightID:       change.FlightID,
+			FlightNumber:   change.FlightNumber,
+			OperatingDate:  change.OperatingDate,
+			Classification: change.Classification,
+			Action:         action,
+			Reasons:        reasons,
+			Changes:        change.Changes,
+			SeatRemaps:     remaps,
+			Status:         ScheduleChangeQueueOpen,
+			CreatedAt:      change.CreatedAt,
+		}, svc)
+		if err != nil {
+			return err
+		}
+	}
+
+	segments, err := dynamodbattribute.Marshal(booking.Segments)
+	if err != nil {
+		return err
+	}
+	expression := "SET Segments = :segments, ScheduleChangeIDs = list_append(if_not_exists(ScheduleChangeIDs, :empty), :changeID)"
+	values := map[string]*dynamodb.AttributeValue{
+		":segments": segments,
+		":empty":    {L: []*dynamodb.AttributeValue{}},
+		":changeID": {L: []*dynamodb.AttributeValue{{S: aws.String(change.ID)}}},
+		":change":   {S: aws.String(change.ID)},
+	}
+	if action != "" {
+		expression += ", PendingScheduleChange = :pending"
+		values[":pending"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	_, err = svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("Bookings"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(bookingID),
+			},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("NOT contains(ScheduleChangeIDs, :change)"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func scheduleChangePut(change *ScheduleChange) (*dynamodb.Put, error) {
+	changes, err := dynamodbattribute.Marshal(change.Changes)
+	if err != nil {
+		return nil, err
+	}
+	remaps, err := dynamodbattribute.Marshal(change.SeatRemaps)
+	if err != nil {
+		return nil, err
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(change.ID),
+		},
+		"FlightID": {
+			S: aws.String(change.FlightID),
+		},
+		"FlightNumber": {
+			S: aws.String(change.FlightNumber),
+		},
+		"OperatingDate": {
+			S: aws.String(change.OperatingDate),
+		},
+		"Classification": {
+			S: aws.String(change.Classification),
+		},
+		"Changes":    changes,
+		"SeatRemaps": remaps,
+		"DepartureShiftMinutes": {
+			N: aws.String(fmt.Sprintf("%d", change.DepartureShiftMinutes)),
+		},
+		"ArrivalShiftMinutes": {
+			N: aws.String(fmt.Sprintf("%d", change.ArrivalShiftMinutes)),
+		},
+		"AffectedBookings": {
+			L: stringListValue(change.AffectedBookings),
+		},
+		"Actor": {
+			S: aws.String(change.Actor),
+		},
+		"CreatedAt": {
+			S: aws.String(change.CreatedAt.Format(time.RFC3339Nano)),
+		},
+	}
+	if change.Reason != "" {
+		item["Reason"] = &dynamodb.AttributeValue{S: aws.String(change.Reason)}
+	}
+	if change.Status != "" {
+		item["Status"] = &dynamodb.AttributeValue{S: aws.String(change.Status)}
+	}
+
+	return &dynamodb.Put{
+		TableName: aws.String("ScheduleChanges"),
+		Item:      item,
+	}, nil
+}
+
+func putScheduleChangeQueueItem(item ScheduleChangeQueueItem, svc *dynamodb.DynamoDB) error {
+	changes, err := dynamodbattribute.Marshal(item.Changes)
+	if err != nil {
+		return err
+	}
+	remaps, err := dynamodbattribute.Marshal(item.SeatRemaps)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("ScheduleChangeQueue"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"BookingID": {
+				S: aws.String(item.BookingID),
+			},
+			"ChangeID": {
+				S: aws.String(item.ChangeID),
+			},
+			"FlightID": {
+				S: aws.String(item.FlightID),
+			},
+			"FlightNumber": {
+				S: aws.String(item.FlightNumber),
+			},
+			"OperatingDate": {
+				S: aws.String(item.OperatingDate),
+			},
+			"Classification": {
+				S: aws.String(item.Classification),
+			},
+			"Action": {
+				S: aws.String(item.Action),
+			},
+			"Reasons": {
+				L: stringListValue(item.Reasons),
+			},
+			"Changes":    changes,
+			"SeatRemaps": remaps,
+			"Status": {
+				S: aws.String(item.Status),
+			},
+			"CreatedAt": {
+				S: aws.String(item.CreatedAt.Format(time.RFC3339Nano)),
+			},
+		},
+		// A resumed change must not reopen an item an agent already resolved.
+		ConditionExpression: aws.String("attribute_not_exists(ChangeID)"),
+	})
+	if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+		return nil
+	}
+	return err
+}
+
+func GetScheduleChangeByID(changeID string, svc *dynamodb.DynamoDB) (*ScheduleChange, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("ScheduleChanges"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(changeID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errors.New("Schedule change not found")
+	}
+
+	change := &ScheduleChange{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// GetScheduleChangesByFlight returns the changes of a flight, oldest first.
+func GetScheduleChangesByFlight(flightID string, svc *dynamodb.DynamoDB) ([]ScheduleChange, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("ScheduleChanges"),
+		IndexName:              aws.String("FlightIndex"),
+		KeyConditionExpression: aws.String("FlightID = :flightID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":flightID": {
+				S: aws.String(flightID),
+			},
+		},
+	}
+
+	changes := []ScheduleChange{}
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var change ScheduleChange
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &change); unmarshalErr != nil {
+				return false
+			}
+			changes = append(changes, change)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	return changes, nil
+}
+
+// GetScheduleChangeQueue lists the queued bookings with a status, optionally
+// only those needing one action, oldest first.
+func GetScheduleChangeQueue(status, action string, svc *dynamodb.DynamoDB) ([]ScheduleChangeQueueItem, error) {
+	if status == "" {
+		status = ScheduleChangeQueueOpen
+	}
+	filter := "#status = :status"
+	values := map[string]*dynamodb.AttributeValue{
+		":status": {
+			S: aws.String(status),
+		},
+	}
+	if action != "" {
+		filter += " AND #action = :action"
+		values[":action"] = &dynamodb.AttributeValue{S: aws.String(action)}
+	}
+
+	items := []ScheduleChangeQueueItem{}
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("ScheduleChangeQueue"),
+		FilterExpression: aws.String(filter),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+			"#action": aws.String("Action"),
+		},
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, value := range page.Items {
+			var item ScheduleChangeQueueItem
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(value, &item); unmarshalErr != nil {
+				return false
+			}
+			items = append(items, item)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items, nil
+}
+
+// ResolveScheduleChangeQueueItem closes a queued booking. The booking stops
+// being flagged once none of its queue items is open.
+func ResolveScheduleChangeQueueItem(bookingID, changeID string, resolution ScheduleChangeResolution, svc *dynamodb.DynamoDB) (*ScheduleChangeQueueItem, error) {
+	if strings.TrimSpace(resolution.Actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+	if strings.TrimSpace(resolution.Resolution) == "" {
+		return nil, errors.New("Resolution is required")
+	}
+
+	result, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("ScheduleChangeQueue"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"BookingID": {
+				S: aws.String(bookingID),
+			},
+			"ChangeID": {
+				S: aws.String(changeID),
+			},
+		},
+		UpdateExpression:    aws.String("SET #status = :resolved, ResolvedAt = :now, ResolvedBy = :actor, Resolution = :resolution"),
+		ConditionExpression: aws.String("#status = :open"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":resolved":   {S: aws.String(ScheduleChangeQueueResolved)},
+			":open":       {S: aws.String(ScheduleChangeQueueOpen)},
+			":now":        {S: aws.String(time.Now().UTC().Format(time.RFC3339))},
+			":actor":      {S: aws.String(resolution.Actor)},
+			":resolution": {S: aws.String(resolution.Resolution)},
+		},
+		ReturnValues: aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return nil, errors.New("Queue item not found or already resolved")
+		}
+		return nil, err
+	}
+
+	item := &ScheduleChangeQueueItem{}
+	if err := dynamodbattribute.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, err
+	}
+
+	open, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("ScheduleChangeQueue"),
+		KeyConditionExpression: aws.String("BookingID = :bookingID"),
+		FilterExpression:       aws.String("#status = :open"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":bookingID": {S: aws.String(bookingID)},
+			":open":      {S: aws.String(ScheduleChangeQueueOpen)},
+		},
+	})
+	if err != nil {
+		return item, err
+	}
+	if len(open.Items) == 0 {
+		_, err = svc.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("Bookings"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(bookingID),
+				},
+			},
+			UpdateExpression: aws.String("SET PendingScheduleChange = :pending"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pending": {BOOL: aws.Bool(false)},
+			},
+		})
+		if err != nil {
+			return item, err
+		}
+	}
+
+	fmt.Printf("Resolved schedule change %s of Booking %s by %s\n", changeID, bookingID, resolution.Actor)
+	return item, nil
+}
+
+func ensureScheduleChangeTables(svc *dynamodb.DynamoDB) {
+	if !doesTableExist("ScheduleChanges", svc) {
+		if err := createScheduleChangesTable(svc); err != nil {
+			fmt.Printf("Error creating ScheduleChanges table: %v\n", err)
+		}
+	}
+	if !doesTableExist("ScheduleChangeQueue", svc) {
+		if err := createScheduleChangeQueueTable(svc); err != nil {
+			fmt.Printf("Error creating ScheduleChangeQueue table: %v\n", err)
+		}
+	}
+}
+
+func createScheduleChangesTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("ScheduleChanges"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("FlightID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("CreatedAt"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("FlightIndex"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("FlightID"),
+						KeyType:       aws.String("HASH"),
+					},
+					{
+						AttributeName: aws.String("CreatedAt"),
+						KeyType:       aws.String("RANGE"),
+					},
+				},
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String("ALL"),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ScheduleChanges table created successfully")
+	return nil
+}
+
+func createScheduleChangeQueueTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("ScheduleChangeQueue"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("BookingID"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("ChangeID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("BookingID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("ChangeID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ScheduleChangeQueue table created successfully")
+	return nil
+}
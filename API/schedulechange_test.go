@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// cabinSeats lays out every seat of a section, marking the given seats as windows.
+func cabinSeats(section *FlightSection, windows ...int) []Seat {
+	seats := []Seat{}
+	for row := 1; row <= section.NumRows; row++ {
+		for col := 1; col <= section.NumCols; col++ {
+			seat := Seat{ID: fmt.Sprintf("%s-%d%s", section.ID, row, seatColumnLetter(col)), Row: row, Col: col, FlightSectionID: section.ID}
+			for _, window := range windows {
+				if col == window {
+					seat.Attributes = []string{"WINDOW"}
+				}
+			}
+			seats = append(seats, seat)
+		}
+	}
+	return seats
+}
+
+func TestRemapSeats(t *testing.T) {
+	oldSections := map[string]*FlightSection{
+		"oldJ": {ID: "oldJ", SeatClass: "Business", NumRows: 2, NumCols: 2},
+		"oldY": {ID: "oldY", SeatClass: "Economy", NumRows: 10, NumCols: 3},
+	}
+	newJ := &FlightSection{ID: "newJ", SeatClass: "Business", NumRows: 1, NumCols: 2}
+	newY := &FlightSection{ID: "newY", SeatClass: "Economy", NumRows: 2, NumCols: 3}
+
+	tests := []struct {
+		name        string
+		occupied    []*Seat
+		newSections []*FlightSection
+		windows     []int
+		want        []SeatRemap
+		wantHeld    map[string]string
+	}{
+		{
+			name:        "seat kept",
+			occupied:    []*Seat{{ID: "oldY-1B", Row: 1, Col: 2, FlightSectionID: "oldY", IsBooked: true, BookingID: "b1"}},
+			newSections: []*FlightSection{newJ, newY},
+			want: []SeatRemap{
+				{BookingID: "b1", FromSeatID: "oldY-1B", FromSeatClass: "Economy", FromRow: 1, FromCol: 2, ToSeatID: "newY-1B", ToFlightSectionID: "newY", ToSeatClass: "Economy", ToRow: 1, ToCol: 2, Outcome: SeatRemapSameSeat},
+			},
+		},
+		{
+			name:        "row removed moves to the first free seat of the cabin",
+			occupied:    []*Seat{{ID: "oldY-9A", Row: 9, Col: 1, FlightSectionID: "oldY", IsBooked: true, BookingID: "b1"}},
+			newSections: []*FlightSection{newJ, newY},
+			want: []SeatRemap{
+				{BookingID: "b1", FromSeatID: "oldY-9A", FromSeatClass: "Economy", FromRow: 9, FromCol: 1, ToSeatID: "newY-1A", ToFlightSectionID: "newY", ToSeatClass: "Economy", ToRow: 1, ToCol: 1, Outcome: SeatRemapMoved},
+			},
+		},
+		{
+			name:        "window seat moves to a window",
+			occupied:    []*Seat{{ID: "oldY-9C", Row: 9, Col: 3, FlightSectionID: "oldY", IsBooked: true, BookingID: "b1", Attributes: []string{"WINDOW"}}},
+			newSections: []*FlightSection{newY},
+			windows:     []int{3},
+			want: []SeatRemap{
+				{BookingID: "b1", FromSeatID: "oldY-9C", FromSeatClass: "Economy", FromRow: 9, FromCol: 3, ToSeatID: "newY-1C", ToFlightSectionID: "newY", ToSeatClass: "Economy", ToRow: 1, ToCol: 3, Outcome: SeatRemapMoved},
+			},
+		},
+		{
+			name:        "cabin removed moves to another class",
+			occupied:    []*Seat{{ID: "oldJ-1A", Row: 1, Col: 1, FlightSectionID: "oldJ", IsBooked: true, BookingID: "b1"}},
+			newSections: []*FlightSection{newY},
+			want: []SeatRemap{
+				{BookingID: "b1", FromSeatID: "oldJ-1A", FromSeatClass: "Business", FromRow: 1, FromCol: 1, ToSeatID: "newY-1A", ToFlightSectionID: "newY", ToSeatClass: "Economy", ToRow: 1, ToCol: 1, Outcome: SeatRemapClassChanged},
+			},
+		},
+		{
+			name: "booked seats go before held seats",
+			occupied: []*Seat{
+				{ID: "oldJ-1A", Row: 1, Col: 1, FlightSectionID: "oldJ", IsHeld: true, HoldToken: "token"},
+				{ID: "oldJ-2B", Row: 2, Col: 2, FlightSectionID: "oldJ", IsBooked: true, BookingID: "b1"},
+				{ID: "oldJ-2A", Row: 2, Col: 1, FlightSectionID: "oldJ", IsBooked: true, BookingID: "b2"},
+			},
+			newSections: []*FlightSection{newJ},
+			want: []SeatRemap{
+				{BookingID: "b2", FromSeatID: "oldJ-2A", FromSeatClass: "Business", FromRow: 2, FromCol: 1, ToSeatID: "newJ-1A", ToFlightSectionID: "newJ", ToSeatClass: "Business", ToRow: 1, ToCol: 1, Outcome: SeatRemapMoved},
+				{BookingID: "b1", FromSeatID: "oldJ-2B", FromSeatClass: "Business", FromRow: 2, FromCol: 2, ToSeatID: "newJ-1B", ToFlightSectionID: "newJ", ToSeatClass: "Business", ToRow: 1, ToCol: 2, Outcome: SeatRemapMoved},
+				{FromSeatID: "oldJ-1A", FromSeatClass: "Business", FromRow: 1, FromCol: 1, Outcome: SeatRemapUnseated},
+			},
+		},
+		{
+			name:        "held seat keeps its hold",
+			occupied:    []*Seat{{ID: "oldJ-1B", Row: 1, Col: 2, FlightSectionID: "oldJ", IsHeld: true, HoldToken: "token"}},
+			newSections: []*FlightSection{newJ},
+			want: []SeatRemap{
+				{FromSeatID: "oldJ-1B", FromSeatClass: "Business", FromRow: 1, FromCol: 2, ToSeatID: "newJ-1B", ToFlightSectionID: "newJ", ToSeatClass: "Business", ToRow: 1, ToCol: 2, Outcome: SeatRemapSameSeat},
+			},
+			wantHeld: map[string]string{"newJ-1B": "token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newSections := map[string]*FlightSection{}
+			newSeats := []Seat{}
+			for _, section := range tt.newSections {
+				newSections[section.ID] = section
+				newSeats = append(newSeats, cabinSeats(section, tt.windows...)...)
+			}
+
+			got := remapSeats(tt.occupied, oldSections, newSeats, newSections)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remapSeats() = %+v, want %+v", got, tt.want)
+			}
+
+			held := map[string]string{}
+			for _, seat := range newSeats {
+				if seat.IsHeld {
+					held[seat.ID] = seat.HoldToken
+				}
+			}
+			if tt.wantHeld == nil {
+				tt.wantHeld = map[string]string{}
+			}
+			if !reflect.DeepEqual(held, tt.wantHeld) {
+				t.Errorf("remapSeats() held seats = %v, want %v", held, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestFlightChangePlanClassify(t *testing.T) {
+	thresholds := ScheduleChangeThresholds{MinorDeparture: time.Hour, MinorArrival: time.Hour}
+	flight := &Flight{OriginAirport: "AMS", DestinationAirport: "LHR"}
+
+	tests := []struct {
+		name           string
+		destination    string
+		departureShift time.Duration
+		arrivalShift   time.Duration
+		outcomes       []string
+		want           string
+	}{
+		{name: "shift within thresholds", departureShift: time.Hour, arrivalShift: time.Hour, want: ScheduleChangeMinor},
+		{name: "departure shift", departureShift: time.Hour + time.Minute, want: ScheduleChangeSignificant},
+		{name: "arrival shift", arrivalShift: 2 * time.Hour, want: ScheduleChangeSignificant},
+		{name: "new destination", destination: "LGW", want: ScheduleChangeSignificant},
+		{name: "seats moved in their cabin", outcomes: []string{SeatRemapSameSeat, SeatRemapMoved}, want: ScheduleChangeMinor},
+		{name: "seat moved to another cabin", outcomes: []string{SeatRemapSameSeat, SeatRemapClassChanged}, want: ScheduleChangeSignificant},
+		{name: "passenger unseated", outcomes: []string{SeatRemapUnseated}, want: ScheduleChangeSignificant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &flightChangePlan{flight: flight, changed: *flight, departureShift: tt.departureShift, arrivalShift: tt.arrivalShift}
+			if tt.destination != "" {
+				plan.changed.DestinationAirport = tt.destination
+			}
+			for _, outcome := range tt.outcomes {
+				plan.remaps = append(plan.remaps, SeatRemap{Outcome: outcome})
+			}
+
+			if got := plan.classify(thresholds); got != tt.want {
+				t.Errorf("classify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlightCabinCheck(t *testing.T) {
+	flight := &Flight{ID: "f1", OriginAirport: "LHR"}
+
+	check := flightCabinCheck(flight, []string{"s1", "s2"}).ConditionCheck
+	want := "(attribute_not_exists(CabinChangeID) OR CabinChangeUntil < :now) AND contains(FlightSectionID, :section1) AND contains(FlightSectionID, :section2)"
+	if got := aws.StringValue(check.ConditionExpression); got != want {
+		t.Errorf("flightCabinCheck() condition = %q, want %q", got, want)
+	}
+	for placeholder, section := range map[string]string{":section1": "s1", ":section2": "s2"} {
+		if got := aws.StringValue(check.ExpressionAttributeValues[placeholder].S); got != section {
+			t.Errorf("flightCabinCheck() %s = %q, want %q", placeholder, got, section)
+		}
+	}
+
+	sale := flightOpenForSaleCheck(flight, []string{"s1"}).ConditionCheck
+	want = "(attribute_not_exists(#status) OR #status IN (:scheduled, :delayed)) AND (attribute_not_exists(CabinChangeID) OR CabinChangeUntil < :now) AND contains(FlightSectionID, :section1)"
+	if got := aws.StringValue(sale.ConditionExpression); got != want {
+		t.Errorf("flightOpenForSaleCheck() condition = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Flights are indexed by route and UTC departure time in RouteDateIndex, so a
+// search is a single Query per route instead of a Scan.
+
+// flightRoute is the RouteDateIndex partition key of a flight.
+func flightRoute(originAirport, destinationAirport string) string {
+	return strings.ToUpper(originAirport) + "#" + strings.ToUpper(destinationAirport)
+}
+
+func flightRouteDateIndex() *dynamodb.GlobalSecondaryIndex {
+	return flightDepartureIndex("RouteDateIndex", "Route")
+}
+
+// flightOriginDateIndex lists departures from an airport by time, used to build connections.
+func flightOriginDateIndex() *dynamodb.GlobalSecondaryIndex {
+	return flightDepartureIndex("OriginDateIndex", "OriginAirport")
+}
+
+func flightDepartureIndex(indexName, hashKey string) *dynamodb.GlobalSecondaryIndex {
+	return &dynamodb.GlobalSecondaryIndex{
+		IndexName: aws.String(indexName),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(hashKey),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("DepartureUTC"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		Projection: &dynamodb.Projection{
+			ProjectionType: aws.String("ALL"),
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// ensureFlightSearchIndexes adds the search indexes to a Flights table created
+// before they existed. DynamoDB only accepts one index creation per UpdateTable
+// call, so a missing index is added per run until all of them exist.
+func ensureFlightSearchIndexes(svc *dynamodb.DynamoDB) error {
+	description, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String("Flights"),
+	})
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, index := range description.Table.GlobalSecondaryIndexes {
+		existing[aws.StringValue(index.IndexName)] = true
+	}
+
+	for _, index := range []*dynamodb.GlobalSecondaryIndex{flightRouteDateIndex(), flightOriginDateIndex(), flightAirlineIndex()} {
+		if existing[aws.StringValue(index.IndexName)] {
+			continue
+		}
+
+		_, err = svc.UpdateTable(&dynamodb.UpdateTableInput{
+			TableName: aws.String("Flights"),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: index.KeySchema[0].AttributeName,
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("DepartureUTC"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+				{
+					Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+						IndexName:             index.IndexName,
+						KeySchema:             index.KeySchema,
+						Projection:            index.Projection,
+						ProvisionedThroughput: index.ProvisionedThroughput,
+					},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s added to Flights table, run again once it is active\n", aws.StringValue(index.IndexName))
+		return nil
+	}
+
+	return nil
+}
+
+// BackfillFlightRoutes creates the search indexes if needed and writes the Route
+// and DepartureUTC keys on flights created before search existed.
+func BackfillFlightRoutes(svc *dynamodb.DynamoDB) (int, error) {
+	if err := ensureFlightSearchIndexes(svc); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	var updateErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("Flights"),
+		FilterExpression: aws.String("attribute_not_exists(Route) OR attribute_not_exists(DepartureUTC)"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if updateErr = dynamodbattribute.UnmarshalMap(item, &flight); updateErr != nil {
+				return false
+			}
+			_, updateErr = svc.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String("Flights"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID":            item["ID"],
+					"OriginAirport": item["OriginAirport"],
+				},
+				UpdateExpression: aws.String("SET #Route = :route, DepartureUTC = :departureUTC"),
+				ExpressionAttributeNames: map[string]*string{
+					"#Route": aws.String("Route"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":route": {
+						S: aws.String(flightRoute(flight.OriginAirport, flight.DestinationAirport)),
+					},
+					":departureUTC": {
+						S: aws.String(flight.DepartureDate.UTC().Format(time.RFC3339)),
+					},
+				},
+			})
+			if updateErr != nil {
+				return false
+			}
+			updated++
+		}
+		return true
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	return updated, updateErr
+}
+
+type FlightSearchQuery struct {
+	Origin        string
+	Destination   string
+	DepartureFrom time.Time
+	DepartureTo   time.Time
+	Passengers    int
+	// SeatClass optionally restricts the free seats counted to one cabin.
+	SeatClass string
+	// FlightNumber optionally restricts the results to flights operated or
+	// marketed under that number.
+	FlightNumber string
+}
+
+type FlightSearchResult struct {
+	Flight       Flight              `json:"flight"`
+	FreeSeats    int                 `json:"freeSeats"`
+	Availability []*SeatAvailability `json:"availability"`
+}
+
+func validateFlightSearchQuery(query FlightSearchQuery) error {
+	if err := ValidateAirportCode(query.Origin); err != nil {
+		return errors.New("origin: " + err.Error())
+	}
+	if err := ValidateAirportCode(query.Destination); err != nil {
+		return errors.New("destination: " + err.Error())
+	}
+	if query.DepartureFrom.IsZero() || query.DepartureTo.IsZero() {
+		return errors.New("A departure date or range is required")
+	}
+	if query.DepartureTo.Before(query.DepartureFrom) {
+		return errors.New("The end of the departure range is before its start")
+	}
+	if query.Passengers < 1 {
+		return errors.New("passengers must be at least 1")
+	}
+	return nil
+}
+
+// ParseDepartureRange reads a departure date (YYYY-MM-DD) or a from/to range of
+// dates or RFC3339 times. Dates are days in location, the time zone of the
+// origin airport, so a date covers the flights of that local day.
+func ParseDepartureRange(date, from, to string, location *time.Location) (time.Time, time.Time, error) {
+	if date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("date must be formatted as YYYY-MM-DD")
+		}
+		return day, endOfDay(day), nil
+	}
+
+	start, err := parseDepartureBound(from, false, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseDepartureBound(to, true, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// OriginDepartureRange is ParseDepartureRange with dates in the time zone of the origin airport.
+func OriginDepartureRange(origin, date, from, to string, svc *dynamodb.DynamoDB) (time.Time, time.Time, error) {
+	if err := ValidateAirportCode(origin); err != nil {
+		return time.Time{}, time.Time{}, errors.New("origin: " + err.Error())
+	}
+	location, err := airportLocation(strings.ToUpper(origin), svc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("origin: %v", err)
+	}
+	return ParseDepartureRange(date, from, to, location)
+}
+
+// endOfDay returns the last second of the local day starting at day, which
+// is not always 24 hours long.
+func endOfDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location()).Add(-time.Second)
+}
+
+func parseDepartureBound(value string, isEnd bool, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("Either date or both from and to are required")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date or RFC3339 time", value)
+	}
+	if isEnd {
+		return endOfDay(day), nil
+	}
+	return day, nil
+}
+
+// queryFlightsByRoute returns the flights of a route departing within [from, to], ordered by departure.
+func queryFlightsByRoute(origin, destination string, from, to time.Time, svc *dynamodb.DynamoDB) ([]Flight, error) {
+	return queryFlightDepartures(flightRouteDateIndex(), flightRoute(origin, destination), from, to, svc)
+}
+
+// queryFlightsFromAirport returns the flights leaving an airport within [from, to], ordered by departure.
+func queryFlightsFromAirport(origin string, from, to time.Time, svc *dynamodb.DynamoDB) ([]Flight, error) {
+	return queryFlightDepartures(flightOriginDateIndex(), origin, from, to, svc)
+}
+
+func queryFlightDepartures(index *dynamodb.GlobalSecondaryIndex, hashValue string, from, to time.Time, svc *dynamodb.DynamoDB) ([]Flight, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("Flights"),
+		IndexName:              index.IndexName,
+		KeyConditionExpression: aws.String("#hash = :hash AND DepartureUTC BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]*string{
+			"#hash": index.KeySchema[0].AttributeName,
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":hash": {
+				S: aws.String(hashValue),
+			},
+			":from": {
+				S: aws.String(from.UTC().Format(time.RFC3339)),
+			},
+			":to": {
+				S: aws.String(to.UTC().Format(time.RFC3339)),
+			},
+		},
+	}
+
+	flights := []Flight{}
+	var unmarshalErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var flight Flight
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &flight); unmarshalErr != nil {
+				return false
+			}
+			flights = append(flights, flight)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return flights, nil
+}
+
+// freeSeatsForClass sums the free seats of a flight, optionally for a single seat class.
+func freeSeatsForClass(availability []*SeatAvailability, seatClass string) (int, []*SeatAvailability) {
+	freeSeats := 0
+	matching := []*SeatAvailability{}
+	for _, sectionAvailability := range availability {
+		if seatClass != "" && !strings.EqualFold(sectionAvailability.SeatClass, seatClass) {
+			continue
+		}
+		freeSeats += sectionAvailability.Free
+		matching = append(matching, sectionAvailability)
+	}
+	return freeSeats, matching
+}
+
+// SearchFlights returns the direct flights of a route departing within the
+// requested window that are open for sale and have enough free seats, sorted
+// by departure time.
+func SearchFlights(query FlightSearchQuery, svc *dynamodb.DynamoDB) ([]FlightSearchResult, error) {
+	if err := validateFlightSearchQuery(query); err != nil {
+		return nil, err
+	}
+
+	flights, err := queryFlightsByRoute(query.Origin, query.Destination, query.DepartureFrom, query.DepartureTo, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []FlightSearchResult{}
+	for _, flight := range flights {
+		if !flight.isOpenForSale() {
+			continue
+		}
+		if query.FlightNumber != "" && !flight.hasNumber(query.FlightNumber) {
+			continue
+		}
+		availability, err := GetAvailabilityForFlight(flight, svc)
+		if err != nil {
+			return nil, err
+		}
+
+		freeSeats, matching := freeSeatsForClass(availability, query.SeatClass)
+		if freeSeats < query.Passengers {
+			continue
+		}
+
+		results = append(results, FlightSearchResult{Flight: flight, FreeSeats: freeSeats, Availability: matching})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Flight.DepartureDate.Before(results[j].Flight.DepartureDate)
+	})
+
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDepartureRange(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		date     string
+		from     string
+		to       string
+		location *time.Location
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{
+			name:     "date in UTC",
+			date:     "2024-06-01",
+			location: time.UTC,
+			wantFrom: "2024-06-01T00:00:00Z",
+			wantTo:   "2024-06-01T23:59:59Z",
+		},
+		{
+			name:     "date is the local day of the origin",
+			date:     "2024-06-01",
+			location: newYork,
+			wantFrom: "2024-06-01T04:00:00Z",
+			wantTo:   "2024-06-02T03:59:59Z",
+		},
+		{
+			name:     "local day ahead of UTC",
+			date:     "2024-06-01",
+			location: tokyo,
+			wantFrom: "2024-05-31T15:00:00Z",
+			wantTo:   "2024-06-01T14:59:59Z",
+		},
+		{
+			name:     "day the clocks go forward has 23 hours",
+			date:     "2024-03-10",
+			location: newYork,
+			wantFrom: "2024-03-10T05:00:00Z",
+			wantTo:   "2024-03-11T03:59:59Z",
+		},
+		{
+			name:     "date range covers both local days",
+			from:     "2024-06-01",
+			to:       "2024-06-02",
+			location: newYork,
+			wantFrom: "2024-06-01T04:00:00Z",
+			wantTo:   "2024-06-03T03:59:59Z",
+		},
+		{
+			name:     "RFC3339 bounds are kept as they are",
+			from:     "2024-06-01T10:00:00+02:00",
+			to:       "2024-06-01T18:00:00Z",
+			location: newYork,
+			wantFrom: "2024-06-01T08:00:00Z",
+			wantTo:   "2024-06-01T18:00:00Z",
+		},
+		{
+			name:     "date wins over a range",
+			date:     "2024-06-01",
+			from:     "2024-07-01",
+			to:       "2024-07-02",
+			location: time.UTC,
+			wantFrom: "2024-06-01T00:00:00Z",
+			wantTo:   "2024-06-01T23:59:59Z",
+		},
+		{name: "invalid date", date: "01/06/2024", location: time.UTC, wantErr: true},
+		{name: "missing to", from: "2024-06-01", location: time.UTC, wantErr: true},
+		{name: "nothing given", location: time.UTC, wantErr: true},
+		{name: "invalid bound", from: "tomorrow", to: "2024-06-02", location: time.UTC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := ParseDepartureRange(tt.date, tt.from, tt.to, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDepartureRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := from.UTC().Format(time.RFC3339); got != tt.wantFrom {
+				t.Errorf("ParseDepartureRange() from = %v, want %v", got, tt.wantFrom)
+			}
+			if got := to.UTC().Format(time.RFC3339); got != tt.wantTo {
+				t.Errorf("ParseDepartureRange() to = %v, want %v", got, tt.wantTo)
+			}
+		})
+	}
+}
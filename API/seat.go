@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -11,39 +13,117 @@ import (
 )
 
 type Seat struct {
-	ID              string `json:"id"`
-	Row             int    `json:"Row"`
-	Col             int    `json:"Col"`
-	IsBooked        bool   `json:"IsBooked"`
-	FlightSectionID string `json:FlightSectionId`
-	FlightNumber    string `json:FlightNumber`
+	ID       string `json:"id"`
+	Row      int    `json:"Row"`
+	Col      int    `json:"Col"`
+	IsBooked bool   `json:"IsBooked"`
+	IsHeld   bool   `json:"IsHeld"`
+	// HoldToken is handed to whoever holds the seat and is needed to book
+	// it. It is never returned when seats are read.
+	HoldToken       string `dynamodbav:"HoldToken,omitempty" json:"-"`
+	FlightSectionID string `json:"FlightSectionID"`
+	FlightNumber    string `json:"FlightNumber"`
+	// FlightID is the dated flight owning the seat's FlightSection.
+	FlightID string `json:"FlightID,omitempty"`
+
+	// Blocked seats are out of sale for operational reasons, see seatblock.go.
+	IsBlocked    bool       `json:"IsBlocked"`
+	BlockReason  string     `json:"BlockReason,omitempty"`
+	BlockedBy    string     `json:"BlockedBy,omitempty"`
+	BlockedAt    *time.Time `json:"BlockedAt,omitempty"`
+	BlockedUntil *time.Time `json:"BlockedUntil,omitempty"`
+	BlockNotes   string     `json:"BlockNotes,omitempty"`
+	// BlockHistory records every block and release of the seat.
+	BlockHistory []SeatBlockChange `json:"BlockHistory,omitempty"`
+	// unblockedBy is who lifts the block in a pending update. Releases
+	// without an actor are recorded as expiries.
+	unblockedBy string
+
+	Attributes []string `json:"Attributes,omitempty"`
+
+	// BookingID is set while the seat is booked through a Booking.
+	BookingID string `json:"BookingID,omitempty"`
 }
 
-func CreateSeat(seat Seat, svc *dynamodb.DynamoDB) error {
-	seatID := uuid.New().String()
+// seatAttributes are the seat characteristics a seat can be tagged with.
+var seatAttributes = map[string]bool{
+	"WINDOW":             true,
+	"AISLE":              true,
+	"MIDDLE":             true,
+	"EXIT_ROW":           true,
+	"EXTRA_LEGROOM":      true,
+	"BASSINET":           true,
+	"POWER":              true,
+	"RESTRICTED_RECLINE": true,
+}
+
+func validateSeatAttributes(attributes []string) error {
+	for _, attribute := range attributes {
+		if !seatAttributes[attribute] {
+			return fmt.Errorf("Unknown seat attribute %q", attribute)
+		}
+	}
+	return nil
+}
 
+func ensureSeatTables(svc *dynamodb.DynamoDB) {
 	if !doesTableExist("Seats", svc) {
 		if err := createSeatsTable(svc); err != nil {
 			fmt.Printf("Error creating Seats table: %v\n", err)
 		}
 	}
+	if !doesTableExist("SeatAvailability", svc) {
+		if err := createSeatAvailabilityTable(svc); err != nil {
+			fmt.Printf("Error creating SeatAvailability table: %v\n", err)
+		}
+	}
+	if !doesTableExist("SeatPositions", svc) {
+		if err := createSeatPositionsTable(svc); err != nil {
+			fmt.Printf("Error creating SeatPositions table: %v\n", err)
+		}
+	}
+}
+
+func CreateSeat(seat Seat, svc *dynamodb.DynamoDB) error {
+	seat.ID = uuid.New().String()
+
+	ensureSeatTables(svc)
 
-	if err := validateFlightNumber(seat.FlightNumber, svc); err != nil {
+	if err := validateFlightSectionID(seat.FlightSectionID, svc); err != nil {
 		return err
 	}
-	if err := validateFlightSectionID(seat.FlightSectionID, svc); err != nil {
+	if err := validateSeatFlight(&seat, svc); err != nil {
 		return err
 	}
 	if err := validateRowColInFlightSection(seat, svc); err != nil {
 		return err
 	}
+	if err := validateSeatAttributes(seat.Attributes); err != nil {
+		return err
+	}
+	if err := validateSeatPositionFree(seat, svc); err != nil {
+		return err
+	}
+
+	// Seats are created for sale; blocking goes through BlockSeats.
+	seat.IsBlocked = false
+
+	// Insert the seat, claim its position and bump the availability counters in one transaction.
+	writes := []*dynamodb.TransactWriteItem{
+		{Put: seatPut(seat)},
+		{Put: seatPositionPut(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col, seat.ID)},
+	}
+	conflictMessages := []string{"", errSeatPositionTaken.Error()}
+	return writeSeatWithAvailability(writes, conflictMessages, seat.FlightNumber, seat.FlightSectionID, seatCreateDelta(seat), svc)
+}
 
-	// Create a DynamoDB PutItem input.
-	input := &dynamodb.PutItemInput{
+// seatPut builds the DynamoDB Put for a new seat.
+func seatPut(seat Seat) *dynamodb.Put {
+	put := &dynamodb.Put{
 		TableName: aws.String("Seats"),
 		Item: map[string]*dynamodb.AttributeValue{
 			"ID": {
-				S: aws.String(seatID),
+				S: aws.String(seat.ID),
 			},
 			"Row": {
 				N: aws.String(fmt.Sprintf("%d", seat.Row)),
@@ -60,18 +140,59 @@ func CreateSeat(seat Seat, svc *dynamodb.DynamoDB) error {
 			"IsBooked": {
 				BOOL: aws.Bool(seat.IsBooked),
 			},
+			"IsHeld": {
+				BOOL: aws.Bool(seat.IsHeld && !seat.IsBooked),
+			},
+			"IsBlocked": {
+				BOOL: aws.Bool(seat.IsBlocked),
+			},
 		},
 	}
-
-	// Insert the item into DynamoDB.
-	_, err := svc.PutItem(input)
-	if err != nil {
-		return err
+	if seat.FlightID != "" {
+		put.Item["FlightID"] = &dynamodb.AttributeValue{S: aws.String(seat.FlightID)}
+	}
+	if seat.BookingID != "" && seat.IsBooked {
+		put.Item["BookingID"] = &dynamodb.AttributeValue{S: aws.String(seat.BookingID)}
+	}
+	if seat.HoldToken != "" && seat.IsHeld && !seat.IsBooked {
+		put.Item["HoldToken"] = &dynamodb.AttributeValue{S: aws.String(seat.HoldToken)}
 	}
+	if len(seat.Attributes) > 0 {
+		put.Item["Attributes"] = &dynamodb.AttributeValue{SS: aws.StringSlice(seat.Attributes)}
+	}
+	if seat.IsBlocked {
+		put.Item["BlockReason"] = &dynamodb.AttributeValue{S: aws.String(seat.BlockReason)}
+		put.Item["BlockedBy"] = &dynamodb.AttributeValue{S: aws.String(seat.BlockedBy)}
+		put.Item["BlockedAt"] = &dynamodb.AttributeValue{S: aws.String(seat.BlockedAt.Format(time.RFC3339))}
+		if seat.BlockNotes != "" {
+			put.Item["BlockNotes"] = &dynamodb.AttributeValue{S: aws.String(seat.BlockNotes)}
+		}
+		if seat.BlockedUntil != nil {
+			put.Item["BlockedUntil"] = &dynamodb.AttributeValue{S: aws.String(seat.BlockedUntil.Format(time.RFC3339))}
+		}
+		change := SeatBlockChange{Action: SeatBlockActionBlocked, ReasonCode: seat.BlockReason, Actor: seat.BlockedBy, At: *seat.BlockedAt}
+		put.Item["BlockHistory"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{change.attributeValue()}}
+	}
+	return put
+}
 
-	// No errors occurred, return nil.
-	return nil
+// seatCreateDelta is how creating the seat moves the availability counters.
+func seatCreateDelta(seat Seat) availabilityDelta {
+	delta := availabilityDelta{Total: 1}
+	if seat.IsBooked {
+		delta.Booked = 1
+	} else if seat.IsHeld {
+		delta.Held = 1
+	}
+	if seat.IsBlocked {
+		delta.Blocked = 1
+	}
+	if expiry := blockExpiry(&seat); expiry != "" {
+		delta.BlockExpiries = []string{expiry}
+	}
+	return delta
 }
+
 func GetSeatsByFlightNumber(FlightNumber string, svc *dynamodb.DynamoDB) ([]*Seat, error) {
 	queryInput := &dynamodb.QueryInput{
 		TableName:              aws.String("Seats"),
@@ -87,19 +208,24 @@ func GetSeatsByFlightNumber(FlightNumber string, svc *dynamodb.DynamoDB) ([]*Sea
 		},
 	}
 
-	result, err := svc.Query(queryInput)
-	if err != nil {
-		return nil, err
-	}
-
 	seats := []*Seat{}
 
-	for _, item := range result.Items {
-		seat := &Seat{}
-		if err := dynamodbattribute.UnmarshalMap(item, seat); err != nil {
-			return nil, err
+	var unmarshalErr error
+	err := svc.QueryPages(queryInput, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			seat := &Seat{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, seat); unmarshalErr != nil {
+				return false
+			}
+			seats = append(seats, seat)
 		}
-		seats = append(seats, seat)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
 	}
 
 	return seats, nil
@@ -137,6 +263,23 @@ func GetSeatsByFlightSectionID(FlightSectionID string, svc *dynamodb.DynamoDB) (
 	return seats, nil
 }
 
+// GetSeatsByFlight returns the seats of one dated flight.
+func GetSeatsByFlight(flight *Flight, svc *dynamodb.DynamoDB) ([]*Seat, error) {
+	seats := []*Seat{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		sectionSeats, err := GetSeatsByFlightSectionID(flightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, seat := range sectionSeats {
+			if seatOnFlight(seat, flight) {
+				seats = append(seats, seat)
+			}
+		}
+	}
+	return seats, nil
+}
+
 func GetSeatByID(seatID string, svc *dynamodb.DynamoDB) (*Seat, error) {
 	// Create a DynamoDB GetItem input.
 	input := &dynamodb.GetItemInput{
@@ -169,31 +312,37 @@ func GetSeatByID(seatID string, svc *dynamodb.DynamoDB) (*Seat, error) {
 	return seat, nil
 }
 func GetAllSeats(svc *dynamodb.DynamoDB) ([]Seat, error) {
-	input := &dynamodb.ScanInput{
-		TableName: aws.String("Seats"),
-	}
+	seats := []Seat{}
 
-	result, err := svc.Scan(input)
+	// Scan every page, a single Scan stops after 1 MB of seats.
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String("Seats"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			seat := Seat{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &seat); unmarshalErr != nil {
+				return false
+			}
+			seats = append(seats, seat)
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	seats := []Seat{}
-
-	for _, item := range result.Items {
-		seat := Seat{}
-		if err := dynamodbattribute.UnmarshalMap(item, &seat); err != nil {
-			return nil, err
-		}
-		seats = append(seats, seat)
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
 	}
 
 	return seats, nil
 }
 
-func UpdateSeatIsBooked(seatID, flightSectionID string, isBooked bool, svc *dynamodb.DynamoDB) error {
-	// Create a DynamoDB UpdateItem input to update the IsBooked property.
-	input := &dynamodb.UpdateItemInput{
+var errSeatNotFound = errors.New("Seat not found")
+
+// getSeat loads a seat by its full primary key.
+func getSeat(seatID, flightSectionID string, svc *dynamodb.DynamoDB) (*Seat, error) {
+	input := &dynamodb.GetItemInput{
 		TableName: aws.String("Seats"),
 		Key: map[string]*dynamodb.AttributeValue{
 			"ID": {
@@ -203,29 +352,291 @@ func UpdateSeatIsBooked(seatID, flightSectionID string, isBooked bool, svc *dyna
 				S: aws.String(flightSectionID),
 			},
 		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":isBooked": {
-				BOOL: aws.Bool(isBooked),
+	}
+
+	result, err := svc.GetItem(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, errSeatNotFound
+	}
+
+	seat := &Seat{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, seat); err != nil {
+		return nil, err
+	}
+
+	return seat, nil
+}
+
+// seatUpdate builds a conditional seat update from the current state of the
+// seat to next. It only applies while the seat is still in the state it was
+// read in, so concurrent changes cannot double count.
+func seatUpdate(seat, next *Seat) *dynamodb.TransactWriteItem {
+	values := map[string]*dynamodb.AttributeValue{
+		":wasBooked": {
+			BOOL: aws.Bool(seat.IsBooked),
+		},
+		":wasHeld": {
+			BOOL: aws.Bool(seat.IsHeld),
+		},
+		":wasBlocked": {
+			BOOL: aws.Bool(seat.IsBlocked),
+		},
+		":isBooked": {
+			BOOL: aws.Bool(next.IsBooked),
+		},
+		":isHeld": {
+			BOOL: aws.Bool(next.IsHeld),
+		},
+		":isBlocked": {
+			BOOL: aws.Bool(next.IsBlocked),
+		},
+	}
+	updateExpression := "SET IsBooked = :isBooked, IsHeld = :isHeld, IsBlocked = :isBlocked"
+	removed := []string{}
+
+	if next.IsBlocked {
+		updateExpression += ", BlockReason = :blockReason, BlockedBy = :blockedBy, BlockedAt = :blockedAt, BlockNotes = :blockNotes"
+		values[":blockReason"] = &dynamodb.AttributeValue{S: aws.String(next.BlockReason)}
+		values[":blockedBy"] = &dynamodb.AttributeValue{S: aws.String(next.BlockedBy)}
+		values[":blockedAt"] = &dynamodb.AttributeValue{S: aws.String(next.BlockedAt.Format(time.RFC3339))}
+		values[":blockNotes"] = &dynamodb.AttributeValue{S: aws.String(next.BlockNotes)}
+		if next.BlockedUntil != nil {
+			updateExpression += ", BlockedUntil = :blockedUntil"
+			values[":blockedUntil"] = &dynamodb.AttributeValue{S: aws.String(next.BlockedUntil.Format(time.RFC3339))}
+		} else {
+			removed = append(removed, "BlockedUntil")
+		}
+	} else if seat.IsBlocked {
+		removed = append(removed, "BlockReason", "BlockedBy", "BlockedAt", "BlockedUntil", "BlockNotes")
+	}
+	if change := blockChange(seat, next, time.Now().UTC()); change != nil {
+		updateExpression += ", BlockHistory = list_append(if_not_exists(BlockHistory, :emptyHistory), :blockChange)"
+		values[":emptyHistory"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+		values[":blockChange"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{change.attributeValue()}}
+	}
+
+	if next.BookingID != "" {
+		updateExpression += ", BookingID = :bookingID"
+		values[":bookingID"] = &dynamodb.AttributeValue{S: aws.String(next.BookingID)}
+	} else if seat.BookingID != "" {
+		removed = append(removed, "BookingID")
+	}
+
+	// A hold only survives while the seat stays held, and the update only
+	// applies while the seat is held under the token it was read with.
+	condition := "IsBooked = :wasBooked" +
+		" AND (attribute_not_exists(IsHeld) OR IsHeld = :wasHeld)" +
+		" AND (attribute_not_exists(IsBlocked) OR IsBlocked = :wasBlocked)"
+	if seat.HoldToken != "" {
+		condition += " AND HoldToken = :wasHoldToken"
+		values[":wasHoldToken"] = &dynamodb.AttributeValue{S: aws.String(seat.HoldToken)}
+	} else {
+		condition += " AND attribute_not_exists(HoldToken)"
+	}
+	if next.IsHeld && !next.IsBooked && next.HoldToken != "" {
+		updateExpression += ", HoldToken = :holdToken"
+		values[":holdToken"] = &dynamodb.AttributeValue{S: aws.String(next.HoldToken)}
+	} else if seat.HoldToken != "" {
+		removed = append(removed, "HoldToken")
+	}
+
+	if len(removed) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removed, ", ")
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: aws.String("Seats"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(seat.ID),
+				},
+				"FlightSectionID": {
+					S: aws.String(seat.FlightSectionID),
+				},
 			},
+			ConditionExpression:       aws.String(condition),
+			UpdateExpression:          aws.String(updateExpression),
+			ExpressionAttributeValues: values,
 		},
-		UpdateExpression: aws.String("SET IsBooked = :isBooked"),
-		ReturnValues:     aws.String("UPDATED_NEW"),
 	}
+}
+
+// updateSeatState moves a seat to the booked/held/blocked state of next and
+// keeps the availability counters in step with it.
+// flightChecks are written in the same transaction, so the seat is not sold
+// on a flight that closed for sale, or changed its cabin, after it was read.
+func updateSeatState(seat, next *Seat, svc *dynamodb.DynamoDB, flightChecks ...*dynamodb.TransactWriteItem) error {
+	if seat.IsBooked == next.IsBooked && seat.IsHeld == next.IsHeld && seat.IsBlocked == next.IsBlocked && seat.BookingID == next.BookingID && !next.IsBlocked {
+		return nil
+	}
+
+	delta := availabilityDelta{}
+	delta.Booked = boolToInt(next.IsBooked) - boolToInt(seat.IsBooked)
+	delta.Held = boolToInt(next.IsHeld) - boolToInt(seat.IsHeld)
+	delta.Blocked = boolToInt(next.IsBlocked) - boolToInt(seat.IsBlocked)
+	if expiry := blockExpiry(next); expiry != "" && expiry != blockExpiry(seat) {
+		delta.BlockExpiries = []string{expiry}
+	}
+
+	writes := append([]*dynamodb.TransactWriteItem{seatUpdate(seat, next)}, flightChecks...)
+	conflictMessages := []string{""}
+	for range flightChecks {
+		conflictMessages = append(conflictMessages, "Flight closed for sale or changed its cabin, please retry")
+	}
+	return writeSeatWithAvailability(writes, conflictMessages, seat.FlightNumber, seat.FlightSectionID, delta, svc)
+}
 
-	// Update the IsBooked property of the seat in DynamoDB.
-	result, err := svc.UpdateItem(input)
+// seatFlight loads the dated flight a seat is sold on. Seats stored before
+// seats had a FlightID are looked up by their FlightNumber.
+func seatFlight(seat *Seat, svc *dynamodb.DynamoDB) (*Flight, error) {
+	if seat.FlightID != "" {
+		return GetFlightByID(seat.FlightID, svc)
+	}
+	flight, err := GetFlightByFlightNumber(seat.FlightNumber, svc)
+	if err != nil {
+		return nil, err
+	}
+	if !seatOnFlight(seat, flight) {
+		return nil, errors.New("Seat does not belong to a section of its flight")
+	}
+	return flight, nil
+}
+
+// seatSaleCheck rejects selling a seat on a flight that is closed for sale
+// and returns the check keeping the flight open, with the seat's section,
+// while the seat is written.
+func seatSaleCheck(seat *Seat, svc *dynamodb.DynamoDB) (*dynamodb.TransactWriteItem, error) {
+	flight, err := seatFlight(seat, svc)
+	if err != nil {
+		return nil, err
+	}
+	if !flight.isOpenForSale() {
+		return nil, fmt.Errorf("Flight %s is %s and closed for sale", flight.FlightNumber, flight.currentStatus())
+	}
+	return flightOpenForSaleCheck(flight, []string{seat.FlightSectionID}), nil
+}
+
+// seatReleaseCheck returns the check keeping the seat's section on its
+// flight, and out of a cabin change, while the seat is released.
+func seatReleaseCheck(seat *Seat, svc *dynamodb.DynamoDB) (*dynamodb.TransactWriteItem, error) {
+	flight, err := seatFlight(seat, svc)
+	if err != nil {
+		return nil, err
+	}
+	return flightCabinCheck(flight, []string{seat.FlightSectionID}), nil
+}
+
+// releaseExpiredBlock clears a block whose expiry has passed so the seat can be sold again.
+func releaseExpiredBlock(next *Seat) error {
+	if !next.IsBlocked {
+		return nil
+	}
+	if next.isBlockActive(time.Now()) {
+		return errors.New("Seat is blocked")
+	}
+	next.IsBlocked = false
+	return nil
+}
+
+// heldFor reports whether the seat is held under holdToken. Holds taken
+// before hold tokens existed match no token.
+func (seat *Seat) heldFor(holdToken string) bool {
+	return seat.IsHeld && seat.HoldToken != "" && seat.HoldToken == holdToken
+}
+
+// UpdateSeatIsBooked books or releases a seat. A held seat can only be
+// booked with the token of its hold.
+func UpdateSeatIsBooked(seatID, flightSectionID string, isBooked bool, holdToken string, svc *dynamodb.DynamoDB) error {
+	seat, err := getSeat(seatID, flightSectionID, svc)
+	if err != nil {
+		return err
+	}
+	if isBooked && seat.IsHeld && !seat.heldFor(holdToken) {
+		return errors.New("Seat is held by another customer")
+	}
+
+	// Booking a seat releases any hold on it.
+	next := *seat
+	next.IsBooked = isBooked
+	next.IsHeld = false
+	if !isBooked {
+		next.BookingID = ""
+	}
+	var flightCheck *dynamodb.TransactWriteItem
+	if isBooked {
+		if err := releaseExpiredBlock(&next); err != nil {
+			return err
+		}
+		flightCheck, err = seatSaleCheck(seat, svc)
+	} else {
+		flightCheck, err = seatReleaseCheck(seat, svc)
+	}
 	if err != nil {
-		fmt.Printf("Error updating seat %s IsBooked: %v\n", seatID, err)
 		return err
 	}
 
-	// Check the result for debugging purposes (optional).
-	fmt.Printf("UpdateItem result: %v\n", result)
+	if err := updateSeatState(seat, &next, svc, flightCheck); err != nil {
+		fmt.Printf("Error updating seat %s IsBooked: %v\n", seatID, err)
+		return err
+	}
 
 	fmt.Printf("Updated seat %s IsBooked to %v\n", seatID, isBooked)
 	return nil
 }
 
+// UpdateSeatIsHeld holds or releases a seat. Holding returns the token
+// needed to book the seat or release the hold; holding it again with the
+// same token keeps the hold.
+func UpdateSeatIsHeld(seatID, flightSectionID string, isHeld bool, holdToken string, svc *dynamodb.DynamoDB) (string, error) {
+	seat, err := getSeat(seatID, flightSectionID, svc)
+	if err != nil {
+		return "", err
+	}
+
+	if seat.IsBooked && isHeld {
+		return "", errors.New("Seat is already booked")
+	}
+	if seat.heldFor(holdToken) && isHeld {
+		return holdToken, nil
+	}
+	if seat.IsHeld && seat.HoldToken != "" && !seat.heldFor(holdToken) {
+		return "", errors.New("Seat is held by another customer")
+	}
+	if seat.IsHeld && isHeld {
+		return "", errors.New("Seat is already held")
+	}
+
+	next := *seat
+	next.IsHeld = isHeld
+	next.HoldToken = ""
+	var flightCheck *dynamodb.TransactWriteItem
+	if isHeld {
+		if err := releaseExpiredBlock(&next); err != nil {
+			return "", err
+		}
+		flightCheck, err = seatSaleCheck(seat, svc)
+		next.HoldToken = uuid.New().String()
+	} else {
+		flightCheck, err = seatReleaseCheck(seat, svc)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := updateSeatState(seat, &next, svc, flightCheck); err != nil {
+		fmt.Printf("Error updating seat %s IsHeld: %v\n", seatID, err)
+		return "", err
+	}
+
+	fmt.Printf("Updated seat %s IsHeld to %v\n", seatID, isHeld)
+	return next.HoldToken, nil
+}
+
 func createSeatsTable(svc *dynamodb.DynamoDB) error {
 	// Define the parameters for creating the "Seats" table.
 	params := &dynamodb.CreateTableInput{
@@ -303,35 +714,73 @@ func createSeatsTable(svc *dynamodb.DynamoDB) error {
 	fmt.Println("Seats table created successfully")
 	return nil
 }
-func validateFlightNumber(flightNumber string, svc *dynamodb.DynamoDB) error {
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String("Flights"),
-		IndexName:              aws.String("FlightNumberIndex"),
-		KeyConditionExpression: aws.String("#fn = :fn"),
-		ExpressionAttributeNames: map[string]*string{
-			"#fn": aws.String("FlightNumber"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":fn": {
-				S: aws.String(flightNumber),
-			},
-		},
-	}
 
-	// Perform the query.
-	result, err := svc.Query(queryInput)
+// validateSeatFlight binds a seat to the dated flight that owns its
+// FlightSection. A FlightID or FlightNumber given on the seat must match it.
+func validateSeatFlight(seat *Seat, svc *dynamodb.DynamoDB) error {
+	flightSection, err := GetFlightSectionByID(seat.FlightSectionID, svc)
 	if err != nil {
 		return err
 	}
-
-	// If the count is 0, FlightNumber does not exist.
-	if *result.Count == 0 {
-		return errors.New("FlightNumber does not exist")
+	flight, err := sectionFlight(flightSection, seat, svc)
+	if err != nil {
+		return err
+	}
+	if seat.FlightID != "" && seat.FlightID != flight.ID {
+		return errors.New("FlightSection does not belong to the given FlightID")
+	}
+	if seat.FlightNumber != "" && seat.FlightNumber != flight.FlightNumber {
+		return errors.New("FlightSection does not belong to the given FlightNumber")
 	}
 
+	seat.FlightID = flight.ID
+	seat.FlightNumber = flight.FlightNumber
 	return nil
 }
 
+// sectionFlight returns the dated flight owning a FlightSection. Sections
+// created before flights owned their sections are found through the flight
+// the seat names, until backfill-flight-keys attaches them.
+func sectionFlight(flightSection *FlightSection, seat *Seat, svc *dynamodb.DynamoDB) (*Flight, error) {
+	if flightSection.FlightID != "" {
+		return GetFlightByID(flightSection.FlightID, svc)
+	}
+
+	var flight *Flight
+	var err error
+	switch {
+	case seat.FlightID != "":
+		flight, err = GetFlightByID(seat.FlightID, svc)
+	case seat.FlightNumber != "":
+		flight, err = GetFlightByFlightNumber(seat.FlightNumber, svc)
+	default:
+		return nil, errors.New("FlightSection is not attached to a flight, give the seat's FlightID or run backfill-flight-keys")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("FlightSection is not attached to a flight, run backfill-flight-keys: %v", err)
+	}
+	for _, flightSectionID := range flight.FlightSectionID {
+		if flightSectionID == flightSection.ID {
+			return flight, nil
+		}
+	}
+	return nil, errors.New("FlightSection does not belong to the given flight")
+}
+
+// seatOnFlight reports whether a seat belongs to the dated flight. Seats
+// stored before flights owned their sections are matched by section.
+func seatOnFlight(seat *Seat, flight *Flight) bool {
+	if seat.FlightID != "" {
+		return seat.FlightID == flight.ID
+	}
+	for _, flightSectionID := range flight.FlightSectionID {
+		if seat.FlightSectionID == flightSectionID {
+			return true
+		}
+	}
+	return false
+}
+
 func validateFlightSectionID(flightSectionID string, svc *dynamodb.DynamoDB) error {
 	// Query the FlightSections table to check if the FlightSectionID exists.
 	queryInput := &dynamodb.QueryInput{
@@ -366,6 +815,10 @@ func validateRowColInFlightSection(seat Seat, svc *dynamodb.DynamoDB) error {
 		return err
 	}
 
+	return checkRowColInFlightSection(seat, flightSection)
+}
+
+func checkRowColInFlightSection(seat Seat, flightSection *FlightSection) error {
 	// Check if the provided Row and Col are within the valid range
 	if seat.Row < 1 || seat.Row > flightSection.NumRows || seat.Col < 1 || seat.Col > flightSection.NumCols {
 		return errors.New("Row or Col is out of range for the FlightSection")
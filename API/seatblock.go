@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Reason codes for taking a seat out of sale.
+var seatBlockReasons = map[string]string{
+	"MAINTENANCE":    "Seat is unserviceable, e.g. broken recline or tray table",
+	"CREW_REST":      "Seat is reserved for crew rest",
+	"WEIGHT_BALANCE": "Seat is restricted for weight and balance",
+	"OPERATIONAL":    "Seat is held back for another operational reason",
+}
+
+// Actions recorded in a seat's BlockHistory.
+const (
+	SeatBlockActionBlocked   = "BLOCKED"
+	SeatBlockActionUnblocked = "UNBLOCKED"
+	SeatBlockActionExpired   = "EXPIRED"
+)
+
+// SeatBlockChange is one entry of a seat's BlockHistory.
+type SeatBlockChange struct {
+	Action     string    `json:"action"`
+	ReasonCode string    `json:"reasonCode"`
+	Actor      string    `json:"actor,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+func (change SeatBlockChange) attributeValue() *dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"action": {
+			S: aws.String(change.Action),
+		},
+		"reasonCode": {
+			S: aws.String(change.ReasonCode),
+		},
+		"at": {
+			S: aws.String(change.At.Format(time.RFC3339)),
+		},
+	}
+	if change.Actor != "" {
+		item["actor"] = &dynamodb.AttributeValue{S: aws.String(change.Actor)}
+	}
+	return &dynamodb.AttributeValue{M: item}
+}
+
+// blockChange describes how moving a seat to next changes its block, or
+// returns nil when the block stays as it is.
+func blockChange(seat, next *Seat, now time.Time) *SeatBlockChange {
+	switch {
+	case next.IsBlocked && (!seat.IsBlocked || !seat.BlockedAt.Equal(*next.BlockedAt)):
+		return &SeatBlockChange{Action: SeatBlockActionBlocked, ReasonCode: next.BlockReason, Actor: next.BlockedBy, At: *next.BlockedAt}
+	case seat.IsBlocked && !next.IsBlocked && next.unblockedBy != "":
+		return &SeatBlockChange{Action: SeatBlockActionUnblocked, ReasonCode: seat.BlockReason, Actor: next.unblockedBy, At: now}
+	case seat.IsBlocked && !next.IsBlocked:
+		return &SeatBlockChange{Action: SeatBlockActionExpired, ReasonCode: seat.BlockReason, At: now}
+	}
+	return nil
+}
+
+// blockExpiry identifies a pending block expiry in the availability
+// counters, or is empty when the seat has no block that expires.
+func blockExpiry(seat *Seat) string {
+	if !seat.IsBlocked || seat.BlockedUntil == nil {
+		return ""
+	}
+	return seat.BlockedUntil.UTC().Format(time.RFC3339) + "#" + seat.ID
+}
+
+// SeatRef identifies a seat by its full primary key.
+type SeatRef struct {
+	ID              string `json:"id"`
+	FlightSectionID string `json:"FlightSectionID"`
+	// HoldToken books a seat the customer holds. It is not stored.
+	HoldToken string `json:"holdToken,omitempty" dynamodbav:"-"`
+}
+
+type SeatBlockRequest struct {
+	Seats      []SeatRef  `json:"seats"`
+	ReasonCode string     `json:"reasonCode"`
+	Actor      string     `json:"actor"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	Notes      string     `json:"notes"`
+}
+
+type SeatUnblockRequest struct {
+	Seats []SeatRef `json:"seats"`
+	Actor string    `json:"actor"`
+}
+
+// SeatBlockResult reports the outcome for one seat of a bulk block or unblock.
+type SeatBlockResult struct {
+	SeatID string `json:"seatID"`
+	Error  string `json:"error,omitempty"`
+}
+
+// isBlockActive reports whether the seat is blocked at the given time. Blocks
+// without an expiry stay active until they are lifted.
+func (seat *Seat) isBlockActive(at time.Time) bool {
+	if !seat.IsBlocked {
+		return false
+	}
+	return seat.BlockedUntil == nil || at.Before(*seat.BlockedUntil)
+}
+
+func validateSeatBlockRequest(request SeatBlockRequest) error {
+	if len(request.Seats) == 0 {
+		return errors.New("At least one seat is required")
+	}
+	if _, ok := seatBlockReasons[request.ReasonCode]; !ok {
+		codes := []string{}
+		for code := range seatBlockReasons {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		return fmt.Errorf("ReasonCode must be one of %s", strings.Join(codes, ", "))
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		return errors.New("Actor is required")
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return errors.New("ExpiresAt must be in the future")
+	}
+	return nil
+}
+
+func blockSeat(ref SeatRef, request SeatBlockRequest, svc *dynamodb.DynamoDB) error {
+	seat, err := getSeat(ref.ID, ref.FlightSectionID, svc)
+	if err != nil {
+		return err
+	}
+
+	if seat.IsBooked {
+		return errors.New("Seat is booked and must be released before it can be blocked")
+	}
+	if seat.IsHeld {
+		return errors.New("Seat is held and must be released before it can be blocked")
+	}
+
+	blockedAt := time.Now().UTC()
+	next := *seat
+	next.IsBlocked = true
+	next.BlockReason = request.ReasonCode
+	next.BlockedBy = request.Actor
+	next.BlockedAt = &blockedAt
+	next.BlockedUntil = request.ExpiresAt
+	next.BlockNotes = request.Notes
+
+	return updateSeatState(seat, &next, svc)
+}
+
+func unblockSeat(ref SeatRef, actor string, svc *dynamodb.DynamoDB) error {
+	seat, err := getSeat(ref.ID, ref.FlightSectionID, svc)
+	if err != nil {
+		return err
+	}
+	if !seat.IsBlocked {
+		return errors.New("Seat is not blocked")
+	}
+
+	next := *seat
+	next.IsBlocked = false
+	next.unblockedBy = actor
+	return updateSeatState(seat, &next, svc)
+}
+
+// BlockSeats takes the given seats out of sale. Each seat is blocked on its
+// own, so one seat failing does not stop the others.
+func BlockSeats(request SeatBlockRequest, svc *dynamodb.DynamoDB) ([]SeatBlockResult, error) {
+	if err := validateSeatBlockRequest(request); err != nil {
+		return nil, err
+	}
+
+	results := []SeatBlockResult{}
+	for _, ref := range request.Seats {
+		result := SeatBlockResult{SeatID: ref.ID}
+		if err := blockSeat(ref, request, svc); err != nil {
+			result.Error = err.Error()
+		} else {
+			fmt.Printf("Seat %s blocked by %s: %s\n", ref.ID, request.Actor, request.ReasonCode)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// UnblockSeats puts the given seats back on sale.
+func UnblockSeats(request SeatUnblockRequest, svc *dynamodb.DynamoDB) ([]SeatBlockResult, error) {
+	if len(request.Seats) == 0 {
+		return nil, errors.New("At least one seat is required")
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		return nil, errors.New("Actor is required")
+	}
+
+	results := []SeatBlockResult{}
+	for _, ref := range request.Seats {
+		result := SeatBlockResult{SeatID: ref.ID}
+		if err := unblockSeat(ref, request.Actor, svc); err != nil {
+			result.Error = err.Error()
+		} else {
+			fmt.Printf("Seat %s unblocked by %s\n", ref.ID, request.Actor)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ReleaseExpiredSeatBlocks unblocks the seats of a flight whose block has
+// expired, returning them to the availability counters.
+func ReleaseExpiredSeatBlocks(flight *Flight, svc *dynamodb.DynamoDB) ([]SeatBlockResult, error) {
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := []SeatBlockResult{}
+	for _, seat := range seats {
+		if !seat.IsBlocked || seat.isBlockActive(now) {
+			continue
+		}
+
+		result := SeatBlockResult{SeatID: seat.ID}
+		next := *seat
+		next.IsBlocked = false
+		if err := updateSeatState(seat, &next, svc); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// dueBlockExpiry returns the seat of a block expiry and whether it is due by
+// now. Expiries that cannot be parsed are due, so they get dropped.
+func dueBlockExpiry(expiry string, now time.Time) (string, bool) {
+	parts := strings.SplitN(expiry, "#", 2)
+	seatID := ""
+	if len(parts) == 2 {
+		seatID = parts[1]
+	}
+	until, err := time.Parse(time.RFC3339, parts[0])
+	return seatID, err != nil || !now.Before(until)
+}
+
+// discountExpiredBlocks leaves the blocks of a section that expired by now
+// out of its Blocked counter without writing anything. Expiries of seats that
+// were unblocked or blocked again meanwhile are not counted.
+func discountExpiredBlocks(sectionAvailability *SeatAvailability, now time.Time, svc *dynamodb.DynamoDB) error {
+	for _, expiry := range sectionAvailability.BlockExpiries {
+		seatID, due := dueBlockExpiry(expiry, now)
+		if !due || seatID == "" {
+			continue
+		}
+		seat, err := getSeat(seatID, sectionAvailability.FlightSectionID, svc)
+		if errors.Is(err, errSeatNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if blockExpiry(seat) == expiry && sectionAvailability.Blocked > 0 {
+			sectionAvailability.Blocked--
+		}
+	}
+	sectionAvailability.computeFree()
+	return nil
+}
+
+// ReleaseDueBlocks releases the seats of every section whose block expired
+// and drops their expiries from the counters. It returns how many expiries
+// it handled.
+func ReleaseDueBlocks(svc *dynamodb.DynamoDB) (int, error) {
+	if !doesTableExist("SeatAvailability", svc) {
+		return 0, nil
+	}
+
+	sections := []*SeatAvailability{}
+	var unmarshalErr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("SeatAvailability"),
+		FilterExpression: aws.String("attribute_exists(BlockExpiries)"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		pageSections := []*SeatAvailability{}
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageSections); unmarshalErr != nil {
+			return false
+		}
+		sections = append(sections, pageSections...)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if unmarshalErr != nil {
+		return 0, unmarshalErr
+	}
+
+	released := 0
+	now := time.Now()
+	for _, sectionAvailability := range sections {
+		due, err := releaseDueBlocks(sectionAvailability, now, svc)
+		released += due
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+// releaseDueBlocks releases the seats of a section whose block expired by now
+// and drops their expiries from the counters. It returns how many expiries
+// were due.
+func releaseDueBlocks(sectionAvailability *SeatAvailability, now time.Time, svc *dynamodb.DynamoDB) (int, error) {
+	due := 0
+	for _, expiry := range sectionAvailability.BlockExpiries {
+		seatID, isDue := dueBlockExpiry(expiry, now)
+		if !isDue {
+			continue
+		}
+		due++
+
+		if seatID != "" {
+			seat, err := getSeat(seatID, sectionAvailability.FlightSectionID, svc)
+			if err != nil && !errors.Is(err, errSeatNotFound) {
+				return due, err
+			}
+			// A seat unblocked or blocked again meanwhile no longer matches the expiry.
+			if err == nil && blockExpiry(seat) == expiry {
+				next := *seat
+				next.IsBlocked = false
+				if err := updateSeatState(seat, &next, svc); err != nil {
+					fmt.Printf("Error releasing expired block of seat %s: %v\n", seat.ID, err)
+					continue
+				}
+			}
+		}
+
+		_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("SeatAvailability"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"FlightNumber": {
+					S: aws.String(sectionAvailability.FlightNumber),
+				},
+				"FlightSectionID": {
+					S: aws.String(sectionAvailability.FlightSectionID),
+				},
+			},
+			UpdateExpression: aws.String("DELETE BlockExpiries :expiry"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":expiry": {
+					SS: aws.StringSlice([]string{expiry}),
+				},
+			},
+		})
+		if err != nil {
+			return due, err
+		}
+	}
+	return due, nil
+}
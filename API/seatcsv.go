@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+// seatCSVHeader is the column layout shared by seat import and export.
+// Attributes are separated by ";" and state is one of free, held, booked or
+// blocked, of which only free and blocked seats are imported. blockReason is a seatBlockReasons code of a blocked seat; files
+// exported before it existed leave the column out.
+var seatCSVHeader = []string{"section", "row", "col", "attributes", "state", "blockReason"}
+
+// seatImportChunkSize keeps each import transaction (two items per seat plus
+// one counter per section) below the DynamoDB limit of 100 items.
+const seatImportChunkSize = 40
+
+type SeatImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type SeatImportReport struct {
+	FlightNumber  string            `json:"flightNumber"`
+	OperatingDate string            `json:"operatingDate"`
+	DryRun        bool              `json:"dryRun"`
+	RowsRead      int               `json:"rowsRead"`
+	SeatsCreated  int               `json:"seatsCreated"`
+	Errors        []SeatImportError `json:"errors"`
+}
+
+// seatImportSections resolves the section column of an import, by
+// FlightSectionID or by the SeatClass of one of the flight's sections.
+type seatImportSections struct {
+	flight   *Flight
+	sections map[string]*FlightSection
+	svc      *dynamodb.DynamoDB
+}
+
+func (s *seatImportSections) resolve(value string) (*FlightSection, error) {
+	if flightSection, ok := s.sections[value]; ok {
+		return flightSection, nil
+	}
+
+	for _, flightSectionID := range s.flight.FlightSectionID {
+		flightSection, err := s.load(flightSectionID)
+		if err != nil {
+			return nil, err
+		}
+		if flightSectionID == value || strings.EqualFold(flightSection.SeatClass, value) {
+			s.sections[value] = flightSection
+			return flightSection, nil
+		}
+	}
+
+	// Same check as validateFlightSectionID, then make sure the section belongs to the flight.
+	if err := validateFlightSectionID(value, s.svc); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("FlightSection %s is not part of flight %s", value, s.flight.FlightNumber)
+}
+
+func (s *seatImportSections) load(flightSectionID string) (*FlightSection, error) {
+	if flightSection, ok := s.sections[flightSectionID]; ok {
+		return flightSection, nil
+	}
+	flightSection, err := GetFlightSectionByID(flightSectionID, s.svc)
+	if err != nil {
+		return nil, err
+	}
+	s.sections[flightSectionID] = flightSection
+	return flightSection, nil
+}
+
+// parseSeatCSVState sets the state of an imported seat. Held and booked seats
+// are refused, as a file carries neither the hold token nor the booking.
+func parseSeatCSVState(value, blockReason string, seat *Seat, actor string) error {
+	state := strings.ToLower(strings.TrimSpace(value))
+	blockReason = strings.ToUpper(strings.TrimSpace(blockReason))
+	if blockReason != "" && state != SeatStateBlocked {
+		return errors.New("BlockReason is only allowed on blocked seats")
+	}
+
+	switch state {
+	case "", SeatStateFree:
+	case SeatStateHeld:
+		return errors.New("Held seats cannot be imported, hold them once the seats exist")
+	case SeatStateBooked:
+		return errors.New("Booked seats cannot be imported, book them once the seats exist")
+	case SeatStateBlocked:
+		if blockReason == "" {
+			blockReason = "OPERATIONAL"
+		}
+		if _, ok := seatBlockReasons[blockReason]; !ok {
+			return fmt.Errorf("Unknown block reason %q", blockReason)
+		}
+		blockedAt := time.Now().UTC()
+		seat.IsBlocked = true
+		seat.BlockReason = blockReason
+		seat.BlockedBy = actor
+		seat.BlockedAt = &blockedAt
+		seat.BlockNotes = "Imported from CSV"
+	default:
+		return fmt.Errorf("Unknown state %q, expected free or blocked", value)
+	}
+	return nil
+}
+
+func parseSeatCSVAttributes(value string) []string {
+	attributes := []string{}
+	for _, attribute := range strings.Split(value, ";") {
+		if attribute = strings.ToUpper(strings.TrimSpace(attribute)); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+func validateSeatCSVHeader(header []string) error {
+	if len(header) != len(seatCSVHeader) && len(header) != len(seatCSVHeader)-1 {
+		return fmt.Errorf("Header must be %s", strings.Join(seatCSVHeader, ","))
+	}
+	for i, column := range header {
+		if !strings.EqualFold(strings.TrimSpace(column), seatCSVHeader[i]) {
+			return fmt.Errorf("Header must be %s", strings.Join(seatCSVHeader, ","))
+		}
+	}
+	return nil
+}
+
+// ImportSeatsCSV creates the seats described in a CSV file for a flight. Every
+// line is validated before anything is written; if any line fails, the report
+// lists the errors and no seat is created. With dryRun the seats are only validated.
+func ImportSeatsCSV(flight *Flight, r io.Reader, dryRun bool, actor string, svc *dynamodb.DynamoDB) (*SeatImportReport, error) {
+	if strings.TrimSpace(actor) == "" {
+		actor = "csv-import"
+	}
+
+	existing := map[string]bool{}
+	if doesTableExist("Seats", svc) {
+		existingSeats, err := GetSeatsByFlight(flight, svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, seat := range existingSeats {
+			existing[seatPositionKey(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col)] = true
+		}
+	}
+
+	reader := csv.NewReader(r)
+	// Every record must have as many fields as the header.
+	reader.FieldsPerRecord = 0
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read CSV header: %v", err)
+	}
+	if err := validateSeatCSVHeader(header); err != nil {
+		return nil, err
+	}
+
+	report := &SeatImportReport{FlightNumber: flight.FlightNumber, OperatingDate: flight.operatingDate(), DryRun: dryRun, Errors: []SeatImportError{}}
+	sections := &seatImportSections{flight: flight, sections: map[string]*FlightSection{}, svc: svc}
+	inFile := map[string]int{}
+	seats := []Seat{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				report.RowsRead++
+				report.Errors = append(report.Errors, SeatImportError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		report.RowsRead++
+
+		seat, err := parseSeatCSVRecord(record, flight, actor, sections)
+		if err != nil {
+			report.Errors = append(report.Errors, SeatImportError{Line: line, Message: err.Error()})
+			continue
+		}
+
+		positionKey := seatPositionKey(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col)
+		if existing[positionKey] {
+			report.Errors = append(report.Errors, SeatImportError{Line: line, Message: errSeatPositionTaken.Error()})
+			continue
+		}
+		if firstLine, ok := inFile[positionKey]; ok {
+			report.Errors = append(report.Errors, SeatImportError{Line: line, Message: fmt.Sprintf("Duplicate of line %d", firstLine)})
+			continue
+		}
+		inFile[positionKey] = line
+
+		seats = append(seats, seat)
+	}
+
+	if len(report.Errors) > 0 || dryRun {
+		if len(report.Errors) == 0 {
+			report.SeatsCreated = len(seats)
+		}
+		return report, nil
+	}
+
+	ensureSeatTables(svc)
+	for flightSectionID := range sections.sections {
+		if err := ensureAvailability(flight.FlightNumber, flightSectionID, svc); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeImportedSeats(seats, sections.sections, svc); err != nil {
+		return nil, err
+	}
+	report.SeatsCreated = len(seats)
+
+	fmt.Printf("Imported %d seats for flight %s on %s\n", len(seats), flight.FlightNumber, flight.operatingDate())
+	return report, nil
+}
+
+func parseSeatCSVRecord(record []string, flight *Flight, actor string, sections *seatImportSections) (Seat, error) {
+	seat := Seat{ID: uuid.New().String(), FlightNumber: flight.FlightNumber, FlightID: flight.ID}
+
+	flightSection, err := sections.resolve(strings.TrimSpace(record[0]))
+	if err != nil {
+		return seat, err
+	}
+	seat.FlightSectionID = flightSection.ID
+
+	if seat.Row, err = strconv.Atoi(strings.TrimSpace(record[1])); err != nil {
+		return seat, errors.New("Row must be a number")
+	}
+	if seat.Col, err = strconv.Atoi(strings.TrimSpace(record[2])); err != nil {
+		return seat, errors.New("Col must be a number")
+	}
+	if err := checkRowColInFlightSection(seat, flightSection); err != nil {
+		return seat, err
+	}
+
+	seat.Attributes = parseSeatCSVAttributes(record[3])
+	if err := validateSeatAttributes(seat.Attributes); err != nil {
+		return seat, err
+	}
+
+	blockReason := ""
+	if len(record) > 5 {
+		blockReason = record[5]
+	}
+	if err := parseSeatCSVState(record[4], blockReason, &seat, actor); err != nil {
+		return seat, err
+	}
+
+	return seat, nil
+}
+
+// writeImportedSeats writes the seats in transactional chunks. If a chunk
+// fails, the chunks already written are undone so the import leaves nothing
+// behind; seats that could not be undone are listed in the error.
+func writeImportedSeats(seats []Seat, sections map[string]*FlightSection, svc *dynamodb.DynamoDB) error {
+	written := [][]Seat{}
+
+	for start := 0; start < len(seats); start += seatImportChunkSize {
+		end := start + seatImportChunkSize
+		if end > len(seats) {
+			end = len(seats)
+		}
+		chunk := seats[start:end]
+
+		_, err := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: seatImportTransaction(chunk, sections, false),
+		})
+		if err != nil {
+			left := []string{}
+			for _, writtenChunk := range written {
+				_, undoErr := svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+					TransactItems: seatImportTransaction(writtenChunk, sections, true),
+				})
+				if undoErr != nil {
+					fmt.Printf("Error undoing seat import: %v\n", undoErr)
+					for _, seat := range writtenChunk {
+						left = append(left, seat.ID)
+					}
+				}
+			}
+			_, canceled := err.(*dynamodb.TransactionCanceledException)
+			if canceled {
+				err = errors.New("Seats were created concurrently for the same positions")
+			}
+			if len(left) > 0 {
+				return fmt.Errorf("%v, and %d seats already written could not be removed: %s", err, len(left), strings.Join(left, ", "))
+			}
+			if canceled {
+				return fmt.Errorf("%v, nothing was imported", err)
+			}
+			return err
+		}
+		written = append(written, chunk)
+	}
+
+	return nil
+}
+
+// seatImportTransaction creates (or with undo, deletes) a chunk of seats with
+// their positions and a single counter update per section. A seat is only
+// deleted while it is still booked and held as it was read.
+func seatImportTransaction(seats []Seat, sections map[string]*FlightSection, undo bool) []*dynamodb.TransactWriteItem {
+	items := []*dynamodb.TransactWriteItem{}
+	deltas := map[string]availabilityDelta{}
+	order := []string{}
+
+	for _, seat := range seats {
+		put := seatPositionPut(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col, seat.ID)
+		if undo {
+			items = append(items,
+				&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+					TableName: aws.String("Seats"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"ID":              {S: aws.String(seat.ID)},
+						"FlightSectionID": {S: aws.String(seat.FlightSectionID)},
+					},
+					ConditionExpression: aws.String("IsBooked = :isBooked AND IsHeld = :isHeld"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":isBooked": {BOOL: aws.Bool(seat.IsBooked)},
+						":isHeld":   {BOOL: aws.Bool(seat.IsHeld && !seat.IsBooked)},
+					},
+				}},
+				&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+					TableName: put.TableName,
+					Key:       map[string]*dynamodb.AttributeValue{"PositionKey": put.Item["PositionKey"]},
+				}},
+			)
+		} else {
+			items = append(items, &dynamodb.TransactWriteItem{Put: seatPut(seat)}, &dynamodb.TransactWriteItem{Put: put})
+		}
+
+		seatDelta := seatCreateDelta(seat)
+		delta, ok := deltas[seat.FlightSectionID]
+		if !ok {
+			order = append(order, seat.FlightSectionID)
+		}
+		delta.Total += seatDelta.Total
+		delta.Booked += seatDelta.Booked
+		delta.Held += seatDelta.Held
+		delta.Blocked += seatDelta.Blocked
+		delta.BlockExpiries = append(delta.BlockExpiries, seatDelta.BlockExpiries...)
+		deltas[seat.FlightSectionID] = delta
+	}
+
+	for _, flightSectionID := range order {
+		delta := deltas[flightSectionID]
+		if undo {
+			// Expiries of undone seats are dropped when they come due.
+			delta = availabilityDelta{Total: -delta.Total, Booked: -delta.Booked, Held: -delta.Held, Blocked: -delta.Blocked}
+		}
+		items = append(items, availabilityUpdate(seats[0].FlightNumber, sections[flightSectionID], delta))
+	}
+
+	return items
+}
+
+// ExportSeatsCSV writes the seats of a flight in the import CSV format.
+func ExportSeatsCSV(flight *Flight, w io.Writer, svc *dynamodb.DynamoDB) error {
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(seats, func(i, j int) bool {
+		if seats[i].FlightSectionID != seats[j].FlightSectionID {
+			return seats[i].FlightSectionID < seats[j].FlightSectionID
+		}
+		if seats[i].Row != seats[j].Row {
+			return seats[i].Row < seats[j].Row
+		}
+		return seats[i].Col < seats[j].Col
+	})
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(seatCSVHeader); err != nil {
+		return err
+	}
+	for _, seat := range seats {
+		record := []string{
+			seat.FlightSectionID,
+			strconv.Itoa(seat.Row),
+			strconv.Itoa(seat.Col),
+			strings.Join(seat.Attributes, ";"),
+			seatState(seat),
+			"",
+		}
+		if record[4] == SeatStateBlocked {
+			record[5] = seat.BlockReason
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Seat map cell types.
+const (
+	SeatMapCellSeat  = "seat"
+	SeatMapCellAisle = "aisle"
+	SeatMapCellEmpty = "empty"
+)
+
+// Seat states as rendered on the seat map.
+const (
+	SeatStateFree    = "free"
+	SeatStateHeld    = "held"
+	SeatStateBooked  = "booked"
+	SeatStateBlocked = "blocked"
+)
+
+type SeatMapCell struct {
+	Type   string `json:"type"`
+	SeatID string `json:"seatID,omitempty"`
+	Label  string `json:"label,omitempty"`
+	State  string `json:"state,omitempty"`
+	// BlockReason is only set for blocked seats so agents can see why.
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type SeatMapRow struct {
+	Number int           `json:"number"`
+	Cells  []SeatMapCell `json:"cells"`
+}
+
+type SeatMapSection struct {
+	FlightSectionID string       `json:"flightSectionID"`
+	SeatClass       string       `json:"seatClass"`
+	Columns         []string     `json:"columns"`
+	Rows            []SeatMapRow `json:"rows"`
+}
+
+type SeatMap struct {
+	FlightNumber  string           `json:"flightNumber"`
+	FlightID      string           `json:"flightID"`
+	OperatingDate string           `json:"operatingDate"`
+	Sections      []SeatMapSection `json:"sections"`
+}
+
+// seatClassOrder ranks cabins front to back; unknown classes go last.
+var seatClassOrder = map[string]int{
+	"first":           0,
+	"business":        1,
+	"premium economy": 2,
+	"premium":         2,
+	"economy":         3,
+}
+
+func seatClassRank(seatClass string) int {
+	if rank, ok := seatClassOrder[strings.ToLower(strings.TrimSpace(seatClass))]; ok {
+		return rank
+	}
+	return len(seatClassOrder)
+}
+
+// seatColumnLetter returns the letter for a 1-based column, skipping "I" as is customary on aircraft.
+// Columns past Z continue with AA, AB and so on.
+func seatColumnLetter(col int) string {
+	letters := "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+	if col < 1 {
+		return fmt.Sprintf("%d", col)
+	}
+	label := ""
+	for ; col > 0; col = (col - 1) / len(letters) {
+		label = string(letters[(col-1)%len(letters)]) + label
+	}
+	return label
+}
+
+// defaultAislesAfter returns a conventional aisle layout for a cabin width
+// when the FlightSection does not define its own.
+func defaultAislesAfter(numCols int) []int {
+	switch {
+	case numCols <= 3:
+		return nil
+	case numCols <= 6:
+		return []int{numCols / 2}
+	case numCols == 7:
+		return []int{2, 5}
+	case numCols == 8:
+		return []int{2, 6}
+	default:
+		return []int{3, numCols - 3}
+	}
+}
+
+func seatState(seat *Seat) string {
+	switch {
+	case seat.isBlockActive(time.Now()):
+		return SeatStateBlocked
+	case seat.IsBooked:
+		return SeatStateBooked
+	case seat.IsHeld:
+		return SeatStateHeld
+	default:
+		return SeatStateFree
+	}
+}
+
+// GetSeatMap builds the ready-to-render seat map of a flight. Sections are
+// ordered by cabin class and their rows are numbered consecutively.
+func GetSeatMap(flight *Flight, svc *dynamodb.DynamoDB) (*SeatMap, error) {
+	seats, err := GetSeatsByFlight(flight, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	seatsBySection := map[string]map[[2]int]*Seat{}
+	for _, seat := range seats {
+		if seatsBySection[seat.FlightSectionID] == nil {
+			seatsBySection[seat.FlightSectionID] = map[[2]int]*Seat{}
+		}
+		seatsBySection[seat.FlightSectionID][[2]int{seat.Row, seat.Col}] = seat
+	}
+
+	flightSections := []*FlightSection{}
+	for _, flightSectionID := range flight.FlightSectionID {
+		flightSection, err := GetFlightSectionByID(flightSectionID, svc)
+		if err != nil {
+			return nil, err
+		}
+		flightSections = append(flightSections, flightSection)
+	}
+	sort.SliceStable(flightSections, func(i, j int) bool {
+		ri, rj := seatClassRank(flightSections[i].SeatClass), seatClassRank(flightSections[j].SeatClass)
+		if ri != rj {
+			return ri < rj
+		}
+		return flightSections[i].ID < flightSections[j].ID
+	})
+
+	seatMap := &SeatMap{FlightNumber: flight.FlightNumber, FlightID: flight.ID, OperatingDate: flight.operatingDate(), Sections: []SeatMapSection{}}
+	rowOffset := 0
+	for _, flightSection := range flightSections {
+		seatMap.Sections = append(seatMap.Sections, buildSeatMapSection(flightSection, seatsBySection[flightSection.ID], rowOffset))
+		rowOffset += flightSection.NumRows
+	}
+
+	return seatMap, nil
+}
+
+func buildSeatMapSection(flightSection *FlightSection, seats map[[2]int]*Seat, rowOffset int) SeatMapSection {
+	aislesAfter := flightSection.AislesAfter
+	if len(aislesAfter) == 0 {
+		aislesAfter = defaultAislesAfter(flightSection.NumCols)
+	}
+	isAisle := map[int]bool{}
+	for _, col := range aislesAfter {
+		isAisle[col] = true
+	}
+
+	section := SeatMapSection{
+		FlightSectionID: flightSection.ID,
+		SeatClass:       flightSection.SeatClass,
+		Columns:         []string{},
+		Rows:            []SeatMapRow{},
+	}
+	for col := 1; col <= flightSection.NumCols; col++ {
+		section.Columns = append(section.Columns, seatColumnLetter(col))
+		if isAisle[col] {
+			section.Columns = append(section.Columns, "")
+		}
+	}
+
+	for row := 1; row <= flightSection.NumRows; row++ {
+		mapRow := SeatMapRow{Number: rowOffset + row, Cells: []SeatMapCell{}}
+		for col := 1; col <= flightSection.NumCols; col++ {
+			cell := SeatMapCell{Type: SeatMapCellEmpty}
+			if seat, ok := seats[[2]int{row, col}]; ok {
+				cell = SeatMapCell{
+					Type:   SeatMapCellSeat,
+					SeatID: seat.ID,
+					Label:  fmt.Sprintf("%d%s", mapRow.Number, seatColumnLetter(col)),
+					State:  seatState(seat),
+				}
+				if cell.State == SeatStateBlocked {
+					cell.BlockReason = seat.BlockReason
+				}
+			}
+			mapRow.Cells = append(mapRow.Cells, cell)
+			if isAisle[col] {
+				mapRow.Cells = append(mapRow.Cells, SeatMapCell{Type: SeatMapCellAisle})
+			}
+		}
+		section.Rows = append(section.Rows, mapRow)
+	}
+
+	return section
+}
+
+// seatMapSymbols are the one-character seat states used in the text rendering.
+var seatMapSymbols = map[string]string{
+	SeatStateFree:    ".",
+	SeatStateHeld:    "H",
+	SeatStateBooked:  "X",
+	SeatStateBlocked: "B",
+}
+
+// RenderSeatMapText renders the seat map in fixed-width text for agent terminals.
+func RenderSeatMapText(seatMap *SeatMap) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Seat map for flight %s\n", seatMap.FlightNumber)
+	for _, section := range seatMap.Sections {
+		b.WriteString("\n")
+		if len(section.Rows) > 0 {
+			fmt.Fprintf(&b, "%s (rows %d-%d)\n", section.SeatClass, section.Rows[0].Number, section.Rows[len(section.Rows)-1].Number)
+		} else {
+			fmt.Fprintf(&b, "%s\n", section.SeatClass)
+		}
+
+		// Every cell is as wide as the longest column letters, so wide cabins stay aligned.
+		width := 1
+		for _, column := range section.Columns {
+			if len(column) > width {
+				width = len(column)
+			}
+		}
+
+		var line strings.Builder
+		line.WriteString("    ")
+		for _, column := range section.Columns {
+			fmt.Fprintf(&line, " %-*s", width, column)
+		}
+		b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+
+		for _, row := range section.Rows {
+			line.Reset()
+			fmt.Fprintf(&line, "%4d", row.Number)
+			for _, cell := range row.Cells {
+				symbol := " "
+				switch cell.Type {
+				case SeatMapCellSeat:
+					symbol = seatMapSymbols[cell.State]
+				case SeatMapCellEmpty:
+					symbol = "-"
+				}
+				fmt.Fprintf(&line, " %-*s", width, symbol)
+			}
+			b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+		}
+	}
+
+	b.WriteString("\nLegend: . free  H held  X booked  B blocked  - no seat\n")
+	return b.String()
+}
+
+// seatMapColors are the fill colours used in the SVG rendering.
+var seatMapColors = map[string]string{
+	SeatStateFree:    "#2e7d32",
+	SeatStateHeld:    "#f9a825",
+	SeatStateBooked:  "#c62828",
+	SeatStateBlocked: "#616161",
+}
+
+// RenderSeatMapSVG renders the seat map as a standalone SVG document for emails and kiosks.
+func RenderSeatMapSVG(seatMap *SeatMap) string {
+	const (
+		cellSize  = 32
+		gap       = 4
+		margin    = 16
+		labelSize = 32
+		titleSize = 32
+		headSize  = 28
+	)
+
+	width := 0
+	for _, section := range seatMap.Sections {
+		if w := len(section.Columns) * (cellSize + gap); w > width {
+			width = w
+		}
+	}
+	width += 2*margin + labelSize
+
+	var body strings.Builder
+	y := margin + titleSize
+	for _, section := range seatMap.Sections {
+		fmt.Fprintf(&body, `<text x="%d" y="%d" font-size="14" font-weight="bold">%s</text>`+"\n", margin, y+16, html.EscapeString(section.SeatClass))
+		y += headSize
+
+		for i, column := range section.Columns {
+			x := margin + labelSize + i*(cellSize+gap)
+			fmt.Fprintf(&body, `<text x="%d" y="%d" font-size="12" text-anchor="middle">%s</text>`+"\n", x+cellSize/2, y+12, column)
+		}
+		y += 20
+
+		for _, row := range section.Rows {
+			fmt.Fprintf(&body, `<text x="%d" y="%d" font-size="12" text-anchor="end">%d</text>`+"\n", margin+labelSize-8, y+cellSize/2+4, row.Number)
+			for i, cell := range row.Cells {
+				if cell.Type != SeatMapCellSeat {
+					continue
+				}
+				x := margin + labelSize + i*(cellSize+gap)
+				fmt.Fprintf(&body, `<rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="%s"><title>%s %s</title></rect>`+"\n",
+					x, y, cellSize, cellSize, seatMapColors[cell.State], cell.Label, cell.State)
+			}
+			y += cellSize + gap
+		}
+		y += gap * 2
+	}
+	height := y + margin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="18" font-weight="bold">Flight %s</text>`+"\n", margin, margin+18, html.EscapeString(seatMap.FlightNumber))
+	b.WriteString(body.String())
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package main
+
+import "testing"
+
+func TestSeatColumnLetter(t *testing.T) {
+	tests := []struct {
+		col  int
+		want string
+	}{
+		{1, "A"},
+		{8, "H"},
+		{9, "J"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{50, "AZ"},
+		{51, "BA"},
+		{0, "0"},
+	}
+
+	for _, tt := range tests {
+		if got := seatColumnLetter(tt.col); got != tt.want {
+			t.Errorf("seatColumnLetter(%d) = %q, want %q", tt.col, got, tt.want)
+		}
+	}
+}
+
+// testSeatMap is a two-cabin map with a seat in every state.
+func testSeatMap() *SeatMap {
+	business := &FlightSection{ID: "business", SeatClass: "Business", NumRows: 2, NumCols: 4}
+	economy := &FlightSection{ID: "economy", SeatClass: "Economy", NumRows: 2, NumCols: 6}
+	return &SeatMap{
+		FlightNumber: "FB100",
+		Sections: []SeatMapSection{
+			buildSeatMapSection(business, map[[2]int]*Seat{
+				{1, 1}: {ID: "1A", Row: 1, Col: 1, IsBooked: true},
+				{1, 2}: {ID: "1B", Row: 1, Col: 2},
+				{1, 3}: {ID: "1C", Row: 1, Col: 3, IsHeld: true},
+				{1, 4}: {ID: "1D", Row: 1, Col: 4},
+				{2, 1}: {ID: "2A", Row: 2, Col: 1, IsBlocked: true, BlockReason: "CREW_REST"},
+				{2, 4}: {ID: "2D", Row: 2, Col: 4},
+			}, 0),
+			buildSeatMapSection(economy, map[[2]int]*Seat{
+				{1, 1}: {ID: "3A", Row: 1, Col: 1},
+				{1, 6}: {ID: "3F", Row: 1, Col: 6, IsBooked: true},
+				{2, 3}: {ID: "4C", Row: 2, Col: 3},
+			}, 2),
+		},
+	}
+}
+
+func TestRenderSeatMapText(t *testing.T) {
+	want := `Seat map for flight FB100
+
+Business (rows 1-2)
+     A B   C D
+   1 X .   H .
+   2 B -   - .
+
+Economy (rows 3-4)
+     A B C   D E F
+   3 . - -   - - X
+   4 - - .   - - -
+
+Legend: . free  H held  X booked  B blocked  - no seat
+`
+	if got := RenderSeatMapText(testSeatMap()); got != want {
+		t.Errorf("RenderSeatMapText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderSeatMapTextWideCabin(t *testing.T) {
+	section := &FlightSection{ID: "wide", SeatClass: "Economy", NumRows: 1, NumCols: 27, AislesAfter: []int{26}}
+	seatMap := &SeatMap{
+		FlightNumber: "FB1",
+		Sections: []SeatMapSection{
+			buildSeatMapSection(section, map[[2]int]*Seat{
+				{1, 26}: {ID: "1AA", Row: 1, Col: 26, IsBooked: true},
+			}, 0),
+		},
+	}
+
+	want := `Seat map for flight FB1
+
+Economy (rows 1-1)
+     A  B  C  D  E  F  G  H  J  K  L  M  N  O  P  Q  R  S  T  U  V  W  X  Y  Z  AA    AB
+   1 -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  -  X     -
+
+Legend: . free  H held  X booked  B blocked  - no seat
+`
+	if got := RenderSeatMapText(seatMap); got != want {
+		t.Errorf("RenderSeatMapText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderSeatMapSVG(t *testing.T) {
+	want := `<svg xmlns="http://www.w3.org/2000/svg" width="316" height="320" viewBox="0 0 316 320" font-family="sans-serif">
+<text x="16" y="34" font-size="18" font-weight="bold">Flight FB100</text>
+<text x="16" y="64" font-size="14" font-weight="bold">Business</text>
+<text x="64" y="88" font-size="12" text-anchor="middle">A</text>
+<text x="100" y="88" font-size="12" text-anchor="middle">B</text>
+<text x="136" y="88" font-size="12" text-anchor="middle"></text>
+<text x="172" y="88" font-size="12" text-anchor="middle">C</text>
+<text x="208" y="88" font-size="12" text-anchor="middle">D</text>
+<text x="40" y="116" font-size="12" text-anchor="end">1</text>
+<rect x="48" y="96" width="32" height="32" rx="4" fill="#c62828"><title>1A booked</title></rect>
+<rect x="84" y="96" width="32" height="32" rx="4" fill="#2e7d32"><title>1B free</title></rect>
+<rect x="156" y="96" width="32" height="32" rx="4" fill="#f9a825"><title>1C held</title></rect>
+<rect x="192" y="96" width="32" height="32" rx="4" fill="#2e7d32"><title>1D free</title></rect>
+<text x="40" y="152" font-size="12" text-anchor="end">2</text>
+<rect x="48" y="132" width="32" height="32" rx="4" fill="#616161"><title>2A blocked</title></rect>
+<rect x="192" y="132" width="32" height="32" rx="4" fill="#2e7d32"><title>2D free</title></rect>
+<text x="16" y="192" font-size="14" font-weight="bold">Economy</text>
+<text x="64" y="216" font-size="12" text-anchor="middle">A</text>
+<text x="100" y="216" font-size="12" text-anchor="middle">B</text>
+<text x="136" y="216" font-size="12" text-anchor="middle">C</text>
+<text x="172" y="216" font-size="12" text-anchor="middle"></text>
+<text x="208" y="216" font-size="12" text-anchor="middle">D</text>
+<text x="244" y="216" font-size="12" text-anchor="middle">E</text>
+<text x="280" y="216" font-size="12" text-anchor="middle">F</text>
+<text x="40" y="244" font-size="12" text-anchor="end">3</text>
+<rect x="48" y="224" width="32" height="32" rx="4" fill="#2e7d32"><title>3A free</title></rect>
+<rect x="264" y="224" width="32" height="32" rx="4" fill="#c62828"><title>3F booked</title></rect>
+<text x="40" y="280" font-size="12" text-anchor="end">4</text>
+<rect x="120" y="260" width="32" height="32" rx="4" fill="#2e7d32"><title>4C free</title></rect>
+</svg>
+`
+	if got := RenderSeatMapSVG(testSeatMap()); got != want {
+		t.Errorf("RenderSeatMapSVG() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// The SeatPositions table holds one item per (flight, section, row, col). A seat
+// can only be created together with its position item, which makes the
+// position unique at the storage level.
+
+var errSeatPositionTaken = errors.New("A seat already exists at this Row and Col for the FlightSection")
+
+func seatPositionKey(flightNumber, flightSectionID string, row, col int) string {
+	return fmt.Sprintf("%s#%s#%d#%d", flightNumber, flightSectionID, row, col)
+}
+
+// seatPositionPut claims a seat position; it fails if the position is already taken.
+func seatPositionPut(flightNumber, flightSectionID string, row, col int, seatID string) *dynamodb.Put {
+	return &dynamodb.Put{
+		TableName: aws.String("SeatPositions"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"PositionKey": {
+				S: aws.String(seatPositionKey(flightNumber, flightSectionID, row, col)),
+			},
+			"SeatID": {
+				S: aws.String(seatID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(PositionKey)"),
+	}
+}
+
+// findSeatsAtPosition returns the seats stored at a position, including seats
+// created before position items existed.
+func findSeatsAtPosition(flightNumber, flightSectionID string, row, col int, svc *dynamodb.DynamoDB) ([]*Seat, error) {
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String("Seats"),
+		IndexName:              aws.String("FlightSectionIndex"),
+		KeyConditionExpression: aws.String("#FlightSectionID = :FlightSectionID"),
+		FilterExpression:       aws.String("#FlightNumber = :FlightNumber AND #Row = :Row AND #Col = :Col"),
+		ExpressionAttributeNames: map[string]*string{
+			"#FlightSectionID": aws.String("FlightSectionID"),
+			"#FlightNumber":    aws.String("FlightNumber"),
+			"#Row":             aws.String("Row"),
+			"#Col":             aws.String("Col"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":FlightSectionID": {
+				S: aws.String(flightSectionID),
+			},
+			":FlightNumber": {
+				S: aws.String(flightNumber),
+			},
+			":Row": {
+				N: aws.String(fmt.Sprintf("%d", row)),
+			},
+			":Col": {
+				N: aws.String(fmt.Sprintf("%d", col)),
+			},
+		},
+	}
+
+	seats := []*Seat{}
+	var unmarshalErr error
+	err := svc.QueryPages(queryInput, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			seat := &Seat{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, seat); unmarshalErr != nil {
+				return false
+			}
+			seats = append(seats, seat)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return seats, nil
+}
+
+func validateSeatPositionFree(seat Seat, svc *dynamodb.DynamoDB) error {
+	seats, err := findSeatsAtPosition(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col, svc)
+	if err != nil {
+		return err
+	}
+
+	if len(seats) > 0 {
+		return errSeatPositionTaken
+	}
+
+	return nil
+}
+
+// DuplicateSeatGroup describes seats that share one position.
+type DuplicateSeatGroup struct {
+	FlightNumber    string   `json:"flightNumber"`
+	FlightSectionID string   `json:"flightSectionID"`
+	Row             int      `json:"row"`
+	Col             int      `json:"col"`
+	KeptSeatID      string   `json:"keptSeatID,omitempty"`
+	RemovedSeatIDs  []string `json:"removedSeatIDs,omitempty"`
+	// Conflict is set when more than one of the seats is booked, held or
+	// blocked, so they cannot be merged without deciding which state the seat
+	// keeps. Such groups are left for manual resolution.
+	Conflict bool `json:"conflict"`
+}
+
+type SeatRepairReport struct {
+	DryRun              bool                 `json:"dryRun"`
+	SeatsChecked        int                  `json:"seatsChecked"`
+	Duplicates          []DuplicateSeatGroup `json:"duplicates"`
+	PositionsBackfilled int                  `json:"positionsBackfilled"`
+}
+
+// seatMergeRank orders duplicates so the seat carrying the most state is kept.
+func seatMergeRank(seat *Seat) int {
+	switch {
+	case seat.IsBooked:
+		return 0
+	case seat.IsHeld:
+		return 1
+	case seat.IsBlocked:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// planSeatMerge picks the seat a group of duplicates keeps and the free
+// seats it can remove. It reports a conflict when another seat than the kept
+// one is booked, held or blocked.
+func planSeatMerge(group []*Seat) (*Seat, []*Seat, bool) {
+	sort.SliceStable(group, func(i, j int) bool {
+		ri, rj := seatMergeRank(group[i]), seatMergeRank(group[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return group[i].ID < group[j].ID
+	})
+	if len(group) > 1 && seatMergeRank(group[1]) < seatMergeRank(&Seat{}) {
+		return group[0], nil, true
+	}
+	return group[0], group[1:], false
+}
+
+// RepairDuplicateSeats finds seats sharing a (flight, section, row, col)
+// position and merges each group into a single seat. The seat carrying state
+// is kept and free duplicates are removed; groups where more than one seat is
+// booked, held or blocked are reported as conflicts and left alone. Positions
+// of the surviving seats are backfilled into SeatPositions and the
+// availability counters of touched sections are rebuilt. An empty
+// flightNumber checks every seat.
+func RepairDuplicateSeats(flightNumber string, dryRun bool, svc *dynamodb.DynamoDB) (*SeatRepairReport, error) {
+	var seats []*Seat
+	if flightNumber != "" {
+		flightSeats, err := GetSeatsByFlightNumber(flightNumber, svc)
+		if err != nil {
+			return nil, err
+		}
+		seats = flightSeats
+	} else {
+		allSeats, err := GetAllSeats(svc)
+		if err != nil {
+			return nil, err
+		}
+		for i := range allSeats {
+			seats = append(seats, &allSeats[i])
+		}
+	}
+
+	positionsTableExists := doesTableExist("SeatPositions", svc)
+	if !dryRun && !positionsTableExists {
+		if err := createSeatPositionsTable(svc); err != nil {
+			fmt.Printf("Error creating SeatPositions table: %v\n", err)
+		}
+	}
+
+	groups := map[string][]*Seat{}
+	keys := []string{}
+	for _, seat := range seats {
+		key := seatPositionKey(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], seat)
+	}
+	sort.Strings(keys)
+
+	report := &SeatRepairReport{DryRun: dryRun, SeatsChecked: len(seats), Duplicates: []DuplicateSeatGroup{}}
+	touchedSections := map[availabilityKey]bool{}
+
+	for _, key := range keys {
+		group := groups[key]
+		kept, removed, conflict := planSeatMerge(group)
+
+		if len(group) > 1 {
+			duplicate := DuplicateSeatGroup{
+				FlightNumber:    kept.FlightNumber,
+				FlightSectionID: kept.FlightSectionID,
+				Row:             kept.Row,
+				Col:             kept.Col,
+				Conflict:        conflict,
+			}
+			if duplicate.Conflict {
+				report.Duplicates = append(report.Duplicates, duplicate)
+				continue
+			}
+
+			duplicate.KeptSeatID = kept.ID
+			for _, seat := range removed {
+				if !dryRun {
+					deleted, err := deleteFreeSeat(seat, svc)
+					if err != nil {
+						return nil, err
+					}
+					// The seat was sold, held or blocked since it was read.
+					if !deleted {
+						duplicate.Conflict = true
+						continue
+					}
+					touchedSections[availabilityKey{FlightNumber: kept.FlightNumber, FlightSectionID: kept.FlightSectionID}] = true
+				}
+				duplicate.RemovedSeatIDs = append(duplicate.RemovedSeatIDs, seat.ID)
+			}
+			report.Duplicates = append(report.Duplicates, duplicate)
+		}
+
+		backfilled, err := backfillSeatPosition(kept, positionsTableExists, dryRun, svc)
+		if err != nil {
+			return nil, err
+		}
+		if backfilled {
+			report.PositionsBackfilled++
+		}
+	}
+
+	if !dryRun {
+		for touched := range touchedSections {
+			if _, err := rebuildSectionAvailability(touched.FlightNumber, touched.FlightSectionID, false, svc); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// backfillSeatPosition records the position of a seat created before
+// SeatPositions existed. It reports whether a position item was (or would be) written.
+func backfillSeatPosition(seat *Seat, positionsTableExists, dryRun bool, svc *dynamodb.DynamoDB) (bool, error) {
+	positionKey := seatPositionKey(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col)
+	if positionsTableExists {
+		result, err := svc.GetItem(&dynamodb.GetItemInput{
+			TableName: aws.String("SeatPositions"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"PositionKey": {
+					S: aws.String(positionKey),
+				},
+			},
+		})
+		if err != nil {
+			return false, err
+		}
+		if result.Item != nil && result.Item["SeatID"] != nil && aws.StringValue(result.Item["SeatID"].S) == seat.ID {
+			return false, nil
+		}
+	}
+
+	if dryRun {
+		return true, nil
+	}
+
+	put := seatPositionPut(seat.FlightNumber, seat.FlightSectionID, seat.Row, seat.Col, seat.ID)
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName: put.TableName,
+		Item:      put.Item,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// deleteFreeSeat deletes a duplicate seat unless it is booked, held or
+// blocked by now. It reports whether the seat was deleted.
+func deleteFreeSeat(seat *Seat, svc *dynamodb.DynamoDB) (bool, error) {
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("Seats"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(seat.ID),
+			},
+			"FlightSectionID": {
+				S: aws.String(seat.FlightSectionID),
+			},
+		},
+		ConditionExpression: aws.String("NOT (IsBooked = :true OR IsHeld = :true OR IsBlocked = :true)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":true": {
+				BOOL: aws.Bool(true),
+			},
+		},
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	fmt.Printf("Deleted duplicate seat %s\n", seat.ID)
+	return true, nil
+}
+
+func createSeatPositionsTable(svc *dynamodb.DynamoDB) error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String("SeatPositions"),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("PositionKey"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("PositionKey"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+
+	_, err := svc.CreateTable(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("SeatPositions table created successfully")
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanSeatMerge(t *testing.T) {
+	tests := []struct {
+		name         string
+		group        []*Seat
+		wantKept     string
+		wantRemoved  []string
+		wantConflict bool
+	}{
+		{
+			name:        "single seat",
+			group:       []*Seat{{ID: "a"}},
+			wantKept:    "a",
+			wantRemoved: []string{},
+		},
+		{
+			name:        "free duplicates keep the lowest ID",
+			group:       []*Seat{{ID: "c"}, {ID: "a"}, {ID: "b"}},
+			wantKept:    "a",
+			wantRemoved: []string{"b", "c"},
+		},
+		{
+			name:        "booked seat wins over free ones",
+			group:       []*Seat{{ID: "a"}, {ID: "b", IsBooked: true}},
+			wantKept:    "b",
+			wantRemoved: []string{"a"},
+		},
+		{
+			name:        "held seat wins over free ones",
+			group:       []*Seat{{ID: "a"}, {ID: "b", IsHeld: true}},
+			wantKept:    "b",
+			wantRemoved: []string{"a"},
+		},
+		{
+			name:        "blocked seat wins over free ones",
+			group:       []*Seat{{ID: "a"}, {ID: "b", IsBlocked: true}},
+			wantKept:    "b",
+			wantRemoved: []string{"a"},
+		},
+		{
+			name:         "two booked seats conflict",
+			group:        []*Seat{{ID: "a", IsBooked: true}, {ID: "b", IsBooked: true}},
+			wantKept:     "a",
+			wantConflict: true,
+		},
+		{
+			name:         "booked and held seats conflict",
+			group:        []*Seat{{ID: "a", IsHeld: true}, {ID: "b", IsBooked: true}},
+			wantKept:     "b",
+			wantConflict: true,
+		},
+		{
+			name:         "booked and blocked seats conflict",
+			group:        []*Seat{{ID: "a", IsBlocked: true}, {ID: "b", IsBooked: true}, {ID: "c"}},
+			wantKept:     "b",
+			wantConflict: true,
+		},
+		{
+			name:         "held and blocked seats conflict",
+			group:        []*Seat{{ID: "a", IsBlocked: true}, {ID: "b", IsHeld: true}},
+			wantKept:     "b",
+			wantConflict: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, removed, conflict := planSeatMerge(tt.group)
+			if kept.ID != tt.wantKept {
+				t.Errorf("planSeatMerge() kept = %v, want %v", kept.ID, tt.wantKept)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("planSeatMerge() conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+			if tt.wantConflict {
+				if len(removed) != 0 {
+					t.Errorf("planSeatMerge() removed = %v, want none on a conflict", seatIDs(removed))
+				}
+				return
+			}
+			if got := seatIDs(removed); !reflect.DeepEqual(got, tt.wantRemoved) {
+				t.Errorf("planSeatMerge() removed = %v, want %v", got, tt.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SSIM Chapter 7 files hold fixed-width 200 character records: a type 1
+// header, a type 2 carrier record, type 3 flight legs with optional type 4
+// segment data, and a type 5 trailer. Type 0 records only pad blocks.
+const ssimRecordLength = 200
+
+// Diff actions of an SSIM import.
+const (
+	SSIMActionCreate    = "create"
+	SSIMActionUpdate    = "update"
+	SSIMActionUnchanged = "unchanged"
+)
+
+// ssimCabins maps the cabin codes of an aircraft configuration such as
+// "C20Y150" to the section layout used for them.
+var ssimCabins = map[byte]FlightSection{
+	'F': {SeatClass: "First", NumCols: 4, AislesAfter: []int{2}},
+	'C': {SeatClass: "Business", NumCols: 4, AislesAfter: []int{2}},
+	'J': {SeatClass: "Business", NumCols: 4, AislesAfter: []int{2}},
+	'W': {SeatClass: "Premium Economy", NumCols: 6, AislesAfter: []int{3}},
+	'Y': {SeatClass: "Economy", NumCols: 6, AislesAfter: []int{3}},
+}
+
+type SSIMIssue struct {
+	Line       int    `json:"line"`
+	RecordType string `json:"recordType"`
+	Message    string `json:"message"`
+}
+
+// SSIMScheduleDiff compares one flight leg of the file with the schedule
+// stored for it.
+type SSIMScheduleDiff struct {
+	ScheduleID   string   `json:"scheduleID"`
+	FlightNumber string   `json:"flightNumber"`
+	Route        string   `json:"route"`
+	Action       string   `json:"action"`
+	Changes      []string `json:"changes,omitempty"`
+	// AffectedFlights counts the generated flights from today on that an update replaces.
+	AffectedFlights int `json:"affectedFlights,omitempty"`
+	// ExistingFlights counts flights created by hand with the same number and
+	// route in the period, which the schedule would duplicate.
+	ExistingFlights int `json:"existingFlights,omitempty"`
+}
+
+type SSIMImportReport struct {
+	Airline   string                      `json:"airline"`
+	DryRun    bool                        `json:"dryRun"`
+	Records   int                         `json:"records"`
+	Legs      int                         `json:"legs"`
+	Errors    []SSIMIssue                 `json:"errors"`
+	Diff      []SSIMScheduleDiff          `json:"diff"`
+	Generated []*ScheduleGenerationReport `json:"generated"`
+}
+
+type ssimLeg struct {
+	line     int
+	schedule Schedule
+}
+
+// ssimParser holds the state of reading one SSIM file.
+type ssimParser struct {
+	records    int
+	issues     []SSIMIssue
+	timeMode   byte
+	airline    string
+	validTo    time.Time
+	lastSerial int
+	sawHeader  bool
+	sawTrailer bool
+	legs       []ssimLeg
+	legLines   map[string]int
+}
+
+// ssimField returns the trimmed value of a 1-based, inclusive column range.
+func ssimField(record string, from, to int) string {
+	return strings.TrimSpace(record[from-1 : to])
+}
+
+func parseSSIMDate(value string) (time.Time, error) {
+	date, err := time.Parse("02Jan06", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a DDMMMYY date", value)
+	}
+	return date, nil
+}
+
+// parseSSIMTime returns the minutes after midnight of an HHMM time.
+func parseSSIMTime(value string) (int, error) {
+	if len(value) != 4 || !isNumeric(value) {
+		return 0, fmt.Errorf("%q is not an HHMM time", value)
+	}
+	hours, _ := strconv.Atoi(value[:2])
+	minutes, _ := strconv.Atoi(value[2:])
+	if minutes > 59 || hours > 24 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("%q is not an HHMM time", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// parseSSIMOffset returns the minutes of a +HHMM or -HHMM UTC variation.
+func parseSSIMOffset(value string) (int, error) {
+	if len(value) != 5 || (value[0] != '+' && value[0] != '-') || !isNumeric(value[1:]) {
+		return 0, fmt.Errorf("%q is not a +HHMM UTC variation", value)
+	}
+	hours, _ := strconv.Atoi(value[1:3])
+	minutes, _ := strconv.Atoi(value[3:])
+	offset := hours*60 + minutes
+	if value[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// parseSSIMDateVariation reads a date variation, where "A" means the day before.
+func parseSSIMDateVariation(value byte) (int, error) {
+	switch {
+	case value == ' ':
+		return 0, nil
+	case value == 'A':
+		return -1, nil
+	case value >= '0' && value <= '9':
+		return int(value - '0'), nil
+	}
+	return 0, fmt.Errorf("%q is not a date variation", value)
+}
+
+// parseSSIMConfiguration lays out one section per cabin of an aircraft
+// configuration. Seat counts are rounded up to full rows.
+func parseSSIMConfiguration(configuration string) ([]FlightSection, error) {
+	if configuration == "" {
+		return nil, errors.New("Aircraft configuration is required to lay out seats")
+	}
+
+	sections := []FlightSection{}
+	for i := 0; i < len(configuration); {
+		cabin, ok := ssimCabins[configuration[i]]
+		if !ok {
+			return nil, fmt.Errorf("Aircraft configuration %q has an unknown cabin code %c", configuration, configuration[i])
+		}
+		end := i + 1
+		for end < len(configuration) && configuration[end] >= '0' && configuration[end] <= '9' {
+			end++
+		}
+		seats, err := strconv.Atoi(configuration[i+1 : end])
+		if err != nil || seats < 1 {
+			return nil, fmt.Errorf("Aircraft configuration %q needs a seat count after %c", configuration, configuration[i])
+		}
+		cabin.NumRows = (seats + cabin.NumCols - 1) / cabin.NumCols
+		sections = append(sections, cabin)
+		i = end
+	}
+	return sections, nil
+}
+
+// shiftDaysOfWeek moves a days of operation pattern by a number of days.
+func shiftDaysOfWeek(pattern string, shift int) string {
+	shifted := []byte(".......")
+	for i := 0; i < 7; i++ {
+		if pattern[i] == '.' {
+			continue
+		}
+		day := ((i+shift)%7 + 7) % 7
+		shifted[day] = byte('1' + day)
+	}
+	return string(shifted)
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 && a%b != 0 {
+		return a/b - 1
+	}
+	return a / b
+}
+
+func (p *ssimParser) issue(line int, recordType, format string, args ...interface{}) {
+	p.issues = append(p.issues, SSIMIssue{Line: line, RecordType: recordType, Message: fmt.Sprintf(format, args...)})
+}
+
+// parseSSIM reads every record of a file, collecting flight legs and issues.
+func parseSSIM(r io.Reader) (*ssimParser, error) {
+	p := &ssimParser{issues: []SSIMIssue{}, legLines: map[string]int{}}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		recordType := record[:1]
+		if len(record) > ssimRecordLength {
+			p.issue(line, recordType, "Record is longer than %d characters", ssimRecordLength)
+			continue
+		}
+		// Trailing spaces are often stripped by editors and transfers.
+		record += strings.Repeat(" ", ssimRecordLength-len(record))
+		if recordType == "0" {
+			continue
+		}
+		p.records++
+
+		serial, err := strconv.Atoi(record[194:200])
+		if err != nil {
+			p.issue(line, recordType, "Record serial number %q is not numeric", record[194:200])
+		} else {
+			if recordType == "5" && ssimField(record, 188, 193) != "" && ssimField(record, 188, 193) != fmt.Sprintf("%06d", p.lastSerial) {
+				p.issue(line, recordType, "Trailer refers to serial number %s, the last record is %06d", ssimField(record, 188, 193), p.lastSerial)
+			}
+			if serial <= p.lastSerial {
+				p.issue(line, recordType, "Record serial number %d does not follow %d", serial, p.lastSerial)
+			}
+			p.lastSerial = serial
+		}
+
+		switch recordType {
+		case "1":
+			p.sawHeader = true
+			if !strings.HasPrefix(record[1:], "AIRLINE STANDARD SCHEDULE DATA SET") {
+				p.issue(line, recordType, "Header record does not start with AIRLINE STANDARD SCHEDULE DATA SET")
+			}
+		case "2":
+			p.parseCarrier(line, record)
+		case "3":
+			if p.airline == "" {
+				p.issue(line, recordType, "Flight leg record appears before a carrier record")
+				continue
+			}
+			schedule, err := p.parseLeg(record)
+			if err != nil {
+				p.issue(line, recordType, "%v", err)
+				continue
+			}
+			if first, ok := p.legLines[schedule.ID]; ok {
+				p.issue(line, recordType, "Duplicate of line %d", first)
+				continue
+			}
+			p.legLines[schedule.ID] = line
+			p.legs = append(p.legs, ssimLeg{line: line, schedule: schedule})
+		case "4":
+			// Segment data such as meal service has no place in our model.
+			if p.airline == "" {
+				p.issue(line, recordType, "Segment data record appears before a carrier record")
+			}
+		case "5":
+			p.sawTrailer = true
+			if airline := ssimField(record, 3, 5); airline != p.airline {
+				p.issue(line, recordType, "Trailer airline %s does not match carrier record %s", airline, p.airline)
+			}
+		default:
+			p.issue(line, recordType, "Unknown record type %s", recordType)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !p.sawHeader {
+		p.issue(0, "1", "File has no header record")
+	}
+	if !p.sawTrailer {
+		p.issue(line, "5", "File has no trailer record")
+	}
+	return p, nil
+}
+
+func (p *ssimParser) parseCarrier(line int, record string) {
+	if !p.sawHeader {
+		p.issue(line, "2", "Carrier record appears before the header record")
+	}
+	p.timeMode = record[1]
+	if p.timeMode != 'U' && p.timeMode != 'L' {
+		p.issue(line, "2", "Time mode must be U or L")
+	}
+	p.airline = ssimField(record, 3, 5)
+	if p.airline == "" {
+		p.issue(line, "2", "Airline designator is required")
+	}
+	if validTo := ssimField(record, 22, 28); validTo != "" && validTo != "00XXX00" {
+		date, err := parseSSIMDate(validTo)
+		if err != nil {
+			p.issue(line, "2", "Schedule validity end: %v", err)
+		}
+		p.validTo = date
+	}
+}
+
+// parseLeg maps a flight leg onto a Schedule. Times are converted to UTC, so
+// a departure that falls on the previous or next UTC day shifts the days of
+// operation and the period with it.
+func (p *ssimParser) parseLeg(record string) (Schedule, error) {
+	airline := ssimField(record, 3, 5)
+	if airline != p.airline {
+		return Schedule{}, fmt.Errorf("Airline %s does not match carrier record %s", airline, p.airline)
+	}
+	number, err := strconv.Atoi(ssimField(record, 6, 9))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Flight number %q is not numeric", ssimField(record, 6, 9))
+	}
+	flightNumber := fmt.Sprintf("%s%d%s", airline, number, ssimField(record, 2, 2))
+
+	validFrom, err := parseSSIMDate(ssimField(record, 15, 21))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Period of operation start: %v", err)
+	}
+	validTo := p.validTo
+	if to := ssimField(record, 22, 28); to != "00XXX00" {
+		if validTo, err = parseSSIMDate(to); err != nil {
+			return Schedule{}, fmt.Errorf("Period of operation end: %v", err)
+		}
+	} else if validTo.IsZero() {
+		return Schedule{}, errors.New("An open period of operation needs a schedule validity end on the carrier record")
+	}
+	if validTo.Before(validFrom) {
+		return Schedule{}, errors.New("Period of operation ends before it starts")
+	}
+
+	days := strings.ReplaceAll(record[28:35], " ", ".")
+	if err := validateDaysOfWeek(days); err != nil {
+		return Schedule{}, err
+	}
+	if frequency := record[35]; frequency != ' ' && frequency != '1' {
+		return Schedule{}, errors.New("Only weekly frequency is supported")
+	}
+
+	origin, destination := ssimField(record, 37, 39), ssimField(record, 55, 57)
+	if err := ValidateAirportCode(origin); err != nil {
+		return Schedule{}, fmt.Errorf("Departure station: %v", err)
+	}
+	if err := ValidateAirportCode(destination); err != nil {
+		return Schedule{}, fmt.Errorf("Arrival station: %v", err)
+	}
+
+	departure, err := parseSSIMTime(record[39:43])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Departure time: %v", err)
+	}
+	arrival, err := parseSSIMTime(record[61:65])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Arrival time: %v", err)
+	}
+	departureOffset, err := parseSSIMOffset(record[47:52])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Departure %v", err)
+	}
+	arrivalOffset, err := parseSSIMOffset(record[65:70])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Arrival %v", err)
+	}
+	departureVariation, err := parseSSIMDateVariation(record[192])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Departure %v", err)
+	}
+	arrivalVariation, err := parseSSIMDateVariation(record[193])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Arrival %v", err)
+	}
+
+	if p.timeMode == 'L' {
+		departure -= departureOffset
+		arrival -= arrivalOffset
+	}
+	departure += departureVariation * 24 * 60
+	arrival += arrivalVariation * 24 * 60
+	if arrival <= departure {
+		return Schedule{}, errors.New("Arrival is not after departure")
+	}
+
+	configuration := ssimField(record, 173, 192)
+	if _, err := parseSSIMConfiguration(configuration); err != nil {
+		return Schedule{}, err
+	}
+
+	shift := floorDiv(departure, 24*60)
+	departure -= shift * 24 * 60
+
+	return Schedule{
+		ID:                    fmt.Sprintf("SSIM-%s-%s-%s", flightNumber, ssimField(record, 10, 11), ssimField(record, 12, 13)),
+		FlightNumber:          flightNumber,
+		OriginAirport:         origin,
+		DestinationAirport:    destination,
+		DepartureTime:         fmt.Sprintf("%02d:%02d", departure/60, departure%60),
+		Timezone:              "UTC",
+		BlockMinutes:          arrival - departure - shift*24*60,
+		DaysOfWeek:            shiftDaysOfWeek(days, shift),
+		ValidFrom:             validFrom.AddDate(0, 0, shift).Format("2006-01-02"),
+		ValidTo:               validTo.AddDate(0, 0, shift).Format("2006-01-02"),
+		AircraftType:          ssimField(record, 73, 75),
+		AircraftConfiguration: configuration,
+	}, nil
+}
+
+// diffSSIMSchedule compares a schedule from the file with the stored one,
+// which it returns when there is one.
+func diffSSIMSchedule(schedule Schedule, tablesExist bool, svc *dynamodb.DynamoDB) (SSIMScheduleDiff, *Schedule, error) {
+	diff := SSIMScheduleDiff{
+		ScheduleID:   schedule.ID,
+		FlightNumber: schedule.FlightNumber,
+		Route:        flightRoute(schedule.OriginAirport, schedule.DestinationAirport),
+		Action:       SSIMActionCreate,
+	}
+
+	var current *Schedule
+	if tablesExist {
+		var err error
+		if current, err = GetScheduleByID(schedule.ID, svc); err != nil && err.Error() != "Schedule not found" {
+			return diff, nil, err
+		}
+	}
+
+	if current == nil {
+		if !doesTableExist("Flights", svc) {
+			return diff, nil, nil
+		}
+		validFrom, _ := time.Parse("2006-01-02", schedule.ValidFrom)
+		validTo, _ := time.Parse("2006-01-02", schedule.ValidTo)
+		flights, err := queryFlightsByRoute(schedule.OriginAirport, schedule.DestinationAirport, validFrom, validTo.Add(24*time.Hour-time.Second), svc)
+		if err != nil {
+			return diff, nil, err
+		}
+		for _, flight := range flights {
+			if flight.FlightNumber == schedule.FlightNumber && flight.ScheduleID == "" {
+				diff.ExistingFlights++
+			}
+		}
+		return diff, nil, nil
+	}
+
+	fields := []struct {
+		name, before, after string
+	}{
+		{"FlightNumber", current.FlightNumber, schedule.FlightNumber},
+		{"AirlineID", current.AirlineID, schedule.AirlineID},
+		{"OriginAirport", strings.ToUpper(current.OriginAirport), schedule.OriginAirport},
+		{"DestinationAirport", strings.ToUpper(current.DestinationAirport), schedule.DestinationAirport},
+		{"DepartureTime", current.DepartureTime, schedule.DepartureTime},
+		{"Timezone", current.Timezone, schedule.Timezone},
+		{"BlockMinutes", strconv.Itoa(current.BlockMinutes), strconv.Itoa(schedule.BlockMinutes)},
+		{"DaysOfWeek", current.DaysOfWeek, schedule.DaysOfWeek},
+		{"ValidFrom", current.ValidFrom, schedule.ValidFrom},
+		{"ValidTo", current.ValidTo, schedule.ValidTo},
+		{"AircraftType", current.AircraftType, schedule.AircraftType},
+		{"AircraftConfiguration", current.AircraftConfiguration, schedule.AircraftConfiguration},
+	}
+	for _, field := range fields {
+		if field.before != field.after {
+			diff.Changes = append(diff.Changes, fmt.Sprintf("%s: %s -> %s", field.name, field.before, field.after))
+		}
+	}
+	if len(diff.Changes) == 0 {
+		diff.Action = SSIMActionUnchanged
+		return diff, current, nil
+	}
+
+	diff.Action = SSIMActionUpdate
+	instances, err := getScheduleInstances(schedule.ID, time.Now().UTC().Format("2006-01-02"), svc)
+	if err != nil {
+		return diff, nil, err
+	}
+	diff.AffectedFlights = len(instances)
+	return diff, current, nil
+}
+
+// validateSSIMLeg runs the checks of CreateSchedule on a leg. A leg keeps the
+// sections of its stored schedule while its configuration is unchanged and
+// gets new ones laid out from the configuration otherwise.
+func validateSSIMLeg(schedule Schedule, current *Schedule, svc *dynamodb.DynamoDB) error {
+	if current != nil && current.AircraftConfiguration == schedule.AircraftConfiguration {
+		schedule.FlightSectionIDs = current.FlightSectionIDs
+		return validateSchedule(schedule, svc)
+	}
+	if _, err := parseSSIMConfiguration(schedule.AircraftConfiguration); err != nil {
+		return err
+	}
+	return validateScheduleDetails(schedule, svc)
+}
+
+// deleteUnusedScheduleSections removes the sections an import replaced,
+// unless another schedule still lays out its flights from them.
+func deleteUnusedScheduleSections(flightSectionIDs []string, svc *dynamodb.DynamoDB) error {
+	if len(flightSectionIDs) == 0 {
+		return nil
+	}
+	schedules, err := GetAllSchedules(svc)
+	if err != nil {
+		return err
+	}
+	inUse := map[string]bool{}
+	for _, schedule := range schedules {
+		for _, flightSectionID := range schedule.FlightSectionIDs {
+			inUse[flightSectionID] = true
+		}
+	}
+
+	for _, flightSectionID := range flightSectionIDs {
+		if inUse[flightSectionID] {
+			continue
+		}
+		_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("FlightSections"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(flightSectionID),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportSSIM reads an SSIM file and stores one schedule per flight leg. The
+// file is validated as a whole first and nothing is written if any record
+// fails; with dryRun only the validation report and the diff are returned.
+// When horizonDays is positive, the flights of the imported schedules are
+// generated afterwards.
+func ImportSSIM(r io.Reader, dryRun bool, horizonDays int, svc *dynamodb.DynamoDB) (*SSIMImportReport, error) {
+	parser, err := parseSSIM(r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SSIMImportReport{
+		Airline:   parser.airline,
+		DryRun:    dryRun,
+		Records:   parser.records,
+		Legs:      len(parser.legs),
+		Errors:    parser.issues,
+		Diff:      []SSIMScheduleDiff{},
+		Generated: []*ScheduleGenerationReport{},
+	}
+
+	if parser.airline != "" {
+		airline, err := GetAirlineByCode(parser.airline, svc)
+		if err != nil {
+			report.Errors = append(report.Errors, SSIMIssue{RecordType: "2", Message: fmt.Sprintf("Airline %s: %v", parser.airline, err)})
+		} else {
+			for i := range parser.legs {
+				parser.legs[i].schedule.AirlineID = airline.ID
+			}
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	tablesExist := doesTableExist("Schedules", svc) && doesTableExist("ScheduleInstances", svc)
+	current := make([]*Schedule, len(parser.legs))
+	for i := range parser.legs {
+		leg := &parser.legs[i]
+		if err := applyRouteDefaults(&leg.schedule, svc); err != nil {
+			report.Errors = append(report.Errors, SSIMIssue{Line: leg.line, RecordType: "3", Message: err.Error()})
+			continue
+		}
+		diff, stored, err := diffSSIMSchedule(leg.schedule, tablesExist, svc)
+		if err != nil {
+			return nil, err
+		}
+		report.Diff = append(report.Diff, diff)
+		current[i] = stored
+		if err := validateSSIMLeg(leg.schedule, stored, svc); err != nil {
+			report.Errors = append(report.Errors, SSIMIssue{Line: leg.line, RecordType: "3", Message: err.Error()})
+		}
+	}
+	if len(report.Errors) > 0 {
+		report.Diff = []SSIMScheduleDiff{}
+		return report, nil
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	ensureScheduleTables(svc)
+	replaced := []string{}
+	for i, leg := range parser.legs {
+		if report.Diff[i].Action == SSIMActionUnchanged {
+			continue
+		}
+
+		schedule := leg.schedule
+		created := []string{}
+		if current[i] != nil && current[i].AircraftConfiguration == schedule.AircraftConfiguration {
+			schedule.FlightSectionIDs = current[i].FlightSectionIDs
+		} else {
+			sections, _ := parseSSIMConfiguration(schedule.AircraftConfiguration)
+			for _, section := range sections {
+				section, err := createFlightSection(section, svc)
+				if err != nil {
+					deleteScheduledSections(schedule.FlightNumber, created, svc)
+					return nil, err
+				}
+				created = append(created, section.ID)
+			}
+			schedule.FlightSectionIDs = created
+		}
+
+		if err := putSchedule(schedule, "", svc); err != nil {
+			deleteScheduledSections(schedule.FlightNumber, created, svc)
+			return nil, err
+		}
+		if current[i] != nil && len(created) > 0 {
+			replaced = append(replaced, current[i].FlightSectionIDs...)
+		}
+	}
+	if err := deleteUnusedScheduleSections(replaced, svc); err != nil {
+		fmt.Printf("Error removing replaced schedule sections: %v\n", err)
+	}
+	fmt.Printf("Imported %d SSIM flight legs for %s\n", len(parser.legs), parser.airline)
+
+	if horizonDays > 0 {
+		for _, leg := range parser.legs {
+			generated, err := GenerateScheduleFlights(leg.schedule.ID, horizonDays, svc)
+			if err != nil {
+				return report, err
+			}
+			report.Generated = append(report.Generated, generated)
+		}
+	}
+
+	return report, nil
+}
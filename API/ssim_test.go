@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ssimRecord lays out fields at their 1-based start columns of a 200
+// character record and numbers it with serial.
+func ssimRecord(serial int, fields map[int]string) string {
+	record := []byte(strings.Repeat(" ", ssimRecordLength))
+	for column, value := range fields {
+		copy(record[column-1:], value)
+	}
+	copy(record[194:], fmt.Sprintf("%06d", serial))
+	return string(record)
+}
+
+// ssimLegRecord returns a flight leg of XX100 overriding the given fields.
+func ssimLegRecord(serial int, overrides map[int]string) string {
+	fields := map[int]string{
+		1:   "3",
+		3:   "XX ",
+		6:   " 100",
+		10:  "01",
+		12:  "01",
+		15:  "01JAN27",
+		22:  "31JAN27",
+		29:  "1.3.5..",
+		37:  "AMS",
+		40:  "0800",
+		48:  "+0000",
+		55:  "LHR",
+		62:  "0900",
+		66:  "+0000",
+		73:  "320",
+		173: "C20Y150",
+	}
+	for column, value := range overrides {
+		fields[column] = value
+	}
+	return ssimRecord(serial, fields)
+}
+
+func TestParseSSIMLeg(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeMode byte
+		validTo  string
+		fields   map[int]string
+		want     Schedule
+		wantErr  string
+	}{
+		{
+			name:     "UTC times",
+			timeMode: 'U',
+			want: Schedule{
+				ID:                    "SSIM-XX100-01-01",
+				FlightNumber:          "XX100",
+				OriginAirport:         "AMS",
+				DestinationAirport:    "LHR",
+				DepartureTime:         "08:00",
+				Timezone:              "UTC",
+				BlockMinutes:          60,
+				DaysOfWeek:            "1.3.5..",
+				ValidFrom:             "2027-01-01",
+				ValidTo:               "2027-01-31",
+				AircraftType:          "320",
+				AircraftConfiguration: "C20Y150",
+			},
+		},
+		{
+			name:     "local departure on the previous UTC day",
+			timeMode: 'L',
+			fields:   map[int]string{40: "0030", 48: "+0200", 62: "0230", 66: "+0200"},
+			want: Schedule{
+				ID:                    "SSIM-XX100-01-01",
+				FlightNumber:          "XX100",
+				OriginAirport:         "AMS",
+				DestinationAirport:    "LHR",
+				DepartureTime:         "22:30",
+				Timezone:              "UTC",
+				BlockMinutes:          120,
+				DaysOfWeek:            ".2.4..7",
+				ValidFrom:             "2026-12-31",
+				ValidTo:               "2027-01-30",
+				AircraftType:          "320",
+				AircraftConfiguration: "C20Y150",
+			},
+		},
+		{
+			name:     "arrival on the next day",
+			timeMode: 'U',
+			fields:   map[int]string{40: "2300", 62: "0100", 194: "1"},
+			want: Schedule{
+				ID:                    "SSIM-XX100-01-01",
+				FlightNumber:          "XX100",
+				OriginAirport:         "AMS",
+				DestinationAirport:    "LHR",
+				DepartureTime:         "23:00",
+				Timezone:              "UTC",
+				BlockMinutes:          120,
+				DaysOfWeek:            "1.3.5..",
+				ValidFrom:             "2027-01-01",
+				ValidTo:               "2027-01-31",
+				AircraftType:          "320",
+				AircraftConfiguration: "C20Y150",
+			},
+		},
+		{
+			name:     "open period ends with the carrier validity",
+			timeMode: 'U',
+			validTo:  "28FEB27",
+			fields:   map[int]string{22: "00XXX00"},
+			want: Schedule{
+				ID:                    "SSIM-XX100-01-01",
+				FlightNumber:          "XX100",
+				OriginAirport:         "AMS",
+				DestinationAirport:    "LHR",
+				DepartureTime:         "08:00",
+				Timezone:              "UTC",
+				BlockMinutes:          60,
+				DaysOfWeek:            "1.3.5..",
+				ValidFrom:             "2027-01-01",
+				ValidTo:               "2027-02-28",
+				AircraftType:          "320",
+				AircraftConfiguration: "C20Y150",
+			},
+		},
+		{
+			name:     "open period without carrier validity",
+			timeMode: 'U',
+			fields:   map[int]string{22: "00XXX00"},
+			wantErr:  "An open period of operation needs a schedule validity end on the carrier record",
+		},
+		{
+			name:     "other airline",
+			timeMode: 'U',
+			fields:   map[int]string{3: "YY "},
+			wantErr:  "Airline YY does not match carrier record XX",
+		},
+		{
+			name:     "invalid departure time",
+			timeMode: 'U',
+			fields:   map[int]string{40: "0860"},
+			wantErr:  `Departure time: "0860" is not an HHMM time`,
+		},
+		{
+			name:     "arrival before departure",
+			timeMode: 'U',
+			fields:   map[int]string{62: "0700"},
+			wantErr:  "Arrival is not after departure",
+		},
+		{
+			name:     "period ends before it starts",
+			timeMode: 'U',
+			fields:   map[int]string{22: "01DEC26"},
+			wantErr:  "Period of operation ends before it starts",
+		},
+		{
+			name:     "unsupported frequency",
+			timeMode: 'U',
+			fields:   map[int]string{36: "2"},
+			wantErr:  "Only weekly frequency is supported",
+		},
+		{
+			name:     "unknown cabin",
+			timeMode: 'U',
+			fields:   map[int]string{173: "Q20"},
+			wantErr:  `Aircraft configuration "Q20" has an unknown cabin code Q`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ssimParser{timeMode: tt.timeMode, airline: "XX"}
+			if tt.validTo != "" {
+				validTo, err := parseSSIMDate(tt.validTo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.validTo = validTo
+			}
+
+			got, err := p.parseLeg(ssimLegRecord(1, tt.fields))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseLeg() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLeg() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLeg() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSSIM(t *testing.T) {
+	header := ssimRecord(1, map[int]string{1: "1AIRLINE STANDARD SCHEDULE DATA SET"})
+	carrier := ssimRecord(2, map[int]string{1: "2U", 3: "XX "})
+	trailer := func(serial int, airline string) string {
+		return ssimRecord(serial, map[int]string{1: "5", 3: airline, 188: fmt.Sprintf("%06d", serial-1)})
+	}
+
+	tests := []struct {
+		name       string
+		records    []string
+		wantLegs   int
+		wantIssues []SSIMIssue
+	}{
+		{
+			name:     "valid file",
+			records:  []string{header, carrier, ssimLegRecord(3, nil), trailer(4, "XX ")},
+			wantLegs: 1,
+		},
+		{
+			name:     "duplicate leg",
+			records:  []string{header, carrier, ssimLegRecord(3, nil), ssimLegRecord(4, nil), trailer(5, "XX ")},
+			wantLegs: 1,
+			wantIssues: []SSIMIssue{
+				{Line: 4, RecordType: "3", Message: "Duplicate of line 3"},
+			},
+		},
+		{
+			name:     "serial out of order",
+			records:  []string{header, carrier, ssimLegRecord(2, nil), trailer(4, "XX ")},
+			wantLegs: 1,
+			wantIssues: []SSIMIssue{
+				{Line: 3, RecordType: "3", Message: "Record serial number 2 does not follow 2"},
+				{Line: 4, RecordType: "5", Message: "Trailer refers to serial number 000003, the last record is 000002"},
+			},
+		},
+		{
+			name:     "leg before carrier and no trailer",
+			records:  []string{header, ssimLegRecord(2, nil)},
+			wantLegs: 0,
+			wantIssues: []SSIMIssue{
+				{Line: 2, RecordType: "3", Message: "Flight leg record appears before a carrier record"},
+				{Line: 2, RecordType: "5", Message: "File has no trailer record"},
+			},
+		},
+		{
+			name:     "trailer of another airline",
+			records:  []string{header, carrier, trailer(3, "YY ")},
+			wantLegs: 0,
+			wantIssues: []SSIMIssue{
+				{Line: 3, RecordType: "5", Message: "Trailer airline YY does not match carrier record XX"},
+			},
+		},
+		{
+			name:     "invalid leg",
+			records:  []string{header, carrier, ssimLegRecord(3, map[int]string{37: "A1S"}), trailer(4, "XX ")},
+			wantLegs: 0,
+			wantIssues: []SSIMIssue{
+				{Line: 3, RecordType: "3", Message: "Departure station: Airport code must be exactly 3 alphabetic characters"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseSSIM(strings.NewReader(strings.Join(tt.records, "\n")))
+			if err != nil {
+				t.Fatalf("parseSSIM() error = %v", err)
+			}
+			if len(p.legs) != tt.wantLegs {
+				t.Errorf("parseSSIM() legs = %d, want %d", len(p.legs), tt.wantLegs)
+			}
+			wantIssues := tt.wantIssues
+			if wantIssues == nil {
+				wantIssues = []SSIMIssue{}
+			}
+			if !reflect.DeepEqual(p.issues, wantIssues) {
+				t.Errorf("parseSSIM() issues = %+v, want %+v", p.issues, wantIssues)
+			}
+		})
+	}
+}
+
+func TestParseSSIMConfiguration(t *testing.T) {
+	tests := []struct {
+		configuration string
+		want          []FlightSection
+		wantErr       bool
+	}{
+		{
+			configuration: "C20Y150",
+			want: []FlightSection{
+				{SeatClass: "Business", NumRows: 5, NumCols: 4, AislesAfter: []int{2}},
+				{SeatClass: "Economy", NumRows: 25, NumCols: 6, AislesAfter: []int{3}},
+			},
+		},
+		{
+			configuration: "Y175",
+			want: []FlightSection{
+				{SeatClass: "Economy", NumRows: 30, NumCols: 6, AislesAfter: []int{3}},
+			},
+		},
+		{configuration: "", wantErr: true},
+		{configuration: "Y", wantErr: true},
+		{configuration: "Y0", wantErr: true},
+		{configuration: "X12", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.configuration, func(t *testing.T) {
+			got, err := parseSSIMConfiguration(tt.configuration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSSIMConfiguration(%q) error = %v, wantErr %v", tt.configuration, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSSIMConfiguration(%q) = %+v, want %+v", tt.configuration, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
@@ -12,3 +15,64 @@ func doesTableExist(tableName string, svc *dynamodb.DynamoDB) bool {
 	})
 	return err == nil
 }
+
+// ensureIndex adds a global secondary index to a table created before the
+// index existed. It fails until the index is active, so callers relying on
+// the index, e.g. for uniqueness checks, wait for it.
+func ensureIndex(tableName string, index *dynamodb.GlobalSecondaryIndex, svc *dynamodb.DynamoDB) error {
+	description, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	pending := fmt.Errorf("%s is being added to the %s table, retry once it is active", aws.StringValue(index.IndexName), tableName)
+	for _, existing := range description.Table.GlobalSecondaryIndexes {
+		if aws.StringValue(existing.IndexName) != aws.StringValue(index.IndexName) {
+			continue
+		}
+		if aws.StringValue(existing.IndexStatus) != dynamodb.IndexStatusActive {
+			return pending
+		}
+		return nil
+	}
+
+	_, err = svc.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: index.KeySchema[0].AttributeName,
+				AttributeType: aws.String("S"),
+			},
+		},
+		GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+			{
+				Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+					IndexName:             index.IndexName,
+					KeySchema:             index.KeySchema,
+					Projection:            index.Projection,
+					ProvisionedThroughput: index.ProvisionedThroughput,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s added to %s table\n", aws.StringValue(index.IndexName), tableName)
+	return pending
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var numericPattern = regexp.MustCompile("^[0-9]+$")
+
+func isNumeric(s string) bool {
+	return numericPattern.MatchString(s)
+}
@@ -2,6 +2,7 @@ import { BrowserRouter, Routes, Route } from "react-router-dom";
 import Home from "./pages/Home";
 import Airlines from "./pages/Airlines";
 import Airports from "./pages/Airports";
+import AirlineRoutes from "./pages/AirlineRoutes";
 import FlightSections from "./pages/FlightSections";
 import Flights from "./pages/Flights";
 import Seats from "./pages/Seats";
@@ -14,6 +15,7 @@ function App() {
           <Route path="/" element={<Home />} />
           <Route path="/airlines" element={<Airlines />} />
           <Route path="/airports" element={<Airports />} />
+          <Route path="/routes" element={<AirlineRoutes />} />
           <Route path="/flightsections" element={<FlightSections />} />
           <Route path="/flights" element={<Flights />} />
           <Route path="/seats" element={<Seats />} />
@@ -26,6 +26,7 @@ interface FlightFormProps {
 }
 
 interface FlightData {
+  airlineID: string;
   flightNumber: string;
   flightSectionID: string[];
   originAirport: string;
@@ -38,8 +39,34 @@ interface FlightData {
 interface AirportData {
   id: string;
   code: string;
+  name?: string;
+  city?: string;
 }
 
+interface AirlineData {
+  id: string;
+  code: string;
+  name: string;
+  active?: boolean;
+}
+
+// A flight number is the airline's IATA designator followed by a 1-4 digit
+// number and an optional suffix letter, as the API checks it.
+const flightNumberError = (flightNumber: string, airline?: AirlineData) => {
+  if (!airline) {
+    return "Select the operating airline.";
+  }
+  if (!new RegExp(`^${airline.code}[0-9]{1,4}[A-Z]?$`).test(flightNumber)) {
+    return `The flight number must be ${airline.code} followed by a 1-4 digit number and an optional suffix letter, e.g. ${airline.code}123.`;
+  }
+  return "";
+};
+
+const airportLabel = (airport: AirportData) =>
+  airport.name
+    ? `${airport.code} – ${airport.name}, ${airport.city}`
+    : airport.code;
+
 const modalStyles = {
   position: "absolute",
   top: "50%",
@@ -54,6 +81,7 @@ const modalStyles = {
 
 const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
   const [flightData, setFlightData] = useState<FlightData>({
+    airlineID: "",
     flightNumber: "",
     flightSectionID: [],
     originAirport: "",
@@ -65,6 +93,8 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
   const [airports, setAirports] = useState<AirportData[]>([]);
   const [flightSections, setFlightSections] = useState<any[]>([]);
   const [loadingAirports, setLoadingAirports] = useState<boolean>(true);
+  const [airlines, setAirlines] = useState<AirlineData[]>([]);
+  const [errorMessage, setErrorMessage] = useState("");
 
   useEffect(() => {
     const fetchAirports = async () => {
@@ -88,8 +118,22 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
       }
     };
 
+    const fetchAirlines = async () => {
+      try {
+        const response = await axios.get("http://127.0.0.1:3000/airlines");
+        setAirlines(
+          response.data.filter(
+            (airline: AirlineData) => airline.active !== false
+          )
+        );
+      } catch (error) {
+        console.error("Error fetching airlines:", error);
+      }
+    };
+
     fetchAirports();
     fetchFlightSections();
+    fetchAirlines();
   }, []);
 
   const handleDateChange = (date: moment.Moment | null) => {
@@ -130,11 +174,20 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
   }
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
+    const airline = airlines.find(
+      (airline) => airline.id === flightData.airlineID
+    );
+    const error = flightNumberError(flightData.flightNumber, airline);
+    setErrorMessage(error);
+    if (error) {
+      return;
+    }
     try {
       const flightTimeFormated = millisecondsToNanoseconds(
         flightData.flightTime!.asMilliseconds()
       );
       await axios.post("http://127.0.0.1:3000/flights", {
+        airlineID: flightData.airlineID,
         flightNumber: flightData.flightNumber,
         flightSectionID: flightData.flightSectionID,
         originAirport: flightData.originAirport,
@@ -145,7 +198,9 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
       onClose(); // Close the modal if the request is successful
     } catch (error) {
       console.error("Error creating flight:", error);
-      // Handle error, show error message, etc.
+      setErrorMessage(
+        "The flight could not be created. Check that the airline is active, has an ACTIVE route between the airports on that day, and that the flight does not exist yet."
+      );
     }
   };
 
@@ -156,6 +211,24 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
           Create Flight
         </Typography>
         <form onSubmit={handleSubmit}>
+          <FormControl fullWidth>
+            <InputLabel htmlFor="airlineID">Airline</InputLabel>
+            <Select
+              label="Airline"
+              name="airlineID"
+              value={flightData.airlineID}
+              onChange={handleSelectChange}
+              required
+            >
+              {airlines.map((airline) => (
+                <MenuItem key={airline.id} value={airline.id}>
+                  {`${airline.code} – ${airline.name}`}
+                </MenuItem>
+              ))}
+            </Select>
+          </FormControl>
+          <br />
+          <br />
           <TextField
             label="Flight Number"
             name="flightNumber"
@@ -181,7 +254,7 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
               ) : (
                 airports.map((airport) => (
                   <MenuItem key={airport.id} value={airport.code}>
-                    {airport.code}
+                    {airportLabel(airport)}
                   </MenuItem>
                 ))
               )}
@@ -207,7 +280,7 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
               ) : (
                 airports.map((airport) => (
                   <MenuItem key={airport.id} value={airport.code}>
-                    {airport.code}
+                    {airportLabel(airport)}
                   </MenuItem>
                 ))
               )}
@@ -254,7 +327,7 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
           <br />
           <LocalizationProvider dateAdapter={AdapterMoment}>
             <TimePicker
-              label="Flight Time"
+              label="Flight Time (00:00 to estimate from distance)"
               value={flightData.flightTimeDate}
               onChange={(newTime) => {
                 handleFlightTimeChange(newTime);
@@ -266,6 +339,11 @@ const FlightForm: React.FC<FlightFormProps> = ({ open, onClose }) => {
 
           <br />
           <br />
+          {errorMessage && (
+            <Typography variant="body2" color="error">
+              {errorMessage}
+            </Typography>
+          )}
           <Button variant="contained" type="submit">
             Submit
           </Button>
@@ -22,6 +22,9 @@ const NavigationBar: React.FC = () => {
           <Button color="inherit" LinkComponent={Link} href="/airports">
             Airports
           </Button>
+          <Button color="inherit" LinkComponent={Link} href="/routes">
+            Routes
+          </Button>
           <Button color="inherit" LinkComponent={Link} href="/flightsections">
             Flight Sections
           </Button>
@@ -0,0 +1,355 @@
+import React, { useCallback, useEffect, useState } from "react";
+import NavigationBar from "../components/Navigation";
+import Footer from "../components/Footer";
+import { DataGrid, GridColDef, GridRenderCellParams } from "@mui/x-data-grid";
+import {
+  Box,
+  Button,
+  FormControl,
+  InputLabel,
+  MenuItem,
+  Modal,
+  Select,
+  SelectChangeEvent,
+  TextField,
+  Typography,
+} from "@mui/material";
+import axios from "axios";
+import PublishIcon from "@mui/icons-material/Publish";
+
+/* Styles and grid definition */
+
+const modalStyle = {
+  position: "absolute" as "absolute",
+  top: "50%",
+  left: "50%",
+  transform: "translate(-50%, -50%)",
+  width: 400,
+  bgcolor: "background.paper",
+  border: "2px solid #000",
+  boxShadow: 24,
+  p: 4,
+  maxHeight: "90vh",
+  overflowY: "auto" as "auto",
+};
+
+// Flights can only be created on ACTIVE routes.
+const routeStatuses = ["PLANNED", "ACTIVE", "SUSPENDED", "DISCONTINUED"];
+
+interface RouteData {
+  id: string;
+  airlineID: string;
+  originAirport: string;
+  destinationAirport: string;
+  distanceKm?: number;
+  status: string;
+  validFrom?: string;
+  validTo?: string;
+  aircraftType?: string;
+  aircraftConfiguration?: string;
+}
+
+interface AirlineData {
+  id: string;
+  code: string;
+  name: string;
+}
+
+interface AirportData {
+  id: string;
+  code: string;
+  name?: string;
+}
+
+const emptyRoute = {
+  originAirport: "",
+  destinationAirport: "",
+  status: "PLANNED",
+  validFrom: "",
+  validTo: "",
+  aircraftType: "",
+  aircraftConfiguration: "",
+};
+
+const AirlineRoutes: React.FC = () => {
+  /* States */
+
+  const [data, setData] = useState<RouteData[]>([]);
+  const [loading, setLoading] = useState<boolean>(false);
+  const [airlines, setAirlines] = useState<AirlineData[]>([]);
+  const [airports, setAirports] = useState<AirportData[]>([]);
+  const [airlineID, setAirlineID] = useState("");
+  const [open, setOpen] = React.useState(false);
+  const [route, setRoute] = useState(emptyRoute);
+  const [errorMessage, setErrorMessage] = useState(""); // State for error message
+
+  /* Handlers and hooks */
+
+  const fetchRoutes = useCallback(async () => {
+    if (!airlineID) {
+      setData([]);
+      return;
+    }
+    setLoading(true);
+    try {
+      const response = await axios.get(
+        `http://127.0.0.1:3000/airlines/${airlineID}/routes`
+      );
+      setData(response.data.routes || []);
+    } catch (error) {
+      console.error("Error fetching routes:", error);
+      setData([]);
+    }
+    setLoading(false);
+  }, [airlineID]);
+
+  const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+    setRoute({ ...route, [e.target.name]: e.target.value });
+  };
+
+  const handleSelectChange = (event: SelectChangeEvent) => {
+    setRoute({ ...route, [event.target.name]: event.target.value });
+  };
+
+  const handleOpen = () => {
+    setOpen(true);
+    setRoute(emptyRoute);
+    setErrorMessage(""); // Clear error message when modal is opened
+  };
+
+  const handleClose = () => setOpen(false);
+
+  const handleSubmit = async (e: any) => {
+    e.preventDefault();
+    try {
+      await axios.post("http://127.0.0.1:3000/routes", {
+        ...route,
+        airlineID: airlineID,
+      });
+      handleClose();
+      fetchRoutes();
+    } catch (error: any) {
+      if (error.response && error.response.status === 400) {
+        setErrorMessage(
+          "The route is invalid, or the airline already has it in the same period."
+        );
+      }
+    }
+  };
+
+  // The whole route is sent back, as the API replaces its validity and aircraft.
+  const handleStatusChange = async (row: RouteData, status: string) => {
+    try {
+      await axios.put(`http://127.0.0.1:3000/routes/${row.id}`, {
+        ...row,
+        status: status,
+      });
+      fetchRoutes();
+    } catch (error) {
+      console.error("Error updating route:", error);
+    }
+  };
+
+  useEffect(() => {
+    const fetchData = async () => {
+      try {
+        const [airlinesResponse, airportsResponse] = await Promise.all([
+          axios.get("http://127.0.0.1:3000/airlines"),
+          axios.get("http://127.0.0.1:3000/airports"),
+        ]);
+        setAirlines(airlinesResponse.data);
+        setAirports(airportsResponse.data);
+      } catch (error) {
+        console.error("Error fetching airlines and airports:", error);
+      }
+    };
+
+    fetchData();
+  }, []);
+
+  useEffect(() => {
+    fetchRoutes();
+  }, [fetchRoutes]);
+
+  const columns: GridColDef[] = [
+    { field: "originAirport", headerName: "Origin", flex: 1 },
+    { field: "destinationAirport", headerName: "Destination", flex: 1 },
+    { field: "distanceKm", headerName: "Distance (km)", flex: 1 },
+    { field: "validFrom", headerName: "Valid From", flex: 1 },
+    { field: "validTo", headerName: "Valid To", flex: 1 },
+    { field: "aircraftType", headerName: "Aircraft", flex: 1 },
+    {
+      field: "status",
+      headerName: "Status",
+      flex: 1,
+      renderCell: (params: GridRenderCellParams<RouteData>) => (
+        <Select
+          size="small"
+          value={params.row.status}
+          onChange={(e) => handleStatusChange(params.row, e.target.value)}
+        >
+          {routeStatuses.map((status) => (
+            <MenuItem key={status} value={status}>
+              {status}
+            </MenuItem>
+          ))}
+        </Select>
+      ),
+    },
+  ];
+
+  return (
+    <div>
+      <NavigationBar />
+      <Box sx={{ display: "flex", alignItems: "center", gap: 2, p: 1 }}>
+        <FormControl sx={{ minWidth: 240 }} size="small">
+          <InputLabel htmlFor="airlineID">Airline</InputLabel>
+          <Select
+            label="Airline"
+            value={airlineID}
+            onChange={(e) => setAirlineID(e.target.value)}
+          >
+            {airlines.map((airline) => (
+              <MenuItem key={airline.id} value={airline.id}>
+                {`${airline.code} – ${airline.name}`}
+              </MenuItem>
+            ))}
+          </Select>
+        </FormControl>
+        <Button onClick={handleOpen} disabled={!airlineID}>
+          Create Route
+        </Button>
+      </Box>
+      <Modal
+        open={open}
+        onClose={handleClose}
+        aria-labelledby="modal-modal-title"
+        aria-describedby="modal-modal-description"
+      >
+        <Box sx={modalStyle} component="form" onSubmit={handleSubmit}>
+          <Typography id="modal-modal-title" variant="h6" component="h2">
+            Route creation form
+          </Typography>
+          <FormControl fullWidth margin="dense">
+            <InputLabel htmlFor="originAirport">Origin Airport</InputLabel>
+            <Select
+              required
+              label="Origin Airport"
+              name="originAirport"
+              value={route.originAirport}
+              onChange={handleSelectChange}
+            >
+              {airports.map((airport) => (
+                <MenuItem key={airport.id} value={airport.code}>
+                  {airport.name
+                    ? `${airport.code} – ${airport.name}`
+                    : airport.code}
+                </MenuItem>
+              ))}
+            </Select>
+          </FormControl>
+          <FormControl fullWidth margin="dense">
+            <InputLabel htmlFor="destinationAirport">
+              Destination Airport
+            </InputLabel>
+            <Select
+              required
+              label="Destination Airport"
+              name="destinationAirport"
+              value={route.destinationAirport}
+              onChange={handleSelectChange}
+            >
+              {airports.map((airport) => (
+                <MenuItem key={airport.id} value={airport.code}>
+                  {airport.name
+                    ? `${airport.code} – ${airport.name}`
+                    : airport.code}
+                </MenuItem>
+              ))}
+            </Select>
+          </FormControl>
+          <FormControl fullWidth margin="dense">
+            <InputLabel htmlFor="status">Status</InputLabel>
+            <Select
+              label="Status"
+              name="status"
+              value={route.status}
+              onChange={handleSelectChange}
+            >
+              {routeStatuses.map((status) => (
+                <MenuItem key={status} value={status}>
+                  {status}
+                </MenuItem>
+              ))}
+            </Select>
+          </FormControl>
+          <TextField
+            fullWidth
+            margin="dense"
+            type="date"
+            name="validFrom"
+            label="Valid From"
+            InputLabelProps={{ shrink: true }}
+            value={route.validFrom}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            type="date"
+            name="validTo"
+            label="Valid To"
+            InputLabelProps={{ shrink: true }}
+            value={route.validTo}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            name="aircraftType"
+            label="Aircraft type (e.g. 320)"
+            value={route.aircraftType}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            name="aircraftConfiguration"
+            label="Aircraft configuration (e.g. C20Y150)"
+            value={route.aircraftConfiguration}
+            onChange={handleChange}
+          />
+          <br />
+          {errorMessage && (
+            <Typography variant="body2" color="error">
+              {errorMessage}
+            </Typography>
+          )}
+          <br />
+          <Button variant="contained" type="submit" endIcon={<PublishIcon />}>
+            Submit
+          </Button>
+        </Box>
+      </Modal>
+      <Box sx={{ height: 400, width: "100%" }}>
+        <DataGrid
+          rows={data}
+          columns={columns}
+          loading={loading}
+          initialState={{
+            pagination: {
+              paginationModel: {
+                pageSize: 5,
+              },
+            },
+          }}
+          pageSizeOptions={[5]}
+          disableRowSelectionOnClick
+        />
+      </Box>
+      <Footer />
+    </div>
+  );
+};
+
+export default AirlineRoutes;
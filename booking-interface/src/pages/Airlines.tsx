@@ -18,6 +18,8 @@ const modalStyle = {
   border: "2px solid #000",
   boxShadow: 24,
   p: 4,
+  maxHeight: "90vh",
+  overflowY: "auto" as "auto",
 };
 const columns: GridColDef[] = [
   {
@@ -27,24 +29,43 @@ const columns: GridColDef[] = [
   },
   {
     field: "code",
-    headerName: "Airline code",
+    headerName: "IATA",
     flex: 1,
   },
+  { field: "icao", headerName: "ICAO", flex: 1 },
+  { field: "name", headerName: "Name", flex: 2 },
+  { field: "callsign", headerName: "Callsign", flex: 1 },
+  { field: "country", headerName: "Country", flex: 1 },
+  { field: "active", headerName: "Active", type: "boolean", flex: 1 },
 ];
 
+const emptyAirline = {
+  code: "",
+  icao: "",
+  name: "",
+  callsign: "",
+  country: "",
+  logoURL: "",
+};
+
 const Airlines: React.FC = () => {
   /* States */
 
   const [data, setData] = useState<any[]>([]);
   const [loading, setLoading] = useState<boolean>(true);
   const [open, setOpen] = React.useState(false);
-  const [airlineCode, setAirlineCode] = useState("");
+  const [airline, setAirline] = useState(emptyAirline);
   const [errorMessage, setErrorMessage] = useState(""); // State for error message
 
   /* Handlers and hooks */
 
+  const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+    setAirline({ ...airline, [e.target.name]: e.target.value });
+  };
+
   const handleOpen = () => {
     setOpen(true);
+    setAirline(emptyAirline);
     setErrorMessage(""); // Clear error message when modal is opened
   };
 
@@ -53,11 +74,12 @@ const Airlines: React.FC = () => {
   const handleSubmit = async (e: any) => {
     e.preventDefault();
     try {
-      await axios.post("http://127.0.0.1:3000/airlines", { code: airlineCode });
+      await axios.post("http://127.0.0.1:3000/airlines", airline);
+      handleClose();
     } catch (error: any) {
       if (error.response && error.response.status === 500) {
         setErrorMessage(
-          "The following Airline code is already used or it's more than 6 characters in length."
+          "The airline is invalid, or its IATA or ICAO designator is already used."
         );
       }
     }
@@ -92,13 +114,57 @@ const Airlines: React.FC = () => {
           <Typography id="modal-modal-title" variant="h6" component="h2">
             Airline creation form
           </Typography>
-          <Typography variant="body1">Airline Code:</Typography>
           <TextField
             required
-            id="outlined-required"
-            label="Required"
-            value={airlineCode}
-            onChange={(e) => setAirlineCode(e.target.value)}
+            fullWidth
+            margin="dense"
+            name="code"
+            label="IATA designator (e.g. FB)"
+            value={airline.code}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="icao"
+            label="ICAO designator (e.g. BUC)"
+            value={airline.icao}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="name"
+            label="Name"
+            value={airline.name}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            name="callsign"
+            label="Callsign"
+            value={airline.callsign}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="country"
+            label="Country (ISO 3166, e.g. BG)"
+            value={airline.country}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            name="logoURL"
+            label="Logo URL"
+            value={airline.logoURL}
+            onChange={handleChange}
           />
           <br />
           {errorMessage && (
@@ -17,6 +17,8 @@ const modalStyle = {
   border: "2px solid #000",
   boxShadow: 24,
   p: 4,
+  maxHeight: "90vh",
+  overflowY: "auto" as "auto",
 };
 const columns: GridColDef[] = [
   {
@@ -29,19 +31,44 @@ const columns: GridColDef[] = [
     headerName: "Airport code",
     flex: 1,
   },
+  { field: "icao", headerName: "ICAO", flex: 1 },
+  { field: "name", headerName: "Name", flex: 2 },
+  { field: "city", headerName: "City", flex: 1 },
+  { field: "country", headerName: "Country", flex: 1 },
+  { field: "latitude", headerName: "Latitude", flex: 1 },
+  { field: "longitude", headerName: "Longitude", flex: 1 },
+  { field: "elevation", headerName: "Elevation (ft)", flex: 1 },
+  { field: "timezone", headerName: "Timezone", flex: 1 },
 ];
+
+const emptyAirport = {
+  code: "",
+  icao: "",
+  name: "",
+  city: "",
+  country: "",
+  latitude: "",
+  longitude: "",
+  elevation: "",
+  timezone: "",
+};
 const Airports: React.FC = () => {
   /* States */
   const [data, setData] = useState<any[]>([]);
   const [loading, setLoading] = useState<boolean>(true);
   const [open, setOpen] = React.useState(false);
-  const [airportCode, setAirportCode] = useState("");
+  const [airport, setAirport] = useState(emptyAirport);
   const [errorMessage, setErrorMessage] = useState("");
 
   /* Handlers and hooks */
 
+  const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+    setAirport({ ...airport, [e.target.name]: e.target.value });
+  };
+
   const handleOpen = () => {
     setOpen(true);
+    setAirport(emptyAirport);
     setErrorMessage("");
   };
 
@@ -50,12 +77,18 @@ const Airports: React.FC = () => {
   const handleSubmit = async (e: any) => {
     e.preventDefault();
     try {
-      await axios.post("http://127.0.0.1:3000/airports", { code: airportCode });
+      await axios.post("http://127.0.0.1:3000/airports", {
+        ...airport,
+        latitude: Number(airport.latitude),
+        longitude: Number(airport.longitude),
+        elevation:
+          airport.elevation === "" ? undefined : Number(airport.elevation),
+      });
       handleClose();
     } catch (error: any) {
       if (error.response && error.response.status === 500) {
         setErrorMessage(
-          "The following Airport code is already used or it's more than 3 characters in length."
+          "The airport is invalid, or its IATA or ICAO code is already used."
         );
       }
     }
@@ -90,13 +123,88 @@ const Airports: React.FC = () => {
           <Typography id="modal-modal-title" variant="h6" component="h2">
             Airport creation form
           </Typography>
-          <Typography variant="body1">Airport Code:</Typography>
           <TextField
             required
-            id="outlined-required"
-            label="Required"
-            value={airportCode}
-            onChange={(e) => setAirportCode(e.target.value)}
+            fullWidth
+            margin="dense"
+            name="code"
+            label="IATA code"
+            value={airport.code}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="icao"
+            label="ICAO code"
+            value={airport.icao}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="name"
+            label="Name"
+            value={airport.name}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="city"
+            label="City"
+            value={airport.city}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="country"
+            label="Country (ISO 3166, e.g. BG)"
+            value={airport.country}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="latitude"
+            label="Latitude"
+            type="number"
+            value={airport.latitude}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="longitude"
+            label="Longitude"
+            type="number"
+            value={airport.longitude}
+            onChange={handleChange}
+          />
+          <TextField
+            fullWidth
+            margin="dense"
+            name="elevation"
+            label="Elevation (ft)"
+            type="number"
+            value={airport.elevation}
+            onChange={handleChange}
+          />
+          <TextField
+            required
+            fullWidth
+            margin="dense"
+            name="timezone"
+            label="Timezone (e.g. Europe/Sofia)"
+            value={airport.timezone}
+            onChange={handleChange}
           />
           <br />
           {errorMessage && (
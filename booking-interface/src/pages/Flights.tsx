@@ -73,7 +73,8 @@ const Flights: React.FC = () => {
       field: "flightTime",
       headerName: "Flight Time",
       flex: 1,
-      valueFormatter: (params) => formatDuration(parseInt(params.value, 10)),
+      // The API returns flightTime in nanoseconds, like it accepts it.
+      valueFormatter: (params) => formatDuration(params.value / 1e6),
     },
     {
       field: "eta",